@@ -40,11 +40,19 @@ app.kubernetes.io/instance: {{ .Release.Name }}
 {{- end }}
 
 {{/*
-HA preflight: replicas > 1 requires a shared backend (S3 or NFS RWX).
+Object storage backend in use (S3, GCS or Azure Blob): "true" or empty.
+Data then lives in the bucket and no data PVC is needed.
+*/}}
+{{- define "application.objectStorage" -}}
+{{- if or .Values.s3.enabled .Values.gcs.enabled .Values.azureBlob.enabled -}}true{{- end -}}
+{{- end }}
+
+{{/*
+HA preflight: replicas > 1 requires a shared backend (object storage or NFS RWX).
 Local PVC is RWO and cannot be mounted on multiple nodes simultaneously.
 */}}
-{{- if and (gt (int .Values.replicas) 1) (not .Values.s3.enabled) (not .Values.nfs.enabled) -}}
-{{- fail "replicas > 1 requires either s3.enabled=true OR nfs.enabled=true (RWX). A local PVC (ReadWriteOnce) cannot be shared across replicas." -}}
+{{- if and (gt (int .Values.replicas) 1) (not (include "application.objectStorage" .)) (not .Values.nfs.enabled) -}}
+{{- fail "replicas > 1 requires either s3/gcs/azureBlob.enabled=true OR nfs.enabled=true (RWX). A local PVC (ReadWriteOnce) cannot be shared across replicas." -}}
 {{- end -}}
 
 {{/*
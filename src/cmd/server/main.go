@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"oci-storage/config"
 	"oci-storage/pkg/coordination"
 	"oci-storage/pkg/handlers"
@@ -11,6 +13,7 @@ import (
 	"oci-storage/pkg/storage"
 	"oci-storage/pkg/utils"
 	"oci-storage/pkg/version"
+	"os"
 	"path/filepath"
 	"time"
 
@@ -19,21 +22,59 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// setupBackend creates the storage backend (local filesystem or S3) based on config
+// setupBackend creates the storage backend (local filesystem, S3, GCS or Azure Blob) based on config
 func setupBackend(cfg *config.Config, log *utils.Logger) storage.Backend {
-	if cfg.S3.Enabled {
+	enabled := 0
+	for _, on := range []bool{cfg.S3.Enabled, cfg.GCS.Enabled, cfg.AzureBlob.Enabled} {
+		if on {
+			enabled++
+		}
+	}
+	if enabled > 1 {
+		log.Fatal("Only one of s3, gcs and azureBlob storage backends can be enabled")
+	}
+
+	// Object stores stage monolithic uploads, and chunked ones without multipart support, on local disk
+	localTempDir := filepath.Join(cfg.Storage.Path, "temp")
+
+	switch {
+	case cfg.S3.Enabled:
 		log.WithFields(logrus.Fields{
 			"endpoint": cfg.S3.Endpoint,
 			"bucket":   cfg.S3.Bucket,
 			"region":   cfg.S3.Region,
 		}).Info("Initializing S3 storage backend")
 
-		localTempDir := filepath.Join(cfg.Storage.Path, "temp")
 		backend, err := storage.NewS3Backend(cfg.S3, localTempDir)
 		if err != nil {
 			log.WithError(err).Fatal("Failed to initialize S3 backend")
 		}
 		return backend
+
+	case cfg.GCS.Enabled:
+		log.WithFields(logrus.Fields{
+			"bucket":   cfg.GCS.Bucket,
+			"endpoint": cfg.GCS.Endpoint,
+		}).Info("Initializing GCS storage backend")
+
+		backend, err := storage.NewGCSBackend(cfg.GCS, localTempDir)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to initialize GCS backend")
+		}
+		return backend
+
+	case cfg.AzureBlob.Enabled:
+		log.WithFields(logrus.Fields{
+			"storageAccount": cfg.AzureBlob.StorageAccount,
+			"container":      cfg.AzureBlob.Container,
+			"endpoint":       cfg.AzureBlob.Endpoint,
+		}).Info("Initializing Azure Blob storage backend")
+
+		backend, err := storage.NewAzureBackend(cfg.AzureBlob, localTempDir)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to initialize Azure Blob backend")
+		}
+		return backend
 	}
 
 	log.WithField("path", cfg.Storage.Path).Info("Using local filesystem storage backend")
@@ -41,10 +82,11 @@ func setupBackend(cfg *config.Config, log *utils.Logger) storage.Backend {
 }
 
 // setupCoordination creates distributed coordination primitives.
-// With Redis: distributed locks + upload tracking + scan dedup across replicas.
-// Without Redis: noop implementations (single-replica mode).
+// With Redis: distributed locks + upload tracking + scan dedup + cache access counters across replicas.
+// Without Redis: noop implementations (single-replica mode); the access store is nil and
+// cache accesses are persisted to the per-image metadata.
 // Returns a cleanup function that must be deferred to close connections.
-func setupCoordination(cfg *config.Config, log *utils.Logger) (coordination.LockManager, coordination.UploadTracker, coordination.ScanTracker, func()) {
+func setupCoordination(cfg *config.Config, log *utils.Logger) (coordination.LockManager, coordination.UploadTracker, coordination.ScanTracker, coordination.AccessStore, func()) {
 	if cfg.Redis.Enabled {
 		client, err := ociRedis.NewClient(cfg.Redis, log)
 		if err != nil {
@@ -54,16 +96,96 @@ func setupCoordination(cfg *config.Config, log *utils.Logger) (coordination.Lock
 			log.Info("Closing Redis connection")
 			client.Close()
 		}
-		// Client implements LockManager, UploadTracker, and ScanTracker
-		return client, client, client, cleanup
+		// Client implements LockManager, UploadTracker, ScanTracker and AccessStore
+		return client, client, client, client, cleanup
 	}
 
 	log.Info("Redis disabled - running in single-replica mode (no distributed coordination)")
-	return &coordination.NoopLockManager{}, &coordination.NoopUploadTracker{}, &coordination.NoopScanTracker{}, func() {}
+	return &coordination.NoopLockManager{}, &coordination.NoopUploadTracker{}, &coordination.NoopScanTracker{}, nil, func() {}
+}
+
+// setupCache puts a local read-through cache in front of an object storage backend.
+// With Redis, replicas tell each other which cached paths they changed.
+func setupCache(cfg *config.Config, log *utils.Logger, backend storage.Backend, locker coordination.LockManager) storage.Backend {
+	if !cfg.Storage.Cache.Enabled {
+		return backend
+	}
+	if _, ok := backend.(*storage.LocalBackend); ok {
+		log.Warn("Storage cache only applies to object storage backends, ignoring it")
+		return backend
+	}
+
+	dir := cfg.Storage.Cache.Path
+	if dir == "" {
+		dir = filepath.Join(cfg.Storage.Path, "blob-cache")
+	}
+	cache, err := storage.NewCachingBackend(backend, cfg.Storage.Cache, dir)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize storage cache")
+	}
+	if invalidator, ok := locker.(coordination.CacheInvalidator); ok {
+		cache.SetPublisher(func(path string) {
+			if err := invalidator.PublishInvalidation(context.Background(), path); err != nil {
+				log.WithError(err).WithField("path", path).Warn("Failed to publish cache invalidation")
+			}
+		})
+		invalidator.SubscribeInvalidations(context.Background(), cache.Invalidate)
+	}
+
+	log.WithFields(logrus.Fields{
+		"path":       dir,
+		"maxSizeGB":  cfg.Storage.Cache.MaxSizeGB,
+		"memoryMB":   cfg.Storage.Cache.MemoryMB,
+		"ttlSeconds": cfg.Storage.Cache.TTLSeconds,
+	}).Info("Storage cache enabled")
+	return cache
+}
+
+// setupEncryption encrypts stored objects when enabled. The cache stays below it, so
+// cached blobs are encrypted on local disk too.
+func setupEncryption(cfg *config.Config, log *utils.Logger, backend storage.Backend) storage.Backend {
+	if !cfg.Storage.Encryption.Enabled {
+		return backend
+	}
+	keys, err := openKeyWrapper(cfg.Storage.Encryption)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load storage encryption keys")
+	}
+
+	encrypting := storage.NewEncryptingBackend(backend, keys)
+	completed := service.EncryptionCompleted(encrypting)
+	if completed {
+		encrypting.RejectPlaintext()
+	}
+	log.WithFields(logrus.Fields{
+		"activeKey":         keys.ActiveKeyID(),
+		"plaintextRejected": completed,
+	}).Info("Storage encryption enabled")
+	return encrypting
+}
+
+// setupStorage builds the backend the server stores through: the configured backend,
+// its cache and encryption. Subcommands changing stored data use it too, so replicas
+// see their writes encrypted and drop the cached paths they changed.
+func setupStorage(cfg *config.Config, log *utils.Logger, locker coordination.LockManager) storage.Backend {
+	backend := setupBackend(cfg, log)
+	backend = setupCache(cfg, log, backend, locker)
+	return setupEncryption(cfg, log, backend)
+}
+
+// openKeyWrapper returns the keys wrapping data keys: KMS when a key is configured, the key file otherwise
+func openKeyWrapper(cfg config.StorageEncryptionConfig) (storage.KeyWrapper, error) {
+	if cfg.KMS.KeyID != "" {
+		return storage.NewKMSKeyWrapper(cfg.KMS)
+	}
+	if cfg.KeyFile == "" {
+		return nil, errors.New("storage encryption needs a key file or a KMS key")
+	}
+	return storage.NewFileKeyring(cfg.KeyFile)
 }
 
 // setupServices initialise et configure tous les services
-func setupServices(cfg *config.Config, log *utils.Logger, pm *utils.PathManager, backend storage.Backend, locker coordination.LockManager, scanTracker coordination.ScanTracker) (interfaces.ChartServiceInterface, interfaces.ImageServiceInterface, interfaces.IndexServiceInterface, interfaces.ProxyServiceInterface, *service.BackupService, interfaces.ScanServiceInterface) {
+func setupServices(cfg *config.Config, log *utils.Logger, pm *utils.PathManager, backend storage.Backend, locker coordination.LockManager, scanTracker coordination.ScanTracker, accessStore coordination.AccessStore) (interfaces.ChartServiceInterface, interfaces.ImageServiceInterface, interfaces.IndexServiceInterface, interfaces.ProxyServiceInterface, *service.BackupService, interfaces.ScanServiceInterface) {
 
 	tmpChartService := service.NewChartService(cfg, log, pm, backend, nil)
 	indexService := service.NewIndexService(cfg, log, pm, backend, tmpChartService, locker)
@@ -77,7 +199,14 @@ func setupServices(cfg *config.Config, log *utils.Logger, pm *utils.PathManager,
 	// Initialize proxy service if enabled
 	var proxyService interfaces.ProxyServiceInterface
 	if cfg.Proxy.Enabled {
-		proxyService = service.NewProxyService(cfg, log, pm, backend)
+		ps := service.NewProxyService(cfg, log, pm, backend)
+		ps.StartAccessTracking(context.Background(), accessStore)
+		ps.StartEviction(context.Background())
+		// Helm charts pulled through the proxy are listed in the UI and index.yaml
+		tmpChartService.SetCachedChartSource(ps)
+		finalChartService.SetCachedChartSource(ps)
+		ps.SetChartIndexUpdater(indexService)
+		proxyService = ps
 		log.Info("Proxy/cache service enabled")
 	}
 
@@ -95,7 +224,7 @@ func setupServices(cfg *config.Config, log *utils.Logger, pm *utils.PathManager,
 func setupHandlers(
 	chartService interfaces.ChartServiceInterface,
 	imageService interfaces.ImageServiceInterface,
-	_ interfaces.IndexServiceInterface,
+	indexService interfaces.IndexServiceInterface,
 	proxyService interfaces.ProxyServiceInterface,
 	scanService interfaces.ScanServiceInterface,
 	pathManager *utils.PathManager,
@@ -106,7 +235,7 @@ func setupHandlers(
 	backupService *service.BackupService,
 	log *utils.Logger,
 
-) (*handlers.HelmHandler, *handlers.ImageHandler, *handlers.OCIHandler, *handlers.ConfigHandler, *handlers.IndexHandler, *handlers.BackupHandler, *handlers.CacheHandler, *handlers.GCHandler, *handlers.ScanHandler) {
+) (*handlers.HelmHandler, *handlers.ImageHandler, *handlers.OCIHandler, *handlers.ConfigHandler, *handlers.IndexHandler, *handlers.BackupHandler, *handlers.CacheHandler, *handlers.GCHandler, *handlers.ScanHandler, *handlers.PrefetchHandler, *handlers.HelmProxyHandler, *handlers.SyncHandler, *handlers.ReplicationHandler, *handlers.StorageHandler) {
 	helmHandler := handlers.NewHelmHandler(chartService, pathManager, log, backend)
 	imageHandler := handlers.NewImageHandler(imageService, proxyService, pathManager, log)
 	ociHandler := handlers.NewOCIHandler(chartService, imageService, proxyService, scanService, cfg, log, pathManager, backend, uploadTracker, locker)
@@ -131,7 +260,63 @@ func setupHandlers(
 		scanHandler = handlers.NewScanHandler(scanService, log)
 	}
 
-	return helmHandler, imageHandler, ociHandler, configHandler, indexHandler, backupHandler, cacheHandler, gcHandler, scanHandler
+	// Prefetch handler - reuses the OCI handler's proxy download path
+	var prefetchHandler *handlers.PrefetchHandler
+	if proxyService != nil {
+		prefetchHandler = handlers.NewPrefetchHandler(ociHandler, chartService, log)
+	}
+
+	// Helm repository proxy handler - serves proxy.helmRepositories
+	var helmProxyHandler *handlers.HelmProxyHandler
+	if proxyService != nil && len(cfg.Proxy.HelmRepositories) > 0 {
+		helmProxyHandler = handlers.NewHelmProxyHandler(proxyService, log)
+	}
+
+	// Sync handler - mirrors sync.jobs through the concrete ProxyService
+	var syncHandler *handlers.SyncHandler
+	if cfg.Sync.Enabled {
+		ps, ok := proxyService.(*service.ProxyService)
+		if !ok {
+			log.WithFunc().Fatal("Repository sync requires the proxy to be enabled")
+		}
+		syncService, err := service.NewSyncService(cfg, log, pathManager, backend, ps, imageService, locker)
+		if err != nil {
+			log.WithFunc().WithError(err).Fatal("Failed to initialize sync service")
+		}
+		syncService.Start(context.Background())
+		syncHandler = handlers.NewSyncHandler(syncService, log)
+	}
+
+	// Object stores with multipart uploads take chunked pushes directly, on any replica
+	if uploader, ok := storage.AsMultipartUploader(backend); ok {
+		uploadService := service.NewUploadService(backend, uploader, pathManager, locker, log)
+		uploadService.Start(context.Background())
+		ociHandler.SetUploadService(uploadService)
+	}
+
+	// Replication handler - pushes are queued by the OCI handler and copied in the background
+	var replicationHandler *handlers.ReplicationHandler
+	if cfg.Replication.Enabled {
+		replicationService, err := service.NewReplicationService(cfg, log, pathManager, backend, locker)
+		if err != nil {
+			log.WithFunc().WithError(err).Fatal("Failed to initialize replication service")
+		}
+		replicationService.Start(context.Background())
+		ociHandler.SetReplicationService(replicationService)
+		replicationHandler = handlers.NewReplicationHandler(replicationService, log)
+	}
+
+	// Storage handler - blob layout migration, fsck and encryption rewrap
+	storageHandler := handlers.NewStorageHandler(
+		service.NewBlobMigrationService(backend, pathManager, locker, log),
+		service.NewFsckService(backend, pathManager, proxyService, indexService, locker, log),
+		log,
+	)
+	if encrypting, ok := storage.Unwrap(backend).(*storage.EncryptingBackend); ok {
+		storageHandler.SetEncryptionService(service.NewEncryptionService(encrypting, locker, log))
+	}
+
+	return helmHandler, imageHandler, ociHandler, configHandler, indexHandler, backupHandler, cacheHandler, gcHandler, scanHandler, prefetchHandler, helmProxyHandler, syncHandler, replicationHandler, storageHandler
 }
 
 func setupHTTPServer(app *fiber.App, log *utils.Logger) {
@@ -166,6 +351,14 @@ func main() {
 	}
 	log := utils.NewLogger(logConfig)
 
+	// Subcommands run instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, log, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-blobs" {
+		os.Exit(runMigrateBlobs(cfg, log))
+	}
+
 	// Log version info at startup
 	log.WithFields(logrus.Fields{
 		"version": version.Version,
@@ -176,18 +369,23 @@ func main() {
 		log.WithError(err).Fatal("Failed to load auth configuration")
 	}
 
-	// Storage backend (local or S3)
-	backend := setupBackend(cfg, log)
-
 	// Distributed coordination (Redis or noop)
-	locker, uploadTracker, scanTracker, coordCleanup := setupCoordination(cfg, log)
+	locker, uploadTracker, scanTracker, accessStore, coordCleanup := setupCoordination(cfg, log)
 	defer coordCleanup()
 
+	// Storage backend (local or S3)
+	backend := setupStorage(cfg, log, locker)
+	// Blobs written before sharding are served from their flat paths until migrated
+	if !service.BlobLayoutMigrated(backend) {
+		log.Info("Blob layout migration not completed, serving blobs from flat and sharded layouts")
+		backend = storage.NewLegacyBlobBackend(backend)
+	}
+
 	// PathManager
 	pathManager := utils.NewPathManager(cfg.Storage.Path, log)
 
 	// Services
-	chartService, imageService, indexService, proxyService, backupService, scanService := setupServices(cfg, log, pathManager, backend, locker, scanTracker)
+	chartService, imageService, indexService, proxyService, backupService, scanService := setupServices(cfg, log, pathManager, backend, locker, scanTracker, accessStore)
 
 	// Ensure index.yaml exists at startup
 	if err := indexService.EnsureIndexExists(); err != nil {
@@ -195,7 +393,7 @@ func main() {
 	}
 
 	// Handlers
-	helmHandler, imageHandler, ociHandler, configHandler, indexHandler, backupHandler, cacheHandler, gcHandler, scanHandler := setupHandlers(
+	helmHandler, imageHandler, ociHandler, configHandler, indexHandler, backupHandler, cacheHandler, gcHandler, scanHandler, prefetchHandler, helmProxyHandler, syncHandler, replicationHandler, storageHandler := setupHandlers(
 		chartService,
 		imageService,
 		indexService,
@@ -307,8 +505,44 @@ func main() {
 	app.Get("/cache/status", cacheHandler.GetCacheStatus)
 	app.Get("/cache/images", cacheHandler.ListCachedImages)
 	app.Delete("/cache/image/*", cacheHandler.DeleteCachedImageWildcard)
+	app.Put("/cache/pin/*", cacheHandler.PinCachedImageWildcard)
+	app.Delete("/cache/pin/*", cacheHandler.PinCachedImageWildcard)
+	app.Get("/cache/eviction/simulate", cacheHandler.SimulateEviction)
 	app.Post("/cache/purge", cacheHandler.PurgeCache)
 
+	// Cache pre-warm routes
+	if prefetchHandler != nil {
+		app.Post("/api/cache/prefetch", prefetchHandler.StartPrefetch)
+		app.Get("/api/cache/prefetch/:job", prefetchHandler.GetPrefetchJob)
+	}
+
+	// Helm repository proxy routes
+	if helmProxyHandler != nil {
+		app.Get("/helm-proxy/:repo/index.yaml", helmProxyHandler.GetIndex)
+		app.Get("/helm-proxy/:repo/charts/:chart/:file", helmProxyHandler.GetChart)
+	}
+
+	// Repository sync routes
+	if syncHandler != nil {
+		app.Get("/api/sync/jobs", syncHandler.ListJobs)
+		app.Get("/api/sync/jobs/:name", syncHandler.GetJob)
+		app.Post("/api/sync/jobs/:name/run", syncHandler.RunJob)
+	}
+
+	// Push replication routes
+	if replicationHandler != nil {
+		app.Get("/api/replication/rules", replicationHandler.ListRules)
+		app.Post("/api/replication/rules/:name/run", replicationHandler.ReplicateNow)
+	}
+
+	// Storage maintenance routes
+	app.Get("/api/storage/blob-layout", storageHandler.GetBlobLayoutStatus)
+	app.Post("/api/storage/blob-layout/migrate", storageHandler.MigrateBlobLayout)
+	app.Get("/api/storage/fsck", storageHandler.GetFsckReport)
+	app.Post("/api/storage/fsck", storageHandler.RunFsck)
+	app.Get("/api/storage/encryption", storageHandler.GetEncryptionStatus)
+	app.Post("/api/storage/encryption/rewrap", storageHandler.RewrapEncryption)
+
 	// Garbage collection routes
 	if gcHandler != nil {
 		app.Post("/gc", gcHandler.RunGC)
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"oci-storage/config"
+	service "oci-storage/pkg/services"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runMigrate implements the "migrate" subcommand: it copies every object from one
+// storage backend to another, then prints a consistency report. It returns the exit code.
+//
+//	oci-storage migrate -from local -to s3 [-to-bucket other] [-workers 8] [-dry-run] [-verify] [-report report.json]
+func runMigrate(cfg *config.Config, log *utils.Logger, args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	from := flags.String("from", "local", "source backend: local, s3, gcs or azure")
+	to := flags.String("to", "", "target backend: local, s3, gcs or azure")
+	fromPath := flags.String("from-path", cfg.Storage.Path, "source directory of the local backend")
+	toPath := flags.String("to-path", cfg.Storage.Path, "target directory of the local backend")
+	fromBucket := flags.String("from-bucket", "", "source bucket or container (default: from config)")
+	toBucket := flags.String("to-bucket", "", "target bucket or container (default: from config)")
+	workers := flags.Int("workers", 8, "number of objects copied in parallel")
+	dryRun := flags.Bool("dry-run", false, "only report what would be copied")
+	verify := flags.Bool("verify", false, "re-hash blobs already in the target instead of trusting their size")
+	reportPath := flags.String("report", "", "write the JSON report to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *to == "" {
+		fmt.Fprintln(os.Stderr, "migrate: -to is required")
+		flags.Usage()
+		return 2
+	}
+
+	source, sourceName, err := openBackend(cfg, *from, *fromPath, *fromBucket)
+	if err != nil {
+		log.WithError(err).Error("Failed to open source backend")
+		return 1
+	}
+	target, targetName, err := openBackend(cfg, *to, *toPath, *toBucket)
+	if err != nil {
+		log.WithError(err).Error("Failed to open target backend")
+		return 1
+	}
+	if sourceName == targetName {
+		log.WithField("backend", sourceName).Error("Source and target backends are the same")
+		return 2
+	}
+	// Contents are compared and verified in clear, then encrypted again with new data keys
+	if cfg.Storage.Encryption.Enabled {
+		keys, err := openKeyWrapper(cfg.Storage.Encryption)
+		if err != nil {
+			log.WithError(err).Error("Failed to load storage encryption keys")
+			return 1
+		}
+		encryptedSource := storage.NewEncryptingBackend(source, keys)
+		if !service.EncryptionCompleted(encryptedSource) {
+			log.Error("Source holds objects not yet encrypted: run the encryption rewrap first")
+			return 1
+		}
+		encryptedSource.RejectPlaintext()
+		source, target = encryptedSource, storage.NewEncryptingBackend(target, keys)
+	}
+	log.WithFields(logrus.Fields{
+		"source": sourceName,
+		"target": targetName,
+	}).Info("Migrating storage")
+
+	// Interrupted migrations resume on the next run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pathManager := utils.NewPathManager(cfg.Storage.Path, log)
+	report, runErr := service.NewStorageMigrator(source, target, pathManager, *workers, *dryRun, *verify, log).Run(ctx)
+	report.Source, report.Target = sourceName, targetName
+
+	data, _ := json.MarshalIndent(report, "", "  ")
+	if *reportPath != "" {
+		if err := os.WriteFile(*reportPath, data, 0644); err != nil {
+			log.WithError(err).Error("Failed to write migration report")
+		}
+	} else {
+		fmt.Println(string(data))
+	}
+
+	if runErr != nil {
+		log.WithError(runErr).Error("Storage migration aborted")
+		return 1
+	}
+	if !report.Consistent && !report.DryRun {
+		log.WithField("failed", report.Failed).Error("Storage migration incomplete")
+		return 1
+	}
+	return 0
+}
+
+// runMigrateBlobs implements the "migrate-blobs" subcommand: it moves the blobs of the
+// configured backend from the flat layout to the sharded one, as the blob-layout endpoint
+// does, but in the foreground so it can run as a job before replicas are upgraded.
+// It returns the exit code.
+//
+//	oci-storage migrate-blobs
+func runMigrateBlobs(cfg *config.Config, log *utils.Logger) int {
+	// The lock is shared with running replicas, so the endpoint cannot start a second run
+	locker, _, _, _, coordCleanup := setupCoordination(cfg, log)
+	defer coordCleanup()
+
+	// Not wrapped in the legacy blob layout: the migration reads the flat paths itself
+	backend := setupStorage(cfg, log, locker)
+	pathManager := utils.NewPathManager(cfg.Storage.Path, log)
+	status, err := service.NewBlobMigrationService(backend, pathManager, locker, log).Run()
+	if err != nil {
+		log.WithError(err).Error("Blob layout migration not started")
+		return 1
+	}
+
+	data, _ := json.MarshalIndent(status, "", "  ")
+	fmt.Println(string(data))
+	if !status.Completed {
+		log.WithFields(logrus.Fields{
+			"failed":    status.Failed,
+			"lastError": status.LastError,
+		}).Error("Blob layout migration incomplete")
+		return 1
+	}
+	return 0
+}
+
+// openBackend creates a backend of the given kind from its config section, whether or
+// not it is the enabled one. It also returns a name identifying where the data lives.
+func openBackend(cfg *config.Config, kind, path, bucket string) (storage.Backend, string, error) {
+	localTempDir := filepath.Join(cfg.Storage.Path, "temp")
+
+	switch kind {
+	case "local":
+		return storage.NewLocalBackend(path), "local:" + path, nil
+
+	case "s3":
+		s3Cfg := cfg.S3
+		if bucket != "" {
+			s3Cfg.Bucket = bucket
+		}
+		backend, err := storage.NewS3Backend(s3Cfg, localTempDir)
+		if err != nil {
+			return nil, "", err
+		}
+		return backend, "s3://" + s3Cfg.Bucket, nil
+
+	case "gcs":
+		gcsCfg := cfg.GCS
+		if bucket != "" {
+			gcsCfg.Bucket = bucket
+		}
+		backend, err := storage.NewGCSBackend(gcsCfg, localTempDir)
+		if err != nil {
+			return nil, "", err
+		}
+		return backend, "gs://" + gcsCfg.Bucket, nil
+
+	case "azure":
+		azureCfg := cfg.AzureBlob
+		if bucket != "" {
+			azureCfg.Container = bucket
+		}
+		backend, err := storage.NewAzureBackend(azureCfg, localTempDir)
+		if err != nil {
+			return nil, "", err
+		}
+		return backend, "azure://" + azureCfg.StorageAccount + "/" + azureCfg.Container, nil
+	}
+	return nil, "", fmt.Errorf("unknown storage backend %q", kind)
+}
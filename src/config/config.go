@@ -45,18 +45,117 @@ type Backup struct {
 	} `yaml:"azure"`
 }
 
+// RegistryTLSConfig defines how the proxy connects to an upstream registry
+type RegistryTLSConfig struct {
+	CAFile             string `yaml:"caFile,omitempty"`             // PEM bundle trusted in addition to the system roots
+	CertFile           string `yaml:"certFile,omitempty"`           // Client certificate (PEM) for mutual TLS
+	KeyFile            string `yaml:"keyFile,omitempty"`            // Client certificate key (PEM)
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"` // Do not verify the upstream certificate
+	PlainHTTP          bool   `yaml:"plainHTTP,omitempty"`          // Talk plain HTTP to the upstream host even for https:// URLs
+}
+
+// RegistryEndpoint is one upstream serving a proxied registry (a mirror or the registry itself)
+type RegistryEndpoint struct {
+	URL      string             `yaml:"url"`                // e.g., "https://harbor.internal"
+	Prefix   string             `yaml:"prefix,omitempty"`   // Optional repository prefix, e.g. a Harbor proxy-cache project "dockerhub"
+	Username string             `yaml:"username,omitempty"` // Optional username for auth
+	Password string             `yaml:"password,omitempty"` // Optional password/token for auth
+	TLS      *RegistryTLSConfig `yaml:"tls,omitempty"`      // Optional TLS settings (defaults to the registry's)
+}
+
 // RegistryConfig defines an upstream registry for proxying
 type RegistryConfig struct {
-	Name     string `yaml:"name"`               // e.g., "docker.io", "ghcr.io"
-	URL      string `yaml:"url"`                // e.g., "https://registry-1.docker.io"
-	Default  bool   `yaml:"default"`            // Is this the default registry?
-	Username string `yaml:"username,omitempty"` // Optional username for auth
-	Password string `yaml:"password,omitempty"` // Optional password/token for auth
+	Name      string             `yaml:"name"`                // e.g., "docker.io", "ghcr.io"
+	URL       string             `yaml:"url"`                 // e.g., "https://registry-1.docker.io"
+	Default   bool               `yaml:"default"`             // Is this the default registry?
+	Username  string             `yaml:"username,omitempty"`  // Optional username for auth
+	Password  string             `yaml:"password,omitempty"`  // Optional password/token for auth
+	TLS       *RegistryTLSConfig `yaml:"tls,omitempty"`       // Optional TLS settings for private PKI or insecure registries
+	Endpoints []RegistryEndpoint `yaml:"endpoints,omitempty"` // Optional ordered failover list (replaces url; credentials and TLS are inherited when unset)
+}
+
+// GetEndpoints returns the upstream endpoints in failover order.
+// Without an explicit endpoints list, the registry URL and credentials form a single endpoint.
+// Endpoints without their own credentials or TLS settings inherit the registry's.
+func (r *RegistryConfig) GetEndpoints() []RegistryEndpoint {
+	if len(r.Endpoints) == 0 {
+		return []RegistryEndpoint{{URL: r.URL, Username: r.Username, Password: r.Password, TLS: r.TLS}}
+	}
+	endpoints := make([]RegistryEndpoint, len(r.Endpoints))
+	for i, ep := range r.Endpoints {
+		if ep.Username == "" && ep.Password == "" {
+			ep.Username, ep.Password = r.Username, r.Password
+		}
+		if ep.TLS == nil {
+			ep.TLS = r.TLS
+		}
+		endpoints[i] = ep
+	}
+	return endpoints
+}
+
+// HelmRepositoryConfig defines an upstream HTTP Helm chart repository (index.yaml + .tgz archives)
+// proxied under /helm-proxy/<name>/
+type HelmRepositoryConfig struct {
+	Name     string             `yaml:"name"`               // e.g., "prometheus-community"
+	URL      string             `yaml:"url"`                // e.g., "https://prometheus-community.github.io/helm-charts"
+	Username string             `yaml:"username,omitempty"` // Optional basic auth username
+	Password string             `yaml:"password,omitempty"` // Optional basic auth password
+	TLS      *RegistryTLSConfig `yaml:"tls,omitempty"`      // Optional TLS settings, as for registries
 }
 
 // CacheConfig defines cache settings for the proxy
 type CacheConfig struct {
-	MaxSizeGB int `yaml:"maxSizeGB"` // Maximum cache size in GB
+	MaxSizeGB           int `yaml:"maxSizeGB"`           // Maximum cache size in GB
+	NegativeTTLSeconds  int `yaml:"negativeTTLSeconds"`  // How long upstream 404s are remembered (default: 60, negative disables)
+	TagsTTLSeconds      int `yaml:"tagsTTLSeconds"`      // How long upstream tag lists and catalogs are cached (default: 60)
+	AccessFlushSeconds  int `yaml:"accessFlushSeconds"`  // How often batched cache hits are persisted (default: 30)
+	HelmIndexTTLSeconds int `yaml:"helmIndexTTLSeconds"` // How long upstream Helm index.yaml files are cached (default: 300)
+
+	// RegistryMaxSizeGB caps the cache size per upstream registry name, e.g. {"nvcr.io": 100}
+	RegistryMaxSizeGB map[string]int `yaml:"registryMaxSizeGB"`
+	// Pinned lists cached images never evicted nor GC'd as stale. Globs ("*" also matches "/")
+	// or "regex:" patterns, matched against the image name or name:tag,
+	// e.g. "proxy/docker.io/library/*" or "proxy/docker.io/library/alpine:3.*"
+	Pinned []string `yaml:"pinned"`
+
+	Eviction EvictionConfig `yaml:"eviction"`
+}
+
+// EvictionConfig selects and tunes the policy deciding which cached images are evicted
+type EvictionConfig struct {
+	Policy         string `yaml:"policy"`         // lru | lfu | gdsf | max-age (default: lru)
+	MaxAgeDays     int    `yaml:"maxAgeDays"`     // max-age: evict images not pulled for this long; also the stale GC cutoff (default: 30)
+	GDSFAgingHours int    `yaml:"gdsfAgingHours"` // gdsf: hours after which an image's access frequency counts half (default: 24)
+}
+
+// CircuitBreakerConfig defines the per-registry circuit breaker for upstream calls
+type CircuitBreakerConfig struct {
+	FailureThreshold int `yaml:"failureThreshold"` // Consecutive failures before the breaker opens (default: 5)
+	OpenSeconds      int `yaml:"openSeconds"`      // Time spent open before a half-open probe is allowed (default: 30)
+}
+
+// RateLimitConfig defines how the proxy reacts to upstream pull quotas (RateLimit-* headers)
+type RateLimitConfig struct {
+	LowWatermark   int `yaml:"lowWatermark"`   // Remaining pulls below which an endpoint is deprioritized and prefetching stops (default: 10)
+	BackoffSeconds int `yaml:"backoffSeconds"` // Backoff after a 429 or exhausted quota when upstream gives no reset time (default: 60)
+}
+
+// ProxyPolicyRule matches upstream images by registry name, repository and tag.
+// Patterns are globs ("*" matches any characters, including "/") or, with a "regex:"
+// prefix, regular expressions that must match the whole value. Empty fields match anything.
+type ProxyPolicyRule struct {
+	Name       string `yaml:"name,omitempty"`       // Optional label reported when the rule denies a pull
+	Registry   string `yaml:"registry,omitempty"`   // Registry name, e.g. "docker.io"
+	Repository string `yaml:"repository,omitempty"` // Upstream repository, e.g. "library/*"
+	Tag        string `yaml:"tag,omitempty"`        // Tag, e.g. "latest" (pulls by digest are not matched on tag)
+}
+
+// ProxyPolicyConfig restricts which upstream images may be proxied.
+// Deny rules win; when allow rules are set, an image must also match one of them.
+type ProxyPolicyConfig struct {
+	Allow []ProxyPolicyRule `yaml:"allow"`
+	Deny  []ProxyPolicyRule `yaml:"deny"`
 }
 
 // TimeoutConfig defines timeout settings for proxy operations
@@ -69,10 +168,59 @@ type TimeoutConfig struct {
 
 // ProxyConfig groups proxy-related settings
 type ProxyConfig struct {
-	Enabled    bool             `yaml:"enabled"`
-	Cache      CacheConfig      `yaml:"cache"`
-	Timeout    TimeoutConfig    `yaml:"timeout"`
-	Registries []RegistryConfig `yaml:"registries"`
+	Enabled          bool                   `yaml:"enabled"`
+	Cache            CacheConfig            `yaml:"cache"`
+	Timeout          TimeoutConfig          `yaml:"timeout"`
+	CircuitBreaker   CircuitBreakerConfig   `yaml:"circuitBreaker"`
+	RateLimit        RateLimitConfig        `yaml:"rateLimit"`
+	Policy           ProxyPolicyConfig      `yaml:"policy"`
+	Registries       []RegistryConfig       `yaml:"registries"`
+	HelmRepositories []HelmRepositoryConfig `yaml:"helmRepositories"` // HTTP Helm repositories served under /helm-proxy/<name>/
+	MirrorFor        string                 `yaml:"mirrorFor"`        // Registry name served for un-prefixed pulls not found locally (e.g. "docker.io")
+}
+
+// SyncJobConfig mirrors the tags of an upstream repository into a local repository on a schedule
+type SyncJobConfig struct {
+	Name            string   `yaml:"name"`            // Job name used by the API, e.g. "app-releases"
+	Source          string   `yaml:"source"`          // Upstream repository prefixed by a proxy registry name, e.g. "ghcr.io/org/app"
+	Target          string   `yaml:"target"`          // Local repository (default: "mirror/<source>"), never under proxy/
+	TagPattern      string   `yaml:"tagPattern"`      // Regular expression tags must match (default: all tags)
+	Platforms       []string `yaml:"platforms"`       // os/arch[/variant] copied from multi-arch images (default: all)
+	IntervalMinutes int      `yaml:"intervalMinutes"` // Time between runs (default: 360)
+}
+
+// SyncConfig defines scheduled mirroring of upstream repositories (requires the proxy)
+type SyncConfig struct {
+	Enabled bool            `yaml:"enabled"`
+	Jobs    []SyncJobConfig `yaml:"jobs"`
+}
+
+// ReplicationDestination is a downstream OCI registry pushed artifacts are copied to
+type ReplicationDestination struct {
+	URL       string             `yaml:"url"`                 // e.g. "https://registry.eu.example.com"
+	Namespace string             `yaml:"namespace,omitempty"` // Optional prefix of destination repositories, e.g. "central"
+	Username  string             `yaml:"username,omitempty"`  // Optional credentials (or REPLICATION_<RULE>_USERNAME)
+	Password  string             `yaml:"password,omitempty"`  // Optional credentials (or REPLICATION_<RULE>_PASSWORD)
+	TLS       *RegistryTLSConfig `yaml:"tls,omitempty"`       // Optional TLS settings, as for registries
+}
+
+// ReplicationRule copies matching pushes to a destination registry
+type ReplicationRule struct {
+	Name string `yaml:"name"` // Rule name used by the API, e.g. "eu-west"
+	// Repositories are globs ("*" also matches "/") or "regex:" patterns matched against the
+	// pushed repository name (default: all local repositories)
+	Repositories []string               `yaml:"repositories"`
+	TagPattern   string                 `yaml:"tagPattern"` // Regular expression pushed tags must match (default: all tags)
+	Charts       string                 `yaml:"charts"`     // include | exclude | only (default: include)
+	Destination  ReplicationDestination `yaml:"destination"`
+}
+
+// ReplicationConfig defines push replication to downstream registries
+type ReplicationConfig struct {
+	Enabled          bool              `yaml:"enabled"`
+	Rules            []ReplicationRule `yaml:"rules"`
+	MaxAttempts      int               `yaml:"maxAttempts"`      // Attempts before a replication is moved to the failed queue (default: 10)
+	RetryBaseSeconds int               `yaml:"retryBaseSeconds"` // First retry delay, doubled on each attempt up to one hour (default: 30)
 }
 
 // TrivyPolicyConfig defines the security gate policy
@@ -103,6 +251,68 @@ type S3Config struct {
 	AccessKey string `yaml:"accessKey"` // overridable via S3_ACCESS_KEY env
 	SecretKey string `yaml:"secretKey"` // overridable via S3_SECRET_KEY env
 	PathStyle bool   `yaml:"pathStyle"` // true for Garage/MinIO, false for AWS
+	// PublicEndpoint is the endpoint clients reach the bucket on, used in presigned URLs (default: endpoint)
+	PublicEndpoint string `yaml:"publicEndpoint"`
+	// PartSizeMB is the part size of chunked blob uploads sent as multipart uploads (default: 16, minimum: 5)
+	PartSizeMB int `yaml:"partSizeMB"`
+}
+
+// BlobRedirectConfig makes blob downloads redirect to presigned object storage URLs,
+// so layer bytes go from the bucket to the client without flowing through the pods
+type BlobRedirectConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	TTLSeconds int  `yaml:"ttlSeconds"` // Lifetime of presigned URLs (default: 300)
+	// StreamUserAgents are User-Agent substrings of clients that can't follow redirects
+	StreamUserAgents []string `yaml:"streamUserAgents"`
+	// StreamRepositories are repository prefixes always streamed, e.g. "proxy/" when the bucket is not reachable by clients of the cache
+	StreamRepositories []string `yaml:"streamRepositories"`
+}
+
+// StorageCacheConfig puts a local read-through cache in front of object storage: blobs
+// on local disk, small metadata (manifests, tag metadata, index.yaml) in memory
+type StorageCacheConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Path       string `yaml:"path"`       // Blob cache directory (default: <storage.path>/blob-cache)
+	MaxSizeGB  int    `yaml:"maxSizeGB"`  // Disk budget of the blob cache (default: 10)
+	MemoryMB   int    `yaml:"memoryMB"`   // Memory budget of the metadata cache (default: 64)
+	TTLSeconds int    `yaml:"ttlSeconds"` // How long cached metadata is trusted without an invalidation from another replica (default: 30)
+}
+
+// StorageEncryptionConfig encrypts stored objects with per-object data keys, wrapped by a
+// key from KeyFile or by a KMS key. One of them must be set.
+type StorageEncryptionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// KeyFile holds one "<id> <base64 32-byte key>" per line. The first key encrypts, the others only decrypt.
+	KeyFile string    `yaml:"keyFile"`
+	KMS     KMSConfig `yaml:"kms"`
+}
+
+// KMSConfig points at an AWS KMS compatible service wrapping data keys
+type KMSConfig struct {
+	KeyID     string `yaml:"keyID"`     // key ID, ARN or alias of the key wrapping new data keys
+	Endpoint  string `yaml:"endpoint"`  // e.g. "http://local-kms:8080" (default: AWS)
+	Region    string `yaml:"region"`    // e.g. "eu-west-1"
+	AccessKey string `yaml:"accessKey"` // overridable via KMS_ACCESS_KEY env (default: AWS credential chain)
+	SecretKey string `yaml:"secretKey"` // overridable via KMS_SECRET_KEY env
+}
+
+// GCSConfig defines Google Cloud Storage as primary storage (blobs/manifests/charts in a bucket)
+type GCSConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	Bucket          string `yaml:"bucket"`          // e.g. "oci-storage"
+	CredentialsFile string `yaml:"credentialsFile"` // Service account key, overridable via GCS_CREDENTIALS_FILE (default: workload identity)
+	Endpoint        string `yaml:"endpoint"`        // Optional, e.g. "http://fake-gcs-server:4443/storage/v1/" for the emulator
+	PublicEndpoint  string `yaml:"publicEndpoint"`  // Optional host clients reach the bucket on, used in signed URLs, e.g. "https://storage.example.com"
+}
+
+// AzureBlobConfig defines Azure Blob Storage as primary storage (blobs/manifests/charts in a container)
+type AzureBlobConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	StorageAccount string `yaml:"storageAccount"` // e.g. "ocistorage"
+	AccountKey     string `yaml:"accountKey"`     // overridable via AZURE_BLOB_ACCOUNT_KEY env
+	Container      string `yaml:"container"`      // e.g. "oci-storage"
+	Endpoint       string `yaml:"endpoint"`       // Optional, e.g. "http://azurite:10000/devstoreaccount1" for Azurite
+	PublicEndpoint string `yaml:"publicEndpoint"` // Optional endpoint clients reach the account on, used in SAS URLs
 }
 
 // RedisConfig defines Redis connection settings for shared state across replicas
@@ -119,7 +329,10 @@ type Config struct {
 	} `yaml:"server"`
 
 	Storage struct {
-		Path string `yaml:"path"`
+		Path       string                  `yaml:"path"`
+		Redirect   BlobRedirectConfig      `yaml:"redirect"`
+		Cache      StorageCacheConfig      `yaml:"cache"`
+		Encryption StorageEncryptionConfig `yaml:"encryption"`
 	} `yaml:"storage"`
 
 	Logging struct {
@@ -130,8 +343,14 @@ type Config struct {
 	Backup Backup      `yaml:"backup"`
 	Proxy  ProxyConfig `yaml:"proxy"`
 	Trivy  TrivyConfig `yaml:"trivy"`
+	Sync   SyncConfig  `yaml:"sync"`
 	S3     S3Config    `yaml:"s3"`
 	Redis  RedisConfig `yaml:"redis"`
+
+	GCS       GCSConfig       `yaml:"gcs"`
+	AzureBlob AzureBlobConfig `yaml:"azureBlob"`
+
+	Replication ReplicationConfig `yaml:"replication"`
 }
 
 type Secrets struct {
@@ -266,6 +485,84 @@ func loadConfigFromEnv(config *Config) {
 		}
 	}
 
+	if v := os.Getenv("PROXY_MIRROR_FOR"); v != "" {
+		config.Proxy.MirrorFor = v
+	}
+
+	// Negative cache, eviction, circuit breaker and rate limit defaults
+	if config.Proxy.Cache.NegativeTTLSeconds == 0 {
+		config.Proxy.Cache.NegativeTTLSeconds = 60
+	}
+	if config.Proxy.Cache.TagsTTLSeconds == 0 {
+		config.Proxy.Cache.TagsTTLSeconds = 60
+	}
+	if config.Proxy.Cache.HelmIndexTTLSeconds == 0 {
+		config.Proxy.Cache.HelmIndexTTLSeconds = 300
+	}
+	if config.Proxy.Cache.AccessFlushSeconds == 0 {
+		config.Proxy.Cache.AccessFlushSeconds = 30
+	}
+	if v := os.Getenv("PROXY_EVICTION_POLICY"); v != "" {
+		config.Proxy.Cache.Eviction.Policy = v
+	}
+	if config.Proxy.Cache.Eviction.Policy == "" {
+		config.Proxy.Cache.Eviction.Policy = "lru"
+	}
+	if config.Proxy.Cache.Eviction.MaxAgeDays == 0 {
+		config.Proxy.Cache.Eviction.MaxAgeDays = 30
+	}
+	if config.Proxy.Cache.Eviction.GDSFAgingHours == 0 {
+		config.Proxy.Cache.Eviction.GDSFAgingHours = 24
+	}
+	if config.Proxy.CircuitBreaker.FailureThreshold == 0 {
+		config.Proxy.CircuitBreaker.FailureThreshold = 5
+	}
+	if config.Proxy.CircuitBreaker.OpenSeconds == 0 {
+		config.Proxy.CircuitBreaker.OpenSeconds = 30
+	}
+	if config.Proxy.RateLimit.LowWatermark == 0 {
+		config.Proxy.RateLimit.LowWatermark = 10
+	}
+	if config.Proxy.RateLimit.BackoffSeconds == 0 {
+		config.Proxy.RateLimit.BackoffSeconds = 60
+	}
+	if config.Replication.MaxAttempts == 0 {
+		config.Replication.MaxAttempts = 10
+	}
+	if config.Replication.RetryBaseSeconds == 0 {
+		config.Replication.RetryBaseSeconds = 30
+	}
+	for i := range config.Replication.Rules {
+		if config.Replication.Rules[i].Charts == "" {
+			config.Replication.Rules[i].Charts = "include"
+		}
+	}
+	for i := range config.Sync.Jobs {
+		if config.Sync.Jobs[i].IntervalMinutes == 0 {
+			config.Sync.Jobs[i].IntervalMinutes = 360
+		}
+		if config.Sync.Jobs[i].Target == "" {
+			config.Sync.Jobs[i].Target = "mirror/" + config.Sync.Jobs[i].Source
+		}
+	}
+	if config.Storage.Redirect.TTLSeconds == 0 {
+		config.Storage.Redirect.TTLSeconds = 300
+	}
+	if config.Storage.Cache.MaxSizeGB == 0 {
+		config.Storage.Cache.MaxSizeGB = 10
+	}
+	if config.Storage.Cache.MemoryMB == 0 {
+		config.Storage.Cache.MemoryMB = 64
+	}
+	if config.Storage.Cache.TTLSeconds == 0 {
+		config.Storage.Cache.TTLSeconds = 30
+	}
+	if v := os.Getenv("PROXY_NEGATIVE_TTL"); v != "" {
+		if val, err := strconv.Atoi(v); err == nil {
+			config.Proxy.Cache.NegativeTTLSeconds = val
+		}
+	}
+
 	// S3 config from environment
 	if v := os.Getenv("S3_ENABLED"); v != "" {
 		config.S3.Enabled = v == "true"
@@ -288,6 +585,96 @@ func loadConfigFromEnv(config *Config) {
 	if v := os.Getenv("S3_PATH_STYLE"); v != "" {
 		config.S3.PathStyle = v == "true"
 	}
+	if v := os.Getenv("S3_PUBLIC_ENDPOINT"); v != "" {
+		config.S3.PublicEndpoint = v
+	}
+	if v := os.Getenv("S3_PART_SIZE_MB"); v != "" {
+		if size, err := strconv.Atoi(v); err == nil {
+			config.S3.PartSizeMB = size
+		}
+	}
+	if v := os.Getenv("STORAGE_REDIRECT_ENABLED"); v != "" {
+		config.Storage.Redirect.Enabled = v == "true"
+	}
+	if v := os.Getenv("STORAGE_REDIRECT_TTL_SECONDS"); v != "" {
+		if ttl, err := strconv.Atoi(v); err == nil && ttl > 0 {
+			config.Storage.Redirect.TTLSeconds = ttl
+		}
+	}
+	if v := os.Getenv("STORAGE_CACHE_ENABLED"); v != "" {
+		config.Storage.Cache.Enabled = v == "true"
+	}
+	if v := os.Getenv("STORAGE_CACHE_PATH"); v != "" {
+		config.Storage.Cache.Path = v
+	}
+	if v := os.Getenv("STORAGE_CACHE_MAX_SIZE_GB"); v != "" {
+		if size, err := strconv.Atoi(v); err == nil && size > 0 {
+			config.Storage.Cache.MaxSizeGB = size
+		}
+	}
+	if v := os.Getenv("STORAGE_CACHE_MEMORY_MB"); v != "" {
+		if size, err := strconv.Atoi(v); err == nil && size > 0 {
+			config.Storage.Cache.MemoryMB = size
+		}
+	}
+	if v := os.Getenv("STORAGE_ENCRYPTION_ENABLED"); v != "" {
+		config.Storage.Encryption.Enabled = v == "true"
+	}
+	if v := os.Getenv("STORAGE_ENCRYPTION_KEY_FILE"); v != "" {
+		config.Storage.Encryption.KeyFile = v
+	}
+	if v := os.Getenv("KMS_KEY_ID"); v != "" {
+		config.Storage.Encryption.KMS.KeyID = v
+	}
+	if v := os.Getenv("KMS_ENDPOINT"); v != "" {
+		config.Storage.Encryption.KMS.Endpoint = v
+	}
+	if v := os.Getenv("KMS_REGION"); v != "" {
+		config.Storage.Encryption.KMS.Region = v
+	}
+	if v := os.Getenv("KMS_ACCESS_KEY"); v != "" {
+		config.Storage.Encryption.KMS.AccessKey = v
+	}
+	if v := os.Getenv("KMS_SECRET_KEY"); v != "" {
+		config.Storage.Encryption.KMS.SecretKey = v
+	}
+
+	// GCS config from environment
+	if v := os.Getenv("GCS_ENABLED"); v != "" {
+		config.GCS.Enabled = v == "true"
+	}
+	if v := os.Getenv("GCS_BUCKET"); v != "" {
+		config.GCS.Bucket = v
+	}
+	if v := os.Getenv("GCS_CREDENTIALS_FILE"); v != "" {
+		config.GCS.CredentialsFile = v
+	}
+	if v := os.Getenv("GCS_ENDPOINT"); v != "" {
+		config.GCS.Endpoint = v
+	}
+	if v := os.Getenv("GCS_PUBLIC_ENDPOINT"); v != "" {
+		config.GCS.PublicEndpoint = v
+	}
+
+	// Azure Blob config from environment
+	if v := os.Getenv("AZURE_BLOB_ENABLED"); v != "" {
+		config.AzureBlob.Enabled = v == "true"
+	}
+	if v := os.Getenv("AZURE_BLOB_STORAGE_ACCOUNT"); v != "" {
+		config.AzureBlob.StorageAccount = v
+	}
+	if v := os.Getenv("AZURE_BLOB_ACCOUNT_KEY"); v != "" {
+		config.AzureBlob.AccountKey = v
+	}
+	if v := os.Getenv("AZURE_BLOB_CONTAINER"); v != "" {
+		config.AzureBlob.Container = v
+	}
+	if v := os.Getenv("AZURE_BLOB_ENDPOINT"); v != "" {
+		config.AzureBlob.Endpoint = v
+	}
+	if v := os.Getenv("AZURE_BLOB_PUBLIC_ENDPOINT"); v != "" {
+		config.AzureBlob.PublicEndpoint = v
+	}
 
 	// Redis config from environment
 	if v := os.Getenv("REDIS_ENABLED"); v != "" {
@@ -317,6 +704,9 @@ func loadConfigFromEnv(config *Config) {
 
 // loadRegistryCredentialsFromEnv loads registry credentials from environment variables
 // Format: REGISTRY_<NAME>_USERNAME and REGISTRY_<NAME>_PASSWORD
+// Helm repositories: HELM_REPO_<NAME>_USERNAME and HELM_REPO_<NAME>_PASSWORD
+// Replication destinations: REPLICATION_<RULE>_USERNAME and REPLICATION_<RULE>_PASSWORD
+// Mirror endpoints: REGISTRY_<NAME>_ENDPOINT_<N>_USERNAME and REGISTRY_<NAME>_ENDPOINT_<N>_PASSWORD
 // Example: GHCR_USERNAME, GHCR_PASSWORD for ghcr.io
 func loadRegistryCredentialsFromEnv(config *Config) {
 	// Map of registry names to env var prefixes
@@ -331,6 +721,11 @@ func loadRegistryCredentialsFromEnv(config *Config) {
 	for i := range config.Proxy.Registries {
 		reg := &config.Proxy.Registries[i]
 
+		// The registry URL is the logical key used by the cache; default it to the first endpoint
+		if reg.URL == "" && len(reg.Endpoints) > 0 {
+			reg.URL = reg.Endpoints[0].URL
+		}
+
 		// Check for specific env var prefix for this registry
 		if prefix, ok := registryEnvPrefixes[reg.Name]; ok {
 			if username := os.Getenv(prefix + "_USERNAME"); username != "" {
@@ -350,6 +745,41 @@ func loadRegistryCredentialsFromEnv(config *Config) {
 		if password := os.Getenv("REGISTRY_" + envName + "_PASSWORD"); password != "" {
 			reg.Password = password
 		}
+
+		// Per-endpoint credentials: REGISTRY_<NAME>_ENDPOINT_<N>_USERNAME (N starts at 1)
+		for j := range reg.Endpoints {
+			prefix := fmt.Sprintf("REGISTRY_%s_ENDPOINT_%d", envName, j+1)
+			if username := os.Getenv(prefix + "_USERNAME"); username != "" {
+				reg.Endpoints[j].Username = username
+			}
+			if password := os.Getenv(prefix + "_PASSWORD"); password != "" {
+				reg.Endpoints[j].Password = password
+			}
+		}
+	}
+
+	// Helm repositories: HELM_REPO_<NAME>_USERNAME / HELM_REPO_<NAME>_PASSWORD
+	for i := range config.Proxy.HelmRepositories {
+		repo := &config.Proxy.HelmRepositories[i]
+		envName := strings.ToUpper(strings.ReplaceAll(strings.ReplaceAll(repo.Name, ".", "_"), "-", "_"))
+		if username := os.Getenv("HELM_REPO_" + envName + "_USERNAME"); username != "" {
+			repo.Username = username
+		}
+		if password := os.Getenv("HELM_REPO_" + envName + "_PASSWORD"); password != "" {
+			repo.Password = password
+		}
+	}
+
+	// Replication destinations: REPLICATION_<RULE>_USERNAME / REPLICATION_<RULE>_PASSWORD
+	for i := range config.Replication.Rules {
+		rule := &config.Replication.Rules[i]
+		envName := strings.ToUpper(strings.ReplaceAll(strings.ReplaceAll(rule.Name, ".", "_"), "-", "_"))
+		if username := os.Getenv("REPLICATION_" + envName + "_USERNAME"); username != "" {
+			rule.Destination.Username = username
+		}
+		if password := os.Getenv("REPLICATION_" + envName + "_PASSWORD"); password != "" {
+			rule.Destination.Password = password
+		}
 	}
 }
 
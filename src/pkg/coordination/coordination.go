@@ -42,6 +42,33 @@ type ScanTracker interface {
 	IsScanRunning(ctx context.Context, digest string) bool
 }
 
+// Access is the aggregated pull activity of a cached image.
+type Access struct {
+	Count        int64
+	LastAccessed time.Time
+}
+
+// AccessStore shares cached image access counters across replicas.
+// Keys identify a cached image ("name:tag").
+type AccessStore interface {
+	// RecordAccesses adds the batched counts and keeps the latest access time per key.
+	// Keys not recorded for ttl expire.
+	RecordAccesses(ctx context.Context, accesses map[string]Access, ttl time.Duration) error
+	// LoadAccesses returns the recorded accesses of the given keys; unknown keys are omitted.
+	LoadAccesses(ctx context.Context, keys []string) (map[string]Access, error)
+	// ForgetAccesses drops the recorded accesses of the given keys.
+	ForgetAccesses(ctx context.Context, keys ...string) error
+}
+
+// CacheInvalidator tells the other replicas that a stored path changed, so they drop
+// it from their local storage cache. A path ending with "/" covers everything below it.
+type CacheInvalidator interface {
+	// PublishInvalidation announces a changed path to the other replicas.
+	PublishInvalidation(ctx context.Context, path string) error
+	// SubscribeInvalidations calls fn with the paths changed by other replicas until ctx is done.
+	SubscribeInvalidations(ctx context.Context, fn func(path string))
+}
+
 // --- Noop implementations for single-replica mode ---
 
 // NoopLockManager always succeeds immediately (no distributed coordination).
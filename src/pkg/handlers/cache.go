@@ -2,10 +2,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"oci-storage/pkg/interfaces"
+	service "oci-storage/pkg/services"
 	"oci-storage/pkg/utils"
 
 	"github.com/gofiber/fiber/v2"
@@ -46,6 +49,10 @@ func (h *CacheHandler) GetCacheStatus(c *fiber.Ctx) error {
 		"maxSize":      state.MaxSize,
 		"itemCount":    state.ItemCount,
 		"usagePercent": state.UsagePercent,
+		"pinnedSize":   state.PinnedSize,
+		"eviction":     state.EvictionPolicy,
+		"registries":   state.Registries,
+		"upstreams":    h.proxyService.GetUpstreamStatus(),
 	}
 
 	if diskStats, err := h.pathManager.GetDiskStats(); err == nil {
@@ -96,19 +103,26 @@ func (h *CacheHandler) PurgeCache(c *fiber.Ctx) error {
 	})
 }
 
-// DeleteCachedImageWildcard handles DELETE /cache/image/* with wildcard path parsing
-// Path format: /cache/image/proxy/docker.io/traefik/v3.2 -> name=proxy/docker.io/traefik, tag=v3.2
-func (h *CacheHandler) DeleteCachedImageWildcard(c *fiber.Ctx) error {
-	path := c.Params("*")
-
-	// Split to get name and tag - tag is the last segment
+// cachedImageFromPath splits a wildcard path into image name and tag (the last segment)
+// Path format: proxy/docker.io/traefik/v3.2 -> name=proxy/docker.io/traefik, tag=v3.2
+func cachedImageFromPath(path string) (string, string, bool) {
 	lastSlash := strings.LastIndex(path, "/")
 	if lastSlash == -1 {
-		return HTTPError(c, 400, "Invalid image path format - expected name/tag")
+		return "", "", false
 	}
 
 	name, _ := url.PathUnescape(path[:lastSlash])
 	tag, _ := url.PathUnescape(path[lastSlash+1:])
+	return name, tag, true
+}
+
+// DeleteCachedImageWildcard handles DELETE /cache/image/* with wildcard path parsing
+// Path format: /cache/image/proxy/docker.io/traefik/v3.2 -> name=proxy/docker.io/traefik, tag=v3.2
+func (h *CacheHandler) DeleteCachedImageWildcard(c *fiber.Ctx) error {
+	name, tag, ok := cachedImageFromPath(c.Params("*"))
+	if !ok {
+		return HTTPError(c, 400, "Invalid image path format - expected name/tag")
+	}
 
 	h.log.WithFunc().WithField("name", name).WithField("tag", tag).Debug("Deleting cached image (wildcard)")
 
@@ -127,3 +141,75 @@ func (h *CacheHandler) DeleteCachedImageWildcard(c *fiber.Ctx) error {
 		"tag":     tag,
 	})
 }
+
+// PinCachedImageWildcard handles PUT /cache/pin/* (pin) and DELETE /cache/pin/* (unpin).
+// Pinned images are never evicted nor GC'd as stale.
+func (h *CacheHandler) PinCachedImageWildcard(c *fiber.Ctx) error {
+	name, tag, ok := cachedImageFromPath(c.Params("*"))
+	if !ok {
+		return HTTPError(c, 400, "Invalid image path format - expected name/tag")
+	}
+	pinned := c.Method() != fiber.MethodDelete
+
+	h.log.WithFunc().WithField("name", name).WithField("tag", tag).WithField("pinned", pinned).Debug("Updating cached image pin")
+
+	if h.proxyService == nil || !h.proxyService.IsEnabled() {
+		return HTTPError(c, 400, "Proxy not enabled")
+	}
+
+	if err := h.proxyService.PinCachedImage(name, tag, pinned); err != nil {
+		if errors.Is(err, service.ErrCachedImageNotFound) {
+			return HTTPError(c, 404, "Cached image not found")
+		}
+		h.log.WithFunc().WithError(err).Error("Failed to update cached image pin")
+		return HTTPError(c, 500, err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"name":   name,
+		"tag":    tag,
+		"pinned": pinned,
+	})
+}
+
+// SimulateEviction handles GET /cache/eviction/simulate?policy=lru,lfu&targetGB=50.
+// It reports what each policy would evict now without deleting anything; all policies
+// are simulated when policy is omitted, against the configured cache limit unless
+// targetGB is set.
+func (h *CacheHandler) SimulateEviction(c *fiber.Ctx) error {
+	h.log.WithFunc().Debug("Simulating cache eviction")
+
+	if h.proxyService == nil || !h.proxyService.IsEnabled() {
+		return HTTPError(c, 400, "Proxy not enabled")
+	}
+
+	var policies []string
+	for _, policy := range strings.Split(c.Query("policy"), ",") {
+		if policy = strings.TrimSpace(policy); policy != "" {
+			policies = append(policies, policy)
+		}
+	}
+
+	var targetBytes int64
+	if targetGB := c.Query("targetGB"); targetGB != "" {
+		gb, err := strconv.ParseFloat(targetGB, 64)
+		if err != nil || gb <= 0 {
+			return HTTPError(c, 400, "targetGB must be a positive number")
+		}
+		targetBytes = int64(gb * 1024 * 1024 * 1024)
+	}
+
+	simulations, err := h.proxyService.SimulateEviction(policies, targetBytes)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownEvictionPolicy) {
+			return HTTPError(c, 400, err.Error())
+		}
+		h.log.WithFunc().WithError(err).Error("Failed to simulate cache eviction")
+		return HTTPError(c, 500, err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"policy":      h.proxyService.GetCacheState().EvictionPolicy,
+		"simulations": simulations,
+	})
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/models"
+	service "oci-storage/pkg/services"
+	"oci-storage/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const gb = int64(1024 * 1024 * 1024)
+
+func TestPinCachedImage(t *testing.T) {
+	app, _, _, mockProxyService, _, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	log := utils.NewLogger(utils.Config{})
+	cacheHandler := NewCacheHandler(mockProxyService, utils.NewPathManager(tempDir, log), log)
+	app.Put("/cache/pin/*", cacheHandler.PinCachedImageWildcard)
+	app.Delete("/cache/pin/*", cacheHandler.PinCachedImageWildcard)
+
+	mockProxyService.On("IsEnabled").Return(true)
+	mockProxyService.On("PinCachedImage", "proxy/docker.io/library/alpine", "3.20", true).Return(nil)
+	mockProxyService.On("PinCachedImage", "proxy/docker.io/library/alpine", "3.20", false).Return(nil)
+	mockProxyService.On("PinCachedImage", "proxy/docker.io/library/alpine", "missing", true).
+		Return(service.ErrCachedImageNotFound)
+
+	resp, err := app.Test(httptest.NewRequest("PUT", "/cache/pin/proxy/docker.io/library/alpine/3.20", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("DELETE", "/cache/pin/proxy/docker.io/library/alpine/3.20", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("PUT", "/cache/pin/proxy/docker.io/library/alpine/missing", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+
+	mockProxyService.AssertExpectations(t)
+}
+
+// cacheTestImage stores a single-platform image manifest with sparse layer blobs of the
+// given sizes and registers it as a cached image
+func cacheTestImage(t *testing.T, proxyService *service.ProxyService, handler *OCIHandler, tempDir, name, tag, registry string, layers map[string]int64, lastAccessed time.Time) {
+	manifest := models.OCIManifest{SchemaVersion: 2, MediaType: "application/vnd.oci.image.manifest.v1+json"}
+	var size int64
+	for digest, layerSize := range layers {
+		manifest.Layers = append(manifest.Layers, models.OCIDescriptor{Digest: digest, Size: layerSize})
+		size += layerSize
+
+		blobFile := filepath.Join(tempDir, handler.pathManager.GetBlobPath(digest))
+		if _, err := os.Stat(blobFile); err == nil {
+			continue
+		}
+		assert.NoError(t, os.MkdirAll(filepath.Dir(blobFile), 0755))
+		f, err := os.Create(blobFile)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Truncate(layerSize))
+		f.Close()
+	}
+
+	data, err := json.Marshal(manifest)
+	assert.NoError(t, err)
+	assert.NoError(t, handler.backend.Write(handler.pathManager.GetImageManifestPath(name, tag), data))
+
+	assert.NoError(t, proxyService.AddToCache(models.CachedImageMetadata{
+		Name:           name,
+		Tag:            tag,
+		Digest:         fmt.Sprintf("sha256:%x", sha256.Sum256(data)),
+		SourceRegistry: registry,
+		Size:           size,
+		LastAccessed:   lastAccessed,
+	}))
+	// Eviction runs in the background in the server
+	proxyService.EnforceCacheLimits()
+}
+
+func TestCacheEviction_HonorsPinsAndRegistryQuotas(t *testing.T) {
+	_, _, _, _, handler, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	cfg := *handler.config
+	cfg.Proxy.Cache.MaxSizeGB = 10
+	cfg.Proxy.Cache.RegistryMaxSizeGB = map[string]int{"nvcr.io": 4}
+	cfg.Proxy.Cache.Pinned = []string{"proxy/docker.io/library/busybox:1.*"}
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+
+	digest := func(c string) string { return "sha256:" + strings.Repeat(c, 64) }
+	base, busybox, nginx, torch1, torch2, postgres := digest("a"), digest("b"), digest("c"), digest("d"), digest("e"), digest("f")
+	blobExists := func(d string) bool {
+		exists, _ := handler.backend.Exists(handler.pathManager.GetBlobPath(d))
+		return exists
+	}
+	start := time.Now().Add(-time.Hour)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	// Oldest images, but pinned through the API and by configuration
+	cacheTestImage(t, proxyService, handler, tempDir, "proxy/docker.io/library/alpine", "3.20", "docker.io", map[string]int64{base: 1 * gb}, at(0))
+	assert.NoError(t, proxyService.PinCachedImage("proxy/docker.io/library/alpine", "3.20", true))
+	cacheTestImage(t, proxyService, handler, tempDir, "proxy/docker.io/library/busybox", "1.36", "docker.io", map[string]int64{busybox: 1 * gb}, at(1))
+	cacheTestImage(t, proxyService, handler, tempDir, "proxy/docker.io/library/nginx", "1.27", "docker.io", map[string]int64{base: 1 * gb, nginx: 1 * gb}, at(2))
+
+	// A burst of ML images only displaces older nvcr.io images, and frees their layers
+	cacheTestImage(t, proxyService, handler, tempDir, "proxy/nvcr.io/nvidia/pytorch", "24.01", "nvcr.io", map[string]int64{torch1: 3 * gb}, at(3))
+	cacheTestImage(t, proxyService, handler, tempDir, "proxy/nvcr.io/nvidia/pytorch", "24.02", "nvcr.io", map[string]int64{torch2: 3 * gb}, at(4))
+	assert.False(t, blobExists(torch1))
+	assert.True(t, blobExists(torch2))
+
+	// Sizes are deduplicated: the base layer shared by alpine and nginx counts once
+	state := proxyService.GetCacheState()
+	assert.Equal(t, 6*gb, state.TotalSize)
+	assert.Equal(t, 2*gb, state.PinnedSize)
+	if assert.Len(t, state.Registries, 2) {
+		assert.Equal(t, "docker.io", state.Registries[0].Registry)
+		assert.Equal(t, 3*gb, state.Registries[0].TotalSize)
+		assert.Equal(t, 2, state.Registries[0].PinnedCount)
+		assert.Equal(t, "nvcr.io", state.Registries[1].Registry)
+		assert.Equal(t, 4*gb, state.Registries[1].MaxSize)
+	}
+
+	// Global limit: pinned images survive even though they are the least recently used,
+	// and layers still referenced by remaining images are kept
+	cacheTestImage(t, proxyService, handler, tempDir, "proxy/docker.io/bitnami/postgresql", "16", "docker.io", map[string]int64{base: 1 * gb, postgres: 5 * gb}, at(5))
+
+	images, err := proxyService.GetCachedImages()
+	assert.NoError(t, err)
+	cached := make(map[string]bool)
+	for _, img := range images {
+		cached[img.Name+":"+img.Tag] = true
+	}
+	assert.True(t, cached["proxy/docker.io/library/alpine:3.20"])
+	assert.True(t, cached["proxy/docker.io/library/busybox:1.36"])
+	assert.False(t, cached["proxy/docker.io/library/nginx:1.27"])
+	assert.True(t, cached["proxy/docker.io/bitnami/postgresql:16"])
+	assert.True(t, blobExists(base))
+	assert.False(t, blobExists(nginx))
+
+	state = proxyService.GetCacheState()
+	assert.LessOrEqual(t, state.TotalSize, 9*gb)
+}
+
+func TestSimulateEviction_ComparesPolicies(t *testing.T) {
+	app, _, _, _, handler, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	cfg := *handler.config
+	cfg.Proxy.Cache.MaxSizeGB = 10
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+	cacheHandler := NewCacheHandler(proxyService, handler.pathManager, handler.log)
+	app.Get("/cache/eviction/simulate", cacheHandler.SimulateEviction)
+
+	digest := func(c string) string { return "sha256:" + strings.Repeat(c, 64) }
+	setAccessCount := func(name, tag string, count int64) {
+		path := handler.pathManager.GetCachedImageMetadataPath(name, tag)
+		data, err := handler.backend.Read(path)
+		assert.NoError(t, err)
+		var metadata models.CachedImageMetadata
+		assert.NoError(t, json.Unmarshal(data, &metadata))
+		metadata.AccessCount = count
+		data, err = json.Marshal(metadata)
+		assert.NoError(t, err)
+		assert.NoError(t, handler.backend.Write(path, data))
+	}
+	now := time.Now()
+
+	// 8 GB cached, under the 10 GB limit: nothing is evicted for real
+	cacheTestImage(t, proxyService, handler, tempDir, "proxy/docker.io/library/ancient", "v1", "docker.io", map[string]int64{digest("a"): 1 * gb}, now.AddDate(0, 0, -60))
+	setAccessCount("proxy/docker.io/library/ancient", "v1", 100)
+	cacheTestImage(t, proxyService, handler, tempDir, "proxy/docker.io/library/popular", "v1", "docker.io", map[string]int64{digest("b"): 2 * gb}, now.Add(-3*time.Hour))
+	setAccessCount("proxy/docker.io/library/popular", "v1", 50)
+	cacheTestImage(t, proxyService, handler, tempDir, "proxy/docker.io/library/big", "v1", "docker.io", map[string]int64{digest("c"): 4 * gb}, now.Add(-2*time.Hour))
+	setAccessCount("proxy/docker.io/library/big", "v1", 1)
+	cacheTestImage(t, proxyService, handler, tempDir, "proxy/docker.io/library/recent", "v1", "docker.io", map[string]int64{digest("d"): 1 * gb}, now.Add(-time.Hour))
+	setAccessCount("proxy/docker.io/library/recent", "v1", 2)
+
+	simulations, err := proxyService.SimulateEviction(nil, 5*gb)
+	assert.NoError(t, err)
+
+	evicted := make(map[string][]string)
+	for _, sim := range simulations {
+		assert.Equal(t, 8*gb, sim.SizeBefore)
+		assert.LessOrEqual(t, sim.SizeAfter, 5*gb)
+		assert.Equal(t, sim.SizeBefore-sim.SizeAfter, sim.FreedBytes)
+		for _, img := range sim.Evicted {
+			evicted[sim.Policy] = append(evicted[sim.Policy], strings.TrimPrefix(img.Name, "proxy/docker.io/library/")+"/"+img.Reason)
+		}
+	}
+	assert.Equal(t, []string{"ancient/size", "popular/size"}, evicted["lru"])
+	assert.Equal(t, []string{"big/size"}, evicted["lfu"])
+	assert.Equal(t, []string{"ancient/size", "big/size"}, evicted["gdsf"])
+	assert.Equal(t, []string{"ancient/expired", "popular/size"}, evicted["max-age"])
+
+	// Dry run: every image and blob is still there
+	images, err := proxyService.GetCachedImages()
+	assert.NoError(t, err)
+	assert.Len(t, images, 4)
+	assert.Equal(t, 8*gb, proxyService.GetCacheState().TotalSize)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/cache/eviction/simulate?policy=lfu&targetGB=5", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	var body struct {
+		Policy      string                      `json:"policy"`
+		Simulations []models.EvictionSimulation `json:"simulations"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "lru", body.Policy)
+	if assert.Len(t, body.Simulations, 1) && assert.Len(t, body.Simulations[0].Evicted, 1) {
+		assert.Equal(t, "proxy/docker.io/library/big", body.Simulations[0].Evicted[0].Name)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/cache/eviction/simulate?policy=random", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+// memoryAccessStore is an in-memory coordination.AccessStore standing in for Redis
+type memoryAccessStore struct {
+	mu       sync.Mutex
+	accesses map[string]coordination.Access
+}
+
+func (m *memoryAccessStore) RecordAccesses(_ context.Context, accesses map[string]coordination.Access, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, access := range accesses {
+		current := m.accesses[key]
+		current.Count += access.Count
+		if access.LastAccessed.After(current.LastAccessed) {
+			current.LastAccessed = access.LastAccessed
+		}
+		m.accesses[key] = current
+	}
+	return nil
+}
+
+func (m *memoryAccessStore) LoadAccesses(_ context.Context, keys []string) (map[string]coordination.Access, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make(map[string]coordination.Access)
+	for _, key := range keys {
+		if access, ok := m.accesses[key]; ok {
+			result[key] = access
+		}
+	}
+	return result, nil
+}
+
+func (m *memoryAccessStore) ForgetAccesses(_ context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.accesses, key)
+	}
+	return nil
+}
+
+func TestAccessTracking_BatchesManifestAndBlobHits(t *testing.T) {
+	_, _, _, _, handler, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	cfg := *handler.config
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+
+	digest := func(c string) string { return "sha256:" + strings.Repeat(c, 64) }
+	name := "proxy/docker.io/library/app"
+	stale := time.Now().Add(-48 * time.Hour)
+	cacheTestImage(t, proxyService, handler, tempDir, name, "v1", "docker.io", map[string]int64{digest("a"): 1024}, stale)
+	cacheTestImage(t, proxyService, handler, tempDir, name, "v2", "docker.io", map[string]int64{digest("b"): 1024}, stale)
+
+	readMetadata := func(tag string) models.CachedImageMetadata {
+		data, err := handler.backend.Read(handler.pathManager.GetCachedImageMetadataPath(name, tag))
+		assert.NoError(t, err)
+		var metadata models.CachedImageMetadata
+		assert.NoError(t, json.Unmarshal(data, &metadata))
+		return metadata
+	}
+	v1Manifest, err := handler.backend.Read(handler.pathManager.GetImageManifestPath(name, "v1"))
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		proxyService.UpdateAccessTime(name, "v1")
+	}
+	proxyService.UpdateAccessTime(name, fmt.Sprintf("sha256:%x", sha256.Sum256(v1Manifest)))
+	proxyService.RecordBlobAccess(name, digest("b"))
+
+	// Hot path writes nothing; pending tag hits are visible right away
+	assert.Equal(t, int64(0), readMetadata("v1").AccessCount)
+	images, err := proxyService.GetCachedImages()
+	assert.NoError(t, err)
+	for _, img := range images {
+		if img.Tag == "v1" {
+			assert.Equal(t, int64(3), img.AccessCount)
+		}
+	}
+
+	// Flush: pulls by tag and digest are counted, blob pulls only refresh the access time
+	proxyService.FlushAccesses()
+	v1, v2 := readMetadata("v1"), readMetadata("v2")
+	assert.Equal(t, int64(4), v1.AccessCount)
+	assert.WithinDuration(t, time.Now(), v1.LastAccessed, time.Minute)
+	assert.Equal(t, int64(0), v2.AccessCount)
+	assert.WithinDuration(t, time.Now(), v2.LastAccessed, time.Minute)
+
+	// With a shared store, counters go to the store and are overlaid on the metadata
+	store := &memoryAccessStore{accesses: make(map[string]coordination.Access)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	proxyService.StartAccessTracking(ctx, store)
+
+	proxyService.UpdateAccessTime(name, "v2")
+	proxyService.UpdateAccessTime(name, "v2")
+	proxyService.FlushAccesses()
+	assert.Equal(t, int64(0), readMetadata("v2").AccessCount)
+	assert.Equal(t, int64(2), store.accesses[name+":v2"].Count)
+
+	images, err = proxyService.GetCachedImages()
+	assert.NoError(t, err)
+	for _, img := range images {
+		if img.Tag == "v2" {
+			assert.Equal(t, int64(2), img.AccessCount)
+		}
+	}
+}
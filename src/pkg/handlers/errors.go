@@ -6,3 +6,16 @@ import "github.com/gofiber/fiber/v2"
 func HTTPError(c *fiber.Ctx, status int, message string) error {
 	return c.Status(status).JSON(fiber.Map{"error": message})
 }
+
+// OCIError sends an error response in the OCI distribution spec format
+// ({"errors": [{"code", "message", "detail"}]}) understood by container runtimes
+func OCIError(c *fiber.Ctx, status int, code, message string, detail interface{}) error {
+	entry := fiber.Map{
+		"code":    code,
+		"message": message,
+	}
+	if detail != nil {
+		entry["detail"] = detail
+	}
+	return c.Status(status).JSON(fiber.Map{"errors": []fiber.Map{entry}})
+}
@@ -0,0 +1,92 @@
+// pkg/handlers/helm_proxy.go
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"oci-storage/pkg/interfaces"
+	service "oci-storage/pkg/services"
+	"oci-storage/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// helmPathSegmentRe validates repository, chart and version path segments
+var helmPathSegmentRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// HelmProxyHandler serves upstream HTTP Helm repositories through the cache
+type HelmProxyHandler struct {
+	log          *utils.Logger
+	proxyService interfaces.ProxyServiceInterface
+}
+
+// NewHelmProxyHandler creates a new Helm repository proxy handler
+func NewHelmProxyHandler(proxyService interfaces.ProxyServiceInterface, log *utils.Logger) *HelmProxyHandler {
+	return &HelmProxyHandler{
+		proxyService: proxyService,
+		log:          log,
+	}
+}
+
+// GetIndex handles GET /helm-proxy/:repo/index.yaml
+func (h *HelmProxyHandler) GetIndex(c *fiber.Ctx) error {
+	repo := c.Params("repo")
+	h.log.WithFunc().WithField("repo", repo).Debug("Processing proxied Helm index request")
+
+	if !helmPathSegmentRe.MatchString(repo) {
+		return HTTPError(c, 400, "Invalid repository name")
+	}
+
+	data, err := h.proxyService.GetHelmIndex(c.Context(), repo)
+	if err != nil {
+		return h.sendError(c, err)
+	}
+
+	c.Set("Content-Type", "text/yaml; charset=utf-8")
+	return c.Send(data)
+}
+
+// GetChart handles GET /helm-proxy/:repo/charts/:chart/:file where file is <chart>-<version>.tgz
+func (h *HelmProxyHandler) GetChart(c *fiber.Ctx) error {
+	repo := c.Params("repo")
+	chart := c.Params("chart")
+	file := c.Params("file")
+
+	version, ok := strings.CutPrefix(strings.TrimSuffix(file, ".tgz"), chart+"-")
+	if !ok || !strings.HasSuffix(file, ".tgz") ||
+		!helmPathSegmentRe.MatchString(repo) ||
+		!helmPathSegmentRe.MatchString(chart) ||
+		!helmPathSegmentRe.MatchString(version) {
+		return HTTPError(c, 400, "Invalid chart path - expected /helm-proxy/<repo>/charts/<chart>/<chart>-<version>.tgz")
+	}
+
+	h.log.WithFunc().WithFields(logrus.Fields{
+		"repo":    repo,
+		"chart":   chart,
+		"version": version,
+	}).Debug("Processing proxied Helm chart download")
+
+	data, err := h.proxyService.GetHelmChart(c.Context(), repo, chart, version)
+	if err != nil {
+		return h.sendError(c, err)
+	}
+
+	c.Set("Content-Type", "application/gzip")
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file))
+	return c.Send(data)
+}
+
+func (h *HelmProxyHandler) sendError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrHelmRepoNotConfigured):
+		return HTTPError(c, 404, "Helm repository not configured")
+	case errors.Is(err, service.ErrHelmChartNotFound):
+		return HTTPError(c, 404, "Chart not found")
+	}
+	h.log.WithFunc().WithError(err).Error("Failed to fetch from upstream Helm repository")
+	return HTTPError(c, 502, "Failed to fetch from upstream Helm repository")
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"oci-storage/config"
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/models"
+	service "oci-storage/pkg/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHelmProxy_RewritesIndexAndCachesCharts(t *testing.T) {
+	app, _, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	chartArchive := []byte("demo chart archive")
+	var chartDownloads atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/charts/index.yaml":
+			fmt.Fprintf(w, `apiVersion: v1
+entries:
+  demo:
+  - apiVersion: v2
+    name: demo
+    version: 1.0.0
+    digest: %x
+    urls:
+    - demo-1.0.0.tgz
+    annotations:
+      category: Testing
+  tampered:
+  - name: tampered
+    version: 0.1.0
+    digest: "0000"
+    urls:
+    - http://%s/releases/tampered-0.1.0.tgz
+generated: "2024-01-01T00:00:00Z"
+`, sha256.Sum256(chartArchive), r.Host)
+		case "/charts/demo-1.0.0.tgz":
+			chartDownloads.Add(1)
+			w.Write(chartArchive)
+		case "/releases/tampered-0.1.0.tgz":
+			w.Write([]byte("not what the index says"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := *handler.config
+	cfg.Proxy.Cache.HelmIndexTTLSeconds = 60
+	cfg.Proxy.HelmRepositories = []config.HelmRepositoryConfig{{Name: "demo-repo", URL: upstream.URL + "/charts/"}}
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+	helmProxyHandler := NewHelmProxyHandler(proxyService, handler.log)
+	app.Get("/helm-proxy/:repo/index.yaml", helmProxyHandler.GetIndex)
+	app.Get("/helm-proxy/:repo/charts/:chart/:file", helmProxyHandler.GetChart)
+
+	get := func(path string) (int, string) {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// Index URLs point back at oci-storage; other fields are preserved
+	status, index := get("/helm-proxy/demo-repo/index.yaml")
+	assert.Equal(t, 200, status)
+	assert.Contains(t, index, "- /helm-proxy/demo-repo/charts/demo/demo-1.0.0.tgz")
+	assert.Contains(t, index, "- /helm-proxy/demo-repo/charts/tampered/tampered-0.1.0.tgz")
+	assert.Contains(t, index, "category: Testing")
+	assert.NotContains(t, index, upstream.URL)
+
+	// First download fetches the relative upstream URL, the second is served from the cache
+	for i := 0; i < 2; i++ {
+		status, body := get("/helm-proxy/demo-repo/charts/demo/demo-1.0.0.tgz")
+		assert.Equal(t, 200, status)
+		assert.Equal(t, string(chartArchive), body)
+	}
+	assert.Equal(t, int32(1), chartDownloads.Load())
+
+	images, err := proxyService.GetCachedImages()
+	assert.NoError(t, err)
+	if assert.Len(t, images, 1) {
+		assert.Equal(t, "proxy/helm/demo-repo/demo", images[0].Name)
+		assert.Equal(t, "1.0.0", images[0].Tag)
+		assert.Equal(t, "helm/demo-repo", images[0].SourceRegistry)
+	}
+
+	status, _ = get("/helm-proxy/demo-repo/charts/tampered/tampered-0.1.0.tgz")
+	assert.Equal(t, 502, status)
+	status, _ = get("/helm-proxy/demo-repo/charts/demo/demo-9.9.9.tgz")
+	assert.Equal(t, 404, status)
+	status, _ = get("/helm-proxy/unknown/index.yaml")
+	assert.Equal(t, 404, status)
+	status, _ = get("/helm-proxy/demo-repo/charts/demo/other-1.0.0.tgz")
+	assert.Equal(t, 400, status)
+
+	// Upstream down: a fresh replica serves the stored index and the cached chart
+	upstream.Close()
+	offline := NewHelmProxyHandler(service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend), handler.log)
+	app.Get("/offline/:repo/index.yaml", offline.GetIndex)
+	app.Get("/offline/:repo/charts/:chart/:file", offline.GetChart)
+
+	status, index = get("/offline/demo-repo/index.yaml")
+	assert.Equal(t, 200, status)
+	assert.Contains(t, index, "/helm-proxy/demo-repo/charts/demo/demo-1.0.0.tgz")
+	status, body := get("/offline/demo-repo/charts/demo/demo-1.0.0.tgz")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, string(chartArchive), body)
+}
+
+// helmChartArchive builds a minimal chart .tgz with the given Chart.yaml
+func helmChartArchive(t *testing.T, chartYAML string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "demo/Chart.yaml", Mode: 0644, Size: int64(len(chartYAML))}))
+	_, err := tw.Write([]byte(chartYAML))
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestProxiedOCIHelmChart_ListedInChartsAndIndex(t *testing.T) {
+	_, _, _, _, handler, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+	assert.NoError(t, os.MkdirAll(filepath.Join(tempDir, "charts"), 0755))
+
+	cfg := *handler.config
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+	handler.proxyService = proxyService
+	chartService := service.NewChartService(&cfg, handler.log, handler.pathManager, handler.backend, nil)
+	chartService.SetCachedChartSource(proxyService)
+	indexService := service.NewIndexService(&cfg, handler.log, handler.pathManager, handler.backend, chartService, &coordination.NoopLockManager{})
+	proxyService.SetChartIndexUpdater(indexService)
+
+	// Blobs are already local, as after a previous pull: no upstream is contacted
+	archive := helmChartArchive(t, "apiVersion: v2\nname: demo\nversion: 1.2.0\ndescription: Demo chart\n")
+	chartConfig := []byte(`{"name":"demo","version":"1.2.0"}`)
+	blob := func(mediaType string, data []byte) models.OCIDescriptor {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+		assert.NoError(t, handler.backend.Write(handler.pathManager.GetBlobPath(digest), data))
+		return models.OCIDescriptor{MediaType: mediaType, Digest: digest, Size: int64(len(data))}
+	}
+	manifest := models.OCIManifest{
+		SchemaVersion: 2,
+		MediaType:     models.MediaTypeOCIManifest,
+		Config:        blob(models.MediaTypeHelmConfig, chartConfig),
+		Layers:        []models.OCIDescriptor{blob(models.MediaTypeHelmChart, archive)},
+	}
+	manifestData, err := json.Marshal(manifest)
+	assert.NoError(t, err)
+
+	name := "proxy/ghcr.io/org/charts/demo"
+	handler.cacheManifest(name, "1.2.0", manifestData, "https://ghcr.io", "org/charts/demo")
+
+	// Cached as a chart, not as an image
+	images, err := proxyService.GetCachedImages()
+	assert.NoError(t, err)
+	assert.Len(t, images, 1)
+	assert.Equal(t, models.ArtifactTypeHelmChart, images[0].ArtifactType)
+	_, err = os.Stat(filepath.Join(tempDir, "images", name, "tags"))
+	assert.True(t, os.IsNotExist(err))
+
+	groups, err := chartService.ListCharts()
+	assert.NoError(t, err)
+	assert.Len(t, groups, 1)
+	assert.Equal(t, "demo", groups[0].Name)
+	assert.Equal(t, name, groups[0].Versions[0].Source)
+
+	data, err := chartService.GetChart("demo", "1.2.0")
+	assert.NoError(t, err)
+	assert.Equal(t, archive, data)
+
+	// index.yaml serves the chart from its layer blob and drops it once evicted
+	readIndex := func() string {
+		data, _ := handler.backend.Read(handler.pathManager.GetIndexPath())
+		return string(data)
+	}
+	assert.Eventually(t, func() bool {
+		return strings.Contains(readIndex(), "/v2/"+name+"/blobs/"+manifest.Layers[0].Digest)
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Contains(t, readIndex(), fmt.Sprintf("digest: %x", sha256.Sum256(archive)))
+
+	assert.NoError(t, proxyService.DeleteCachedImage(name, "1.2.0"))
+	assert.Eventually(t, func() bool {
+		return !strings.Contains(readIndex(), "demo")
+	}, 5*time.Second, 20*time.Millisecond)
+
+	groups, err = chartService.ListCharts()
+	assert.NoError(t, err)
+	assert.Empty(t, groups)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
 
 	"oci-storage/pkg/models"
 	utils "oci-storage/pkg/utils"
@@ -62,6 +63,11 @@ func (m *MockChartService) ExtractChartMetadata(chartData []byte) (*models.Chart
 	return args.Get(0).(*models.ChartMetadata), args.Error(1)
 }
 
+func (m *MockChartService) ListCachedCharts() ([]models.ChartMetadata, error) {
+	args := m.Called()
+	return args.Get(0).([]models.ChartMetadata), args.Error(1)
+}
+
 func (m *MockChartService) ListChartVersions(name string) ([]string, error) {
 	args := m.Called(name)
 	return args.Get(0).([]string), args.Error(1)
@@ -112,9 +118,8 @@ func (m *MockProxyService) UpdateAccessTime(name, tag string) {
 	m.Called(name, tag)
 }
 
-func (m *MockProxyService) EvictLRU(targetBytes int64) error {
-	args := m.Called(targetBytes)
-	return args.Error(0)
+func (m *MockProxyService) RecordBlobAccess(name, digest string) {
+	m.Called(name, digest)
 }
 
 func (m *MockProxyService) DeleteCachedImage(name, tag string) error {
@@ -122,6 +127,35 @@ func (m *MockProxyService) DeleteCachedImage(name, tag string) error {
 	return args.Error(0)
 }
 
+func (m *MockProxyService) PinCachedImage(name, tag string, pinned bool) error {
+	args := m.Called(name, tag, pinned)
+	return args.Error(0)
+}
+
+func (m *MockProxyService) SimulateEviction(policies []string, targetBytes int64) ([]models.EvictionSimulation, error) {
+	args := m.Called(policies, targetBytes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.EvictionSimulation), args.Error(1)
+}
+
+func (m *MockProxyService) GetHelmIndex(ctx context.Context, repo string) ([]byte, error) {
+	args := m.Called(ctx, repo)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockProxyService) GetHelmChart(ctx context.Context, repo, chart, version string) ([]byte, error) {
+	args := m.Called(ctx, repo, chart, version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
 func (m *MockProxyService) AddToCache(metadata models.CachedImageMetadata) error {
 	args := m.Called(metadata)
 	return args.Error(0)
@@ -145,6 +179,37 @@ func (m *MockProxyService) FetchWithAuth(ctx context.Context, req *http.Request,
 	return args.Get(0).(*http.Response), args.Error(1)
 }
 
+func (m *MockProxyService) GetUpstreamStatus() []models.UpstreamStatus {
+	args := m.Called()
+	return args.Get(0).([]models.UpstreamStatus)
+}
+
+func (m *MockProxyService) RetryAfter(registryURL string) time.Duration {
+	args := m.Called(registryURL)
+	return args.Get(0).(time.Duration)
+}
+
+func (m *MockProxyService) IsQuotaLow(registryURL string) bool {
+	args := m.Called(registryURL)
+	return args.Bool(0)
+}
+
+func (m *MockProxyService) ListUpstreamTags(ctx context.Context, registryURL, name string) ([]string, error) {
+	args := m.Called(ctx, registryURL, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockProxyService) ListUpstreamCatalog(ctx context.Context, registryURL string) ([]string, error) {
+	args := m.Called(ctx, registryURL)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
 // MockImageService implements ImageServiceInterface for testing
 type MockImageService struct {
 	mock.Mock
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -44,6 +46,8 @@ type OCIHandler struct {
 	uploadTracker coordination.UploadTracker
 	locker        coordination.LockManager
 	config        *config.Config
+	replicator    interfaces.ReplicationServiceInterface
+	uploads       interfaces.UploadServiceInterface
 }
 
 func NewOCIHandler(
@@ -72,6 +76,17 @@ func NewOCIHandler(
 	}
 }
 
+// SetReplicationService enables push replication of successfully pushed manifests
+func (h *OCIHandler) SetReplicationService(replicator interfaces.ReplicationServiceInterface) {
+	h.replicator = replicator
+}
+
+// SetUploadService writes chunked uploads to object storage through multipart uploads
+// instead of staging them on local disk
+func (h *OCIHandler) SetUploadService(uploads interfaces.UploadServiceInterface) {
+	h.uploads = uploads
+}
+
 func (h *OCIHandler) HandleOCIAPI(c *fiber.Ctx) error {
 	h.log.WithFunc().Debug("Processing API request")
 	return c.JSON(fiber.Map{
@@ -98,6 +113,12 @@ func (h *OCIHandler) GetBlob(c *fiber.Ctx) error {
 	// Normalize Docker Hub names for consistent cache lookup
 	normalizedName := normalizeDockerHubName(name)
 
+	// Blobs are content-addressed: mirror pulls only change where a miss is fetched from
+	mirrored, explicitMirror := h.mirrorName(c, name)
+	if explicitMirror {
+		normalizedName = mirrored
+	}
+
 	h.log.WithFunc().WithFields(logrus.Fields{
 		"name":           name,
 		"normalizedName": normalizedName,
@@ -107,13 +128,25 @@ func (h *OCIHandler) GetBlob(c *fiber.Ctx) error {
 	// Try local first - stream from backend
 	blobPath := h.pathManager.GetBlobPath(digest)
 	if exists, _ := h.backend.Exists(blobPath); exists {
+		if strings.HasPrefix(normalizedName, "proxy/") && h.proxyService != nil && h.proxyService.IsEnabled() {
+			h.proxyService.RecordBlobAccess(normalizedName, digest)
+		}
 		c.Set("Docker-Content-Digest", digest)
+		if location := h.blobRedirectURL(c, normalizedName, blobPath); location != "" {
+			c.Set("Location", location)
+			return c.SendStatus(fiber.StatusTemporaryRedirect)
+		}
 		c.Set("Content-Type", "application/octet-stream")
 		return h.sendBlob(c, blobPath)
 	}
 
 	// Not found locally - try proxy if enabled
 	if h.proxyService != nil && h.proxyService.IsEnabled() {
+		// Not a local repository: fetch the miss from proxy.mirrorFor
+		if mirrored != "" && !explicitMirror && !h.hasLocalManifests(normalizedName) {
+			normalizedName = mirrored
+		}
+
 		h.log.WithFunc().WithFields(logrus.Fields{
 			"name":   normalizedName,
 			"digest": digest,
@@ -126,6 +159,39 @@ func (h *OCIHandler) GetBlob(c *fiber.Ctx) error {
 	return c.SendStatus(404)
 }
 
+// blobRedirectURL returns a presigned object storage URL to redirect a blob download to,
+// or "" when the blob must be streamed: redirects disabled, backend unable to presign,
+// client or repository configured for streaming, blob cached locally, or signing failure.
+func (h *OCIHandler) blobRedirectURL(c *fiber.Ctx, name, blobPath string) string {
+	redirect := h.config.Storage.Redirect
+	presigner, ok := storage.AsPresigner(h.backend)
+	if !redirect.Enabled || !ok {
+		return ""
+	}
+	userAgent := c.Get("User-Agent")
+	for _, agent := range redirect.StreamUserAgents {
+		if agent != "" && strings.Contains(userAgent, agent) {
+			return ""
+		}
+	}
+	for _, prefix := range redirect.StreamRepositories {
+		if prefix != "" && strings.HasPrefix(name, prefix) {
+			return ""
+		}
+	}
+
+	// Blobs not yet moved to the sharded layout are signed at their legacy path
+	if resolver, ok := h.backend.(storage.PathResolver); ok {
+		blobPath = resolver.ResolvePath(blobPath)
+	}
+	location, err := presigner.PresignGet(blobPath, time.Duration(redirect.TTLSeconds)*time.Second)
+	if err != nil {
+		h.log.WithError(err).WithField("path", blobPath).Warn("Failed to presign blob URL, streaming instead")
+		return ""
+	}
+	return location
+}
+
 // sendBlob streams a blob from the backend to the client
 func (h *OCIHandler) sendBlob(c *fiber.Ctx, path string) error {
 	info, err := h.backend.Stat(path)
@@ -146,6 +212,13 @@ func (h *OCIHandler) sendBlob(c *fiber.Ctx, path string) error {
 func (h *OCIHandler) HandleCatalog(c *fiber.Ctx) error {
 	h.log.WithFunc().Debug("Processing catalog request")
 
+	// ?ns=<registry> passes the catalog request through to a proxied registry
+	if ns := c.Query("ns"); ns != "" && h.proxyService != nil && h.proxyService.IsEnabled() {
+		if registry := h.mirrorRegistry(ns); registry != "" {
+			return h.proxyCatalog(c, registry)
+		}
+	}
+
 	repositories := make([]string, 0)
 
 	charts, err := h.chartService.ListCharts()
@@ -186,12 +259,21 @@ func (h *OCIHandler) HandleCatalog(c *fiber.Ctx) error {
 func (h *OCIHandler) HandleListTags(c *fiber.Ctx) error {
 	name := h.getName(c)
 
-	h.log.WithFunc().WithField("name", name).Debug("Processing tags list request")
+	// Registry mirror pulls (?ns=docker.io) list the proxy cache namespace
+	lookupName := name
+	if mirrored, explicit := h.mirrorName(c, name); explicit {
+		lookupName = mirrored
+	}
+
+	h.log.WithFunc().WithFields(logrus.Fields{
+		"name":       name,
+		"lookupName": lookupName,
+	}).Debug("Processing tags list request")
 
 	tags := make([]string, 0)
 
 	if h.imageService != nil {
-		imageTags, err := h.imageService.ListTags(name)
+		imageTags, err := h.imageService.ListTags(lookupName)
 		if err == nil && len(imageTags) > 0 {
 			tags = append(tags, imageTags...)
 		}
@@ -200,7 +282,7 @@ func (h *OCIHandler) HandleListTags(c *fiber.Ctx) error {
 	charts, err := h.chartService.ListCharts()
 	if err == nil {
 		for _, chart := range charts {
-			if chart.Name == name {
+			if chart.Name == lookupName {
 				for _, version := range chart.Versions {
 					tags = append(tags, version.Version)
 				}
@@ -209,12 +291,61 @@ func (h *OCIHandler) HandleListTags(c *fiber.Ctx) error {
 		}
 	}
 
+	// Proxied repositories also list the tags that exist upstream but are not cached yet
+	if strings.HasPrefix(lookupName, "proxy/") && h.proxyService != nil && h.proxyService.IsEnabled() {
+		tags = mergeTags(tags, h.upstreamTags(lookupName))
+	}
+
+	return h.sendTagList(c, name, tags)
+}
+
+// sendTagList writes a tags/list response, honoring the n and last pagination parameters
+// of the distribution spec (tags are returned in lexical order when paginating).
+func (h *OCIHandler) sendTagList(c *fiber.Ctx, name string, tags []string) error {
+	last := c.Query("last")
+	n := c.QueryInt("n", 0)
+	if last == "" && n <= 0 {
+		return c.JSON(fiber.Map{
+			"name": name,
+			"tags": tags,
+		})
+	}
+
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+	if last != "" {
+		start := sort.SearchStrings(sorted, last)
+		if start < len(sorted) && sorted[start] == last {
+			start++
+		}
+		sorted = sorted[start:]
+	}
+	if n > 0 && len(sorted) > n {
+		sorted = sorted[:n]
+		c.Set("Link", fmt.Sprintf(`</v2/%s/tags/list?n=%d&last=%s>; rel="next"`, name, n, url.QueryEscape(sorted[n-1])))
+	}
+
 	return c.JSON(fiber.Map{
 		"name": name,
-		"tags": tags,
+		"tags": sorted,
 	})
 }
 
+// mergeTags appends the upstream tags missing from local, keeping local order first
+func mergeTags(local, upstream []string) []string {
+	seen := make(map[string]bool, len(local))
+	for _, tag := range local {
+		seen[tag] = true
+	}
+	for _, tag := range upstream {
+		if !seen[tag] {
+			seen[tag] = true
+			local = append(local, tag)
+		}
+	}
+	return local
+}
+
 func (h *OCIHandler) HandleManifest(c *fiber.Ctx) error {
 	name := h.getName(c)
 	reference := c.Params("reference")
@@ -232,6 +363,12 @@ func (h *OCIHandler) HandleManifest(c *fiber.Ctx) error {
 	// Normalize Docker Hub names for cache lookup (traefik -> library/traefik)
 	normalizedName := normalizeDockerHubName(name)
 
+	// Registry mirror pulls (?ns=docker.io) are served from the proxy cache namespace
+	mirrored, explicitMirror := h.mirrorName(c, name)
+	if explicitMirror {
+		normalizedName = mirrored
+	}
+
 	h.log.WithFunc().WithFields(logrus.Fields{
 		"name":           name,
 		"normalizedName": normalizedName,
@@ -279,6 +416,17 @@ func (h *OCIHandler) HandleManifest(c *fiber.Ctx) error {
 		return h.proxyManifest(c, normalizedName, reference)
 	}
 
+	// Not a local repository: serve it as a mirror of proxy.mirrorFor
+	if mirrored != "" && !explicitMirror {
+		h.log.WithFunc().WithFields(logrus.Fields{
+			"name":     normalizedName,
+			"mirrored": mirrored,
+		}).Debug("Manifest not found locally, serving as registry mirror")
+
+		c.Locals("name", mirrored)
+		return h.HandleManifest(c)
+	}
+
 	h.log.WithFunc().WithError(err).Debug("Manifest not found")
 	if c.Method() == "HEAD" {
 		return c.Status(404).Send(nil)
@@ -518,9 +666,15 @@ func (h *OCIHandler) PostUpload(c *fiber.Ctx) error {
 		"uuid": uuid,
 	}).Debug("Initializing upload")
 
-	// Register upload session so other replicas know this pod owns it.
-	// TTL of 1 hour covers even very large chunked uploads.
-	if err := h.uploadTracker.Register(c.Context(), uuid, 1*time.Hour); err != nil {
+	if h.uploads != nil {
+		// Session state lives in the bucket: any replica can take the next chunk
+		if err := h.uploads.Create(uuid); err != nil {
+			h.log.WithFunc().WithError(err).Error("Failed to create upload session")
+			return c.SendStatus(500)
+		}
+	} else if err := h.uploadTracker.Register(c.Context(), uuid, 1*time.Hour); err != nil {
+		// Register upload session so other replicas know this pod owns it.
+		// TTL of 1 hour covers even very large chunked uploads.
 		h.log.WithError(err).Warn("Failed to register upload session")
 	}
 
@@ -545,6 +699,10 @@ func (h *OCIHandler) PatchBlob(c *fiber.Ctx) error {
 		return HTTPError(c, 400, "Invalid UUID format")
 	}
 
+	if h.uploads != nil {
+		return h.patchSessionUpload(c, name, uuid)
+	}
+
 	// Check that this upload belongs to this pod (multi-replica safety)
 	if err := h.uploadTracker.CheckOwnership(c.Context(), uuid); err != nil {
 		h.log.WithError(err).WithField("uuid", uuid).Error("Upload routed to wrong replica")
@@ -629,6 +787,10 @@ func (h *OCIHandler) CompleteUpload(c *fiber.Ctx) error {
 		return HTTPError(c, 400, "Invalid digest format")
 	}
 
+	if h.uploads != nil {
+		return h.completeSessionUpload(c, name, uuid, digest)
+	}
+
 	// Check that this upload belongs to this pod (multi-replica safety)
 	if err := h.uploadTracker.CheckOwnership(c.Context(), uuid); err != nil {
 		h.log.WithError(err).WithField("uuid", uuid).Error("Upload routed to wrong replica")
@@ -689,7 +851,7 @@ func (h *OCIHandler) CompleteUpload(c *fiber.Ctx) error {
 	}
 
 	// Verify the uploaded content matches the declared digest
-	actualDigest, err := utils.ComputeFileDigest(tempPath)
+	actualDigest, err := utils.ComputeFileDigest(tempPath, digest)
 	if err != nil {
 		h.log.WithFunc().WithError(err).Error("Failed to compute digest of uploaded blob")
 		os.Remove(tempPath)
@@ -756,6 +918,12 @@ func (h *OCIHandler) HeadBlob(c *fiber.Ctx) error {
 	// Container runtimes (containerd, Docker) do HEAD before GET to check
 	// blob existence. Without this, proxy images fail with "blob unknown".
 	normalizedName := normalizeDockerHubName(name)
+	if mirrored, explicit := h.mirrorName(c, name); explicit {
+		normalizedName = mirrored
+	} else if mirrored != "" && !h.hasLocalManifests(normalizedName) {
+		// Not a local repository: check the proxy.mirrorFor registry
+		normalizedName = mirrored
+	}
 	isProxyPath := strings.HasPrefix(normalizedName, "proxy/")
 	if h.proxyService != nil && h.proxyService.IsEnabled() && isProxyPath {
 		h.log.WithFunc().WithFields(logrus.Fields{
@@ -929,6 +1097,11 @@ func (h *OCIHandler) PutManifest(c *fiber.Ctx) error {
 		"size":      len(manifestData),
 	}).Info("Manifest saved successfully")
 
+	// Queue copies to downstream registries; the push itself never waits for them
+	if h.replicator != nil {
+		h.replicator.Enqueue(name, reference, digestStr)
+	}
+
 	// Trigger async vulnerability scan if enabled
 	// Only scan Docker images (not Helm charts), and only for proper tags
 	if h.scanService != nil && h.scanService.IsEnabled() &&
@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"oci-storage/config"
@@ -105,8 +106,9 @@ func TestPutManifest_MultiArchIndex(t *testing.T) {
 	assert.Equal(t, expectedDigest, returnedDigest, "Digest in response should match original bytes")
 
 	// Verify manifest was saved to blob storage with correct digest
-	// Note: GetBlobPath uses digest as-is, so path is blobs/sha256:xxx not blobs/sha256/xxx
-	blobPath := filepath.Join(tempDir, "blobs", expectedDigest)
+	// Blobs are sharded: blobs/sha256/<ab>/<cd>/<hex>
+	hex := strings.TrimPrefix(expectedDigest, "sha256:")
+	blobPath := filepath.Join(tempDir, "blobs", "sha256", hex[0:2], hex[2:4], hex)
 	assert.FileExists(t, blobPath, "Manifest blob should exist")
 
 	storedData, err := os.ReadFile(blobPath)
@@ -197,8 +199,9 @@ func TestPutManifest_SinglePlatform(t *testing.T) {
 	assert.Equal(t, 201, resp.StatusCode)
 	assert.Equal(t, expectedDigest, resp.Header.Get("Docker-Content-Digest"))
 
-	// Verify blob storage (path is blobs/sha256:xxx not blobs/sha256/xxx)
-	blobPath := filepath.Join(tempDir, "blobs", expectedDigest)
+	// Verify blob storage (path is blobs/sha256/<ab>/<cd>/<hex>)
+	hex := strings.TrimPrefix(expectedDigest, "sha256:")
+	blobPath := filepath.Join(tempDir, "blobs", "sha256", hex[0:2], hex[2:4], hex)
 	storedData, err := os.ReadFile(blobPath)
 	assert.NoError(t, err)
 	assert.Equal(t, manifestBytes, storedData, "Stored bytes should match original exactly")
@@ -357,7 +360,7 @@ func TestPutManifest_RejectsSizeMismatch(t *testing.T) {
 	// Step 1: Create a real blob on disk (simulating a prior push)
 	blobContent := []byte("this is a fake layer blob with some content for testing")
 	blobDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(blobContent))
-	blobPath := filepath.Join(tempDir, "blobs", blobDigest)
+	blobPath := filepath.Join(tempDir, handler.pathManager.GetBlobPath(blobDigest))
 	err := os.MkdirAll(filepath.Dir(blobPath), 0755)
 	assert.NoError(t, err)
 	err = os.WriteFile(blobPath, blobContent, 0644)
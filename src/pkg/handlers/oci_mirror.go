@@ -0,0 +1,66 @@
+// pkg/handlers/oci_mirror.go
+package handlers
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// dockerHubAliases are the hostnames clients use for Docker Hub in the ns parameter
+var dockerHubAliases = map[string]bool{
+	"registry-1.docker.io": true,
+	"index.docker.io":      true,
+}
+
+// mirrorName maps a registry-mirror pull onto the proxy cache namespace.
+// containerd mirrors send the upstream host as ?ns=docker.io; such requests are always
+// served from proxy/<registry>/<name> (explicit=true). Without ns, proxy.mirrorFor provides
+// a fallback path to try only when the repository does not exist locally (explicit=false).
+// Returns "" when the request is not a mirror pull.
+func (h *OCIHandler) mirrorName(c *fiber.Ctx, name string) (mirrored string, explicit bool) {
+	if strings.HasPrefix(name, "proxy/") || h.proxyService == nil || !h.proxyService.IsEnabled() {
+		return "", false
+	}
+
+	if ns := c.Query("ns"); ns != "" {
+		if registry := h.mirrorRegistry(ns); registry != "" {
+			return normalizeDockerHubName("proxy/" + registry + "/" + name), true
+		}
+		// Unknown namespace (e.g. our own hostname): treat as a regular local pull
+		return "", false
+	}
+
+	if registry := h.mirrorRegistry(h.config.Proxy.MirrorFor); registry != "" {
+		return normalizeDockerHubName("proxy/" + registry + "/" + name), false
+	}
+	return "", false
+}
+
+// mirrorRegistry returns the configured registry name for a mirror namespace, or ""
+func (h *OCIHandler) mirrorRegistry(ns string) string {
+	if ns == "" {
+		return ""
+	}
+	if dockerHubAliases[ns] {
+		ns = "docker.io"
+	}
+	for _, reg := range h.config.Proxy.Registries {
+		if reg.Name == ns {
+			return reg.Name
+		}
+	}
+	return ""
+}
+
+// hasLocalManifests reports whether a repository holds manifests in local storage,
+// in which case blob misses are not looked up in the proxy.mirrorFor registry
+func (h *OCIHandler) hasLocalManifests(name string) bool {
+	for _, dir := range []string{filepath.Join("manifests", name), filepath.Join("images", name, "manifests")} {
+		if entries, err := h.backend.List(dir); err == nil && len(entries) > 0 {
+			return true
+		}
+	}
+	return false
+}
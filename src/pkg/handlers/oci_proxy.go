@@ -4,14 +4,14 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"oci-storage/pkg/models"
+	service "oci-storage/pkg/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/sirupsen/logrus"
@@ -43,6 +43,44 @@ func (h *OCIHandler) calculateBlobTimeout(sizeBytes int64) time.Duration {
 	return timeout
 }
 
+// sendUpstreamError maps an upstream fetch error to the response sent to the client:
+// upstream 404s (live or negatively cached) become MANIFEST_UNKNOWN/BLOB_UNKNOWN,
+// an open circuit breaker becomes 503 and an exhausted pull quota 429, both with
+// Retry-After; a proxy policy denial is a 403 DENIED naming the rule; anything else is a 502.
+func (h *OCIHandler) sendUpstreamError(c *fiber.Ctx, err error, registryURL, unknownCode string) error {
+	var denied *service.PolicyDeniedError
+	switch {
+	case errors.As(err, &denied):
+		if c.Method() == "HEAD" {
+			return c.Status(403).Send(nil)
+		}
+		return OCIError(c, 403, "DENIED", "image denied by proxy policy", fiber.Map{
+			"registry":   denied.Registry,
+			"repository": denied.Repository,
+			"reference":  denied.Reference,
+			"rule":       denied.Rule,
+		})
+	case errors.Is(err, service.ErrUpstreamNotFound):
+		if c.Method() == "HEAD" {
+			return c.Status(404).Send(nil)
+		}
+		return OCIError(c, 404, unknownCode, "not found on upstream registry", nil)
+	case errors.Is(err, service.ErrCircuitOpen):
+		retryAfter := h.proxyService.RetryAfter(registryURL)
+		c.Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		return OCIError(c, 503, "UNAVAILABLE", "upstream registry temporarily unavailable", fiber.Map{
+			"registry": registryURL,
+		})
+	case errors.Is(err, service.ErrRateLimited):
+		retryAfter := h.proxyService.RetryAfter(registryURL)
+		c.Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		return OCIError(c, 429, "TOOMANYREQUESTS", "upstream registry pull quota exhausted", fiber.Map{
+			"registry": registryURL,
+		})
+	}
+	return c.SendStatus(502)
+}
+
 // proxyBlob fetches a blob from upstream, caches it completely, then serves from cache.
 // Uses a distributed lock (Redis when enabled) to deduplicate concurrent pulls of the same
 // blob across replicas — critical for HA mode to avoid 2 pods downloading the same multi-GB
@@ -105,7 +143,7 @@ func (h *OCIHandler) proxyBlob(c *fiber.Ctx, name, digest string) error {
 	reader, size, err := h.proxyService.GetBlob(ctx, registryURL, upstreamName, digest)
 	if err != nil {
 		h.log.WithError(err).Error("Failed to fetch blob from upstream")
-		return c.SendStatus(502)
+		return h.sendUpstreamError(c, err, registryURL, "BLOB_UNKNOWN")
 	}
 	defer reader.Close()
 
@@ -154,48 +192,10 @@ func (h *OCIHandler) proxyBlob(c *fiber.Ctx, name, digest string) error {
 		return h.sendBlob(c, blobPath)
 	}
 
-	// Download to a local temp file, then import to backend
-	tempDir := filepath.Dir(h.pathManager.GetTempPath("proxy"))
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		h.log.WithError(err).Warn("Failed to create temp directory")
-	}
-
-	tmpFile, err := os.CreateTemp(tempDir, "proxy-blob-*")
-	if err != nil {
-		h.log.WithError(err).Warn("Failed to create blob cache file, streaming without caching")
-		c.Set("Docker-Content-Digest", digest)
-		c.Set("Content-Type", "application/octet-stream")
-		if size > 0 {
-			c.Set("Content-Length", fmt.Sprintf("%d", size))
-			return c.SendStream(reader, int(size))
-		}
-		return c.SendStream(reader)
-	}
-	tempPath := tmpFile.Name()
-
-	written, err := io.Copy(tmpFile, reader)
-	tmpFile.Close()
+	// Download to a local temp file, verify, then import to backend
+	written, err := service.ImportBlob(h.backend, h.pathManager, reader, digest, size)
 	if err != nil {
-		h.log.WithError(err).Error("Failed to download blob to cache")
-		os.Remove(tempPath)
-		return c.SendStatus(502)
-	}
-
-	// Verify size matches expected (if known) to detect truncated downloads
-	if size > 0 && written != size {
-		h.log.WithFields(logrus.Fields{
-			"digest":   digest,
-			"expected": size,
-			"written":  written,
-		}).Error("Blob size mismatch - download truncated")
-		os.Remove(tempPath)
-		return c.SendStatus(502)
-	}
-
-	// Import temp file to backend storage
-	if err := h.backend.Import(tempPath, blobPath); err != nil {
-		h.log.WithError(err).Error("Failed to import blob to storage")
-		os.Remove(tempPath)
+		h.log.WithError(err).WithField("digest", digest).Error("Failed to cache blob from upstream")
 		return c.SendStatus(502)
 	}
 
@@ -258,8 +258,14 @@ func (h *OCIHandler) proxyManifest(c *fiber.Ctx, name, reference string) error {
 
 	manifestData, contentType, err := h.proxyService.GetManifest(ctx, registryURL, upstreamName, reference)
 	if err != nil {
-		h.log.WithError(err).Error("Failed to fetch manifest from upstream")
-		return c.SendStatus(502)
+		if errors.Is(err, service.ErrUpstreamNotFound) {
+			h.log.WithError(err).Debug("Manifest not found on upstream")
+		} else if errors.Is(err, service.ErrPolicyDenied) {
+			h.log.WithError(err).Warn("Manifest pull denied by proxy policy")
+		} else {
+			h.log.WithError(err).Error("Failed to fetch manifest from upstream")
+		}
+		return h.sendUpstreamError(c, err, registryURL, "MANIFEST_UNKNOWN")
 	}
 
 	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifestData))
@@ -319,6 +325,7 @@ func (h *OCIHandler) cacheManifest(name, reference string, manifestData []byte,
 
 	isManifestList := manifest.MediaType == models.MediaTypeOCIManifestList ||
 		manifest.MediaType == models.MediaTypeDockerManifestList
+	artifactType := models.DetectArtifactType(&manifest)
 
 	if isManifestList {
 		var index models.OCIIndex
@@ -354,6 +361,22 @@ func (h *OCIHandler) cacheManifest(name, reference string, manifestData []byte,
 		}
 
 		go h.prefetchPlatformManifests(index, registryURL, upstreamName)
+	} else if artifactType == models.ArtifactTypeHelmChart {
+		// Helm charts are kept as raw OCI artifacts: they are listed with the charts, not the images
+		totalSize = manifest.GetTotalSize()
+		manifestPath := h.pathManager.GetImageManifestPath(name, reference)
+		if err := h.backend.Write(manifestPath, manifestData); err != nil {
+			h.log.WithError(err).Warn("Failed to save chart manifest")
+			return
+		}
+
+		// The chart archive and its config are small: fetch them now so the chart can be
+		// listed and served from index.yaml even before helm pulls the layer
+		for _, desc := range append([]models.OCIDescriptor{manifest.Config}, manifest.Layers...) {
+			if _, _, err := h.cacheUpstreamBlob(name, desc.Digest); err != nil {
+				h.log.WithError(err).WithField("digest", desc.Digest).Warn("Failed to cache chart blob")
+			}
+		}
 	} else {
 		totalSize = manifest.GetTotalSize()
 		if h.imageService != nil {
@@ -382,6 +405,9 @@ func (h *OCIHandler) cacheManifest(name, reference string, manifestData []byte,
 		LastAccessed:   time.Now(),
 		AccessCount:    1,
 	}
+	if artifactType == models.ArtifactTypeHelmChart {
+		cacheMetadata.ArtifactType = models.ArtifactTypeHelmChart
+	}
 
 	if err := h.proxyService.AddToCache(cacheMetadata); err != nil {
 		h.log.WithError(err).Warn("Failed to add to cache tracking")
@@ -396,6 +422,12 @@ func (h *OCIHandler) cacheManifest(name, reference string, manifestData []byte,
 
 // prefetchPlatformManifests pre-fetches and caches manifests for common platforms (amd64, arm64)
 func (h *OCIHandler) prefetchPlatformManifests(index models.OCIIndex, registryURL, upstreamName string) {
+	// Each prefetch counts as a pull against the upstream quota: keep what is left for real pulls
+	if h.proxyService.IsQuotaLow(registryURL) {
+		h.log.WithField("registry", registryURL).Info("Upstream pull quota low, skipping platform manifest prefetch")
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
@@ -498,7 +530,7 @@ func (h *OCIHandler) proxyHeadBlob(c *fiber.Ctx, name, digest string) error {
 	resp, err := h.proxyService.FetchWithAuth(ctx, req, registryURL, upstreamName)
 	if err != nil {
 		h.log.WithError(err).Error("Failed to HEAD blob from upstream")
-		return c.SendStatus(502)
+		return h.sendUpstreamError(c, err, registryURL, "BLOB_UNKNOWN")
 	}
 	defer resp.Body.Close()
 
@@ -513,3 +545,61 @@ func (h *OCIHandler) proxyHeadBlob(c *fiber.Ctx, name, digest string) error {
 
 	return c.SendStatus(resp.StatusCode)
 }
+
+// upstreamTags lists the tags of a proxied repository on its upstream registry.
+// Failures are logged and yield no tags so cached tags are still served.
+func (h *OCIHandler) upstreamTags(name string) []string {
+	registryURL, upstreamName, err := h.proxyService.ResolveRegistry(name)
+	if err != nil {
+		h.log.WithError(err).Debug("Failed to resolve registry for tags list")
+		return nil
+	}
+
+	timeout := time.Duration(h.config.Proxy.Timeout.ManifestSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tags, err := h.proxyService.ListUpstreamTags(ctx, registryURL, upstreamName)
+	if err != nil {
+		h.log.WithError(err).WithFields(logrus.Fields{
+			"registry": registryURL,
+			"name":     upstreamName,
+		}).Warn("Failed to list upstream tags, serving cached tags only")
+		return nil
+	}
+	return tags
+}
+
+// proxyCatalog passes a _catalog request through to a proxied registry.
+// Repository names are returned under the proxy/<registry>/ namespace so they can be pulled as-is.
+func (h *OCIHandler) proxyCatalog(c *fiber.Ctx, registry string) error {
+	var registryURL string
+	for _, reg := range h.config.Proxy.Registries {
+		if reg.Name == registry {
+			registryURL = reg.URL
+			break
+		}
+	}
+	if registryURL == "" {
+		return HTTPError(c, 404, "Unknown registry")
+	}
+
+	timeout := time.Duration(h.config.Proxy.Timeout.ManifestSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	upstreamRepos, err := h.proxyService.ListUpstreamCatalog(ctx, registryURL)
+	if err != nil {
+		h.log.WithError(err).WithField("registry", registryURL).Warn("Failed to list upstream catalog")
+		return h.sendUpstreamError(c, err, registryURL, "NAME_UNKNOWN")
+	}
+
+	repositories := make([]string, 0, len(upstreamRepos))
+	for _, repo := range upstreamRepos {
+		repositories = append(repositories, "proxy/"+registry+"/"+repo)
+	}
+
+	return c.JSON(fiber.Map{
+		"repositories": repositories,
+	})
+}
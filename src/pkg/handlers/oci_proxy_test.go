@@ -1,16 +1,25 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
 	"io"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"oci-storage/config"
 	"oci-storage/pkg/coordination"
 	"oci-storage/pkg/models"
+	service "oci-storage/pkg/services"
 	"oci-storage/pkg/storage"
 	"oci-storage/pkg/utils"
 
@@ -177,13 +186,11 @@ func TestFindManifestByDigest_ChecksBlobs(t *testing.T) {
 	// sha256 of manifestContent = d69e8ea6ee409e20a594645cd05d6eb0cb313e540f4d027a6492ad588aa2faff
 	digest := "sha256:d69e8ea6ee409e20a594645cd05d6eb0cb313e540f4d027a6492ad588aa2faff"
 
-	// PathManager stores blobs at blobs/{full_digest} including sha256: prefix
-	blobDir := filepath.Join(tempDir, "blobs")
-	err := os.MkdirAll(blobDir, 0755)
+	// PathManager stores blobs sharded by digest: blobs/sha256/<ab>/<cd>/<hex>
+	blobPath := filepath.Join(tempDir, handler.pathManager.GetBlobPath(digest))
+	err := os.MkdirAll(filepath.Dir(blobPath), 0755)
 	assert.NoError(t, err)
 
-	// Store with full digest (sha256:hash)
-	blobPath := filepath.Join(blobDir, digest)
 	err = os.WriteFile(blobPath, manifestContent, 0644)
 	assert.NoError(t, err)
 
@@ -207,10 +214,10 @@ func TestGetBlob_LocalFound(t *testing.T) {
 	digest := "sha256:abc123def456abc123def456abc123def456abc123def456abc123def456abcd"
 
 	// Create blob file locally
-	blobDir := filepath.Join(tempDir, "blobs")
-	err := os.MkdirAll(blobDir, 0755)
+	blobPath := filepath.Join(tempDir, handler.pathManager.GetBlobPath(digest))
+	err := os.MkdirAll(filepath.Dir(blobPath), 0755)
 	assert.NoError(t, err)
-	err = os.WriteFile(filepath.Join(blobDir, digest), blobContent, 0644)
+	err = os.WriteFile(blobPath, blobContent, 0644)
 	assert.NoError(t, err)
 
 	// Proxy should not be called when blob exists locally
@@ -224,6 +231,70 @@ func TestGetBlob_LocalFound(t *testing.T) {
 	assert.Equal(t, digest, resp.Header.Get("Docker-Content-Digest"))
 }
 
+// presigningBackend is a local backend able to presign URLs, standing in for object storage
+type presigningBackend struct {
+	*storage.LocalBackend
+	ttl time.Duration
+}
+
+func (b *presigningBackend) PresignGet(path string, ttl time.Duration) (string, error) {
+	b.ttl = ttl
+	return "https://bucket.example.com/" + filepath.ToSlash(path) + "?signature=abc", nil
+}
+
+func TestGetBlob_RedirectsToPresignedURL(t *testing.T) {
+	app, _, _, mockProxyService, handler, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	app.Get("/v2/:name/blobs/:digest", handler.GetBlob)
+	mockProxyService.On("IsEnabled").Return(true).Maybe()
+
+	blobContent := []byte("test blob content")
+	digest := "sha256:abc123def456abc123def456abc123def456abc123def456abc123def456abcd"
+	blobPath := handler.pathManager.GetBlobPath(digest)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tempDir, blobPath)), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, blobPath), blobContent, 0644))
+
+	backend := &presigningBackend{LocalBackend: storage.NewLocalBackend(tempDir)}
+	handler.backend = backend
+	handler.config.Storage.Redirect = config.BlobRedirectConfig{
+		Enabled:            true,
+		TTLSeconds:         120,
+		StreamUserAgents:   []string{"legacy-client"},
+		StreamRepositories: []string{"internal"},
+	}
+
+	get := func(path, userAgent string) *http.Response {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", userAgent)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := get("/v2/nginx/blobs/"+digest, "docker/27.0")
+	assert.Equal(t, 307, resp.StatusCode)
+	assert.Equal(t, "https://bucket.example.com/"+blobPath+"?signature=abc", resp.Header.Get("Location"))
+	assert.Equal(t, digest, resp.Header.Get("Docker-Content-Digest"))
+	assert.Equal(t, 120*time.Second, backend.ttl)
+
+	// Clients that can't follow redirects and excluded repositories are streamed
+	for _, tc := range []struct{ path, userAgent string }{
+		{"/v2/nginx/blobs/" + digest, "legacy-client/1.2"},
+		{"/v2/internal-tools/blobs/" + digest, "docker/27.0"},
+	} {
+		resp := get(tc.path, tc.userAgent)
+		assert.Equal(t, 200, resp.StatusCode, tc.path)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, blobContent, body)
+	}
+
+	// Disabled redirects stream as before
+	handler.config.Storage.Redirect.Enabled = false
+	resp = get("/v2/nginx/blobs/"+digest, "docker/27.0")
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
 func TestGetBlob_ProxyTriggered(t *testing.T) {
 	// This test verifies that the proxy is called when blob is not found locally
 	app, _, _, mockProxyService, handler, _, cleanup := setupProxyTestEnv(t)
@@ -319,6 +390,7 @@ func TestMultiArchManifestFlow(t *testing.T) {
 		Return(archManifest, "application/vnd.oci.image.manifest.v1+json", nil)
 	mockProxyService.On("AddToCache", mock.Anything).Return(nil)
 	mockProxyService.On("UpdateAccessTime", mock.Anything, mock.Anything).Return()
+	mockProxyService.On("IsQuotaLow", mock.Anything).Return(false).Maybe()
 	mockImageService.On("SaveImage", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
 	mockImageService.On("SaveImageIndex", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
 
@@ -532,6 +604,8 @@ func TestDeepNestedPath_4Segments_ListTags(t *testing.T) {
 	mockImageService.On("ListTags", "proxy/docker.io/library/nginx").Return([]string{}, nil)
 	// Mock ListCharts to return empty slice (not nil - handler iterates over this)
 	mockChartService.On("ListCharts").Return([]models.ChartGroup{}, nil)
+	mockProxyService.On("ResolveRegistry", "proxy/docker.io/library/nginx").Return("https://registry-1.docker.io", "library/nginx", nil)
+	mockProxyService.On("ListUpstreamTags", mock.Anything, "https://registry-1.docker.io", "library/nginx").Return([]string{}, nil)
 
 	req := httptest.NewRequest("GET", "/v2/proxy/docker.io/library/nginx/tags/list", nil)
 	resp, err := app.Test(req)
@@ -539,3 +613,673 @@ func TestDeepNestedPath_4Segments_ListTags(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 200, resp.StatusCode)
 }
+
+func TestListTags_MergesUpstreamTags(t *testing.T) {
+	app, mockChartService, mockImageService, mockProxyService, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	app.Get("/v2/:ns1/:ns2/:ns3/:name/tags/list", handler.HandleListTagsDeepNested4)
+
+	mockProxyService.On("IsEnabled").Return(true)
+	mockImageService.On("ListTags", "proxy/docker.io/library/nginx").Return([]string{"alpine"}, nil)
+	mockChartService.On("ListCharts").Return([]models.ChartGroup{}, nil)
+	mockProxyService.On("ResolveRegistry", "proxy/docker.io/library/nginx").Return("https://registry-1.docker.io", "library/nginx", nil)
+	mockProxyService.On("ListUpstreamTags", mock.Anything, "https://registry-1.docker.io", "library/nginx").
+		Return([]string{"1.25", "1.27", "alpine", "latest"}, nil)
+
+	req := httptest.NewRequest("GET", "/v2/proxy/docker.io/library/nginx/tags/list?n=2", nil)
+	resp, err := app.Test(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, `</v2/proxy/docker.io/library/nginx/tags/list?n=2&last=1.27>; rel="next"`, resp.Header.Get("Link"))
+
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, []string{"1.25", "1.27"}, body.Tags)
+}
+
+func TestHandleManifest_UpstreamNotFound(t *testing.T) {
+	app, _, _, mockProxyService, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	app.Get("/v2/:ns1/:ns2/:ns3/:name/manifests/:reference", handler.HandleManifestDeepNested4)
+
+	mockProxyService.On("IsEnabled").Return(true)
+	mockProxyService.On("ResolveRegistry", "proxy/docker.io/library/nginx").Return("https://registry-1.docker.io", "library/nginx", nil)
+	mockProxyService.On("GetManifest", mock.Anything, "https://registry-1.docker.io", "library/nginx", "no-such-tag").
+		Return(nil, "", fmt.Errorf("%w: library/nginx:no-such-tag", service.ErrUpstreamNotFound))
+
+	req := httptest.NewRequest("GET", "/v2/proxy/docker.io/library/nginx/manifests/no-such-tag", nil)
+	resp, err := app.Test(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "MANIFEST_UNKNOWN")
+}
+
+func TestHandleManifest_CircuitOpen(t *testing.T) {
+	app, _, _, mockProxyService, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	app.Get("/v2/:ns1/:ns2/:ns3/:name/manifests/:reference", handler.HandleManifestDeepNested4)
+
+	mockProxyService.On("IsEnabled").Return(true)
+	mockProxyService.On("ResolveRegistry", "proxy/docker.io/library/nginx").Return("https://registry-1.docker.io", "library/nginx", nil)
+	mockProxyService.On("GetManifest", mock.Anything, "https://registry-1.docker.io", "library/nginx", "latest").
+		Return(nil, "", fmt.Errorf("failed to fetch manifest: %w", service.ErrCircuitOpen))
+	mockProxyService.On("RetryAfter", "https://registry-1.docker.io").Return(20 * time.Second)
+
+	req := httptest.NewRequest("GET", "/v2/proxy/docker.io/library/nginx/manifests/latest", nil)
+	resp, err := app.Test(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, "21", resp.Header.Get("Retry-After"))
+}
+
+func TestHandleManifest_MirrorNamespace(t *testing.T) {
+	app, _, mockImageService, mockProxyService, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	app.Get("/v2/:namespace/:name/manifests/:reference", handler.HandleManifestNested)
+
+	upstreamManifest := []byte(`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.manifest.v1+json"}`)
+
+	// containerd mirror request: /v2/library/nginx/manifests/latest?ns=docker.io
+	mockProxyService.On("IsEnabled").Return(true)
+	mockProxyService.On("ResolveRegistry", "proxy/docker.io/library/nginx").Return("https://registry-1.docker.io", "library/nginx", nil)
+	mockProxyService.On("GetManifest", mock.Anything, "https://registry-1.docker.io", "library/nginx", "latest").
+		Return(upstreamManifest, "application/vnd.oci.image.manifest.v1+json", nil)
+	mockProxyService.On("AddToCache", mock.Anything).Return(nil).Maybe()
+	mockImageService.On("SaveImage", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	req := httptest.NewRequest("GET", "/v2/library/nginx/manifests/latest?ns=docker.io", nil)
+	resp, err := app.Test(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	mockProxyService.AssertCalled(t, "ResolveRegistry", "proxy/docker.io/library/nginx")
+
+	// Wait for background goroutine
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestHandleManifest_MirrorForFallback(t *testing.T) {
+	app, _, mockImageService, mockProxyService, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	handler.config.Proxy.MirrorFor = "docker.io"
+	app.Get("/v2/:name/manifests/:reference", handler.HandleManifest)
+
+	upstreamManifest := []byte(`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.manifest.v1+json"}`)
+
+	// Docker registry-mirrors request without ns: not found locally, served from docker.io
+	mockProxyService.On("IsEnabled").Return(true)
+	mockProxyService.On("ResolveRegistry", "proxy/docker.io/library/redis").Return("https://registry-1.docker.io", "library/redis", nil)
+	mockProxyService.On("GetManifest", mock.Anything, "https://registry-1.docker.io", "library/redis", "7").
+		Return(upstreamManifest, "application/vnd.oci.image.manifest.v1+json", nil)
+	mockProxyService.On("AddToCache", mock.Anything).Return(nil).Maybe()
+	mockImageService.On("SaveImage", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	req := httptest.NewRequest("GET", "/v2/redis/manifests/7", nil)
+	resp, err := app.Test(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	mockProxyService.AssertCalled(t, "ResolveRegistry", "proxy/docker.io/library/redis")
+
+	// Wait for background goroutine
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestHeadBlob_MirrorForSkipsLocalRepository(t *testing.T) {
+	app, _, _, mockProxyService, handler, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	handler.config.Proxy.MirrorFor = "docker.io"
+	app.Head("/v2/:name/blobs/:digest", handler.HeadBlob)
+
+	// A repository already pushed locally
+	manifestDir := filepath.Join(tempDir, "images", "myapp", "manifests")
+	assert.NoError(t, os.MkdirAll(manifestDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(manifestDir, "v1.json"), []byte(`{"schemaVersion": 2}`), 0644))
+
+	mockProxyService.On("IsEnabled").Return(true)
+
+	// Pushing the next version checks its layers first: a miss is not looked up upstream
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	req := httptest.NewRequest("HEAD", "/v2/myapp/blobs/"+digest, nil)
+	resp, err := app.Test(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+	mockProxyService.AssertNotCalled(t, "ResolveRegistry", mock.Anything)
+	mockProxyService.AssertNotCalled(t, "FetchWithAuth", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleManifest_UpstreamRateLimited(t *testing.T) {
+	app, _, _, mockProxyService, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	app.Get("/v2/:ns1/:ns2/:ns3/:name/manifests/:reference", handler.HandleManifestDeepNested4)
+
+	mockProxyService.On("IsEnabled").Return(true)
+	mockProxyService.On("ResolveRegistry", "proxy/docker.io/library/nginx").Return("https://registry-1.docker.io", "library/nginx", nil)
+	mockProxyService.On("GetManifest", mock.Anything, "https://registry-1.docker.io", "library/nginx", "latest").
+		Return(nil, "", fmt.Errorf("failed to fetch manifest: %w", service.ErrRateLimited))
+	mockProxyService.On("RetryAfter", "https://registry-1.docker.io").Return(90 * time.Second)
+
+	req := httptest.NewRequest("GET", "/v2/proxy/docker.io/library/nginx/manifests/latest", nil)
+	resp, err := app.Test(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "91", resp.Header.Get("Retry-After"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "TOOMANYREQUESTS")
+}
+
+func TestHandleManifest_PolicyDenied(t *testing.T) {
+	app, _, _, mockProxyService, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	app.Get("/v2/:ns1/:ns2/:ns3/:name/manifests/:reference", handler.HandleManifestDeepNested4)
+
+	mockProxyService.On("IsEnabled").Return(true)
+	mockProxyService.On("ResolveRegistry", "proxy/docker.io/library/nginx").Return("https://registry-1.docker.io", "library/nginx", nil)
+	mockProxyService.On("GetManifest", mock.Anything, "https://registry-1.docker.io", "library/nginx", "latest").
+		Return(nil, "", &service.PolicyDeniedError{
+			Registry:   "docker.io",
+			Repository: "library/nginx",
+			Reference:  "latest",
+			Rule:       `deny[0] "no-latest"`,
+		})
+
+	req := httptest.NewRequest("GET", "/v2/proxy/docker.io/library/nginx/manifests/latest", nil)
+	resp, err := app.Test(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "DENIED")
+	assert.Contains(t, string(body), "no-latest")
+}
+
+func TestProxyService_PolicyEvaluatedBeforeFetch(t *testing.T) {
+	_, _, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	cfg := *handler.config
+	cfg.Proxy.Registries = append(cfg.Proxy.Registries, config.RegistryConfig{Name: "ghcr.io", URL: "https://ghcr.io"})
+	cfg.Proxy.Policy = config.ProxyPolicyConfig{
+		Allow: []config.ProxyPolicyRule{
+			{Registry: "docker.io", Repository: "library/*"},
+			{Registry: "ghcr.io", Repository: "regex:my-org/(api|web)"},
+		},
+		Deny: []config.ProxyPolicyRule{
+			{Name: "no-latest", Tag: "latest"},
+		},
+	}
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+
+	tests := []struct {
+		name        string
+		registryURL string
+		repository  string
+		reference   string
+		rule        string
+	}{
+		{"deny rule wins over allow", "https://registry-1.docker.io", "library/nginx", "latest", `deny[0] "no-latest"`},
+		{"repository outside allow list", "https://registry-1.docker.io", "bitnami/redis", "7.2", "no allow rule matched"},
+		{"regex allow rule", "https://ghcr.io", "my-org/other", "v1", "no allow rule matched"},
+		{"unconfigured registry", "https://quay.io", "my-org/api", "v1", "no allow rule matched"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Denied before any request is sent, so no upstream is needed
+			_, _, err := proxyService.GetManifest(context.Background(), tt.registryURL, tt.repository, tt.reference)
+
+			var denied *service.PolicyDeniedError
+			if assert.ErrorAs(t, err, &denied) {
+				assert.Equal(t, tt.rule, denied.Rule)
+				assert.ErrorIs(t, err, service.ErrPolicyDenied)
+			}
+		})
+	}
+}
+
+func TestProxyService_CatalogFilteredByPolicy(t *testing.T) {
+	_, _, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/_catalog" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/_catalog?last=my-org%2Fapi&n=2>; rel="next"`)
+			w.Write([]byte(`{"repositories": ["my-org/api", "my-org/internal"]}`))
+			return
+		}
+		w.Write([]byte(`{"repositories": ["my-org/web", "other/tool"]}`))
+	}))
+	defer upstream.Close()
+
+	cfg := *handler.config
+	cfg.Proxy.Registries = []config.RegistryConfig{{Name: "internal", URL: upstream.URL}}
+	cfg.Proxy.Policy = config.ProxyPolicyConfig{
+		Allow: []config.ProxyPolicyRule{{Registry: "internal", Repository: "my-org/*"}},
+		Deny:  []config.ProxyPolicyRule{{Repository: "my-org/internal"}},
+	}
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+
+	// Every page is filtered per repository, not only the listing request itself
+	repos, err := proxyService.ListUpstreamCatalog(context.Background(), upstream.URL)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"my-org/api", "my-org/web"}, repos)
+}
+
+func TestProxyService_UpstreamTLSOptions(t *testing.T) {
+	_, _, _, _, handler, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	manifest := `{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.manifest.v1+json"}`
+	registry := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Write([]byte(manifest))
+	})
+
+	tlsServer := httptest.NewTLSServer(registry)
+	defer tlsServer.Close()
+	plainServer := httptest.NewServer(registry)
+	defer plainServer.Close()
+
+	caFile := filepath.Join(tempDir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, caPEM, 0644))
+
+	plainURL := strings.Replace(plainServer.URL, "http://", "https://", 1)
+
+	cfg := *handler.config
+	cfg.Proxy.Registries = []config.RegistryConfig{
+		{Name: "private.example.com", URL: tlsServer.URL, TLS: &config.RegistryTLSConfig{CAFile: caFile}},
+		{Name: "untrusted.example.com", URL: tlsServer.URL + "/"},
+		{Name: "insecure.example.com", URL: plainURL, TLS: &config.RegistryTLSConfig{PlainHTTP: true}},
+	}
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+
+	// Custom CA bundle
+	data, _, err := proxyService.GetManifest(context.Background(), tlsServer.URL, "app", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, string(data))
+
+	// Same server without the CA bundle: certificate is rejected
+	_, _, err = proxyService.GetManifest(context.Background(), tlsServer.URL+"/", "app", "v1")
+	assert.Error(t, err)
+
+	// Plain HTTP to an https:// URL
+	data, _, err = proxyService.GetManifest(context.Background(), plainURL, "app", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, string(data))
+}
+
+func TestProxyService_EndpointFailover(t *testing.T) {
+	_, _, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	var failingHits, mirrorHits int
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failingHits++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	// Refuses connections
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	// Asks for the registry credentials, inherited by endpoints without their own
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorHits++
+		if user, pass, ok := r.BasicAuth(); !ok || user != "puller" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mirror"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Write([]byte(`{"schemaVersion":2}`))
+	}))
+	defer mirror.Close()
+
+	cfg := *handler.config
+	cfg.Proxy.CircuitBreaker = config.CircuitBreakerConfig{FailureThreshold: 1, OpenSeconds: 60}
+	cfg.Proxy.Registries = []config.RegistryConfig{{
+		Name:     "private.io",
+		URL:      "https://private.io",
+		Username: "puller",
+		Password: "secret",
+		Endpoints: []config.RegistryEndpoint{
+			{URL: failing.URL},
+			{URL: unreachable.URL},
+			{URL: mirror.URL},
+		},
+	}}
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+
+	// A 5xx and a connection error fail over to the next endpoint
+	data, _, err := proxyService.GetManifest(context.Background(), "https://private.io", "team/app", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"schemaVersion":2}`, string(data))
+	assert.Equal(t, 1, failingHits)
+	assert.Equal(t, 2, mirrorHits)
+
+	// Endpoints whose breaker opened are skipped
+	_, _, err = proxyService.GetManifest(context.Background(), "https://private.io", "team/app", "v2")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failingHits)
+	assert.Equal(t, 3, mirrorHits)
+}
+
+func TestProxyService_CircuitBreakerTransitions(t *testing.T) {
+	_, _, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	var hits atomic.Int32
+	var healthy atomic.Bool
+	probing, release := make(chan struct{}, 1), make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// Holds the half-open probe until the test has tried a second request
+		probing <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Write([]byte(`{"schemaVersion":2}`))
+	}))
+	defer upstream.Close()
+
+	cfg := *handler.config
+	cfg.Proxy.CircuitBreaker = config.CircuitBreakerConfig{FailureThreshold: 2, OpenSeconds: 1}
+	cfg.Proxy.Registries = []config.RegistryConfig{{Name: "flaky.io", URL: upstream.URL}}
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+	get := func() error {
+		_, _, err := proxyService.GetManifest(context.Background(), upstream.URL, "team/app", "v1")
+		return err
+	}
+	breakerState := func() string { return proxyService.GetUpstreamStatus()[0].Endpoints[0].BreakerState }
+
+	// Closed until the threshold is reached, then open: calls fail fast
+	assert.Error(t, get())
+	assert.Equal(t, service.BreakerClosed, breakerState())
+	assert.Error(t, get())
+	assert.Equal(t, service.BreakerOpen, breakerState())
+	assert.ErrorIs(t, get(), service.ErrCircuitOpen)
+	assert.Equal(t, int32(2), hits.Load())
+
+	// Half-open once the open period elapsed: a failed probe re-opens it
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, service.BreakerHalfOpen, breakerState())
+	assert.Error(t, get())
+	assert.Equal(t, int32(3), hits.Load())
+	assert.ErrorIs(t, get(), service.ErrCircuitOpen)
+
+	// A single probe is let through while half-open, and closes the breaker on success
+	time.Sleep(1100 * time.Millisecond)
+	healthy.Store(true)
+	probe := make(chan error)
+	go func() { probe <- get() }()
+	<-probing
+	assert.ErrorIs(t, get(), service.ErrCircuitOpen)
+	close(release)
+	assert.NoError(t, <-probe)
+	assert.Equal(t, int32(4), hits.Load())
+	assert.Equal(t, service.BreakerClosed, breakerState())
+
+	go func() { <-probing }()
+	assert.NoError(t, get())
+	assert.Equal(t, int32(5), hits.Load())
+}
+
+func TestProxyService_NegativeCache(t *testing.T) {
+	_, _, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	hits := make(map[string]int)
+	var mu sync.Mutex
+	handle := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.Host+r.URL.Path]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	})
+	upstream := httptest.NewServer(handle)
+	defer upstream.Close()
+	other := httptest.NewServer(handle)
+	defer other.Close()
+	hitsOf := func(registryURL, path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[strings.TrimPrefix(registryURL, "http://")+path]
+	}
+
+	cfg := *handler.config
+	cfg.Proxy.Cache.NegativeTTLSeconds = 1
+	cfg.Proxy.Registries = []config.RegistryConfig{{Name: "upstream.io", URL: upstream.URL}, {Name: "other.io", URL: other.URL}}
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+	get := func(registryURL, name, reference string) {
+		_, _, err := proxyService.GetManifest(context.Background(), registryURL, name, reference)
+		assert.ErrorIs(t, err, service.ErrUpstreamNotFound)
+	}
+
+	// A 404 is remembered for registry/name:reference only
+	get(upstream.URL, "team/app", "missing")
+	get(upstream.URL, "team/app", "missing")
+	assert.Equal(t, 1, hitsOf(upstream.URL, "/v2/team/app/manifests/missing"))
+	get(upstream.URL, "team/app", "other")
+	get(upstream.URL, "team/web", "missing")
+	get(other.URL, "team/app", "missing")
+	assert.Equal(t, 1, hitsOf(upstream.URL, "/v2/team/app/manifests/other"))
+	assert.Equal(t, 1, hitsOf(upstream.URL, "/v2/team/web/manifests/missing"))
+	assert.Equal(t, 1, hitsOf(other.URL, "/v2/team/app/manifests/missing"))
+	assert.Equal(t, 3, proxyService.GetUpstreamStatus()[0].NegativeCacheEntries)
+	assert.Equal(t, 1, proxyService.GetUpstreamStatus()[1].NegativeCacheEntries)
+
+	// Upstream is asked again once the TTL expired
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, 0, proxyService.GetUpstreamStatus()[0].NegativeCacheEntries)
+	get(upstream.URL, "team/app", "missing")
+	assert.Equal(t, 2, hitsOf(upstream.URL, "/v2/team/app/manifests/missing"))
+
+	// A negative TTL disables the negative cache
+	cfg.Proxy.Cache.NegativeTTLSeconds = -1
+	proxyService = service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+	get(upstream.URL, "team/app", "gone")
+	get(upstream.URL, "team/app", "gone")
+	assert.Equal(t, 2, hitsOf(upstream.URL, "/v2/team/app/manifests/gone"))
+	assert.Equal(t, 0, proxyService.GetUpstreamStatus()[0].NegativeCacheEntries)
+}
+
+func TestProxyService_TokenReuse(t *testing.T) {
+	_, _, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	// Token lifetimes per repository, as returned in expires_in
+	expiresIn := map[string]int{"team/app": 300, "team/web": 300, "team/short": 1}
+	var mu sync.Mutex
+	realmHits := make(map[string]int)
+	challenges := 0
+	issued := make(map[string]string) // token -> scope
+	var upstream *httptest.Server
+	upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/token" {
+			scope := r.URL.Query().Get("scope")
+			realmHits[scope]++
+			token := fmt.Sprintf("%s#%d", scope, realmHits[scope])
+			issued[token] = scope
+			repo := strings.TrimSuffix(strings.TrimPrefix(scope, "repository:"), ":pull")
+			json.NewEncoder(w).Encode(map[string]any{"token": token, "expires_in": expiresIn[repo]})
+			return
+		}
+		repo := strings.TrimPrefix(r.URL.Path[:strings.Index(r.URL.Path, "/manifests/")], "/v2/")
+		scope := "repository:" + repo + ":pull"
+		if issued[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] != scope {
+			challenges++
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="%s"`, upstream.URL, scope))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Write([]byte(`{"schemaVersion":2}`))
+	}))
+	defer upstream.Close()
+	// Same registry behind another URL: tokens are not shared across registries
+	other := httptest.NewServer(upstream.Config.Handler)
+	defer other.Close()
+	hits := func(repo string) (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return realmHits["repository:"+repo+":pull"], challenges
+	}
+
+	cfg := *handler.config
+	cfg.Proxy.Registries = []config.RegistryConfig{{Name: "auth.io", URL: upstream.URL}, {Name: "other.io", URL: other.URL}}
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+	get := func(registryURL, name, reference string) {
+		data, _, err := proxyService.GetManifest(context.Background(), registryURL, name, reference)
+		assert.NoError(t, err, name+":"+reference)
+		assert.Equal(t, `{"schemaVersion":2}`, string(data))
+	}
+
+	// One token per registry and scope, sent up front once obtained
+	get(upstream.URL, "team/app", "v1")
+	get(upstream.URL, "team/app", "v2")
+	get(upstream.URL, "team/app", "v3")
+	realm, challenged := hits("team/app")
+	assert.Equal(t, 1, realm)
+	assert.Equal(t, 1, challenged)
+
+	get(upstream.URL, "team/web", "v1")
+	realm, challenged = hits("team/web")
+	assert.Equal(t, 1, realm)
+	assert.Equal(t, 2, challenged)
+
+	get(other.URL, "team/app", "v1")
+	realm, challenged = hits("team/app")
+	assert.Equal(t, 2, realm)
+	assert.Equal(t, 3, challenged)
+
+	// Tokens are dropped once expires_in (less a margin) has passed
+	get(upstream.URL, "team/short", "v1")
+	time.Sleep(time.Second)
+	get(upstream.URL, "team/short", "v2")
+	realm, _ = hits("team/short")
+	assert.Equal(t, 2, realm)
+	get(upstream.URL, "team/app", "v4")
+	realm, _ = hits("team/app")
+	assert.Equal(t, 2, realm)
+}
+
+func TestProxyService_RateLimitBackoff(t *testing.T) {
+	_, _, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	// The primary advertises its quota through RateLimit-* headers, the mirror does not
+	var mu sync.Mutex
+	primaryHits, mirrorHits := 0, 0
+	quota := map[string]string{"RateLimit-Limit": "100;w=21600", "RateLimit-Remaining": "50;w=21600", "RateLimit-Reset": "3600"}
+	manifest := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Write([]byte(`{"schemaVersion":2}`))
+	}
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		primaryHits++
+		for k, v := range quota {
+			w.Header().Set(k, v)
+		}
+		mu.Unlock()
+		manifest(w)
+	}))
+	defer primary.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		mirrorHits++
+		mu.Unlock()
+		manifest(w)
+	}))
+	defer mirror.Close()
+	setQuota := func(remaining, reset string) {
+		mu.Lock()
+		defer mu.Unlock()
+		quota["RateLimit-Remaining"], quota["RateLimit-Reset"] = remaining, reset
+	}
+	counts := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return primaryHits, mirrorHits
+	}
+
+	cfg := *handler.config
+	cfg.Proxy.RateLimit = config.RateLimitConfig{LowWatermark: 10, BackoffSeconds: 60}
+	cfg.Proxy.Registries = []config.RegistryConfig{
+		{Name: "hub.io", URL: "https://hub.io", Endpoints: []config.RegistryEndpoint{{URL: primary.URL}, {URL: mirror.URL}}},
+		{Name: "solo.io", URL: primary.URL},
+	}
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+	get := func(registryURL string) error {
+		_, _, err := proxyService.GetManifest(context.Background(), registryURL, "team/app", fmt.Sprintf("v%d", time.Now().UnixNano()))
+		return err
+	}
+
+	// Limit, remaining and a delta-seconds reset are recorded
+	assert.NoError(t, get("https://hub.io"))
+	rateLimit := proxyService.GetUpstreamStatus()[0].Endpoints[0].RateLimit
+	if assert.NotNil(t, rateLimit) && assert.NotNil(t, rateLimit.Reset) {
+		assert.Equal(t, 100, rateLimit.Limit)
+		assert.Equal(t, 50, rateLimit.Remaining)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *rateLimit.Reset, 5*time.Second)
+	}
+	assert.Nil(t, proxyService.GetUpstreamStatus()[0].Endpoints[1].RateLimit)
+
+	// Below the watermark the primary is tried last, before its quota runs out
+	setQuota("5;w=21600", "3600")
+	assert.NoError(t, get("https://hub.io"))
+	assert.NoError(t, get("https://hub.io"))
+	assert.NoError(t, get("https://hub.io"))
+	primaryCalls, mirrorCalls := counts()
+	assert.Equal(t, 2, primaryCalls)
+	assert.Equal(t, 2, mirrorCalls)
+	assert.False(t, proxyService.IsQuotaLow("https://hub.io"))
+	assert.True(t, proxyService.IsQuotaLow(primary.URL))
+
+	// An exhausted quota holds requests back until its reset, given as a unix timestamp
+	reset := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	setQuota("0", fmt.Sprint(reset.Unix()))
+	assert.NoError(t, get(primary.URL))
+	primaryCalls, _ = counts()
+	assert.Equal(t, 3, primaryCalls)
+	assert.ErrorIs(t, get(primary.URL), service.ErrRateLimited)
+	primaryCalls, _ = counts()
+	assert.Equal(t, 3, primaryCalls)
+	rateLimit = proxyService.GetUpstreamStatus()[1].Endpoints[0].RateLimit
+	if assert.NotNil(t, rateLimit) && assert.NotNil(t, rateLimit.Reset) {
+		assert.Equal(t, 0, rateLimit.Remaining)
+		assert.True(t, reset.Equal(*rateLimit.Reset))
+	}
+
+	// The registry keeps pulling through the mirror
+	assert.NoError(t, get("https://hub.io"))
+	_, mirrorCalls = counts()
+	assert.Equal(t, 3, mirrorCalls)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	service "oci-storage/pkg/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// patchSessionUpload appends a PATCH chunk to an upload session kept in object storage
+func (h *OCIHandler) patchSessionUpload(c *fiber.Ctx, name, uuid string) error {
+	written, size, err := h.uploads.Append(c.Context(), uuid, c.Request().BodyStream())
+	if err != nil {
+		return h.uploadSessionError(c, uuid, err)
+	}
+	if written == 0 {
+		h.log.WithFunc().Error("Received empty body")
+		return HTTPError(c, 400, "Empty body")
+	}
+
+	h.log.WithFunc().WithFields(logrus.Fields{
+		"uuid":  uuid,
+		"bytes": written,
+		"size":  size,
+	}).Info("Successfully processed PATCH data")
+
+	// Build absolute URL for Location header (required by OCI clients like crane)
+	scheme := "http"
+	if c.Protocol() == "https" {
+		scheme = "https"
+	}
+	c.Set("Location", fmt.Sprintf("%s://%s/v2/%s/blobs/uploads/%s", scheme, c.Hostname(), name, uuid))
+	c.Set("Docker-Upload-UUID", uuid)
+	c.Set("Range", fmt.Sprintf("0-%d", size-1))
+	return c.SendStatus(202)
+}
+
+// completeSessionUpload adds the final chunk of an upload session and stores the blob
+func (h *OCIHandler) completeSessionUpload(c *fiber.Ctx, name, uuid, digest string) error {
+	// Idempotent: if blob already exists at final path, skip processing
+	if _, err := h.backend.Stat(h.pathManager.GetBlobPath(digest)); err == nil {
+		h.log.WithFunc().WithField("digest", digest).Info("Blob already exists, skipping upload")
+		if err := h.uploads.Discard(uuid); err != nil {
+			h.log.WithError(err).WithField("uuid", uuid).Warn("Failed to discard upload session")
+		}
+		c.Set("Docker-Content-Digest", digest)
+		return c.SendStatus(201)
+	}
+
+	if err := h.uploads.Complete(c.Context(), uuid, digest, c.Request().BodyStream()); err != nil {
+		return h.uploadSessionError(c, uuid, err)
+	}
+
+	c.Set("Docker-Content-Digest", digest)
+	h.log.WithFunc().WithField("name", name).Info("Upload completed successfully")
+	return c.SendStatus(201)
+}
+
+// uploadSessionError maps upload service errors to OCI error responses
+func (h *OCIHandler) uploadSessionError(c *fiber.Ctx, uuid string, err error) error {
+	switch {
+	case errors.Is(err, service.ErrUploadUnknown):
+		return HTTPError(c, 404, fmt.Sprintf("BLOB_UPLOAD_UNKNOWN: %s", uuid))
+	case errors.Is(err, service.ErrUploadInProgress):
+		return HTTPError(c, 409, fmt.Sprintf("UPLOAD_INVALID: %s", err.Error()))
+	case errors.Is(err, service.ErrDigestMismatch):
+		h.log.WithFunc().WithError(err).Error("Blob digest mismatch - uploaded content does not match declared digest")
+		return HTTPError(c, 400, fmt.Sprintf("DIGEST_INVALID: %s", err.Error()))
+	}
+	h.log.WithFunc().WithError(err).WithField("uuid", uuid).Error("Failed to write upload session")
+	return c.SendStatus(500)
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"oci-storage/pkg/coordination"
+	service "oci-storage/pkg/services"
+	"oci-storage/pkg/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// multipartBackend is a local backend with in-memory multipart uploads, standing in for S3
+type multipartBackend struct {
+	*storage.LocalBackend
+	partSize int64
+	uploads  map[string]map[int][]byte
+	aborted  int
+}
+
+func (b *multipartBackend) PartSize() int64 { return b.partSize }
+
+func (b *multipartBackend) CreateMultipart(path string) (string, error) {
+	id := fmt.Sprintf("upload-%d", len(b.uploads)+1)
+	b.uploads[id] = map[int][]byte{}
+	return id, nil
+}
+
+func (b *multipartBackend) UploadPart(path, uploadID string, number int, data []byte) (string, error) {
+	b.uploads[uploadID][number] = append([]byte(nil), data...)
+	return fmt.Sprintf("etag-%d", number), nil
+}
+
+func (b *multipartBackend) CompleteMultipart(path, uploadID string, parts []storage.CompletedPart) error {
+	var data []byte
+	for _, part := range parts {
+		data = append(data, b.uploads[uploadID][part.Number]...)
+	}
+	delete(b.uploads, uploadID)
+	return b.Write(path, data)
+}
+
+func (b *multipartBackend) AbortMultipart(path, uploadID string) error {
+	delete(b.uploads, uploadID)
+	b.aborted++
+	return nil
+}
+
+// otherPodUploadTracker claims every upload belongs to another replica
+type otherPodUploadTracker struct{ coordination.NoopUploadTracker }
+
+func (t *otherPodUploadTracker) CheckOwnership(_ context.Context, uuid string) error {
+	return fmt.Errorf("upload %s belongs to pod other", uuid)
+}
+
+func TestChunkedUpload_MultipartOnAnyReplica(t *testing.T) {
+	_, _, _, _, handler, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	backend := &multipartBackend{LocalBackend: storage.NewLocalBackend(tempDir), partSize: 8, uploads: map[string]map[int][]byte{}}
+	uploads := service.NewUploadService(backend, backend, handler.pathManager, &coordination.NoopLockManager{}, handler.log)
+
+	// Two replicas sharing the bucket, without session affinity
+	replicas := make([]*fiber.App, 2)
+	for i := range replicas {
+		h := NewOCIHandler(nil, nil, nil, nil, handler.config, handler.log, handler.pathManager, backend, &otherPodUploadTracker{}, &coordination.NoopLockManager{})
+		h.SetUploadService(uploads)
+		app := fiber.New(fiber.Config{StreamRequestBody: true})
+		app.Post("/v2/:name/blobs/uploads/", h.PostUpload)
+		app.Patch("/v2/:name/blobs/uploads/:uuid", h.PatchBlob)
+		app.Put("/v2/:name/blobs/uploads/:uuid", h.CompleteUpload)
+		replicas[i] = app
+	}
+	send := func(replica int, method, path string, body []byte) (int, map[string]string) {
+		resp, err := replicas[replica].Test(httptest.NewRequest(method, path, bytes.NewReader(body)), int(time.Minute.Milliseconds()))
+		assert.NoError(t, err)
+		return resp.StatusCode, map[string]string{
+			"uuid":  resp.Header.Get("Docker-Upload-UUID"),
+			"range": resp.Header.Get("Range"),
+		}
+	}
+
+	blob := []byte("0123456789abcdefghijklmnopqrstu")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(blob))
+
+	status, headers := send(0, "POST", "/v2/app/blobs/uploads/", nil)
+	assert.Equal(t, 202, status)
+	uuid := headers["uuid"]
+
+	// Chunks smaller and larger than a part, alternating replicas
+	status, headers = send(1, "PATCH", "/v2/app/blobs/uploads/"+uuid, blob[:5])
+	assert.Equal(t, 202, status)
+	assert.Equal(t, "0-4", headers["range"])
+	status, headers = send(0, "PATCH", "/v2/app/blobs/uploads/"+uuid, blob[5:26])
+	assert.Equal(t, 202, status)
+	assert.Equal(t, "0-25", headers["range"])
+	assert.Len(t, backend.uploads, 1)
+
+	status, _ = send(1, "PUT", "/v2/app/blobs/uploads/"+uuid+"?digest="+digest, blob[26:])
+	assert.Equal(t, 201, status)
+
+	data, err := backend.Read(handler.pathManager.GetBlobPath(digest))
+	assert.NoError(t, err)
+	assert.Equal(t, blob, data)
+	assert.Empty(t, backend.uploads)
+	exists, _ := backend.Exists("uploads/" + uuid + "/session.json")
+	assert.False(t, exists)
+
+	// A wrong digest aborts the multipart upload
+	_, headers = send(0, "POST", "/v2/app/blobs/uploads/", nil)
+	uuid = headers["uuid"]
+	status, _ = send(1, "PATCH", "/v2/app/blobs/uploads/"+uuid, blob)
+	assert.Equal(t, 202, status)
+	status, _ = send(0, "PUT", "/v2/app/blobs/uploads/"+uuid+"?digest=sha256:"+fmt.Sprintf("%064d", 0), nil)
+	assert.Equal(t, 400, status)
+	assert.Equal(t, 1, backend.aborted)
+	status, _ = send(1, "PATCH", "/v2/app/blobs/uploads/"+uuid, blob)
+	assert.Equal(t, 404, status)
+
+	// sha512 digests are checked on the assembled upload, multipart or not
+	sha512Digest := fmt.Sprintf("sha512:%x", sha512.Sum512(blob))
+	for _, tt := range []struct {
+		chunk  []byte
+		digest string
+		status int
+	}{
+		{blob, sha512Digest, 201},
+		{blob[:5], fmt.Sprintf("sha512:%x", sha512.Sum512(blob[:5])), 201},
+		{blob, fmt.Sprintf("sha512:%0128d", 0), 400},
+		{blob[:5], fmt.Sprintf("sha512:%0128d", 1), 400},
+	} {
+		_, headers = send(0, "POST", "/v2/app/blobs/uploads/", nil)
+		uuid = headers["uuid"]
+		status, _ = send(1, "PATCH", "/v2/app/blobs/uploads/"+uuid, tt.chunk)
+		assert.Equal(t, 202, status)
+		status, _ = send(0, "PUT", "/v2/app/blobs/uploads/"+uuid+"?digest="+tt.digest, nil)
+		assert.Equal(t, tt.status, status, tt.digest)
+		exists, _ := backend.Exists(handler.pathManager.GetBlobPath(tt.digest))
+		assert.Equal(t, tt.status == 201, exists, tt.digest)
+		exists, _ = backend.Exists("uploads/" + uuid + "/data")
+		assert.False(t, exists)
+	}
+	data, err = backend.Read(handler.pathManager.GetBlobPath(sha512Digest))
+	assert.NoError(t, err)
+	assert.Equal(t, blob, data)
+}
+
+func TestCompleteUpload_VerifiesDeclaredAlgorithm(t *testing.T) {
+	_, _, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+	app := fiber.New(fiber.Config{StreamRequestBody: true})
+	app.Post("/v2/:name/blobs/uploads/", handler.PostUpload)
+	app.Put("/v2/:name/blobs/uploads/:uuid", handler.CompleteUpload)
+
+	blob := []byte("monolithic sha512 push")
+	for _, tt := range []struct {
+		digest string
+		status int
+	}{
+		{fmt.Sprintf("sha512:%x", sha512.Sum512(blob)), 201},
+		{fmt.Sprintf("sha512:%0128d", 0), 400},
+		{fmt.Sprintf("sha256:%x", sha256.Sum256(blob)), 201},
+	} {
+		resp, err := app.Test(httptest.NewRequest("POST", "/v2/app/blobs/uploads/", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 202, resp.StatusCode)
+		uuid := resp.Header.Get("Docker-Upload-UUID")
+
+		resp, err = app.Test(httptest.NewRequest("PUT", "/v2/app/blobs/uploads/"+uuid+"?digest="+tt.digest, bytes.NewReader(blob)))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.status, resp.StatusCode, tt.digest)
+		exists, _ := handler.backend.Exists(handler.pathManager.GetBlobPath(tt.digest))
+		assert.Equal(t, tt.status == 201, exists, tt.digest)
+	}
+}
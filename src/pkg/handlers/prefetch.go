@@ -0,0 +1,675 @@
+// pkg/handlers/prefetch.go
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	interfaces "oci-storage/pkg/interfaces"
+	"oci-storage/pkg/models"
+	service "oci-storage/pkg/services"
+	"oci-storage/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+)
+
+const (
+	// maxPrefetchJobs is how many finished jobs are kept for status queries
+	maxPrefetchJobs = 50
+	// prefetchBlobWorkers is how many blobs a job downloads in parallel.
+	// Downloads still go through the shared blob semaphores.
+	prefetchBlobWorkers = 4
+	// prefetchSaveInterval is how often the progress of a running job is saved for other replicas
+	prefetchSaveInterval = 5 * time.Second
+	// prefetchJobsDir holds the status of every job as <id>.json, shared by all replicas
+	prefetchJobsDir = "prefetch"
+)
+
+// PrefetchHandler pre-warms the proxy cache with whole images ahead of time
+type PrefetchHandler struct {
+	oci          *OCIHandler
+	chartService interfaces.ChartServiceInterface
+	log          *utils.Logger
+
+	mu     sync.Mutex
+	jobs   map[string]*models.PrefetchJob // running on this replica
+	saveMu sync.Mutex                     // keeps saved snapshots in order
+}
+
+// NewPrefetchHandler creates a new prefetch handler.
+// Downloads reuse the OCI handler's backend, locks and semaphores.
+func NewPrefetchHandler(oci *OCIHandler, chartService interfaces.ChartServiceInterface, log *utils.Logger) *PrefetchHandler {
+	return &PrefetchHandler{
+		oci:          oci,
+		chartService: chartService,
+		log:          log,
+		jobs:         make(map[string]*models.PrefetchJob),
+	}
+}
+
+// StartPrefetch starts a background job caching every platform manifest and blob of the
+// requested images. A stored Helm chart can be given instead of (or in addition to) images:
+// the images of its manifests, rendered with the default values, are prefetched.
+// POST /api/cache/prefetch
+func (h *PrefetchHandler) StartPrefetch(c *fiber.Ctx) error {
+	if h.oci.proxyService == nil || !h.oci.proxyService.IsEnabled() {
+		return HTTPError(c, 400, "Proxy is not enabled")
+	}
+
+	var req models.PrefetchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return HTTPError(c, 400, "Invalid request body")
+	}
+
+	refs := req.Images
+	if req.Chart != nil {
+		chartRefs, err := h.chartImageRefs(req.Chart.Name, req.Chart.Version)
+		if err != nil {
+			h.log.WithError(err).WithField("chart", req.Chart.Name).Warn("Failed to read chart for prefetch")
+			return HTTPError(c, 404, "Chart not found")
+		}
+		refs = append(refs, chartRefs...)
+	}
+
+	job := &models.PrefetchJob{
+		ID:        uuid.New().String(),
+		Status:    models.PrefetchStatusRunning,
+		StartedAt: time.Now(),
+	}
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		status := models.PrefetchImageStatus{Reference: ref, Status: models.PrefetchStatusPending}
+		name, reference, err := h.oci.parseImageReference(ref)
+		if err != nil {
+			status.Status = models.PrefetchStatusFailed
+			status.Error = err.Error()
+		}
+		status.Name, status.Tag = name, reference
+		job.Images = append(job.Images, status)
+	}
+	if len(job.Images) == 0 {
+		return HTTPError(c, 400, "No images to prefetch")
+	}
+
+	h.update(func() { h.jobs[job.ID] = job })
+	h.saveJob(job)
+	go h.run(job)
+
+	h.log.WithFields(logrus.Fields{
+		"job":    job.ID,
+		"images": len(job.Images),
+	}).Info("Prefetch job started")
+
+	return c.Status(202).JSON(fiber.Map{
+		"id":     job.ID,
+		"status": job.Status,
+		"images": len(job.Images),
+		"url":    "/api/cache/prefetch/" + job.ID,
+	})
+}
+
+// GetPrefetchJob returns the progress of a prefetch job. Jobs running on other replicas
+// report the progress they last saved.
+// GET /api/cache/prefetch/:job
+func (h *PrefetchHandler) GetPrefetchJob(c *fiber.Ctx) error {
+	id := c.Params("job")
+	h.mu.Lock()
+	job, ok := h.jobs[id]
+	h.mu.Unlock()
+	if ok {
+		return c.JSON(h.snapshot(job))
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return HTTPError(c, 404, "Prefetch job not found")
+	}
+	data, err := h.oci.backend.Read(prefetchJobPath(id))
+	if err != nil {
+		return HTTPError(c, 404, "Prefetch job not found")
+	}
+	var stored models.PrefetchJob
+	if err := json.Unmarshal(data, &stored); err != nil {
+		h.log.WithError(err).WithField("job", id).Warn("Failed to parse prefetch job status")
+		return HTTPError(c, 500, "Failed to read prefetch job")
+	}
+	return c.JSON(stored)
+}
+
+// snapshot returns a copy of a job taken under the handler lock
+func (h *PrefetchHandler) snapshot(job *models.PrefetchJob) models.PrefetchJob {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := *job
+	snapshot.Images = append([]models.PrefetchImageStatus(nil), job.Images...)
+	return snapshot
+}
+
+// saveJob records the status of a job in the backend, where every replica can read it
+func (h *PrefetchHandler) saveJob(job *models.PrefetchJob) {
+	h.saveMu.Lock()
+	defer h.saveMu.Unlock()
+
+	data, err := json.MarshalIndent(h.snapshot(job), "", "  ")
+	if err != nil {
+		return
+	}
+	if err := h.oci.backend.Write(prefetchJobPath(job.ID), data); err != nil {
+		h.log.WithError(err).WithField("job", job.ID).Warn("Failed to save prefetch job status")
+	}
+}
+
+// saveProgress saves a running job every prefetchSaveInterval until done is closed
+func (h *PrefetchHandler) saveProgress(job *models.PrefetchJob, done <-chan struct{}) {
+	ticker := time.NewTicker(prefetchSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.saveJob(job)
+		case <-done:
+			return
+		}
+	}
+}
+
+// pruneJobs deletes the oldest finished jobs beyond maxPrefetchJobs
+func (h *PrefetchHandler) pruneJobs() {
+	entries, err := h.oci.backend.List(prefetchJobsDir)
+	if err != nil || len(entries) <= maxPrefetchJobs {
+		return
+	}
+
+	var finished []models.PrefetchJob
+	for _, entry := range entries {
+		if entry.IsDir || !strings.HasSuffix(entry.Name, ".json") {
+			continue
+		}
+		data, err := h.oci.backend.Read(prefetchJobPath(strings.TrimSuffix(entry.Name, ".json")))
+		if err != nil {
+			continue
+		}
+		var job models.PrefetchJob
+		if err := json.Unmarshal(data, &job); err != nil || job.FinishedAt == nil {
+			continue
+		}
+		finished = append(finished, job)
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].FinishedAt.Before(*finished[j].FinishedAt)
+	})
+
+	for excess := len(entries) - maxPrefetchJobs; excess > 0 && len(finished) > 0; excess-- {
+		if err := h.oci.backend.Delete(prefetchJobPath(finished[0].ID)); err != nil {
+			h.log.WithError(err).WithField("job", finished[0].ID).Warn("Failed to delete prefetch job status")
+		}
+		finished = finished[1:]
+	}
+}
+
+func prefetchJobPath(id string) string {
+	return filepath.Join(prefetchJobsDir, id+".json")
+}
+
+// update applies fn to a job under the handler lock
+func (h *PrefetchHandler) update(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fn()
+}
+
+// run processes the images of a job one after the other
+func (h *PrefetchHandler) run(job *models.PrefetchJob) {
+	done := make(chan struct{})
+	go h.saveProgress(job, done)
+
+	seenBlobs := make(map[string]bool)
+	succeeded := 0
+
+	for i := range job.Images {
+		var name, reference string
+		skip := false
+		h.update(func() {
+			img := &job.Images[i]
+			if img.Status == models.PrefetchStatusFailed {
+				skip = true
+				return
+			}
+			img.Status = models.PrefetchStatusRunning
+			name, reference = img.Name, img.Tag
+		})
+		if skip {
+			continue
+		}
+
+		blobs, platforms, err := h.prefetchManifests(name, reference)
+		if err != nil {
+			h.log.WithError(err).WithField("image", name+":"+reference).Warn("Prefetch failed to fetch manifests")
+			h.update(func() {
+				job.Images[i].Status = models.PrefetchStatusFailed
+				job.Images[i].Error = err.Error()
+			})
+			continue
+		}
+
+		// Layers shared between images of the same job are only counted once
+		var pending []string
+		for _, digest := range blobs {
+			if !seenBlobs[digest] {
+				seenBlobs[digest] = true
+				pending = append(pending, digest)
+			}
+		}
+		h.update(func() {
+			job.Images[i].Platforms = platforms
+			job.Images[i].Blobs = len(blobs)
+			job.BlobsTotal += len(pending)
+		})
+
+		failed := h.prefetchBlobs(job, name, pending)
+		h.update(func() {
+			if failed > 0 {
+				job.Images[i].Status = models.PrefetchStatusFailed
+				job.Images[i].Error = fmt.Sprintf("%d blobs failed to download", failed)
+				return
+			}
+			job.Images[i].Status = models.PrefetchStatusCompleted
+		})
+		if failed == 0 {
+			succeeded++
+		}
+	}
+
+	h.update(func() {
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Status = models.PrefetchStatusCompleted
+		if succeeded == 0 {
+			job.Status = models.PrefetchStatusFailed
+		}
+	})
+	close(done)
+	h.saveJob(job)
+	h.update(func() { delete(h.jobs, job.ID) })
+	h.pruneJobs()
+
+	h.log.WithFields(logrus.Fields{
+		"job":         job.ID,
+		"status":      job.Status,
+		"blobsTotal":  job.BlobsTotal,
+		"blobsFailed": job.BlobsFailed,
+	}).Info("Prefetch job finished")
+}
+
+// prefetchManifests fetches and caches the manifest of an image and, for multi-arch images,
+// the manifests of every platform. Returns the config and layer digests to download.
+func (h *PrefetchHandler) prefetchManifests(name, reference string) ([]string, int, error) {
+	registryURL, upstreamName, err := h.oci.proxyService.ResolveRegistry(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	timeout := time.Duration(h.oci.config.Proxy.Timeout.ManifestSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	manifestData, _, err := h.oci.proxyService.GetManifest(ctx, registryURL, upstreamName, reference)
+	if err != nil {
+		return nil, 0, err
+	}
+	h.storeManifestBlob(manifestData)
+	if !strings.HasPrefix(reference, "sha256:") {
+		h.oci.cacheManifest(name, reference, manifestData, registryURL, upstreamName)
+	}
+
+	var index models.OCIIndex
+	if err := json.Unmarshal(manifestData, &index); err != nil {
+		return nil, 0, fmt.Errorf("invalid manifest: %w", err)
+	}
+	isIndex := index.MediaType == models.MediaTypeOCIManifestList ||
+		index.MediaType == models.MediaTypeDockerManifestList ||
+		len(index.Manifests) > 0
+	if !isIndex {
+		return manifestBlobs(manifestData), 0, nil
+	}
+
+	var blobs []string
+	for _, desc := range index.Manifests {
+		childCtx, childCancel := context.WithTimeout(context.Background(), timeout)
+		childData, _, err := h.oci.proxyService.GetManifest(childCtx, registryURL, upstreamName, desc.Digest)
+		childCancel()
+		if err != nil {
+			return nil, 0, fmt.Errorf("platform manifest %s: %w", desc.Digest, err)
+		}
+		h.storeManifestBlob(childData)
+		blobs = append(blobs, manifestBlobs(childData)...)
+	}
+	return blobs, len(index.Manifests), nil
+}
+
+// storeManifestBlob keeps a copy of a manifest under its digest for digest-based lookups
+func (h *PrefetchHandler) storeManifestBlob(data []byte) {
+	blobPath := h.oci.pathManager.GetBlobPath(fmt.Sprintf("sha256:%x", sha256.Sum256(data)))
+	if err := h.oci.backend.Write(blobPath, data); err != nil {
+		h.log.WithError(err).Warn("Failed to cache manifest as blob")
+	}
+}
+
+// manifestBlobs returns the config and layer digests of an image manifest
+func manifestBlobs(data []byte) []string {
+	var manifest models.OCIManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil
+	}
+	var digests []string
+	if manifest.Config.Digest != "" {
+		digests = append(digests, manifest.Config.Digest)
+	}
+	for _, layer := range manifest.Layers {
+		digests = append(digests, layer.Digest)
+	}
+	return digests
+}
+
+// prefetchBlobs downloads blobs with a small worker pool and returns the number of failures
+func (h *PrefetchHandler) prefetchBlobs(job *models.PrefetchJob, name string, digests []string) int {
+	work := make(chan string)
+	var wg sync.WaitGroup
+	var failedMu sync.Mutex
+	failed := 0
+
+	for w := 0; w < prefetchBlobWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for digest := range work {
+				written, cached, err := h.oci.cacheUpstreamBlob(name, digest)
+				h.update(func() {
+					switch {
+					case err != nil:
+						job.BlobsFailed++
+					case cached:
+						job.BlobsCached++
+						job.BlobsDone++
+					default:
+						job.BytesDownloaded += written
+						job.BlobsDone++
+					}
+				})
+				if err != nil {
+					h.log.WithError(err).WithField("digest", digest).Warn("Prefetch failed to download blob")
+					failedMu.Lock()
+					failed++
+					failedMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, digest := range digests {
+		work <- digest
+	}
+	close(work)
+	wg.Wait()
+	return failed
+}
+
+// cacheUpstreamBlob downloads a blob from upstream into the cache without serving it.
+// It takes the same single-flight lock and size semaphores as proxyBlob. Returns the bytes
+// written and whether the blob was already cached (by us or by another replica).
+func (h *OCIHandler) cacheUpstreamBlob(name, digest string) (int64, bool, error) {
+	blobPath := h.pathManager.GetBlobPath(digest)
+	if exists, _ := h.backend.Exists(blobPath); exists {
+		return 0, true, nil
+	}
+
+	maxTimeout := time.Duration(h.config.Proxy.Timeout.MaxTimeoutMinutes) * time.Minute
+	if maxTimeout <= 0 {
+		maxTimeout = 30 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), maxTimeout)
+	defer cancel()
+
+	unlock, err := h.locker.Acquire(ctx, "proxy-blob:"+digest, maxTimeout)
+	if err != nil {
+		// Another replica is downloading it: wait for the result
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
+		for {
+			if exists, _ := h.backend.Exists(blobPath); exists {
+				return 0, true, nil
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return 0, false, fmt.Errorf("timeout waiting for peer download of %s", digest)
+			}
+		}
+	}
+	defer unlock()
+
+	if exists, _ := h.backend.Exists(blobPath); exists {
+		return 0, true, nil
+	}
+
+	registryURL, upstreamName, err := h.proxyService.ResolveRegistry(name)
+	if err != nil {
+		return 0, false, err
+	}
+	reader, size, err := h.proxyService.GetBlob(ctx, registryURL, upstreamName, digest)
+	if err != nil {
+		return 0, false, err
+	}
+	defer reader.Close()
+
+	sem := smallBlobSemaphore
+	if size >= blobSizeThreshold {
+		sem = largeBlobSemaphore
+	}
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+	case <-ctx.Done():
+		return 0, false, fmt.Errorf("timeout waiting for download slot")
+	}
+
+	written, err := service.ImportBlob(h.backend, h.pathManager, reader, digest, size)
+	if err != nil {
+		return 0, false, err
+	}
+	return written, false, nil
+}
+
+// parseImageReference converts an image reference ("nginx:1.27", "ghcr.io/org/app@sha256:...",
+// "proxy/quay.io/org/app:v1") into its proxy cache path and tag or digest.
+func (h *OCIHandler) parseImageReference(ref string) (string, string, error) {
+	name, reference := ref, "latest"
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name, reference = name[:i], name[i+1:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, reference = name[:i], name[i+1:]
+	}
+	if name == "" || reference == "" {
+		return "", "", fmt.Errorf("invalid image reference %q", ref)
+	}
+
+	if !strings.HasPrefix(name, "proxy/") {
+		registry := ""
+		if parts := strings.SplitN(name, "/", 2); len(parts) == 2 && strings.ContainsAny(parts[0], ".:") {
+			registry = h.mirrorRegistry(parts[0])
+			if registry == "" {
+				return "", "", fmt.Errorf("registry %s is not configured for proxying", parts[0])
+			}
+			name = parts[1]
+		} else {
+			registry = h.defaultRegistryName()
+		}
+		name = "proxy/" + registry + "/" + name
+	}
+	name = normalizeDockerHubName(name)
+
+	if err := utils.ValidateRepoName(name); err != nil {
+		return "", "", fmt.Errorf("invalid image name %q", name)
+	}
+	if err := utils.ValidateReference(reference); err != nil {
+		return "", "", fmt.Errorf("invalid tag or digest %q", reference)
+	}
+	return name, reference, nil
+}
+
+// defaultRegistryName returns the name of the default proxied registry
+func (h *OCIHandler) defaultRegistryName() string {
+	for _, reg := range h.config.Proxy.Registries {
+		if reg.Default {
+			return reg.Name
+		}
+	}
+	return "docker.io"
+}
+
+// chartImageRefs returns the images a stored chart deploys with its default values: the
+// templates are rendered and the `image:` fields of the manifests collected. Charts that
+// do not render (a `required` value without default, a `fail`) fall back to their values.
+func (h *PrefetchHandler) chartImageRefs(name, version string) ([]string, error) {
+	data, err := h.chartService.GetChart(name, version)
+	if err != nil {
+		return nil, err
+	}
+	chrt, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid chart archive: %w", err)
+	}
+
+	refs, err := renderImageRefs(chrt)
+	if err == nil {
+		return refs, nil
+	}
+	h.log.WithError(err).WithField("chart", name).Warn("Failed to render chart for prefetch, reading images from its values")
+	values, err := h.chartService.GetChartValues(name, version)
+	if err != nil {
+		return nil, err
+	}
+	return extractImageRefs(values, chrt.Metadata.AppVersion), nil
+}
+
+// renderImageRefs renders a chart as `helm template` would with its default values and
+// collects the `image:` fields of the resulting manifests
+func renderImageRefs(chrt *chart.Chart) ([]string, error) {
+	options := chartutil.ReleaseOptions{Name: chrt.Name(), Namespace: "default", Revision: 1, IsInstall: true}
+	values, err := chartutil.ToRenderValues(chrt, chrt.Values, options, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := engine.Render(chrt, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch v := node.(type) {
+		case map[interface{}]interface{}:
+			for k, child := range v {
+				if image, ok := child.(string); ok && k == "image" {
+					if image = strings.TrimSpace(image); image != "" {
+						refs = append(refs, image)
+					}
+					continue
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	for file, content := range rendered {
+		if !strings.HasSuffix(file, ".yaml") && !strings.HasSuffix(file, ".yml") {
+			continue
+		}
+		decoder := yaml.NewDecoder(strings.NewReader(content))
+		for {
+			var doc interface{}
+			if err := decoder.Decode(&doc); err != nil {
+				if err != io.EOF {
+					return nil, fmt.Errorf("invalid manifest %s: %w", file, err)
+				}
+				break
+			}
+			walk(doc)
+		}
+	}
+	return refs, nil
+}
+
+// extractImageRefs collects image references from Helm chart values using the common
+// conventions: `image: repo:tag` strings and `image: {registry, repository, tag, digest}`
+// maps. Used for charts that cannot be rendered.
+func extractImageRefs(values, appVersion string) []string {
+	var root interface{}
+	if err := yaml.Unmarshal([]byte(values), &root); err != nil {
+		return nil
+	}
+
+	var refs []string
+	var walk func(key string, node interface{})
+	walk = func(key string, node interface{}) {
+		switch v := node.(type) {
+		case map[interface{}]interface{}:
+			if repo, ok := v["repository"].(string); ok && repo != "" && (key == "image" || strings.HasSuffix(strings.ToLower(key), "image")) {
+				ref := repo
+				if registry, ok := v["registry"].(string); ok && registry != "" {
+					ref = registry + "/" + repo
+				}
+				tag := fmt.Sprint(v["tag"])
+				if v["tag"] == nil || tag == "" {
+					tag = appVersion
+				}
+				if digest, ok := v["digest"].(string); ok && digest != "" {
+					ref += "@" + digest
+				} else if tag != "" {
+					ref += ":" + tag
+				}
+				refs = append(refs, ref)
+				return
+			}
+			for k, child := range v {
+				walk(fmt.Sprint(k), child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(key, child)
+			}
+		case string:
+			if key == "image" && v != "" && !strings.Contains(v, "{{") {
+				refs = append(refs, v)
+			}
+		}
+	}
+	walk("", root)
+	return refs
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"oci-storage/pkg/models"
+	"oci-storage/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseImageReference(t *testing.T) {
+	_, _, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	tests := []struct {
+		ref       string
+		name      string
+		reference string
+		wantErr   bool
+	}{
+		{"nginx", "proxy/docker.io/library/nginx", "latest", false},
+		{"nginx:1.27", "proxy/docker.io/library/nginx", "1.27", false},
+		{"docker.io/bitnami/redis:7.2", "proxy/docker.io/bitnami/redis", "7.2", false},
+		{"proxy/docker.io/library/nginx:alpine", "proxy/docker.io/library/nginx", "alpine", false},
+		{"registry-1.docker.io/library/nginx:alpine", "proxy/docker.io/library/nginx", "alpine", false},
+		{"unknown.example.com/app:v1", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			name, reference, err := handler.parseImageReference(tt.ref)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.reference, reference)
+		})
+	}
+}
+
+func TestExtractImageRefs(t *testing.T) {
+	values := `
+image:
+  repository: bitnami/redis
+  tag: 7.2.4
+sidecar:
+  image: busybox:1.36
+metrics:
+  exporterImage:
+    registry: ghcr.io
+    repository: org/exporter
+templated:
+  image: "{{ .Values.global.image }}"
+`
+	refs := extractImageRefs(values, "2.0.0")
+
+	assert.ElementsMatch(t, []string{
+		"bitnami/redis:7.2.4",
+		"busybox:1.36",
+		"ghcr.io/org/exporter:2.0.0",
+	}, refs)
+}
+
+// chartArchiveWith builds a chart .tgz holding the given files below demo/
+func chartArchiveWith(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "demo/" + name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestChartImageRefs(t *testing.T) {
+	_, mockChartService, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+	prefetchHandler := NewPrefetchHandler(handler, mockChartService, utils.NewLogger(utils.Config{}))
+
+	chartYAML := "apiVersion: v2\nname: demo\nversion: 1.0.0\nappVersion: \"2.0.0\"\n"
+	values := `
+global:
+  registry: ghcr.io
+app:
+  repository: org/app
+migrations:
+  enabled: false
+  image: org/migrate:1.0
+`
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: wait
+          image: busybox:1.36
+      containers:
+        - name: app
+          image: "{{ .Values.global.registry }}/{{ .Values.app.repository }}:{{ .Chart.AppVersion }}"
+---
+{{- if .Values.migrations.enabled }}
+apiVersion: batch/v1
+kind: Job
+spec:
+  template:
+    spec:
+      containers:
+        - image: {{ .Values.migrations.image }}
+{{- end }}
+`
+	mockChartService.On("GetChart", "demo", "1.0.0").Return(chartArchiveWith(t, map[string]string{
+		"Chart.yaml":                chartYAML,
+		"values.yaml":               values,
+		"templates/deployment.yaml": deployment,
+		"templates/NOTES.txt":       "image: not/a-manifest:1\n",
+	}), nil)
+
+	// Images built from several values are found, disabled ones are not
+	refs, err := prefetchHandler.chartImageRefs("demo", "1.0.0")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"busybox:1.36", "ghcr.io/org/app:2.0.0"}, refs)
+
+	// A chart that does not render falls back to its values
+	failing := "token: {{ required \"token is required\" .Values.token }}\n"
+	mockChartService.On("GetChart", "failing", "1.0.0").Return(chartArchiveWith(t, map[string]string{
+		"Chart.yaml":                chartYAML,
+		"values.yaml":               values,
+		"templates/deployment.yaml": failing,
+	}), nil)
+	mockChartService.On("GetChartValues", "failing", "1.0.0").Return(values, nil)
+	refs, err = prefetchHandler.chartImageRefs("failing", "1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org/migrate:1.0"}, refs)
+}
+
+func TestPrefetch_CachesManifestAndBlobs(t *testing.T) {
+	app, mockChartService, mockImageService, mockProxyService, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	prefetchHandler := NewPrefetchHandler(handler, mockChartService, utils.NewLogger(utils.Config{}))
+	app.Post("/api/cache/prefetch", prefetchHandler.StartPrefetch)
+	app.Get("/api/cache/prefetch/:job", prefetchHandler.GetPrefetchJob)
+
+	configDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("{}")))
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("layer")))
+	manifest := []byte(`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"config": {"digest": "` + configDigest + `", "size": 2},
+		"layers": [{"digest": "` + layerDigest + `", "size": 5}]}`)
+
+	mockProxyService.On("IsEnabled").Return(true)
+	mockProxyService.On("ResolveRegistry", "proxy/docker.io/library/nginx").Return("https://registry-1.docker.io", "library/nginx", nil)
+	mockProxyService.On("GetManifest", mock.Anything, "https://registry-1.docker.io", "library/nginx", "1.27").
+		Return(manifest, "application/vnd.oci.image.manifest.v1+json", nil)
+	mockProxyService.On("GetBlob", mock.Anything, "https://registry-1.docker.io", "library/nginx", configDigest).
+		Return(io.NopCloser(strings.NewReader("{}")), int64(2), nil)
+	mockProxyService.On("GetBlob", mock.Anything, "https://registry-1.docker.io", "library/nginx", layerDigest).
+		Return(io.NopCloser(strings.NewReader("layer")), int64(5), nil)
+	mockProxyService.On("AddToCache", mock.Anything).Return(nil)
+	mockImageService.On("SaveImage", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	req := httptest.NewRequest("POST", "/api/cache/prefetch", strings.NewReader(`{"images": ["nginx:1.27"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var started struct {
+		ID string `json:"id"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&started))
+
+	var job models.PrefetchJob
+	for i := 0; i < 50; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/cache/prefetch/"+started.ID, nil))
+		assert.NoError(t, err)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+		if job.Status != models.PrefetchStatusRunning {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	assert.Equal(t, models.PrefetchStatusCompleted, job.Status)
+	assert.Equal(t, 2, job.BlobsTotal)
+	assert.Equal(t, 2, job.BlobsDone)
+	assert.Equal(t, int64(7), job.BytesDownloaded)
+
+	exists, _ := handler.backend.Exists(handler.pathManager.GetBlobPath(layerDigest))
+	assert.True(t, exists)
+
+	// Another replica reads the status from the backend
+	replica := fiber.New()
+	replica.Get("/api/cache/prefetch/:job", NewPrefetchHandler(handler, mockChartService, utils.NewLogger(utils.Config{})).GetPrefetchJob)
+	resp, err = replica.Test(httptest.NewRequest("GET", "/api/cache/prefetch/"+started.ID, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	var stored models.PrefetchJob
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&stored))
+	assert.Equal(t, models.PrefetchStatusCompleted, stored.Status)
+	assert.Equal(t, job.BlobsDone, stored.BlobsDone)
+	assert.Equal(t, job.BytesDownloaded, stored.BytesDownloaded)
+
+	for _, id := range []string{"00000000-0000-0000-0000-000000000000", "..%2Fconfig"} {
+		resp, err = replica.Test(httptest.NewRequest("GET", "/api/cache/prefetch/"+id, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 404, resp.StatusCode, id)
+	}
+}
+
+func TestPrefetch_PrunesOldestFinishedJobs(t *testing.T) {
+	_, mockChartService, _, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+	prefetchHandler := NewPrefetchHandler(handler, mockChartService, utils.NewLogger(utils.Config{}))
+
+	save := func(status string, finishedAt *time.Time) string {
+		job := &models.PrefetchJob{ID: uuid.New().String(), Status: status, FinishedAt: finishedAt}
+		prefetchHandler.saveJob(job)
+		return job.ID
+	}
+	start := time.Now().Add(-time.Hour)
+	running := save(models.PrefetchStatusRunning, nil)
+	var ids []string
+	for i := 0; i < maxPrefetchJobs+1; i++ {
+		finishedAt := start.Add(time.Duration(i) * time.Minute)
+		ids = append(ids, save(models.PrefetchStatusCompleted, &finishedAt))
+	}
+
+	prefetchHandler.pruneJobs()
+	entries, err := handler.backend.List(prefetchJobsDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, maxPrefetchJobs)
+	for id, kept := range map[string]bool{running: true, ids[0]: false, ids[1]: false, ids[2]: true} {
+		exists, _ := handler.backend.Exists(prefetchJobPath(id))
+		assert.Equal(t, kept, exists, id)
+	}
+}
@@ -0,0 +1,57 @@
+// pkg/handlers/replication.go
+package handlers
+
+import (
+	"errors"
+
+	"oci-storage/pkg/interfaces"
+	service "oci-storage/pkg/services"
+	"oci-storage/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// ReplicationHandler exposes the push replication rules
+type ReplicationHandler struct {
+	replicationService interfaces.ReplicationServiceInterface
+	log                *utils.Logger
+}
+
+// NewReplicationHandler creates a new push replication handler
+func NewReplicationHandler(replicationService interfaces.ReplicationServiceInterface, log *utils.Logger) *ReplicationHandler {
+	return &ReplicationHandler{
+		replicationService: replicationService,
+		log:                log,
+	}
+}
+
+// ListRules returns the queue sizes and last outcomes of every replication rule
+// GET /api/replication/rules
+func (h *ReplicationHandler) ListRules(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"rules": h.replicationService.GetStatus()})
+}
+
+// ReplicateNow queues every local tag matching a rule and retries its failed replications
+// POST /api/replication/rules/:name/run
+func (h *ReplicationHandler) ReplicateNow(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	queued, err := h.replicationService.ReplicateNow(name)
+	if err != nil {
+		if errors.Is(err, service.ErrReplicationRuleNotFound) {
+			return HTTPError(c, 404, "Replication rule not found")
+		}
+		h.log.WithError(err).WithField("rule", name).Error("Failed to queue replication")
+		return HTTPError(c, 500, "Failed to queue replication")
+	}
+
+	h.log.WithFields(logrus.Fields{
+		"rule":   name,
+		"queued": queued,
+	}).Info("Replication triggered via API")
+	return c.Status(202).JSON(fiber.Map{
+		"rule":   name,
+		"queued": queued,
+	})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oci-storage/config"
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/models"
+	service "oci-storage/pkg/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReplication_PushIsCopiedWithRetries(t *testing.T) {
+	app, _, mockImageService, _, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	// Destination registry requiring basic auth; the first manifest upload fails
+	var mu sync.Mutex
+	destBlobs := map[string][]byte{}
+	destManifests := map[string][]byte{}
+	blobUploads, manifestFailures := 0, 1
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "replicator" || pass != "secret" {
+			w.Header().Set("Www-Authenticate", `Basic realm="dest"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/v2/")
+		switch {
+		case r.Method == http.MethodHead && strings.Contains(path, "/blobs/"):
+			if _, ok := destBlobs[path[strings.LastIndex(path, "/")+1:]]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPost && strings.HasSuffix(path, "/blobs/uploads/"):
+			w.Header().Set("Location", "/v2/"+path+"upload-1?state=abc")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && strings.Contains(path, "/blobs/uploads/"):
+			assert.Equal(t, "abc", r.URL.Query().Get("state"))
+			data, _ := io.ReadAll(r.Body)
+			destBlobs[r.URL.Query().Get("digest")] = data
+			blobUploads++
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.Contains(path, "/manifests/"):
+			if manifestFailures > 0 {
+				manifestFailures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			data, _ := io.ReadAll(r.Body)
+			destManifests[strings.Replace(path, "/manifests/", ":", 1)] = data
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer dest.Close()
+
+	cfg := *handler.config
+	cfg.Replication = config.ReplicationConfig{
+		Enabled:          true,
+		MaxAttempts:      10,
+		RetryBaseSeconds: 3600,
+		Rules: []config.ReplicationRule{{
+			Name:         "eu",
+			Repositories: []string{"team/*"},
+			TagPattern:   `^v\d`,
+			Charts:       "exclude",
+			Destination: config.ReplicationDestination{
+				URL:       dest.URL,
+				Namespace: "central",
+				Username:  "replicator",
+				Password:  "secret",
+			},
+		}},
+	}
+	replicationService, err := service.NewReplicationService(&cfg, handler.log, handler.pathManager, handler.backend, &coordination.NoopLockManager{})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	replicationService.Start(ctx)
+	handler.SetReplicationService(replicationService)
+
+	replicationHandler := NewReplicationHandler(replicationService, handler.log)
+	app.Put("/v2/:namespace/:name/manifests/:reference", handler.PutManifestNested)
+	app.Get("/api/replication/rules", replicationHandler.ListRules)
+	app.Post("/api/replication/rules/:name/run", replicationHandler.ReplicateNow)
+	mockImageService.On("SaveImage", "team/app", mock.Anything, mock.Anything).Return(nil)
+
+	digestOf := func(data []byte) string { return fmt.Sprintf("sha256:%x", sha256.Sum256(data)) }
+	configBlob, layerBlob := []byte(`{"architecture":"amd64"}`), []byte("layer content")
+	for _, blob := range [][]byte{configBlob, layerBlob} {
+		assert.NoError(t, handler.backend.Write(handler.pathManager.GetBlobPath(digestOf(blob)), blob))
+	}
+	manifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"mediaType":"%s","digest":"%s","size":%d},"layers":[{"mediaType":"%s","digest":"%s","size":%d}]}`,
+		models.MediaTypeOCIManifest, models.MediaTypeOCIConfig, digestOf(configBlob), len(configBlob),
+		models.MediaTypeOCILayer, digestOf(layerBlob), len(layerBlob)))
+
+	push := func(tag string) {
+		req := httptest.NewRequest("PUT", "/v2/team/app/manifests/"+tag, bytes.NewReader(manifest))
+		req.Header.Set("Content-Type", models.MediaTypeOCIManifest)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 201, resp.StatusCode)
+	}
+	ruleStatus := func() models.ReplicationRuleStatus {
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/replication/rules", nil))
+		assert.NoError(t, err)
+		var body struct {
+			Rules []models.ReplicationRuleStatus `json:"rules"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Len(t, body.Rules, 1)
+		return body.Rules[0]
+	}
+
+	// "latest" does not match the tag pattern and is never queued
+	push("latest")
+	push("v1.0.0")
+
+	// The failed manifest upload is rescheduled an hour later
+	assert.Eventually(t, func() bool { return ruleStatus().Errors == 1 }, 5*time.Second, 20*time.Millisecond)
+	status := ruleStatus()
+	assert.Equal(t, 1, status.Pending)
+	assert.Equal(t, int64(0), status.Replicated)
+	assert.Contains(t, status.LastFailure.Error, "503")
+
+	// Replicating now retries without waiting for the backoff
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/replication/rules/eu/run", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+	assert.Eventually(t, func() bool { return ruleStatus().Replicated == 1 }, 5*time.Second, 20*time.Millisecond)
+	status = ruleStatus()
+	assert.Equal(t, 0, status.Pending)
+	assert.Equal(t, "v1.0.0", status.LastSuccess.Reference)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, manifest, destManifests["central/team/app:v1.0.0"])
+	assert.NotContains(t, destManifests, "central/team/app:latest")
+	assert.Equal(t, configBlob, destBlobs[digestOf(configBlob)])
+	assert.Equal(t, layerBlob, destBlobs[digestOf(layerBlob)])
+	// Blobs copied by the failed attempt are found by HEAD and not uploaded again
+	assert.Equal(t, 2, blobUploads)
+
+	resp, err = app.Test(httptest.NewRequest("POST", "/api/replication/rules/unknown/run", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
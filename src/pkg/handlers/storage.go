@@ -0,0 +1,107 @@
+// pkg/handlers/storage.go
+package handlers
+
+import (
+	"errors"
+
+	service "oci-storage/pkg/services"
+	"oci-storage/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StorageHandler handles storage maintenance HTTP requests
+type StorageHandler struct {
+	migrationService *service.BlobMigrationService
+	fsckService      *service.FsckService
+	encryption       *service.EncryptionService // nil when storage encryption is disabled
+	log              *utils.Logger
+}
+
+// NewStorageHandler creates a new storage maintenance handler
+func NewStorageHandler(migrationService *service.BlobMigrationService, fsckService *service.FsckService, log *utils.Logger) *StorageHandler {
+	return &StorageHandler{
+		migrationService: migrationService,
+		fsckService:      fsckService,
+		log:              log,
+	}
+}
+
+// SetEncryptionService enables the encryption rewrap endpoints
+func (h *StorageHandler) SetEncryptionService(encryption *service.EncryptionService) {
+	h.encryption = encryption
+}
+
+// MigrateBlobLayout starts moving flat blobs to the sharded layout in the background
+// POST /api/storage/blob-layout/migrate
+func (h *StorageHandler) MigrateBlobLayout(c *fiber.Ctx) error {
+	if err := h.migrationService.Start(); err != nil {
+		if errors.Is(err, service.ErrBlobMigrationRunning) {
+			return HTTPError(c, 409, err.Error())
+		}
+		h.log.WithError(err).Error("Failed to start blob layout migration")
+		return HTTPError(c, 500, "Failed to start blob layout migration")
+	}
+
+	h.log.Info("Blob layout migration triggered via API")
+	return c.Status(202).JSON(h.migrationService.Status())
+}
+
+// GetBlobLayoutStatus returns the progress of the blob layout migration
+// GET /api/storage/blob-layout
+func (h *StorageHandler) GetBlobLayoutStatus(c *fiber.Ctx) error {
+	return c.JSON(h.migrationService.Status())
+}
+
+// RunFsck starts a storage integrity check in the background
+// POST /api/storage/fsck?repair=quarantine|refetch
+func (h *StorageHandler) RunFsck(c *fiber.Ctx) error {
+	repair := c.Query("repair")
+	if err := h.fsckService.Start(repair); err != nil {
+		switch {
+		case errors.Is(err, service.ErrFsckInvalidRepair):
+			return HTTPError(c, 400, err.Error())
+		case errors.Is(err, service.ErrFsckRunning):
+			return HTTPError(c, 409, err.Error())
+		}
+		h.log.WithError(err).Error("Failed to start fsck")
+		return HTTPError(c, 500, "Failed to start fsck")
+	}
+
+	h.log.WithField("repair", repair).Info("Fsck triggered via API")
+	return c.Status(202).JSON(h.fsckService.Report())
+}
+
+// GetFsckReport returns the progress of the running check, or the report of the last one
+// GET /api/storage/fsck
+func (h *StorageHandler) GetFsckReport(c *fiber.Ctx) error {
+	return c.JSON(h.fsckService.Report())
+}
+
+// RewrapEncryption starts encrypting plaintext objects and rewrapping data keys under the
+// active key in the background
+// POST /api/storage/encryption/rewrap
+func (h *StorageHandler) RewrapEncryption(c *fiber.Ctx) error {
+	if h.encryption == nil {
+		return HTTPError(c, 404, "Storage encryption is not enabled")
+	}
+	if err := h.encryption.Start(); err != nil {
+		if errors.Is(err, service.ErrEncryptionRewrapRunning) {
+			return HTTPError(c, 409, err.Error())
+		}
+		h.log.WithError(err).Error("Failed to start encryption rewrap")
+		return HTTPError(c, 500, "Failed to start encryption rewrap")
+	}
+
+	h.log.Info("Encryption rewrap triggered via API")
+	return c.Status(202).JSON(h.encryption.Status())
+}
+
+// GetEncryptionStatus returns the progress of the encryption rewrap
+// GET /api/storage/encryption
+func (h *StorageHandler) GetEncryptionStatus(c *fiber.Ctx) error {
+	if h.encryption == nil {
+		return HTTPError(c, 404, "Storage encryption is not enabled")
+	}
+	return c.JSON(h.encryption.Status())
+}
@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oci-storage/config"
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/models"
+	service "oci-storage/pkg/services"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBlobLayoutMigration_ServesBothLayouts(t *testing.T) {
+	app, _, _, mockProxyService, handler, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	// Blobs stored before sharding: full digest, bare sha256 hex and sha512 names
+	blobs := map[string][]byte{}
+	writeFlat := func(name string, data []byte) {
+		assert.NoError(t, os.MkdirAll(filepath.Join(tempDir, "blobs"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(tempDir, "blobs", name), data, 0644))
+	}
+	for i, content := range []string{"layer one", "layer two", "layer three"} {
+		data := []byte(content)
+		var digest, name string
+		switch i {
+		case 0:
+			digest = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+			name = digest
+		case 1:
+			digest = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+			name = strings.TrimPrefix(digest, "sha256:")
+		case 2:
+			digest = fmt.Sprintf("sha512:%x", sha512.Sum512(data))
+			name = digest
+		}
+		writeFlat(name, data)
+		blobs[digest] = data
+	}
+	// A blob pushed again after the upgrade exists in both layouts
+	dupData := []byte("pushed twice")
+	dupDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(dupData))
+	writeFlat(dupDigest, dupData)
+	assert.NoError(t, handler.backend.Write(handler.pathManager.GetBlobPath(dupDigest), dupData))
+	blobs[dupDigest] = dupData
+
+	assert.False(t, service.BlobLayoutMigrated(handler.backend))
+	handler.backend = storage.NewLegacyBlobBackend(handler.backend)
+	migration := service.NewBlobMigrationService(handler.backend, handler.pathManager, &coordination.NoopLockManager{}, handler.log)
+	storageHandler := NewStorageHandler(migration, nil, handler.log)
+
+	app.Get("/v2/:name/blobs/:digest", handler.GetBlob)
+	app.Get("/api/storage/blob-layout", storageHandler.GetBlobLayoutStatus)
+	app.Post("/api/storage/blob-layout/migrate", storageHandler.MigrateBlobLayout)
+	mockProxyService.On("IsEnabled").Return(false).Maybe()
+
+	pullAll := func() {
+		for digest, data := range blobs {
+			resp, err := app.Test(httptest.NewRequest("GET", "/v2/app/blobs/"+digest, nil))
+			assert.NoError(t, err)
+			assert.Equal(t, 200, resp.StatusCode, digest)
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, data, body, digest)
+		}
+	}
+
+	// Flat blobs are served before the migration
+	pullAll()
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/storage/blob-layout/migrate", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+
+	var status models.BlobLayoutMigration
+	assert.Eventually(t, func() bool {
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/storage/blob-layout", nil))
+		assert.NoError(t, err)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		return !status.Running
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.True(t, status.Completed)
+	assert.Equal(t, 3, status.Moved)
+	assert.Equal(t, 1, status.Deduplicated)
+	assert.Equal(t, 0, status.Failed)
+
+	// Every blob now lives at its sharded path only
+	entries, err := os.ReadDir(filepath.Join(tempDir, "blobs"))
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		assert.True(t, entry.IsDir(), entry.Name())
+	}
+	for digest, data := range blobs {
+		stored, err := os.ReadFile(filepath.Join(tempDir, handler.pathManager.GetBlobPath(digest)))
+		assert.NoError(t, err)
+		assert.Equal(t, data, stored)
+	}
+	pullAll()
+	assert.True(t, service.BlobLayoutMigrated(handler.backend))
+}
+
+func TestBlobDigestFromPath_OnlyDigests(t *testing.T) {
+	pathManager := utils.NewPathManager(t.TempDir(), nil)
+	hex := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		path   string
+		digest string
+	}{
+		{"blobs/sha256/ab/ab/" + hex, "sha256:" + hex},
+		{"blobs/sha256:" + hex, "sha256:" + hex},
+		{"blobs/" + hex, "sha256:" + hex},
+		{"blobs/foo", ""},
+		{"blobs/sha256:XYZ", ""},
+		{"blobs/.tmp-upload", ""},
+		{"blobs/sha256/ab/cd/" + hex, ""},
+		{"blobs/SHA256/ab/ab/" + hex, ""},
+		{"manifests/sha256:" + hex, ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.digest, pathManager.BlobDigestFromPath(tt.path), tt.path)
+	}
+}
+
+// reindexCounter stands in for the index service, counting regenerations
+type reindexCounter struct{ updates int }
+
+func (r *reindexCounter) UpdateIndex() error       { r.updates++; return nil }
+func (r *reindexCounter) GetIndexPath() string     { return "index.yaml" }
+func (r *reindexCounter) EnsureIndexExists() error { return nil }
+
+func TestFsck_ReportsAndRepairs(t *testing.T) {
+	app, _, _, mockProxyService, handler, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	write := func(path string, data []byte) {
+		assert.NoError(t, handler.backend.Write(path, data))
+	}
+	digestOf := func(data []byte) string { return fmt.Sprintf("sha256:%x", sha256.Sum256(data)) }
+	manifestFor := func(config, layer []byte) []byte {
+		return []byte(fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":"%s","size":%d},"layers":[{"digest":"%s","size":%d}]}`,
+			digestOf(config), len(config), digestOf(layer), len(layer)))
+	}
+
+	// Pushed image whose layer got truncated
+	config, layer := []byte(`{"os":"linux"}`), []byte("pushed layer content")
+	write(handler.pathManager.GetBlobPath(digestOf(config)), config)
+	write(handler.pathManager.GetBlobPath(digestOf(layer)), layer[:6])
+	manifest := manifestFor(config, layer)
+	write(handler.pathManager.GetBlobPath(digestOf(manifest)), manifest)
+	write(handler.pathManager.GetImageManifestPath("app", "v1"), manifest)
+	write("images/app/tags/v1.json", []byte(`{"name":"app","tag":"v1"}`))
+
+	// Manifest stored under its digest after being re-serialized
+	reserialized := bytes.ReplaceAll(manifest, []byte(","), []byte(", "))
+	write(handler.pathManager.GetImageManifestPath("app", digestOf(manifest)), reserialized)
+
+	// Proxied image with a corrupt layer
+	proxyLayer := []byte("upstream layer content")
+	write(handler.pathManager.GetBlobPath(digestOf(proxyLayer)), []byte("garbage"))
+	write(handler.pathManager.GetImageManifestPath("proxy/docker.io/nginx", "latest"), manifestFor(config, proxyLayer))
+
+	// Stale metadata
+	write("images/app/tags/old.json", []byte(`{"name":"app","tag":"old"}`))
+	write("cache/metadata/proxy_docker.io_gone_latest.json", []byte(`{"name":"proxy/docker.io/gone","tag":"latest"}`))
+	write("index.yaml", []byte("apiVersion: v1\nentries:\n  demo:\n  - name: demo\n    version: 1.0.0\n    digest: abc\n"))
+
+	indexService := &reindexCounter{}
+	fsck := service.NewFsckService(handler.backend, handler.pathManager, mockProxyService, indexService, &coordination.NoopLockManager{}, handler.log)
+	storageHandler := NewStorageHandler(nil, fsck, handler.log)
+	app.Get("/api/storage/fsck", storageHandler.GetFsckReport)
+	app.Post("/api/storage/fsck", storageHandler.RunFsck)
+
+	mockProxyService.On("IsEnabled").Return(true)
+	mockProxyService.On("ResolveRegistry", "proxy/docker.io/nginx").Return("https://registry-1.docker.io", "library/nginx", nil)
+	mockProxyService.On("GetBlob", mock.Anything, "https://registry-1.docker.io", "library/nginx", digestOf(proxyLayer)).
+		Return(io.NopCloser(bytes.NewReader(proxyLayer)), int64(len(proxyLayer)), nil)
+
+	run := func(query string) models.FsckReport {
+		resp, err := app.Test(httptest.NewRequest("POST", "/api/storage/fsck"+query, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 202, resp.StatusCode)
+
+		var report models.FsckReport
+		assert.Eventually(t, func() bool {
+			resp, err := app.Test(httptest.NewRequest("GET", "/api/storage/fsck", nil))
+			assert.NoError(t, err)
+			report = models.FsckReport{}
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+			return !report.Running
+		}, 5*time.Second, 20*time.Millisecond)
+		return report
+	}
+	actions := func(report models.FsckReport) map[string]string {
+		found := map[string]string{}
+		for _, issue := range report.Issues {
+			found[issue.Kind+" "+filepath.ToSlash(issue.Path)] = issue.Action
+		}
+		return found
+	}
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/storage/fsck?repair=delete", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	layerPath := filepath.ToSlash(handler.pathManager.GetBlobPath(digestOf(layer)))
+	proxyLayerPath := filepath.ToSlash(handler.pathManager.GetBlobPath(digestOf(proxyLayer)))
+	digestManifestPath := filepath.ToSlash(handler.pathManager.GetImageManifestPath("app", digestOf(manifest)))
+	expected := map[string]string{
+		"blob_corrupt " + layerPath:                                      "",
+		"blob_corrupt " + proxyLayerPath:                                 "",
+		"manifest_digest_mismatch " + digestManifestPath:                 "",
+		"tag_orphaned images/app/tags/old.json":                          "",
+		"cache_orphaned cache/metadata/proxy_docker.io_gone_latest.json": "",
+		"index_stale charts/demo-1.0.0.tgz":                              "",
+	}
+
+	// Report only: nothing is touched
+	report := run("")
+	assert.Equal(t, expected, actions(report))
+	assert.Equal(t, 4, report.BlobsChecked)
+	assert.Equal(t, 3, report.ManifestsChecked)
+	assert.Equal(t, 0, report.Repaired)
+	assert.Equal(t, 0, indexService.updates)
+
+	report = run("?repair=refetch")
+	expected["blob_corrupt "+layerPath] = models.FsckActionQuarantined
+	expected["blob_corrupt "+proxyLayerPath] = models.FsckActionRefetched
+	expected["manifest_digest_mismatch "+digestManifestPath] = models.FsckActionRestored
+	expected["tag_orphaned images/app/tags/old.json"] = models.FsckActionQuarantined
+	expected["cache_orphaned cache/metadata/proxy_docker.io_gone_latest.json"] = models.FsckActionQuarantined
+	expected["index_stale charts/demo-1.0.0.tgz"] = models.FsckActionReindexed
+	assert.Equal(t, expected, actions(report))
+	assert.Equal(t, 6, report.Repaired)
+	assert.Equal(t, 1, indexService.updates)
+
+	stored, err := os.ReadFile(filepath.Join(tempDir, proxyLayerPath))
+	assert.NoError(t, err)
+	assert.Equal(t, proxyLayer, stored)
+	stored, err = os.ReadFile(filepath.Join(tempDir, digestManifestPath))
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, stored)
+	_, err = os.Stat(filepath.Join(tempDir, "quarantine", layerPath))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(tempDir, layerPath))
+	assert.True(t, os.IsNotExist(err))
+
+	// The report is kept for later runs
+	reloaded := service.NewFsckService(handler.backend, handler.pathManager, nil, nil, &coordination.NoopLockManager{}, handler.log)
+	assert.Equal(t, 6, reloaded.Report().Repaired)
+}
+
+// countingBackend stands in for an object store, counting the calls that reach it
+type countingBackend struct {
+	storage.Backend
+	mu    sync.Mutex
+	calls int
+}
+
+func (b *countingBackend) count() {
+	b.mu.Lock()
+	b.calls++
+	b.mu.Unlock()
+}
+
+func (b *countingBackend) Calls() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls
+}
+
+func (b *countingBackend) Read(path string) ([]byte, error) { b.count(); return b.Backend.Read(path) }
+func (b *countingBackend) Exists(path string) (bool, error) { b.count(); return b.Backend.Exists(path) }
+func (b *countingBackend) Stat(path string) (*storage.FileInfo, error) {
+	b.count()
+	return b.Backend.Stat(path)
+}
+func (b *countingBackend) ReadStream(path string) (io.ReadCloser, error) {
+	b.count()
+	return b.Backend.ReadStream(path)
+}
+
+func TestStorageCache_ServesReadsLocallyAndInvalidatesWrites(t *testing.T) {
+	app, _, _, mockProxyService, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	remote := &countingBackend{Backend: handler.backend}
+	cacheConfig := config.StorageCacheConfig{Enabled: true, MaxSizeGB: 1, MemoryMB: 1, TTLSeconds: 60}
+	cache, err := storage.NewCachingBackend(remote, cacheConfig, t.TempDir())
+	assert.NoError(t, err)
+	// Another replica, telling this one what it changes
+	other, err := storage.NewCachingBackend(remote, cacheConfig, t.TempDir())
+	assert.NoError(t, err)
+	other.SetPublisher(cache.Invalidate)
+	handler.backend = cache
+
+	app.Get("/v2/:name/blobs/:digest", handler.GetBlob)
+	app.Get("/v2/:name/manifests/:reference", handler.HandleManifest)
+	mockProxyService.On("IsEnabled").Return(false)
+
+	get := func(url string) (int, []byte) {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+	// expectRemoteCalls runs fn and checks how many calls reached the object store
+	expectRemoteCalls := func(expected bool, fn func()) {
+		before := remote.Calls()
+		fn()
+		if expected {
+			assert.Greater(t, remote.Calls(), before)
+		} else {
+			assert.Equal(t, before, remote.Calls())
+		}
+	}
+
+	// Blobs are downloaded once, then served from local disk
+	layer := []byte("cached layer content")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(layer))
+	assert.NoError(t, remote.Write(handler.pathManager.GetBlobPath(digest), layer))
+	expectRemoteCalls(true, func() {
+		status, body := get("/v2/app/blobs/" + digest)
+		assert.Equal(t, 200, status)
+		assert.Equal(t, layer, body)
+	})
+	expectRemoteCalls(false, func() {
+		status, body := get("/v2/app/blobs/" + digest)
+		assert.Equal(t, 200, status)
+		assert.Equal(t, layer, body)
+	})
+
+	// Manifests are served from memory, missing ones included
+	assert.NoError(t, remote.Write(handler.pathManager.GetImageManifestPath("app", "v1"), []byte(`{"schemaVersion":2,"tag":"v1"}`)))
+	expectRemoteCalls(true, func() {
+		status, body := get("/v2/app/manifests/v1")
+		assert.Equal(t, 200, status)
+		assert.Contains(t, string(body), `"tag":"v1"`)
+	})
+	expectRemoteCalls(false, func() {
+		status, _ := get("/v2/app/manifests/v1")
+		assert.Equal(t, 200, status)
+	})
+	expectRemoteCalls(true, func() {
+		status, _ := get("/v2/app/manifests/v2")
+		assert.Equal(t, 404, status)
+	})
+	expectRemoteCalls(false, func() {
+		status, _ := get("/v2/app/manifests/v2")
+		assert.Equal(t, 404, status)
+	})
+
+	// Writes from any replica are seen at once
+	assert.NoError(t, other.Write(handler.pathManager.GetImageManifestPath("app", "v1"), []byte(`{"schemaVersion":2,"tag":"v1.1"}`)))
+	assert.NoError(t, other.Write(handler.pathManager.GetImageManifestPath("app", "v2"), []byte(`{"schemaVersion":2,"tag":"v2"}`)))
+	status, body := get("/v2/app/manifests/v1")
+	assert.Equal(t, 200, status)
+	assert.Contains(t, string(body), `"tag":"v1.1"`)
+	status, _ = get("/v2/app/manifests/v2")
+	assert.Equal(t, 200, status)
+
+	// Deleted blobs are no longer served
+	assert.NoError(t, other.Delete(handler.pathManager.GetBlobPath(digest)))
+	status, _ = get("/v2/app/blobs/" + digest)
+	assert.Equal(t, 404, status)
+}
+
+func TestStorageEncryption_ServesAndRewrapsThroughAPI(t *testing.T) {
+	app, _, _, mockProxyService, handler, _, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	keyDir := t.TempDir()
+	keyring := func(name string, ids ...string) *storage.FileKeyring {
+		var lines []string
+		for _, id := range ids {
+			key := sha256.Sum256([]byte("test key " + id))
+			lines = append(lines, id+" "+base64.StdEncoding.EncodeToString(key[:]))
+		}
+		path := filepath.Join(keyDir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600))
+		k, err := storage.NewFileKeyring(path)
+		assert.NoError(t, err)
+		return k
+	}
+	digestOf := func(data []byte) string { return fmt.Sprintf("sha256:%x", sha256.Sum256(data)) }
+
+	// Blob stored before encryption was enabled
+	legacy := []byte("stored in plaintext")
+	legacyPath := handler.pathManager.GetBlobPath(digestOf(legacy))
+	assert.NoError(t, handler.backend.Write(legacyPath, legacy))
+
+	local := handler.backend
+	encrypting := storage.NewEncryptingBackend(local, keyring("keys-v1", "v1"))
+	handler.backend = encrypting
+	app.Get("/v2/:name/blobs/:digest", handler.GetBlob)
+	app.Get("/v2/:name/manifests/:reference", handler.HandleManifest)
+	mockProxyService.On("IsEnabled").Return(false)
+
+	get := func(url string) (int, []byte, string) {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body, resp.Header.Get("Content-Length")
+	}
+
+	// A layer spanning several segments, imported as pulls and pushes do
+	layer := make([]byte, 200*1024+7)
+	for i := range layer {
+		layer[i] = byte(i * 31)
+	}
+	layerPath := handler.pathManager.GetBlobPath(digestOf(layer))
+	upload := filepath.Join(t.TempDir(), "upload")
+	assert.NoError(t, os.WriteFile(upload, layer, 0644))
+	assert.NoError(t, encrypting.Import(upload, layerPath))
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	manifestPath := handler.pathManager.GetImageManifestPath("app", "v1")
+	assert.NoError(t, encrypting.Write(manifestPath, manifest))
+
+	// Contents are served in clear, with their content size
+	status, body, length := get("/v2/app/blobs/" + digestOf(layer))
+	assert.Equal(t, 200, status)
+	assert.Equal(t, layer, body)
+	assert.Equal(t, fmt.Sprint(len(layer)), length)
+	status, body, _ = get("/v2/app/manifests/v1")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, manifest, body)
+	status, body, _ = get("/v2/app/blobs/" + digestOf(legacy))
+	assert.Equal(t, 200, status)
+	assert.Equal(t, legacy, body)
+
+	// Rotation: the new key encrypts, the previous one still decrypts
+	encrypting = storage.NewEncryptingBackend(local, keyring("keys-v2", "v2", "v1"))
+	handler.backend = encrypting
+	storageHandler := NewStorageHandler(nil, nil, handler.log)
+	storageHandler.SetEncryptionService(service.NewEncryptionService(encrypting, &coordination.NoopLockManager{}, handler.log))
+	app.Get("/api/storage/encryption", storageHandler.GetEncryptionStatus)
+	app.Post("/api/storage/encryption/rewrap", storageHandler.RewrapEncryption)
+	status, body, _ = get("/v2/app/blobs/" + digestOf(layer))
+	assert.Equal(t, 200, status)
+	assert.Equal(t, layer, body)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/storage/encryption/rewrap", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 202, resp.StatusCode)
+	var rewrap models.EncryptionRewrap
+	assert.Eventually(t, func() bool {
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/storage/encryption", nil))
+		assert.NoError(t, err)
+		rewrap = models.EncryptionRewrap{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&rewrap))
+		return !rewrap.Running
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.True(t, rewrap.Completed, rewrap.LastError)
+	assert.Equal(t, "v2", rewrap.ActiveKey)
+	assert.Equal(t, 3, rewrap.Rewrapped)
+	assert.True(t, service.EncryptionCompleted(encrypting))
+
+	// Once rewrapped, objects are served with the active key alone
+	handler.backend = storage.NewEncryptingBackend(local, keyring("keys-v3", "v2"))
+	status, body, _ = get("/v2/app/blobs/" + digestOf(legacy))
+	assert.Equal(t, 200, status)
+	assert.Equal(t, legacy, body)
+	status, body, _ = get("/v2/app/manifests/v1")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, manifest, body)
+}
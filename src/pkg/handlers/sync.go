@@ -0,0 +1,65 @@
+// pkg/handlers/sync.go
+package handlers
+
+import (
+	"errors"
+
+	"oci-storage/pkg/interfaces"
+	service "oci-storage/pkg/services"
+	"oci-storage/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SyncHandler exposes the scheduled repository mirroring jobs
+type SyncHandler struct {
+	syncService interfaces.SyncServiceInterface
+	log         *utils.Logger
+}
+
+// NewSyncHandler creates a new repository sync handler
+func NewSyncHandler(syncService interfaces.SyncServiceInterface, log *utils.Logger) *SyncHandler {
+	return &SyncHandler{
+		syncService: syncService,
+		log:         log,
+	}
+}
+
+// ListJobs returns the configuration and last run of every sync job
+// GET /api/sync/jobs
+func (h *SyncHandler) ListJobs(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"jobs": h.syncService.GetStatus()})
+}
+
+// GetJob returns the status of a sync job
+// GET /api/sync/jobs/:name
+func (h *SyncHandler) GetJob(c *fiber.Ctx) error {
+	status, err := h.syncService.GetJobStatus(c.Params("name"))
+	if err != nil {
+		return HTTPError(c, 404, "Sync job not found")
+	}
+	return c.JSON(status)
+}
+
+// RunJob starts a sync job now, regardless of its schedule
+// POST /api/sync/jobs/:name/run
+func (h *SyncHandler) RunJob(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	if err := h.syncService.RunJob(name); err != nil {
+		switch {
+		case errors.Is(err, service.ErrSyncJobNotFound):
+			return HTTPError(c, 404, "Sync job not found")
+		case errors.Is(err, service.ErrSyncJobRunning):
+			return HTTPError(c, 409, "Sync job already running")
+		}
+		h.log.WithError(err).WithField("job", name).Error("Failed to start sync job")
+		return HTTPError(c, 500, "Failed to start sync job")
+	}
+
+	h.log.WithField("job", name).Info("Sync job triggered via API")
+	return c.Status(202).JSON(fiber.Map{
+		"job": name,
+		"url": "/api/sync/jobs/" + name,
+	})
+}
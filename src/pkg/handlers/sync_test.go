@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"oci-storage/config"
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/models"
+	service "oci-storage/pkg/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSync_MirrorsMatchingTagsAndPlatforms(t *testing.T) {
+	app, _, mockImageService, _, handler, tempDir, cleanup := setupProxyTestEnv(t)
+	defer cleanup()
+
+	digestOf := func(data []byte) string { return fmt.Sprintf("sha256:%x", sha256.Sum256(data)) }
+	blobs := map[string][]byte{}
+	manifests := map[string][]byte{}
+	imageManifest := func(layer string) []byte {
+		config, content := []byte(`{"layer":"`+layer+`"}`), []byte("layer "+layer)
+		blobs[digestOf(config)], blobs[digestOf(content)] = config, content
+		data := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"mediaType":"%s","digest":"%s","size":%d},"layers":[{"mediaType":"%s","digest":"%s","size":%d}]}`,
+			models.MediaTypeOCIManifest, models.MediaTypeOCIConfig, digestOf(config), len(config),
+			models.MediaTypeOCILayer, digestOf(content), len(content)))
+		manifests[digestOf(data)] = data
+		return data
+	}
+	amd64, arm64 := imageManifest("amd64"), imageManifest("arm64")
+	manifests["v1.0.0"] = imageManifest("single")
+	manifests["v1.1.0"] = []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","manifests":[`+
+		`{"mediaType":"%s","digest":"%s","size":%d,"platform":{"os":"linux","architecture":"amd64"}},`+
+		`{"mediaType":"%s","digest":"%s","size":%d,"platform":{"os":"linux","architecture":"arm64"}}]}`,
+		models.MediaTypeOCIManifestList,
+		models.MediaTypeOCIManifest, digestOf(amd64), len(amd64),
+		models.MediaTypeOCIManifest, digestOf(arm64), len(arm64)))
+	manifests["latest"] = manifests["v1.1.0"]
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v2/org/app/")
+		switch {
+		case path == "tags/list":
+			w.Write([]byte(`{"name":"org/app","tags":["latest","v1.0.0","v1.1.0","v2.0.0-rc1"]}`))
+		case strings.HasPrefix(path, "manifests/"):
+			data, ok := manifests[strings.TrimPrefix(path, "manifests/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", models.MediaTypeOCIManifest)
+			w.Write(data)
+		case strings.HasPrefix(path, "blobs/"):
+			data, ok := blobs[strings.TrimPrefix(path, "blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := *handler.config
+	cfg.Proxy.Registries = append(cfg.Proxy.Registries, config.RegistryConfig{Name: "ghcr.io", URL: upstream.URL})
+	cfg.Sync = config.SyncConfig{
+		Enabled: true,
+		Jobs: []config.SyncJobConfig{{
+			Name:            "app-releases",
+			Source:          "ghcr.io/org/app",
+			Target:          "mirror/ghcr.io/org/app",
+			TagPattern:      `^v\d+\.\d+\.\d+$`,
+			Platforms:       []string{"linux/amd64"},
+			IntervalMinutes: 360,
+		}},
+	}
+	proxyService := service.NewProxyService(&cfg, handler.log, handler.pathManager, handler.backend)
+	syncService, err := service.NewSyncService(&cfg, handler.log, handler.pathManager, handler.backend, proxyService, mockImageService, &coordination.NoopLockManager{})
+	assert.NoError(t, err)
+
+	mockImageService.On("SaveImage", "mirror/ghcr.io/org/app", "v1.0.0", mock.Anything).Return(nil)
+	mockImageService.On("SaveImageIndex", "mirror/ghcr.io/org/app", "v1.1.0", mock.Anything, mock.Anything).Return(nil)
+
+	syncHandler := NewSyncHandler(syncService, handler.log)
+	app.Get("/api/sync/jobs/:name", syncHandler.GetJob)
+	app.Post("/api/sync/jobs/:name/run", syncHandler.RunJob)
+
+	runJob := func() models.SyncJobStatus {
+		resp, err := app.Test(httptest.NewRequest("POST", "/api/sync/jobs/app-releases/run", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 202, resp.StatusCode)
+
+		var status models.SyncJobStatus
+		assert.Eventually(t, func() bool {
+			resp, err := app.Test(httptest.NewRequest("GET", "/api/sync/jobs/app-releases", nil))
+			assert.NoError(t, err)
+			status = models.SyncJobStatus{}
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+			return !status.Running && status.LastRun != nil && status.LastRun.FinishedAt != nil
+		}, 5*time.Second, 20*time.Millisecond)
+		return status
+	}
+
+	// Only release tags are mirrored, and only the amd64 platform of multi-arch images
+	status := runJob()
+	assert.Equal(t, models.SyncStatusSucceeded, status.LastRun.Status)
+	assert.Equal(t, 2, status.LastRun.TagsMatched)
+	assert.Equal(t, 2, status.LastRun.TagsCopied)
+	assert.Equal(t, 4, status.LastRun.BlobsCopied)
+	assert.NotNil(t, status.LastSuccess)
+	assert.NotNil(t, status.NextRun)
+
+	stored, err := handler.backend.Read(handler.pathManager.GetImageManifestPath("mirror/ghcr.io/org/app", "v1.1.0"))
+	assert.NoError(t, err)
+	var index models.OCIIndex
+	assert.NoError(t, json.Unmarshal(stored, &index))
+	assert.Len(t, index.Manifests, 1)
+	assert.Equal(t, "amd64", index.Manifests[0].Platform.Architecture)
+
+	var arm64Manifest models.OCIManifest
+	assert.NoError(t, json.Unmarshal(arm64, &arm64Manifest))
+	exists, _ := handler.backend.Exists(handler.pathManager.GetBlobPath(arm64Manifest.Layers[0].Digest))
+	assert.False(t, exists)
+
+	// Mirrored images are local images, not proxy cache entries
+	_, err = os.Stat(filepath.Join(tempDir, "cache", "metadata"))
+	assert.True(t, os.IsNotExist(err))
+
+	// A second run finds everything up to date
+	status = runJob()
+	assert.Equal(t, models.SyncStatusSucceeded, status.LastRun.Status)
+	assert.Equal(t, 0, status.LastRun.TagsCopied)
+	assert.Equal(t, 2, status.LastRun.TagsUnchanged)
+	mockImageService.AssertNumberOfCalls(t, "SaveImage", 1)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/sync/jobs/unknown/run", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+}
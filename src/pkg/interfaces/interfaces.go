@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
 
 	"oci-storage/pkg/models"
 	storage "oci-storage/pkg/utils"
@@ -20,6 +21,8 @@ type ChartServiceInterface interface {
 	GetPathManager() *storage.PathManager
 	GetChartValues(name, version string) (string, error)
 	ExtractChartMetadata(chartData []byte) (*models.ChartMetadata, error)
+	// ListCachedCharts returns the Helm charts held in the proxy cache
+	ListCachedCharts() ([]models.ChartMetadata, error)
 }
 
 type ImageServiceInterface interface {
@@ -96,12 +99,20 @@ type ProxyServiceInterface interface {
 	GetCacheState() *models.CacheState
 	// GetCachedImages returns all cached images metadata
 	GetCachedImages() ([]models.CachedImageMetadata, error)
-	// UpdateAccessTime updates the last accessed time for a cached image
-	UpdateAccessTime(name, tag string)
-	// EvictLRU removes least recently used images until target size is reached
-	EvictLRU(targetBytes int64) error
+	// UpdateAccessTime records a pull of a cached manifest by tag or digest (batched)
+	UpdateAccessTime(name, reference string)
+	// RecordBlobAccess records that a cached blob was served for a repository (batched)
+	RecordBlobAccess(name, digest string)
 	// DeleteCachedImage removes a specific cached image
 	DeleteCachedImage(name, tag string) error
+	// PinCachedImage pins or unpins a cached image (pinned images are never evicted)
+	PinCachedImage(name, tag string, pinned bool) error
+	// SimulateEviction reports what each eviction policy would evict now, without deleting anything
+	SimulateEviction(policies []string, targetBytes int64) ([]models.EvictionSimulation, error)
+	// GetHelmIndex returns a proxied Helm repository's index.yaml rewritten to point at oci-storage
+	GetHelmIndex(ctx context.Context, repo string) ([]byte, error)
+	// GetHelmChart returns a chart archive of a proxied Helm repository, caching it on first download
+	GetHelmChart(ctx context.Context, repo, chart, version string) ([]byte, error)
 	// AddToCache adds image metadata to the cache tracking
 	AddToCache(metadata models.CachedImageMetadata) error
 	// IsEnabled returns whether the proxy is enabled
@@ -110,4 +121,46 @@ type ProxyServiceInterface interface {
 	PurgeAllCache() error
 	// FetchWithAuth performs an HTTP request with upstream registry authentication
 	FetchWithAuth(ctx context.Context, req *http.Request, registryURL, name string) (*http.Response, error)
+	// GetUpstreamStatus returns circuit breaker and negative cache state per registry
+	GetUpstreamStatus() []models.UpstreamStatus
+	// RetryAfter returns how long until an open circuit breaker or exhausted quota allows requests again
+	RetryAfter(registryURL string) time.Duration
+	// IsQuotaLow reports whether the registry's remaining pull quota is low
+	IsQuotaLow(registryURL string) bool
+	// ListUpstreamTags returns all tags of a repository on the upstream registry
+	ListUpstreamTags(ctx context.Context, registryURL, name string) ([]string, error)
+	// ListUpstreamCatalog returns the repositories listed by the upstream registry's _catalog
+	ListUpstreamCatalog(ctx context.Context, registryURL string) ([]string, error)
+}
+
+// SyncServiceInterface runs the scheduled repository mirroring jobs
+type SyncServiceInterface interface {
+	// RunJob starts a run of a sync job in the background
+	RunJob(name string) error
+	// GetStatus returns the status of every configured sync job
+	GetStatus() []models.SyncJobStatus
+	// GetJobStatus returns the status of one sync job
+	GetJobStatus(name string) (*models.SyncJobStatus, error)
+}
+
+// UploadServiceInterface stores chunked blob uploads in object storage, so any replica can continue them
+type UploadServiceInterface interface {
+	// Create starts an empty upload session
+	Create(uuid string) error
+	// Append adds a chunk and returns the bytes read from body and the total upload size
+	Append(ctx context.Context, uuid string, body io.Reader) (int64, int64, error)
+	// Complete adds the final chunk, verifies the digest and stores the blob
+	Complete(ctx context.Context, uuid, digest string, body io.Reader) error
+	// Discard aborts an upload session and deletes its data
+	Discard(uuid string) error
+}
+
+// ReplicationServiceInterface copies pushed artifacts to downstream registries
+type ReplicationServiceInterface interface {
+	// Enqueue queues a successful manifest push for the matching replication rules
+	Enqueue(repository, reference, digest string)
+	// ReplicateNow queues every local tag matching a rule and retries its failed tasks
+	ReplicateNow(name string) (int, error)
+	// GetStatus returns the queue sizes and outcomes of every replication rule
+	GetStatus() []models.ReplicationRuleStatus
 }
@@ -14,15 +14,46 @@ type CachedImageMetadata struct {
 	CachedAt       time.Time `json:"cachedAt"`
 	LastAccessed   time.Time `json:"lastAccessed"`
 	AccessCount    int64     `json:"accessCount"`
+	Pinned         bool      `json:"pinned,omitempty"`         // Pinned through the API: never evicted nor GC'd
+	PinnedByConfig bool      `json:"pinnedByConfig,omitempty"` // Matches proxy.cache.pinned (computed, not persisted)
+	// ArtifactType is "helm" for proxied Helm charts; empty for container images
+	ArtifactType ArtifactType `json:"artifactType,omitempty"`
+}
+
+// IsPinned reports whether the image is protected from eviction and stale GC
+func (m *CachedImageMetadata) IsPinned() bool {
+	return m.Pinned || m.PinnedByConfig
+}
+
+// CachedChart locates the archive of a Helm chart held in the proxy cache
+type CachedChart struct {
+	Repository string `json:"repository"` // e.g. "proxy/ghcr.io/org/charts/foo"
+	Tag        string `json:"tag"`
+	Digest     string `json:"digest"` // chart archive layer
+	Size       int64  `json:"size"`
 }
 
 // CacheState represents the overall cache state
 type CacheState struct {
-	TotalSize    int64                 `json:"totalSize"`
-	MaxSize      int64                 `json:"maxSize"`
-	ItemCount    int                   `json:"itemCount"`
-	UsagePercent float64               `json:"usagePercent"`
-	Images       []CachedImageMetadata `json:"images,omitempty"`
+	TotalSize      int64                 `json:"totalSize"`
+	MaxSize        int64                 `json:"maxSize"`
+	ItemCount      int                   `json:"itemCount"`
+	UsagePercent   float64               `json:"usagePercent"`
+	PinnedSize     int64                 `json:"pinnedSize"`
+	EvictionPolicy string                `json:"evictionPolicy,omitempty"`
+	Registries     []RegistryCacheUsage  `json:"registries,omitempty"`
+	Images         []CachedImageMetadata `json:"images,omitempty"`
+}
+
+// RegistryCacheUsage reports the cache usage of a single upstream registry
+type RegistryCacheUsage struct {
+	Registry     string  `json:"registry"` // e.g., "docker.io"
+	TotalSize    int64   `json:"totalSize"`
+	MaxSize      int64   `json:"maxSize"` // per-registry quota, 0 when the registry has none
+	ItemCount    int     `json:"itemCount"`
+	PinnedSize   int64   `json:"pinnedSize"`
+	PinnedCount  int     `json:"pinnedCount"`
+	UsagePercent float64 `json:"usagePercent"` // of MaxSize, 0 without quota
 }
 
 // CalculateUsagePercent calculates and sets the usage percentage
@@ -34,6 +65,54 @@ func (cs *CacheState) CalculateUsagePercent() {
 	}
 }
 
+// EvictionSimulation reports what an eviction policy would evict from the cache now
+type EvictionSimulation struct {
+	Policy     string         `json:"policy"`
+	SizeBefore int64          `json:"sizeBefore"` // deduplicated cache size
+	SizeAfter  int64          `json:"sizeAfter"`
+	FreedBytes int64          `json:"freedBytes"`
+	Evicted    []EvictedImage `json:"evicted"` // in eviction order
+}
+
+// EvictedImage is a cached image selected by an eviction policy
+type EvictedImage struct {
+	Name         string    `json:"name"`
+	Tag          string    `json:"tag"`
+	Registry     string    `json:"registry"`
+	Size         int64     `json:"size"`
+	LastAccessed time.Time `json:"lastAccessed"`
+	AccessCount  int64     `json:"accessCount"`
+	Reason       string    `json:"reason"` // expired | quota | size
+}
+
+// UpstreamStatus reports the health of an upstream registry as seen by the proxy
+type UpstreamStatus struct {
+	Registry             string                   `json:"registry"` // e.g., "docker.io"
+	URL                  string                   `json:"url"`
+	BreakerState         string                   `json:"breakerState"` // best state across endpoints: closed | half-open | open
+	NegativeCacheEntries int                      `json:"negativeCacheEntries"`
+	Endpoints            []UpstreamEndpointStatus `json:"endpoints"` // in failover order
+}
+
+// UpstreamEndpointStatus reports the circuit breaker state of a single upstream endpoint
+type UpstreamEndpointStatus struct {
+	URL                 string             `json:"url"`
+	BreakerState        string             `json:"breakerState"` // closed | open | half-open
+	ConsecutiveFailures int                `json:"consecutiveFailures"`
+	OpenedAt            *time.Time         `json:"openedAt,omitempty"`
+	LastFailure         *time.Time         `json:"lastFailure,omitempty"`
+	LastError           string             `json:"lastError,omitempty"`
+	RateLimit           *UpstreamRateLimit `json:"rateLimit,omitempty"` // Set once the endpoint advertised a pull quota
+}
+
+// UpstreamRateLimit is the pull quota last advertised by an upstream endpoint
+type UpstreamRateLimit struct {
+	Limit     int        `json:"limit"`
+	Remaining int        `json:"remaining"`
+	Reset     *time.Time `json:"reset,omitempty"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
 // StorageStats contains storage statistics for the registry
 type StorageStats struct {
 	BlobCount        int   `json:"blobCount"`
@@ -44,3 +123,30 @@ type StorageStats struct {
 	ChartsSize       int64 `json:"chartsSize"`
 	TotalSize        int64 `json:"totalSize"`
 }
+
+// BlobLayoutMigration reports the progress of moving blobs from the flat layout
+// (blobs/<digest>) to the sharded one (blobs/<algorithm>/<ab>/<cd>/<hex>)
+type BlobLayoutMigration struct {
+	Running      bool       `json:"running"`
+	Completed    bool       `json:"completed"` // no flat blob left: the legacy fallback is disabled on restart
+	Moved        int        `json:"moved"`
+	Deduplicated int        `json:"deduplicated"` // flat copies deleted because the sharded blob already existed
+	Failed       int        `json:"failed"`
+	LastError    string     `json:"lastError,omitempty"`
+	StartedAt    *time.Time `json:"startedAt,omitempty"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+}
+
+// EncryptionRewrap reports the progress of bringing every stored object under the active
+// encryption key: plaintext objects are encrypted, data keys wrapped by older keys rewrapped
+type EncryptionRewrap struct {
+	Running    bool       `json:"running"`
+	Completed  bool       `json:"completed"` // every object encrypted: plaintext is rejected on restart
+	ActiveKey  string     `json:"activeKey"`
+	Checked    int        `json:"checked"`
+	Rewrapped  int        `json:"rewrapped"`
+	Failed     int        `json:"failed"`
+	LastError  string     `json:"lastError,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
@@ -20,6 +20,10 @@ type ChartMetadata struct {
 		Version    string `yaml:"version"`
 		Repository string `yaml:"repository"`
 	} `yaml:"dependencies,omitempty"`
+
+	// Set for charts served from the proxy cache (not part of Chart.yaml)
+	Source string `yaml:"-"` // cached repository, e.g. "proxy/ghcr.io/org/charts/foo"
+	Digest string `yaml:"-"` // digest of the chart archive blob
 }
 
 type ChartGroup struct {
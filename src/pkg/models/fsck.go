@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Fsck repair modes
+const (
+	FsckRepairNone       = ""           // report only
+	FsckRepairQuarantine = "quarantine" // move broken content under quarantine/
+	FsckRepairRefetch    = "refetch"    // re-download proxied content, quarantine the rest
+)
+
+// Fsck issue kinds
+const (
+	FsckBlobCorrupt            = "blob_corrupt"             // content does not hash to its digest (e.g. truncated)
+	FsckBlobUnreadable         = "blob_unreadable"          // listed but cannot be read
+	FsckBlobMissing            = "blob_missing"             // referenced by a manifest but not stored
+	FsckBlobSizeMismatch       = "blob_size_mismatch"       // stored size differs from the manifest descriptor
+	FsckManifestInvalid        = "manifest_invalid"         // not a JSON manifest
+	FsckManifestDigestMismatch = "manifest_digest_mismatch" // stored under a digest its content does not hash to
+	FsckManifestMissing        = "manifest_missing"         // child of a pushed index not stored
+	FsckTagOrphaned            = "tag_orphaned"             // tag metadata without a manifest
+	FsckIndexInvalid           = "index_invalid"            // index.yaml cannot be read or parsed
+	FsckIndexStale             = "index_stale"              // index.yaml and charts/ disagree
+	FsckCacheInvalid           = "cache_invalid"            // cache metadata cannot be parsed
+	FsckCacheOrphaned          = "cache_orphaned"           // cache metadata without a manifest
+)
+
+// Fsck repair actions
+const (
+	FsckActionQuarantined = "quarantined"
+	FsckActionRefetched   = "refetched"
+	FsckActionRestored    = "restored" // manifest rewritten from its blob copy
+	FsckActionReindexed   = "reindexed"
+)
+
+// FsckIssue is an inconsistency found by fsck
+type FsckIssue struct {
+	Kind        string `json:"kind"`
+	Path        string `json:"path"`
+	Repository  string `json:"repository,omitempty"`
+	Digest      string `json:"digest,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+	Action      string `json:"action,omitempty"` // repair applied, empty when only reported
+	RepairError string `json:"repairError,omitempty"`
+}
+
+// FsckReport reports the progress of a storage integrity check, then its findings
+type FsckReport struct {
+	Running             bool        `json:"running"`
+	Repair              string      `json:"repair,omitempty"`
+	BlobsChecked        int         `json:"blobsChecked"`
+	BytesHashed         int64       `json:"bytesHashed"`
+	ManifestsChecked    int         `json:"manifestsChecked"`
+	TagsChecked         int         `json:"tagsChecked"`
+	ChartsChecked       int         `json:"chartsChecked"`
+	CacheEntriesChecked int         `json:"cacheEntriesChecked"`
+	Issues              []FsckIssue `json:"issues"`
+	Repaired            int         `json:"repaired"`
+	Errors              []string    `json:"errors,omitempty"` // checks that could not complete
+	StartedAt           *time.Time  `json:"startedAt,omitempty"`
+	FinishedAt          *time.Time  `json:"finishedAt,omitempty"`
+	DurationMs          int64       `json:"durationMs"`
+}
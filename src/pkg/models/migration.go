@@ -0,0 +1,24 @@
+package models
+
+// StorageMigrationReport is the outcome of copying every object from one storage backend to another
+type StorageMigrationReport struct {
+	Source      string                    `json:"source"`
+	Target      string                    `json:"target"`
+	DryRun      bool                      `json:"dryRun,omitempty"`
+	Objects     int                       `json:"objects"` // listed in the source
+	Copied      int                       `json:"copied"`
+	Skipped     int                       `json:"skipped"`           // already in the target with the same content
+	Pending     int                       `json:"pending,omitempty"` // dry run: would be copied
+	Failed      int                       `json:"failed"`
+	BytesCopied int64                     `json:"bytesCopied"`
+	Failures    []StorageMigrationFailure `json:"failures,omitempty"`
+	Extra       []string                  `json:"extra,omitempty"` // in the target but not in the source
+	Consistent  bool                      `json:"consistent"`      // every source object is in the target, verified
+	DurationMs  int64                     `json:"durationMs"`
+}
+
+// StorageMigrationFailure is an object that could not be copied
+type StorageMigrationFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Prefetch job and image states
+const (
+	PrefetchStatusPending   = "pending"
+	PrefetchStatusRunning   = "running"
+	PrefetchStatusCompleted = "completed"
+	PrefetchStatusFailed    = "failed"
+)
+
+// PrefetchRequest is the body of POST /api/cache/prefetch
+type PrefetchRequest struct {
+	Images []string          `json:"images"`          // e.g. "nginx:1.27", "ghcr.io/org/app@sha256:..."
+	Chart  *PrefetchChartRef `json:"chart,omitempty"` // Stored Helm chart whose values reference images
+}
+
+// PrefetchChartRef identifies a Helm chart stored in the registry
+type PrefetchChartRef struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// PrefetchJob reports the progress of a cache pre-warm job
+type PrefetchJob struct {
+	ID              string                `json:"id"`
+	Status          string                `json:"status"` // running | completed | failed
+	Images          []PrefetchImageStatus `json:"images"`
+	BlobsTotal      int                   `json:"blobsTotal"`
+	BlobsDone       int                   `json:"blobsDone"`   // downloaded or already cached
+	BlobsCached     int                   `json:"blobsCached"` // already cached before the job
+	BlobsFailed     int                   `json:"blobsFailed"`
+	BytesDownloaded int64                 `json:"bytesDownloaded"`
+	StartedAt       time.Time             `json:"startedAt"`
+	FinishedAt      *time.Time            `json:"finishedAt,omitempty"`
+}
+
+// PrefetchImageStatus reports the progress of a single image within a prefetch job
+type PrefetchImageStatus struct {
+	Reference string `json:"reference"` // as requested
+	Name      string `json:"name"`      // proxy cache path, e.g. proxy/docker.io/library/nginx
+	Tag       string `json:"tag"`       // tag or digest
+	Platforms int    `json:"platforms"` // platform manifests fetched (0 for single-platform images)
+	Blobs     int    `json:"blobs"`
+	Status    string `json:"status"` // pending | running | completed | failed
+	Error     string `json:"error,omitempty"`
+}
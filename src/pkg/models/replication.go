@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// ReplicationTask is a queued copy of a pushed manifest tree to a rule's destination
+type ReplicationTask struct {
+	ID          string    `json:"id"`
+	Rule        string    `json:"rule"`
+	Repository  string    `json:"repository"`
+	Reference   string    `json:"reference"` // tag, or digest for referrers pushed by digest
+	Digest      string    `json:"digest"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// ReplicationEvent records the outcome of one replication
+type ReplicationEvent struct {
+	Repository string    `json:"repository"`
+	Reference  string    `json:"reference"`
+	Digest     string    `json:"digest"`
+	At         time.Time `json:"at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// ReplicationRuleStatus reports the configuration, queue and outcomes of a replication rule
+type ReplicationRuleStatus struct {
+	Name         string            `json:"name"`
+	Destination  string            `json:"destination"`
+	Repositories []string          `json:"repositories,omitempty"`
+	TagPattern   string            `json:"tagPattern,omitempty"`
+	Charts       string            `json:"charts"`
+	Pending      int               `json:"pending"` // queued, including retries
+	Failed       int               `json:"failed"`  // gave up after maxAttempts
+	Replicated   int64             `json:"replicated"`
+	Errors       int64             `json:"errors"` // failed attempts
+	LastSuccess  *ReplicationEvent `json:"lastSuccess,omitempty"`
+	LastFailure  *ReplicationEvent `json:"lastFailure,omitempty"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Sync run outcomes
+const (
+	SyncStatusRunning   = "running"
+	SyncStatusSucceeded = "succeeded"
+	SyncStatusPartial   = "partial" // some tags failed
+	SyncStatusFailed    = "failed"
+)
+
+// SyncJobStatus reports the configuration and last run of a repository sync job
+type SyncJobStatus struct {
+	Name            string     `json:"name"`
+	Source          string     `json:"source"`
+	Target          string     `json:"target"`
+	TagPattern      string     `json:"tagPattern,omitempty"`
+	Platforms       []string   `json:"platforms,omitempty"`
+	IntervalMinutes int        `json:"intervalMinutes"`
+	Running         bool       `json:"running"`
+	NextRun         *time.Time `json:"nextRun,omitempty"`
+	LastRun         *SyncRun   `json:"lastRun,omitempty"`
+	LastSuccess     *time.Time `json:"lastSuccess,omitempty"`
+}
+
+// SyncRun is the result of one run of a sync job
+type SyncRun struct {
+	Status          string           `json:"status"` // running | succeeded | partial | failed
+	StartedAt       time.Time        `json:"startedAt"`
+	FinishedAt      *time.Time       `json:"finishedAt,omitempty"`
+	TagsMatched     int              `json:"tagsMatched"`
+	TagsCopied      int              `json:"tagsCopied"`
+	TagsUnchanged   int              `json:"tagsUnchanged"` // already in sync with upstream
+	TagsFailed      int              `json:"tagsFailed"`
+	BlobsCopied     int              `json:"blobsCopied"`
+	BytesDownloaded int64            `json:"bytesDownloaded"`
+	Error           string           `json:"error,omitempty"`
+	Failures        []SyncTagFailure `json:"failures,omitempty"`
+}
+
+// SyncTagFailure records why a tag could not be mirrored
+type SyncTagFailure struct {
+	Tag   string `json:"tag"`
+	Error string `json:"error"`
+}
@@ -4,16 +4,20 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"oci-storage/config"
+	"oci-storage/pkg/coordination"
 	"oci-storage/pkg/utils"
 
 	goredis "github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
 
-// Client wraps a Redis connection and implements LockManager + UploadTracker.
+// Client wraps a Redis connection and implements LockManager, UploadTracker, ScanTracker, AccessStore
+// and CacheInvalidator.
 type Client struct {
 	rdb   *goredis.Client
 	log   *utils.Logger
@@ -163,3 +167,105 @@ func (c *Client) IsScanRunning(ctx context.Context, digest string) bool {
 	}
 	return exists > 0
 }
+
+// --- AccessStore implementation ---
+
+// luaRecordAccess increments the pull count and keeps the latest access time (unix ms)
+const luaRecordAccess = `
+	redis.call("HINCRBY", KEYS[1], "count", ARGV[1])
+	local last = tonumber(redis.call("HGET", KEYS[1], "last") or "0")
+	if tonumber(ARGV[2]) > last then
+		redis.call("HSET", KEYS[1], "last", ARGV[2])
+	end
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+	return 1
+`
+
+// RecordAccesses merges a batch of cache hits into per-image hashes in one pipeline.
+func (c *Client) RecordAccesses(ctx context.Context, accesses map[string]coordination.Access, ttl time.Duration) error {
+	if len(accesses) == 0 {
+		return nil
+	}
+	pipe := c.rdb.Pipeline()
+	for key, access := range accesses {
+		pipe.Eval(ctx, luaRecordAccess, []string{"oci:access:" + key},
+			access.Count, access.LastAccessed.UnixMilli(), ttl.Milliseconds())
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// LoadAccesses returns the recorded accesses of the given keys in one pipeline.
+func (c *Client) LoadAccesses(ctx context.Context, keys []string) (map[string]coordination.Access, error) {
+	result := make(map[string]coordination.Access)
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	pipe := c.rdb.Pipeline()
+	cmds := make([]*goredis.MapStringStringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HGetAll(ctx, "oci:access:"+key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != goredis.Nil {
+		return nil, err
+	}
+
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			continue
+		}
+		count, _ := strconv.ParseInt(fields["count"], 10, 64)
+		last, _ := strconv.ParseInt(fields["last"], 10, 64)
+		result[keys[i]] = coordination.Access{Count: count, LastAccessed: time.UnixMilli(last)}
+	}
+	return result, nil
+}
+
+// ForgetAccesses deletes the recorded accesses of the given keys.
+func (c *Client) ForgetAccesses(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = "oci:access:" + key
+	}
+	return c.rdb.Del(ctx, redisKeys...).Err()
+}
+
+// --- CacheInvalidator implementation ---
+
+// cacheInvalidationChannel carries "<podID>\n<path>" messages
+const cacheInvalidationChannel = "oci:cache:invalidate"
+
+// PublishInvalidation publishes a changed path, tagged with this pod so it can skip its own messages.
+func (c *Client) PublishInvalidation(ctx context.Context, path string) error {
+	return c.rdb.Publish(ctx, cacheInvalidationChannel, c.podID+"\n"+path).Err()
+}
+
+// SubscribeInvalidations listens in the background for paths changed by other pods.
+// Messages published while the connection is down are lost: cached metadata expires anyway.
+func (c *Client) SubscribeInvalidations(ctx context.Context, fn func(path string)) {
+	sub := c.rdb.Subscribe(ctx, cacheInvalidationChannel)
+	go func() {
+		defer sub.Close()
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				podID, path, found := strings.Cut(msg.Payload, "\n")
+				if !found || podID == c.podID {
+					continue
+				}
+				fn(path)
+			}
+		}
+	}()
+}
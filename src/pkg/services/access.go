@@ -0,0 +1,264 @@
+// pkg/services/access.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// accessStoreTTL bounds how long shared counters of an image that is no longer pulled are kept
+const accessStoreTTL = 90 * 24 * time.Hour
+
+// accessKey identifies a cache hit: a tag, a manifest digest or a blob digest of a repository
+type accessKey struct {
+	name string
+	ref  string
+}
+
+// accessHit aggregates the hits on one key since the last flush
+type accessHit struct {
+	count int64 // pulls (manifest requests); blob requests only refresh last
+	last  time.Time
+}
+
+// cachedImageKey identifies a cached image in the access store
+func cachedImageKey(name, tag string) string {
+	return name + ":" + tag
+}
+
+// UpdateAccessTime records a pull of a cached manifest by tag or digest.
+// Hits are batched in memory and persisted by FlushAccesses.
+func (s *ProxyService) UpdateAccessTime(name, reference string) {
+	s.recordAccess(name, reference, 1)
+}
+
+// RecordBlobAccess records that a cached blob was served for a repository. It refreshes
+// the last access time of the cached images referencing the blob without counting a pull.
+func (s *ProxyService) RecordBlobAccess(name, digest string) {
+	s.recordAccess(name, digest, 0)
+}
+
+func (s *ProxyService) recordAccess(name, ref string, count int64) {
+	now := time.Now()
+	key := accessKey{name: name, ref: ref}
+
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+
+	hit, ok := s.pendingAccess[key]
+	if !ok {
+		hit = &accessHit{}
+		s.pendingAccess[key] = hit
+	}
+	hit.count += count
+	hit.last = now
+}
+
+// StartAccessTracking persists batched cache hits every proxy.cache.accessFlushSeconds
+// until ctx is done, then flushes one last time. With a shared store (Redis) the counters
+// are aggregated across replicas; with a nil store they are written to the per-image metadata.
+func (s *ProxyService) StartAccessTracking(ctx context.Context, store coordination.AccessStore) {
+	s.accessStore = store
+
+	interval := time.Duration(s.config.Proxy.Cache.AccessFlushSeconds) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"interval": interval,
+		"shared":   store != nil,
+	}).Info("Cache access tracking started")
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.FlushAccesses()
+				return
+			case <-ticker.C:
+				s.FlushAccesses()
+			}
+		}
+	}()
+}
+
+// FlushAccesses persists the cache hits recorded since the last flush
+func (s *ProxyService) FlushAccesses() {
+	s.accessMu.Lock()
+	pending := s.pendingAccess
+	s.pendingAccess = make(map[accessKey]*accessHit)
+	s.accessMu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	accesses := s.resolveAccesses(pending)
+	if len(accesses) == 0 {
+		return
+	}
+
+	if s.accessStore != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := s.accessStore.RecordAccesses(ctx, accesses, accessStoreTTL)
+		if err == nil {
+			s.log.WithField("images", len(accesses)).Debug("Cache accesses recorded in shared store")
+			return
+		}
+		// Nothing was recorded: the metadata files are a safe fallback
+		s.log.WithError(err).Warn("Failed to record cache accesses in shared store, writing metadata instead")
+	}
+
+	s.persistAccesses(accesses)
+}
+
+// resolveAccesses maps pending hits to cached images. Tag hits map directly; digest hits
+// (manifests pulled by digest, blobs) are matched against every cached tag of the repository.
+func (s *ProxyService) resolveAccesses(pending map[accessKey]*accessHit) map[string]coordination.Access {
+	accesses := make(map[string]coordination.Access)
+	add := func(key string, hit *accessHit) {
+		access := accesses[key]
+		access.Count += hit.count
+		if hit.last.After(access.LastAccessed) {
+			access.LastAccessed = hit.last
+		}
+		accesses[key] = access
+	}
+
+	byDigest := make(map[string]map[string]*accessHit)
+	for key, hit := range pending {
+		if !strings.Contains(key.ref, ":") {
+			add(cachedImageKey(key.name, key.ref), hit)
+			continue
+		}
+		if byDigest[key.name] == nil {
+			byDigest[key.name] = make(map[string]*accessHit)
+		}
+		byDigest[key.name][key.ref] = hit
+	}
+	if len(byDigest) == 0 {
+		return accesses
+	}
+
+	images, err := s.readCachedImages()
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to read cached images to resolve digest accesses")
+		return accesses
+	}
+	for _, img := range images {
+		hits := byDigest[img.Name]
+		if hits == nil {
+			continue
+		}
+
+		digests := map[string]bool{img.Digest: true}
+		if data, err := s.backend.Read(s.pathManager.GetImageManifestPath(img.Name, img.Tag)); err == nil {
+			s.collectManifestDigests(data, digests)
+		}
+		for digest, hit := range hits {
+			if digests[digest] {
+				add(cachedImageKey(img.Name, img.Tag), hit)
+			}
+		}
+	}
+	return accesses
+}
+
+// persistAccesses merges accesses into the per-image metadata files. Images evicted
+// since the hits were recorded are skipped.
+func (s *ProxyService) persistAccesses(accesses map[string]coordination.Access) {
+	s.cacheMutex.Lock()
+	defer s.cacheMutex.Unlock()
+
+	for key, access := range accesses {
+		sep := strings.LastIndex(key, ":")
+		name, tag := key[:sep], key[sep+1:]
+
+		metadataPath := s.pathManager.GetCachedImageMetadataPath(name, tag)
+		data, err := s.backend.Read(metadataPath)
+		if err != nil {
+			continue
+		}
+		var metadata models.CachedImageMetadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			continue
+		}
+
+		metadata.AccessCount += access.Count
+		if access.LastAccessed.After(metadata.LastAccessed) {
+			metadata.LastAccessed = access.LastAccessed
+		}
+		data, err = json.MarshalIndent(metadata, "", "  ")
+		if err != nil {
+			continue
+		}
+		if err := s.backend.Write(metadataPath, data); err != nil {
+			s.log.WithError(err).WithField("image", key).Warn("Failed to persist cache access")
+		}
+	}
+
+	s.log.WithField("images", len(accesses)).Debug("Cache accesses persisted")
+}
+
+// applyAccesses overlays accesses not yet in the metadata files: counters in the shared
+// store and tag hits still pending on this replica
+func (s *ProxyService) applyAccesses(images []models.CachedImageMetadata) {
+	apply := func(img *models.CachedImageMetadata, count int64, last time.Time) {
+		img.AccessCount += count
+		if last.After(img.LastAccessed) {
+			img.LastAccessed = last
+		}
+	}
+
+	if s.accessStore != nil && len(images) > 0 {
+		keys := make([]string, len(images))
+		for i, img := range images {
+			keys[i] = cachedImageKey(img.Name, img.Tag)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		shared, err := s.accessStore.LoadAccesses(ctx, keys)
+		cancel()
+		if err != nil {
+			s.log.WithError(err).Warn("Failed to load cache accesses from shared store")
+		}
+		for i := range images {
+			if access, ok := shared[keys[i]]; ok {
+				apply(&images[i], access.Count, access.LastAccessed)
+			}
+		}
+	}
+
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+	if len(s.pendingAccess) == 0 {
+		return
+	}
+	for i := range images {
+		if hit, ok := s.pendingAccess[accessKey{name: images[i].Name, ref: images[i].Tag}]; ok {
+			apply(&images[i], hit.count, hit.last)
+		}
+	}
+}
+
+// resetAccesses drops shared counters left over from a previous copy of a cached image
+func (s *ProxyService) resetAccesses(name, tag string) {
+	if s.accessStore == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.accessStore.ForgetAccesses(ctx, cachedImageKey(name, tag)); err != nil {
+		s.log.WithError(err).WithField("image", cachedImageKey(name, tag)).Warn("Failed to reset cache accesses")
+	}
+}
@@ -0,0 +1,51 @@
+// pkg/services/blob_download.go
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+)
+
+// ImportBlob stores a blob read from upstream under its digest. The content is staged in
+// a local temp file and imported only once its size (when known, size > 0) and digest
+// match, so a truncated or tampered download never lands in the store. Returns the bytes
+// written.
+func ImportBlob(backend storage.Backend, pathManager *utils.PathManager, reader io.Reader, digest string, size int64) (int64, error) {
+	h := utils.NewDigestHash(digest)
+	if h == nil {
+		return 0, fmt.Errorf("unsupported digest algorithm: %s", digest)
+	}
+
+	tempDir := filepath.Dir(pathManager.GetTempPath("download"))
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return 0, err
+	}
+	tmpFile, err := os.CreateTemp(tempDir, "blob-*")
+	if err != nil {
+		return 0, err
+	}
+	tempPath := tmpFile.Name()
+	// Import consumes the file: this only cleans up downloads that are not imported
+	defer os.Remove(tempPath)
+
+	written, err := io.Copy(io.MultiWriter(tmpFile, h), reader)
+	tmpFile.Close()
+	if err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	if size > 0 && written != size {
+		return 0, fmt.Errorf("size mismatch: expected %d, got %d", size, written)
+	}
+	if actual := utils.DigestOf(digest, h); actual != digest {
+		return 0, fmt.Errorf("upstream blob hashes to %s", actual)
+	}
+	if err := backend.Import(tempPath, pathManager.GetBlobPath(digest)); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportBlob_VerifiesBeforeStoring(t *testing.T) {
+	storageDir := t.TempDir()
+	backend := storage.NewLocalBackend(storageDir)
+	pathManager := utils.NewPathManager(storageDir, utils.NewLogger(utils.Config{}))
+
+	layer := "layer content"
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(layer)))
+	sha512Digest := fmt.Sprintf("sha512:%x", sha512.Sum512([]byte(layer)))
+
+	for _, tt := range []struct {
+		name    string
+		digest  string
+		content string
+		size    int64
+		err     string
+	}{
+		{"truncated", digest, layer[:5], int64(len(layer)), "size mismatch"},
+		{"tampered", digest, strings.ToUpper(layer), int64(len(layer)), "hashes to"},
+		{"unsupported algorithm", "md5:" + strings.Repeat("0", 32), layer, 0, "unsupported digest algorithm"},
+		{"sha256 of unknown size", digest, layer, 0, ""},
+		{"sha512", sha512Digest, layer, int64(len(layer)), ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			written, err := ImportBlob(backend, pathManager, strings.NewReader(tt.content), tt.digest, tt.size)
+			exists, _ := backend.Exists(pathManager.GetBlobPath(tt.digest))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				assert.False(t, exists, "unverified content stored")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(layer)), written)
+			data, err := backend.Read(pathManager.GetBlobPath(tt.digest))
+			assert.NoError(t, err)
+			assert.Equal(t, layer, string(data))
+		})
+	}
+
+	// Downloads are staged under temp and never left behind
+	staged, err := os.ReadDir(filepath.Join(storageDir, "temp"))
+	assert.NoError(t, err)
+	assert.Empty(t, staged)
+}
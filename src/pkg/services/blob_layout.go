@@ -0,0 +1,211 @@
+// pkg/services/blob_layout.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/models"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrBlobMigrationRunning is returned when the blob layout migration is already in progress
+var ErrBlobMigrationRunning = errors.New("blob layout migration already running")
+
+const (
+	// blobLayoutStatePath records the blob layout migration outcome, shared by replicas
+	blobLayoutStatePath = "migrations/blob-layout.json"
+	// blobMigrationBatchSize is how many flat blobs are listed before moving them
+	blobMigrationBatchSize = 1000
+	// blobMigrationLockTTL bounds the migration lock if the pod dies mid-run
+	blobMigrationLockTTL = 24 * time.Hour
+)
+
+// BlobLayoutMigrated reports whether every blob was moved to the sharded layout, so
+// reads no longer need to fall back to flat paths
+func BlobLayoutMigrated(backend storage.Backend) bool {
+	data, err := backend.Read(blobLayoutStatePath)
+	if err != nil {
+		return false
+	}
+	var state models.BlobLayoutMigration
+	return json.Unmarshal(data, &state) == nil && state.Completed
+}
+
+// BlobMigrationService moves blobs from the flat layout to the sharded one in the
+// background, batch by batch, while both layouts keep being served
+type BlobMigrationService struct {
+	backend     storage.Backend // unwrapped: each layout is seen as it is stored
+	pathManager *utils.PathManager
+	locker      coordination.LockManager
+	log         *utils.Logger
+
+	mu     sync.Mutex
+	status models.BlobLayoutMigration
+}
+
+// NewBlobMigrationService creates the migration service, loading the last recorded outcome
+func NewBlobMigrationService(backend storage.Backend, pm *utils.PathManager, locker coordination.LockManager, log *utils.Logger) *BlobMigrationService {
+	s := &BlobMigrationService{
+		backend:     storage.Unwrap(backend),
+		pathManager: pm,
+		locker:      locker,
+		log:         log,
+	}
+	if data, err := s.backend.Read(blobLayoutStatePath); err == nil {
+		json.Unmarshal(data, &s.status)
+		s.status.Running = false
+	}
+	return s
+}
+
+// Start runs the migration in the background. It returns ErrBlobMigrationRunning if a
+// migration is already running on this or another replica.
+func (s *BlobMigrationService) Start() error {
+	unlock, err := s.begin()
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer unlock()
+		s.migrate()
+	}()
+	return nil
+}
+
+// Run performs the migration in the foreground and returns its outcome, for the
+// migrate-blobs subcommand. Like Start, it fails if a migration is already running.
+func (s *BlobMigrationService) Run() (models.BlobLayoutMigration, error) {
+	unlock, err := s.begin()
+	if err != nil {
+		return models.BlobLayoutMigration{}, err
+	}
+	defer unlock()
+	s.migrate()
+	return s.Status(), nil
+}
+
+// begin takes the migration lock and marks the migration as running
+func (s *BlobMigrationService) begin() (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.Running {
+		return nil, ErrBlobMigrationRunning
+	}
+	unlock, err := s.locker.Acquire(context.Background(), "blob-layout-migration", blobMigrationLockTTL)
+	if err != nil {
+		return nil, ErrBlobMigrationRunning
+	}
+
+	now := time.Now()
+	s.status = models.BlobLayoutMigration{Running: true, StartedAt: &now}
+	return unlock, nil
+}
+
+// Status returns the progress of the running migration, or the outcome of the last one
+func (s *BlobMigrationService) Status() models.BlobLayoutMigration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *BlobMigrationService) migrate() {
+	s.log.Info("Starting blob layout migration")
+	failed := make(map[string]bool)
+
+	for {
+		batch, err := s.listFlatBlobs(failed)
+		if err != nil {
+			s.update(func(st *models.BlobLayoutMigration) { st.LastError = err.Error() })
+			break
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, name := range batch {
+			if err := s.moveBlob(name); err != nil {
+				failed[name] = true
+				s.log.WithError(err).WithField("blob", name).Warn("Failed to move blob to sharded layout")
+				s.update(func(st *models.BlobLayoutMigration) {
+					st.Failed++
+					st.LastError = err.Error()
+				})
+			}
+		}
+	}
+
+	now := time.Now()
+	s.update(func(st *models.BlobLayoutMigration) {
+		st.Running = false
+		st.FinishedAt = &now
+		st.Completed = st.Failed == 0 && st.LastError == ""
+	})
+
+	status := s.Status()
+	if data, err := json.Marshal(status); err == nil {
+		if err := s.backend.Write(blobLayoutStatePath, data); err != nil {
+			s.log.WithError(err).Warn("Failed to record blob layout migration state")
+		}
+	}
+	s.log.WithFields(logrus.Fields{
+		"moved":        status.Moved,
+		"deduplicated": status.Deduplicated,
+		"failed":       status.Failed,
+		"completed":    status.Completed,
+	}).Info("Blob layout migration finished")
+}
+
+// listFlatBlobs returns up to blobMigrationBatchSize blob names stored directly under blobs/
+func (s *BlobMigrationService) listFlatBlobs(skip map[string]bool) ([]string, error) {
+	var batch []string
+	err := s.backend.ListIter("blobs", func(entry storage.FileInfo) error {
+		if entry.IsDir || strings.HasPrefix(entry.Name, ".") || skip[entry.Name] {
+			return nil
+		}
+		batch = append(batch, entry.Name)
+		if len(batch) == blobMigrationBatchSize {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return batch, err
+}
+
+// moveBlob moves a flat blob to its sharded path, or drops it when already there
+func (s *BlobMigrationService) moveBlob(name string) error {
+	legacyPath := filepath.Join("blobs", name)
+	digest := s.pathManager.BlobDigestFromPath(legacyPath)
+	target := s.pathManager.GetBlobPath(digest)
+	if digest == "" || target == s.pathManager.GetLegacyBlobPath(digest) {
+		return errors.New("not a blob digest: " + name)
+	}
+
+	if exists, _ := s.backend.Exists(target); exists {
+		if err := s.backend.Delete(legacyPath); err != nil {
+			return err
+		}
+		s.update(func(st *models.BlobLayoutMigration) { st.Deduplicated++ })
+		return nil
+	}
+	if err := s.backend.Rename(legacyPath, target); err != nil {
+		return err
+	}
+	s.update(func(st *models.BlobLayoutMigration) { st.Moved++ })
+	return nil
+}
+
+func (s *BlobMigrationService) update(fn func(*models.BlobLayoutMigration)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.status)
+}
@@ -0,0 +1,134 @@
+// pkg/services/breaker.go
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// Circuit breaker states reported in /cache/status
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// circuitBreaker tracks consecutive upstream failures for a single registry.
+// Closed: all requests pass. Open: requests fail fast until openFor elapses.
+// Half-open: a single probe request is let through; its outcome closes or re-opens the breaker.
+type circuitBreaker struct {
+	mu            sync.Mutex
+	state         string
+	failures      int
+	threshold     int
+	openFor       time.Duration
+	openedAt      time.Time
+	lastFailure   time.Time
+	lastError     string
+	probeInFlight bool
+}
+
+func newCircuitBreaker(threshold int, openFor time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if openFor <= 0 {
+		openFor = 30 * time.Second
+	}
+	return &circuitBreaker{
+		state:     BreakerClosed,
+		threshold: threshold,
+		openFor:   openFor,
+	}
+}
+
+// allow reports whether a request may be sent upstream. When the open period has
+// elapsed it moves to half-open and lets exactly one probe through.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.openFor {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probeInFlight = true
+		return true
+	case BreakerHalfOpen:
+		if b.probeInFlight {
+			return false
+		}
+		b.probeInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+// recordSuccess closes the breaker and resets the failure counter
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probeInFlight = false
+}
+
+// recordFailure counts a failure and opens the breaker once the threshold is reached.
+// A failed half-open probe re-opens the breaker immediately.
+// Returns true if this call transitioned the breaker to open.
+func (b *circuitBreaker) recordFailure(reason string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastFailure = time.Now()
+	b.lastError = reason
+	b.probeInFlight = false
+
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// release frees the half-open probe slot without counting a success or a failure
+// (e.g. the client cancelled the request before upstream answered).
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probeInFlight = false
+}
+
+// retryAfter returns how long until the breaker allows a probe (0 when not open)
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerOpen {
+		return 0
+	}
+	remaining := b.openFor - time.Since(b.openedAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// snapshot returns a consistent copy of the breaker fields for status reporting
+func (b *circuitBreaker) snapshot() (state string, failures int, openedAt, lastFailure time.Time, lastError string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state = b.state
+	if state == BreakerOpen && time.Since(b.openedAt) >= b.openFor {
+		state = BreakerHalfOpen
+	}
+	return state, b.failures, b.openedAt, b.lastFailure, b.lastError
+}
@@ -0,0 +1,124 @@
+// pkg/services/cache_pins.go
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"oci-storage/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// compilePinPatterns compiles proxy.cache.pinned; invalid patterns are logged and skipped
+func (s *ProxyService) compilePinPatterns() []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, pattern := range s.config.Proxy.Cache.Pinned {
+		re, err := compilePolicyPattern(pattern)
+		if err != nil {
+			s.log.WithError(err).WithField("pattern", pattern).Error("Invalid cache pin pattern, ignoring")
+			continue
+		}
+		if re != nil {
+			patterns = append(patterns, re)
+		}
+	}
+	return patterns
+}
+
+// matchesPinPattern reports whether a cached image matches a configured pin pattern
+func (s *ProxyService) matchesPinPattern(name, tag string) bool {
+	for _, re := range s.pinPatterns {
+		if re.MatchString(name) || re.MatchString(name+":"+tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// PinCachedImage pins or unpins a cached image. Pinned images are never evicted nor GC'd as stale.
+// Images pinned by a proxy.cache.pinned pattern stay pinned until the pattern is removed.
+func (s *ProxyService) PinCachedImage(name, tag string, pinned bool) error {
+	s.cacheMutex.Lock()
+	defer s.cacheMutex.Unlock()
+
+	metadataPath := s.pathManager.GetCachedImageMetadataPath(name, tag)
+	data, err := s.backend.Read(metadataPath)
+	if err != nil {
+		return fmt.Errorf("%w: %s:%s", ErrCachedImageNotFound, name, tag)
+	}
+
+	var metadata models.CachedImageMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return fmt.Errorf("failed to parse cache metadata: %w", err)
+	}
+
+	metadata.Pinned = pinned
+	metadata.PinnedByConfig = false
+	data, err = json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache metadata: %w", err)
+	}
+	if err := s.backend.Write(metadataPath, data); err != nil {
+		return fmt.Errorf("failed to write cache metadata: %w", err)
+	}
+	s.invalidateCacheUsage()
+
+	s.log.WithFields(logrus.Fields{
+		"name":           name,
+		"tag":            tag,
+		"pinned":         pinned,
+		"pinnedByConfig": s.matchesPinPattern(name, tag),
+	}).Info("Cached image pin updated")
+	return nil
+}
+
+// registryQuota returns the configured cache quota of a registry in bytes, 0 when unlimited
+func (s *ProxyService) registryQuota(registry string) int64 {
+	return int64(s.config.Proxy.Cache.RegistryMaxSizeGB[registry]) * 1024 * 1024 * 1024
+}
+
+// registryUsage reports deduplicated cache usage per source registry, sorted by registry name.
+// Registries with a quota are listed even when nothing is cached from them yet.
+func (s *ProxyService) registryUsage(idx *cacheBlobIndex) []models.RegistryCacheUsage {
+	byRegistry := make(map[string]*models.RegistryCacheUsage)
+	usageFor := func(registry string) *models.RegistryCacheUsage {
+		usage, ok := byRegistry[registry]
+		if !ok {
+			usage = &models.RegistryCacheUsage{Registry: registry, MaxSize: s.registryQuota(registry)}
+			byRegistry[registry] = usage
+		}
+		return usage
+	}
+
+	for registry := range s.config.Proxy.Cache.RegistryMaxSizeGB {
+		usageFor(registry)
+	}
+	for _, img := range idx.images {
+		usage := usageFor(img.metadata.SourceRegistry)
+		usage.ItemCount++
+		if img.metadata.IsPinned() {
+			usage.PinnedCount++
+		}
+	}
+
+	result := make([]models.RegistryCacheUsage, 0, len(byRegistry))
+	for registry, usage := range byRegistry {
+		usage.TotalSize = idx.size(func(img *cachedImageBlobs) bool {
+			return img.metadata.SourceRegistry == registry
+		})
+		usage.PinnedSize = idx.size(func(img *cachedImageBlobs) bool {
+			return img.metadata.SourceRegistry == registry && img.metadata.IsPinned()
+		})
+		if usage.MaxSize > 0 {
+			usage.UsagePercent = float64(usage.TotalSize) / float64(usage.MaxSize) * 100
+		}
+		result = append(result, *usage)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Registry < result[j].Registry
+	})
+	return result
+}
@@ -0,0 +1,244 @@
+// pkg/services/cache_usage.go
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"oci-storage/pkg/models"
+	"oci-storage/pkg/storage"
+
+	"github.com/sirupsen/logrus"
+)
+
+// cacheUsageTTL bounds how often /cache/status recomputes blob-level usage
+const cacheUsageTTL = 30 * time.Second
+
+// cacheBlobIndex maps the blobs under blobs/ to the manifests that reference them.
+// It is the basis for deduplicated cache sizes and for freeing layers on eviction.
+type cacheBlobIndex struct {
+	sizes  map[string]int64  // stored blobs by digest
+	files  map[string]string // blob storage path by digest (flat or sharded layout)
+	refs   map[string]int    // number of stored manifests (images, charts) reaching each digest
+	images []*cachedImageBlobs
+}
+
+// cachedImageBlobs is a cached image with every digest reachable from its tag manifest:
+// the manifest itself, platform manifests, configs and layers.
+type cachedImageBlobs struct {
+	metadata models.CachedImageMetadata
+	digests  []string
+	evicted  bool
+}
+
+// buildCacheBlobIndex lists stored blobs, walks every manifest under images/ and manifests/
+// (following index entries into platform manifests) and counts references per digest.
+func (s *ProxyService) buildCacheBlobIndex(images []models.CachedImageMetadata) (*cacheBlobIndex, error) {
+	idx := &cacheBlobIndex{
+		sizes: make(map[string]int64),
+		files: make(map[string]string),
+		refs:  make(map[string]int),
+	}
+	err := s.backend.Walk("blobs", func(blobPath string, entry storage.FileInfo) error {
+		if digest := s.pathManager.BlobDigestFromPath(blobPath); digest != "" {
+			idx.sizes[digest] = entry.Size
+			idx.files[digest] = blobPath
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+
+	roots := make(map[string][]string)
+	s.collectManifestRoots("images", roots)
+	s.collectManifestRoots("manifests", roots)
+	for _, digests := range roots {
+		for _, digest := range digests {
+			idx.refs[digest]++
+		}
+	}
+
+	for _, img := range images {
+		manifestPath := s.pathManager.GetImageManifestPath(img.Name, img.Tag)
+		digests := roots[manifestPath]
+
+		// The manifest blob written as fetched from upstream may differ from the stored copy
+		if img.Digest != "" && len(digests) > 0 && !containsString(digests, img.Digest) {
+			digests = append(digests, img.Digest)
+			idx.refs[img.Digest]++
+		}
+
+		idx.images = append(idx.images, &cachedImageBlobs{metadata: img, digests: digests})
+	}
+
+	return idx, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// storedBlobBytes returns the total size of the blobs directory
+func (s *ProxyService) storedBlobBytes() (int64, error) {
+	var total int64
+	err := s.backend.Walk("blobs", func(blobPath string, entry storage.FileInfo) error {
+		if s.pathManager.BlobDigestFromPath(blobPath) != "" {
+			total += entry.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// collectManifestRoots walks dir and records, for every JSON manifest, the digests it reaches
+func (s *ProxyService) collectManifestRoots(dir string, roots map[string][]string) {
+	s.backend.Walk(dir, func(fullPath string, entry storage.FileInfo) error {
+		if !strings.HasSuffix(entry.Name, ".json") {
+			return nil
+		}
+
+		data, err := s.backend.Read(fullPath)
+		if err != nil {
+			return nil
+		}
+
+		seen := map[string]bool{fmt.Sprintf("sha256:%x", sha256.Sum256(data)): true}
+		if !s.collectManifestDigests(data, seen) {
+			return nil
+		}
+
+		digests := make([]string, 0, len(seen))
+		for digest := range seen {
+			digests = append(digests, digest)
+		}
+		roots[fullPath] = digests
+		return nil
+	})
+}
+
+// collectManifestDigests adds the config, layers and sub-manifests referenced by a manifest
+// to seen, reading sub-manifests from their blobs. Returns false when data is not a manifest.
+func (s *ProxyService) collectManifestDigests(data []byte, seen map[string]bool) bool {
+	var manifest struct {
+		SchemaVersion int `json:"schemaVersion"`
+		Config        struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.SchemaVersion == 0 {
+		return false
+	}
+
+	if manifest.Config.Digest != "" {
+		seen[manifest.Config.Digest] = true
+	}
+	for _, layer := range manifest.Layers {
+		if layer.Digest != "" {
+			seen[layer.Digest] = true
+		}
+	}
+	for _, m := range manifest.Manifests {
+		if m.Digest == "" || seen[m.Digest] {
+			continue
+		}
+		seen[m.Digest] = true
+		if child, err := s.backend.Read(s.pathManager.GetBlobPath(m.Digest)); err == nil {
+			s.collectManifestDigests(child, seen)
+		}
+	}
+	return true
+}
+
+// size returns the deduplicated bytes of stored blobs referenced by the non-evicted
+// cached images matching filter (nil matches all)
+func (idx *cacheBlobIndex) size(filter func(*cachedImageBlobs) bool) int64 {
+	counted := make(map[string]bool)
+	var total int64
+	for _, img := range idx.images {
+		if img.evicted || (filter != nil && !filter(img)) {
+			continue
+		}
+		for _, digest := range img.digests {
+			if counted[digest] {
+				continue
+			}
+			counted[digest] = true
+			total += idx.sizes[digest]
+		}
+	}
+	return total
+}
+
+// releaseBlobs drops an evicted image's references and deletes the blobs no stored
+// manifest references anymore. Returns the number of bytes freed.
+func (s *ProxyService) releaseBlobs(idx *cacheBlobIndex, img *cachedImageBlobs) int64 {
+	var freed int64
+	for _, digest := range img.digests {
+		idx.refs[digest]--
+		if idx.refs[digest] > 0 {
+			continue
+		}
+		blobPath, stored := idx.files[digest]
+		if !stored {
+			continue
+		}
+
+		if err := s.backend.Delete(blobPath); err != nil {
+			s.log.WithError(err).WithField("digest", digest).Warn("Failed to delete unreferenced blob during eviction")
+			continue
+		}
+		freed += idx.sizes[digest]
+		delete(idx.sizes, digest)
+		delete(idx.files, digest)
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"image":      img.metadata.Name,
+		"tag":        img.metadata.Tag,
+		"freedBytes": freed,
+	}).Debug("Released blobs of evicted image")
+	return freed
+}
+
+// cacheUsage returns the blob index used by /cache/status, recomputed at most every cacheUsageTTL
+func (s *ProxyService) cacheUsage(images []models.CachedImageMetadata) (*cacheBlobIndex, error) {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	if s.usage != nil && time.Since(s.usageComputedAt) < cacheUsageTTL {
+		return s.usage, nil
+	}
+
+	idx, err := s.buildCacheBlobIndex(images)
+	if err != nil {
+		return nil, err
+	}
+	s.usage = idx
+	s.usageComputedAt = time.Now()
+	return idx, nil
+}
+
+// invalidateCacheUsage forces the next /cache/status to recompute usage
+func (s *ProxyService) invalidateCacheUsage() {
+	s.usageMu.Lock()
+	s.usage = nil
+	s.usageMu.Unlock()
+}
@@ -0,0 +1,86 @@
+// pkg/services/cached_charts.go
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"oci-storage/pkg/models"
+)
+
+// SetChartIndexUpdater regenerates index.yaml whenever a proxied Helm chart enters or
+// leaves the cache, so the repository index never lists an evicted chart
+func (s *ProxyService) SetChartIndexUpdater(updater IndexUpdater) {
+	s.chartIndex = updater
+}
+
+// GetCachedCharts returns the Helm charts held in the proxy cache whose archive is stored
+// locally: charts pulled through /v2/proxy/... and charts of proxied HTTP Helm repositories
+func (s *ProxyService) GetCachedCharts() ([]models.CachedChart, error) {
+	images, err := s.readCachedImages()
+	if err != nil {
+		return nil, err
+	}
+
+	var charts []models.CachedChart
+	for _, img := range images {
+		if img.ArtifactType != models.ArtifactTypeHelmChart {
+			continue
+		}
+		layer, err := s.cachedChartLayer(img.Name, img.Tag)
+		if err != nil {
+			s.log.WithError(err).WithField("chart", cachedImageKey(img.Name, img.Tag)).Debug("Skipping cached chart without manifest")
+			continue
+		}
+		if exists, _ := s.backend.Exists(s.pathManager.GetBlobPath(layer.Digest)); !exists {
+			continue
+		}
+		charts = append(charts, models.CachedChart{
+			Repository: img.Name,
+			Tag:        img.Tag,
+			Digest:     layer.Digest,
+			Size:       layer.Size,
+		})
+	}
+	return charts, nil
+}
+
+// cachedChartLayer returns the chart archive layer of a cached Helm OCI manifest
+func (s *ProxyService) cachedChartLayer(name, tag string) (models.OCIDescriptor, error) {
+	data, err := s.backend.Read(s.pathManager.GetImageManifestPath(name, tag))
+	if err != nil {
+		return models.OCIDescriptor{}, err
+	}
+	var manifest models.OCIManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return models.OCIDescriptor{}, err
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == models.MediaTypeHelmChart {
+			return layer, nil
+		}
+	}
+	return models.OCIDescriptor{}, fmt.Errorf("no chart layer in cached manifest %s:%s", name, tag)
+}
+
+// isCachedChart reports whether the cache metadata of name:tag marks a Helm chart
+func (s *ProxyService) isCachedChart(name, tag string) bool {
+	data, err := s.backend.Read(s.pathManager.GetCachedImageMetadataPath(name, tag))
+	if err != nil {
+		return false
+	}
+	var metadata models.CachedImageMetadata
+	return json.Unmarshal(data, &metadata) == nil && metadata.ArtifactType == models.ArtifactTypeHelmChart
+}
+
+// chartsChanged refreshes index.yaml in the background after cached charts changed
+func (s *ProxyService) chartsChanged() {
+	if s.chartIndex == nil {
+		return
+	}
+	go func() {
+		if err := s.chartIndex.UpdateIndex(); err != nil {
+			s.log.WithError(err).Warn("Failed to update index after cached chart change")
+		}
+	}()
+}
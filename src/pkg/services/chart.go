@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 
@@ -27,6 +28,11 @@ type IndexUpdater interface {
 	GetIndexPath() string
 }
 
+// CachedChartSource lists the Helm charts held in the proxy cache
+type CachedChartSource interface {
+	GetCachedCharts() ([]models.CachedChart, error)
+}
+
 // ChartService handles chart operations
 type ChartService struct {
 	pathManager *utils.PathManager
@@ -35,6 +41,7 @@ type ChartService struct {
 	log         *utils.Logger
 
 	indexUpdater IndexUpdater
+	cachedCharts CachedChartSource
 }
 
 // NewChartService creates a new chart service
@@ -47,6 +54,12 @@ func NewChartService(config *config.Config, log *utils.Logger, pm *utils.PathMan
 		indexUpdater: indexUpdater,
 	}
 }
+
+// SetCachedChartSource lists the charts cached by the proxy next to the uploaded ones
+func (s *ChartService) SetCachedChartSource(source CachedChartSource) {
+	s.cachedCharts = source
+}
+
 func (s *ChartService) GetPathManager() *utils.PathManager {
 	return s.pathManager
 }
@@ -144,28 +157,88 @@ func (s *ChartService) ListCharts() ([]models.ChartGroup, error) {
 		chartMetadatas = append(chartMetadatas, *metadata)
 	}
 
+	// Uploaded charts take precedence over a cached chart with the same name and version
+	cached, err := s.ListCachedCharts()
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to list cached charts")
+	}
+	for _, metadata := range cached {
+		if !s.ChartExists(metadata.Name, metadata.Version) {
+			chartMetadatas = append(chartMetadatas, metadata)
+		}
+	}
+
 	return models.GroupChartsByName(chartMetadatas), nil
 }
 
+// ListCachedCharts returns the metadata of the Helm charts held in the proxy cache, with
+// Source set to the cached repository and Digest to the chart archive blob
+func (s *ChartService) ListCachedCharts() ([]models.ChartMetadata, error) {
+	if s.cachedCharts == nil {
+		return nil, nil
+	}
+	charts, err := s.cachedCharts.GetCachedCharts()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []models.ChartMetadata
+	for _, chart := range charts {
+		chartData, err := s.backend.Read(s.pathManager.GetBlobPath(chart.Digest))
+		if err != nil {
+			s.log.WithError(err).WithField("repository", chart.Repository).Debug("Failed to read cached chart")
+			continue
+		}
+		metadata, err := s.ExtractChartMetadata(chartData)
+		if err != nil {
+			s.log.WithError(err).WithField("repository", chart.Repository).Warn("Failed to extract cached chart metadata")
+			continue
+		}
+		metadata.Source = chart.Repository
+		metadata.Digest = chart.Digest
+		result = append(result, *metadata)
+	}
+	return result, nil
+}
+
+// chartArchivePath returns where the archive of a chart version is stored: charts/ for
+// uploaded charts, the chart layer blob for charts held in the proxy cache
+func (s *ChartService) chartArchivePath(chartName string, version string) (string, error) {
+	if s.ChartExists(chartName, version) {
+		return s.pathManager.GetChartPath(chartName, version), nil
+	}
+	cached, err := s.ListCachedCharts()
+	if err != nil {
+		return "", err
+	}
+	for _, metadata := range cached {
+		if metadata.Name == chartName && metadata.Version == version {
+			return s.pathManager.GetBlobPath(metadata.Digest), nil
+		}
+	}
+	return "", fmt.Errorf("chart %s version %s not found", chartName, version)
+}
+
 func (s *ChartService) ChartExists(chartName string, version string) bool {
 	exists, _ := s.backend.Exists(s.pathManager.GetChartPath(chartName, version))
 	return exists
 }
 
 func (s *ChartService) GetChart(chartName string, version string) ([]byte, error) {
-	chartPath := s.pathManager.GetChartPath(chartName, version)
-	if !s.ChartExists(chartName, version) {
-		return nil, fmt.Errorf("chart %s version %s not found", chartName, version)
+	chartPath, err := s.chartArchivePath(chartName, version)
+	if err != nil {
+		return nil, err
 	}
 
 	return s.backend.Read(chartPath)
 }
 
 func (s *ChartService) GetChartDetails(chartName string, version string) (*models.ChartMetadata, error) {
-	if !s.ChartExists(chartName, version) {
-		return nil, fmt.Errorf("chart %s version %s not found", chartName, version)
+	chartPath, err := s.chartArchivePath(chartName, version)
+	if err != nil {
+		return nil, err
 	}
-	chartData, err := s.backend.Read(s.pathManager.GetChartPath(chartName, version))
+	chartData, err := s.backend.Read(chartPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read chart: %w", err)
 	}
@@ -196,6 +269,16 @@ func (s *ChartService) ListChartVersions(chartName string) ([]string, error) {
 		versions = append(versions, version)
 	}
 
+	cached, err := s.ListCachedCharts()
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to list cached charts")
+	}
+	for _, metadata := range cached {
+		if metadata.Name == chartName && !slices.Contains(versions, metadata.Version) {
+			versions = append(versions, metadata.Version)
+		}
+	}
+
 	sort.Sort(sort.Reverse(sort.StringSlice(versions)))
 
 	return versions, nil
@@ -216,7 +299,10 @@ func (s *ChartService) DeleteChart(chartName string, version string) error {
 }
 
 func (s *ChartService) GetChartValues(chartName string, version string) (string, error) {
-	chartPath := s.pathManager.GetChartPath(chartName, version)
+	chartPath, err := s.chartArchivePath(chartName, version)
+	if err != nil {
+		return "", err
+	}
 
 	reader, err := s.backend.ReadStream(chartPath)
 	if err != nil {
@@ -0,0 +1,156 @@
+// pkg/services/encryption.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/models"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrEncryptionRewrapRunning is returned when the encryption rewrap is already in progress
+var ErrEncryptionRewrapRunning = errors.New("encryption rewrap already running")
+
+const (
+	// encryptionStatePath records the encryption rewrap outcome, shared by replicas
+	encryptionStatePath = "migrations/encryption.json"
+	// encryptionRewrapLockTTL bounds the rewrap lock if the pod dies mid-run
+	encryptionRewrapLockTTL = 24 * time.Hour
+)
+
+// EncryptionCompleted reports whether every object was encrypted by a completed rewrap,
+// so objects found in plaintext can be rejected
+func EncryptionCompleted(backend storage.Backend) bool {
+	data, err := backend.Read(encryptionStatePath)
+	if err != nil {
+		return false
+	}
+	var state models.EncryptionRewrap
+	return json.Unmarshal(data, &state) == nil && state.Completed
+}
+
+// EncryptionService brings every stored object under the active encryption key in the
+// background: objects stored before encryption was enabled are encrypted, and after a
+// key rotation the data keys wrapped by the previous key are wrapped again
+type EncryptionService struct {
+	backend *storage.EncryptingBackend
+	locker  coordination.LockManager
+	log     *utils.Logger
+
+	mu     sync.Mutex
+	status models.EncryptionRewrap
+}
+
+// NewEncryptionService creates the rewrap service, loading the last recorded outcome
+func NewEncryptionService(backend *storage.EncryptingBackend, locker coordination.LockManager, log *utils.Logger) *EncryptionService {
+	s := &EncryptionService{
+		backend: backend,
+		locker:  locker,
+		log:     log,
+	}
+	if data, err := backend.Read(encryptionStatePath); err == nil {
+		json.Unmarshal(data, &s.status)
+		s.status.Running = false
+	}
+	return s
+}
+
+// Start runs the rewrap in the background. It returns ErrEncryptionRewrapRunning if a
+// rewrap is already running on this or another replica.
+func (s *EncryptionService) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.Running {
+		return ErrEncryptionRewrapRunning
+	}
+	unlock, err := s.locker.Acquire(context.Background(), "encryption-rewrap", encryptionRewrapLockTTL)
+	if err != nil {
+		return ErrEncryptionRewrapRunning
+	}
+
+	now := time.Now()
+	s.status = models.EncryptionRewrap{Running: true, ActiveKey: s.backend.ActiveKeyID(), StartedAt: &now}
+	go func() {
+		defer unlock()
+		s.rewrap()
+	}()
+	return nil
+}
+
+// Status returns the progress of the running rewrap, or the outcome of the last one
+func (s *EncryptionService) Status() models.EncryptionRewrap {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *EncryptionService) rewrap() {
+	s.log.WithField("activeKey", s.backend.ActiveKeyID()).Info("Starting encryption rewrap")
+
+	err := s.backend.WalkStored("", func(path string, info storage.FileInfo) error {
+		if path == encryptionStatePath || !rewrapIncluded(path) {
+			return nil
+		}
+		rewritten, err := s.backend.Rewrap(path)
+		s.update(func(st *models.EncryptionRewrap) {
+			st.Checked++
+			if rewritten {
+				st.Rewrapped++
+			}
+			if err != nil {
+				st.Failed++
+				st.LastError = err.Error()
+			}
+		})
+		if err != nil {
+			s.log.WithError(err).WithField("path", path).Warn("Failed to rewrap object")
+		}
+		return nil
+	})
+
+	now := time.Now()
+	s.update(func(st *models.EncryptionRewrap) {
+		if err != nil {
+			st.LastError = err.Error()
+		}
+		st.Running = false
+		st.FinishedAt = &now
+		st.Completed = err == nil && st.Failed == 0
+	})
+
+	status := s.Status()
+	if data, err := json.Marshal(status); err == nil {
+		if err := s.backend.Write(encryptionStatePath, data); err != nil {
+			s.log.WithError(err).Warn("Failed to record encryption rewrap state")
+		}
+	}
+	s.log.WithFields(logrus.Fields{
+		"checked":   status.Checked,
+		"rewrapped": status.Rewrapped,
+		"failed":    status.Failed,
+		"completed": status.Completed,
+	}).Info("Encryption rewrap finished")
+}
+
+// rewrapIncluded reports whether a path holds a stored object, not local staging or a
+// file being written
+func rewrapIncluded(path string) bool {
+	top, _, _ := strings.Cut(filepath.ToSlash(path), "/")
+	return top != "temp" && !strings.HasPrefix(filepath.Base(path), ".")
+}
+
+func (s *EncryptionService) update(fn func(*models.EncryptionRewrap)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.status)
+}
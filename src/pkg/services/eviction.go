@@ -0,0 +1,313 @@
+// pkg/services/eviction.go
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"oci-storage/config"
+	"oci-storage/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrUnknownEvictionPolicy is returned when an eviction policy name is not supported
+var ErrUnknownEvictionPolicy = errors.New("unknown eviction policy")
+
+// Eviction policy names accepted in proxy.cache.eviction.policy
+const (
+	EvictionPolicyLRU    = "lru"
+	EvictionPolicyLFU    = "lfu"
+	EvictionPolicyGDSF   = "gdsf"
+	EvictionPolicyMaxAge = "max-age"
+)
+
+// EvictionPolicies lists the supported eviction policies
+var EvictionPolicies = []string{EvictionPolicyLRU, EvictionPolicyLFU, EvictionPolicyGDSF, EvictionPolicyMaxAge}
+
+const (
+	defaultEvictionMaxAgeDays = 30
+	defaultGDSFAgingHours     = 24
+
+	// evictionDelay is how long a pass requested by a cached pull waits for more pulls
+	evictionDelay = 10 * time.Second
+	// evictionInterval is how often the limits are enforced without pulls
+	evictionInterval = 15 * time.Minute
+)
+
+// EvictionPolicy ranks cached images for eviction
+type EvictionPolicy interface {
+	// Name returns the policy name as configured
+	Name() string
+	// Priority returns the image's retention value; lower values are evicted first
+	Priority(img models.CachedImageMetadata, now time.Time) float64
+	// MaxAge returns the age after which images are evicted regardless of cache size, 0 for none
+	MaxAge() time.Duration
+}
+
+// NewEvictionPolicy returns the named eviction policy tuned by cfg; an empty name selects LRU
+func NewEvictionPolicy(name string, cfg config.EvictionConfig) (EvictionPolicy, error) {
+	maxAgeDays := cfg.MaxAgeDays
+	if maxAgeDays <= 0 {
+		maxAgeDays = defaultEvictionMaxAgeDays
+	}
+	agingHours := cfg.GDSFAgingHours
+	if agingHours <= 0 {
+		agingHours = defaultGDSFAgingHours
+	}
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", EvictionPolicyLRU:
+		return lruPolicy{}, nil
+	case EvictionPolicyLFU:
+		return lfuPolicy{}, nil
+	case EvictionPolicyGDSF:
+		return gdsfPolicy{aging: time.Duration(agingHours) * time.Hour}, nil
+	case EvictionPolicyMaxAge:
+		return maxAgePolicy{maxAge: time.Duration(maxAgeDays) * 24 * time.Hour}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q (supported: %s)", ErrUnknownEvictionPolicy, name, strings.Join(EvictionPolicies, ", "))
+	}
+}
+
+// lruPolicy evicts the least recently pulled images first
+type lruPolicy struct{}
+
+func (lruPolicy) Name() string { return EvictionPolicyLRU }
+
+func (lruPolicy) Priority(img models.CachedImageMetadata, _ time.Time) float64 {
+	return float64(img.LastAccessed.Unix())
+}
+
+func (lruPolicy) MaxAge() time.Duration { return 0 }
+
+// lfuPolicy evicts the least frequently pulled images first; ties go to the least recent
+type lfuPolicy struct{}
+
+func (lfuPolicy) Name() string { return EvictionPolicyLFU }
+
+func (lfuPolicy) Priority(img models.CachedImageMetadata, _ time.Time) float64 {
+	return float64(img.AccessCount)
+}
+
+func (lfuPolicy) MaxAge() time.Duration { return 0 }
+
+// gdsfPolicy is a size-weighted policy in the spirit of GreedyDual-Size-Frequency:
+// access frequency per GB, halved for every aging period since the last pull, so large
+// images that are rarely pulled go first and stale popularity fades out.
+type gdsfPolicy struct {
+	aging time.Duration
+}
+
+func (gdsfPolicy) Name() string { return EvictionPolicyGDSF }
+
+func (p gdsfPolicy) Priority(img models.CachedImageMetadata, now time.Time) float64 {
+	frequency := math.Max(float64(img.AccessCount), 1)
+	if idle := now.Sub(img.LastAccessed); idle > 0 && p.aging > 0 {
+		frequency *= math.Pow(0.5, float64(idle)/float64(p.aging))
+	}
+	// Floor at 1 MB so tiny images do not dominate
+	sizeGB := math.Max(float64(img.Size), 1024*1024) / (1024 * 1024 * 1024)
+	return frequency / sizeGB
+}
+
+func (gdsfPolicy) MaxAge() time.Duration { return 0 }
+
+// maxAgePolicy evicts images not pulled within maxAge, then falls back to LRU order
+type maxAgePolicy struct {
+	maxAge time.Duration
+}
+
+func (maxAgePolicy) Name() string { return EvictionPolicyMaxAge }
+
+func (maxAgePolicy) Priority(img models.CachedImageMetadata, _ time.Time) float64 {
+	return float64(img.LastAccessed.Unix())
+}
+
+func (p maxAgePolicy) MaxAge() time.Duration { return p.maxAge }
+
+// configuredEvictionPolicy builds the policy from proxy.cache.eviction, falling back to LRU
+// when the configured name is invalid
+func (s *ProxyService) configuredEvictionPolicy() EvictionPolicy {
+	cfg := s.config.Proxy.Cache.Eviction
+	policy, err := NewEvictionPolicy(cfg.Policy, cfg)
+	if err != nil {
+		s.log.WithError(err).Error("Invalid cache eviction policy, falling back to LRU")
+		return lruPolicy{}
+	}
+	return policy
+}
+
+// runEviction selects images to evict from idx under policy: images older than the
+// policy's max age first, then per-registry quotas, then the global limit (down to
+// target). Pinned images are never selected. With apply false nothing is deleted;
+// the selected images are only marked evicted in idx.
+func (s *ProxyService) runEviction(idx *cacheBlobIndex, policy EvictionPolicy, limit, target int64, apply bool) models.EvictionSimulation {
+	now := time.Now()
+	result := models.EvictionSimulation{
+		Policy:     policy.Name(),
+		SizeBefore: idx.size(nil),
+		Evicted:    []models.EvictedImage{},
+	}
+
+	ordered := make([]*cachedImageBlobs, len(idx.images))
+	copy(ordered, idx.images)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pi := policy.Priority(ordered[i].metadata, now)
+		pj := policy.Priority(ordered[j].metadata, now)
+		if pi != pj {
+			return pi < pj
+		}
+		return ordered[i].metadata.LastAccessed.Before(ordered[j].metadata.LastAccessed)
+	})
+
+	evict := func(img *cachedImageBlobs, reason string) {
+		result.Evicted = append(result.Evicted, models.EvictedImage{
+			Name:         img.metadata.Name,
+			Tag:          img.metadata.Tag,
+			Registry:     img.metadata.SourceRegistry,
+			Size:         img.metadata.Size,
+			LastAccessed: img.metadata.LastAccessed,
+			AccessCount:  img.metadata.AccessCount,
+			Reason:       reason,
+		})
+		img.evicted = true
+		if !apply {
+			return
+		}
+
+		s.log.WithFields(logrus.Fields{
+			"image":    img.metadata.Name,
+			"tag":      img.metadata.Tag,
+			"registry": img.metadata.SourceRegistry,
+			"size":     img.metadata.Size,
+			"policy":   policy.Name(),
+			"reason":   reason,
+		}).Info("Evicting cached image")
+
+		if err := s.deleteCachedImageFiles(img.metadata.Name, img.metadata.Tag); err != nil {
+			s.log.WithError(err).Warn("Failed to delete cached image files during eviction")
+		}
+		freed := s.releaseBlobs(idx, img)
+
+		s.log.WithFields(logrus.Fields{
+			"image":      img.metadata.Name,
+			"tag":        img.metadata.Tag,
+			"freedBytes": freed,
+		}).Debug("Cached image evicted")
+	}
+
+	// evictUntil evicts images matching filter (nil matches all) in policy order
+	// until their deduplicated size drops to targetSize
+	evictUntil := func(filter func(*cachedImageBlobs) bool, targetSize int64, reason string) {
+		size := idx.size(filter)
+		for _, img := range ordered {
+			if size <= targetSize {
+				return
+			}
+			if img.evicted || img.metadata.IsPinned() || (filter != nil && !filter(img)) {
+				continue
+			}
+			evict(img, reason)
+			size = idx.size(filter)
+		}
+		if apply && size > targetSize {
+			s.log.WithFields(logrus.Fields{
+				"size":       size,
+				"targetSize": targetSize,
+			}).Warn("Cache still over limit after eviction, remaining images are pinned")
+		}
+	}
+
+	if maxAge := policy.MaxAge(); maxAge > 0 {
+		for _, img := range ordered {
+			if !img.evicted && !img.metadata.IsPinned() && now.Sub(img.metadata.LastAccessed) > maxAge {
+				evict(img, "expired")
+			}
+		}
+	}
+
+	registries := make([]string, 0, len(s.config.Proxy.Cache.RegistryMaxSizeGB))
+	for registry := range s.config.Proxy.Cache.RegistryMaxSizeGB {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+	for _, registry := range registries {
+		quota := s.registryQuota(registry)
+		if quota <= 0 {
+			continue
+		}
+
+		inRegistry := func(img *cachedImageBlobs) bool { return img.metadata.SourceRegistry == registry }
+		if registrySize := idx.size(inRegistry); registrySize > quota {
+			if apply {
+				s.log.WithFields(logrus.Fields{
+					"registry":  registry,
+					"totalSize": registrySize,
+					"maxSize":   quota,
+				}).Info("Registry cache over quota, triggering eviction")
+			}
+			evictUntil(inRegistry, quota*90/100, "quota")
+		}
+	}
+
+	if totalSize := idx.size(nil); totalSize > limit {
+		if apply {
+			s.log.WithFields(logrus.Fields{
+				"totalSize": totalSize,
+				"maxSize":   limit,
+			}).Info("Cache over limit, triggering eviction")
+		}
+		evictUntil(nil, target, "size")
+	}
+
+	result.SizeAfter = idx.size(nil)
+	result.FreedBytes = result.SizeBefore - result.SizeAfter
+	return result
+}
+
+// SimulateEviction reports what each named policy (all supported policies when empty)
+// would evict right now, without deleting anything. targetBytes overrides the global
+// cache limit; 0 uses proxy.cache.maxSizeGB with the usual 90% eviction target.
+func (s *ProxyService) SimulateEviction(policies []string, targetBytes int64) ([]models.EvictionSimulation, error) {
+	if len(policies) == 0 {
+		policies = EvictionPolicies
+	}
+
+	resolved := make([]EvictionPolicy, 0, len(policies))
+	for _, name := range policies {
+		policy, err := NewEvictionPolicy(name, s.config.Proxy.Cache.Eviction)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, policy)
+	}
+
+	limit := int64(s.config.Proxy.Cache.MaxSizeGB) * 1024 * 1024 * 1024
+	target := limit * 90 / 100
+	if targetBytes > 0 {
+		limit, target = targetBytes, targetBytes
+	}
+
+	images, err := s.GetCachedImages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached images: %w", err)
+	}
+	idx, err := s.buildCacheBlobIndex(images)
+	if err != nil {
+		return nil, err
+	}
+
+	simulations := make([]models.EvictionSimulation, 0, len(resolved))
+	for _, policy := range resolved {
+		for _, img := range idx.images {
+			img.evicted = false
+		}
+		simulations = append(simulations, s.runEviction(idx, policy, limit, target, false))
+	}
+	return simulations, nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"oci-storage/config"
+	"oci-storage/pkg/models"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// walkCounter counts the walks of the blob store, the cost of an eviction pass
+type walkCounter struct {
+	storage.Backend
+	mu    sync.Mutex
+	walks int
+}
+
+func (b *walkCounter) Walk(dir string, fn func(path string, info storage.FileInfo) error) error {
+	if dir == "blobs" {
+		b.mu.Lock()
+		b.walks++
+		b.mu.Unlock()
+	}
+	return b.Backend.Walk(dir, fn)
+}
+
+func (b *walkCounter) Walks() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.walks
+}
+
+func TestProxyService_EvictsOutsidePulls(t *testing.T) {
+	backend := &walkCounter{Backend: storage.NewLocalBackend(t.TempDir())}
+	log := utils.NewLogger(utils.Config{})
+	cfg := &config.Config{}
+	cfg.Proxy.Enabled = true
+	cfg.Proxy.Cache.MaxSizeGB = 1
+	proxyService := NewProxyService(cfg, log, utils.NewPathManager(t.TempDir(), log), backend)
+
+	// Caching pulls only request a pass, merged into one
+	for _, tag := range []string{"1.25", "1.26", "1.27"} {
+		assert.NoError(t, proxyService.AddToCache(models.CachedImageMetadata{Name: "proxy/docker.io/library/nginx", Tag: tag, LastAccessed: time.Now()}))
+	}
+	assert.Equal(t, 0, backend.Walks())
+	assert.Len(t, proxyService.evictRequests, 1)
+
+	proxyService.EnforceCacheLimits()
+	assert.Equal(t, 1, backend.Walks())
+
+}
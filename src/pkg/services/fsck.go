@@ -0,0 +1,663 @@
+// pkg/services/fsck.go
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/interfaces"
+	"oci-storage/pkg/models"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// ErrFsckRunning is returned when a storage check is already in progress
+	ErrFsckRunning = errors.New("fsck already running")
+	// ErrFsckInvalidRepair is returned for an unknown repair mode
+	ErrFsckInvalidRepair = errors.New("invalid fsck repair mode")
+	// errFsckChanged records a repair skipped because the content changed during the check
+	errFsckChanged = errors.New("changed during the check, not repaired")
+)
+
+const (
+	// fsckReportPath keeps the report of the last check, shared by replicas
+	fsckReportPath = "fsck/report.json"
+	// fsckQuarantineDir receives broken content, under its original path
+	fsckQuarantineDir = "quarantine"
+	// fsckLockTTL bounds the fsck lock if the pod dies mid-run
+	fsckLockTTL = 24 * time.Hour
+	// fsckRefetchTimeout bounds each upstream download during repair
+	fsckRefetchTimeout = 30 * time.Minute
+)
+
+// FsckService checks the integrity of the storage: blob contents against their digest,
+// manifests against the blobs they reference, tag metadata, index.yaml and cache
+// metadata. Broken content can be quarantined or re-fetched from the proxied registry.
+type FsckService struct {
+	backend      storage.Backend
+	pathManager  *utils.PathManager
+	proxyService interfaces.ProxyServiceInterface
+	indexService interfaces.IndexServiceInterface
+	locker       coordination.LockManager
+	log          *utils.Logger
+
+	mu     sync.Mutex
+	report models.FsckReport
+}
+
+// NewFsckService creates the fsck service, loading the report of the last check
+func NewFsckService(backend storage.Backend, pm *utils.PathManager, proxyService interfaces.ProxyServiceInterface, indexService interfaces.IndexServiceInterface, locker coordination.LockManager, log *utils.Logger) *FsckService {
+	s := &FsckService{
+		backend:      backend,
+		pathManager:  pm,
+		proxyService: proxyService,
+		indexService: indexService,
+		locker:       locker,
+		log:          log,
+	}
+	if data, err := backend.Read(fsckReportPath); err == nil {
+		json.Unmarshal(data, &s.report)
+		s.report.Running = false
+	}
+	return s
+}
+
+// Start runs a check in the background. It returns ErrFsckRunning if a check is already
+// running on this or another replica.
+func (s *FsckService) Start(repair string) error {
+	switch repair {
+	case models.FsckRepairNone, models.FsckRepairQuarantine, models.FsckRepairRefetch:
+	default:
+		return fmt.Errorf("%w: %q", ErrFsckInvalidRepair, repair)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.report.Running {
+		return ErrFsckRunning
+	}
+	unlock, err := s.locker.Acquire(context.Background(), "fsck", fsckLockTTL)
+	if err != nil {
+		return ErrFsckRunning
+	}
+
+	now := time.Now()
+	s.report = models.FsckReport{Running: true, Repair: repair, Issues: []models.FsckIssue{}, StartedAt: &now}
+	go func() {
+		defer unlock()
+		s.run(repair)
+	}()
+	return nil
+}
+
+// Report returns the progress of the running check, or the report of the last one
+func (s *FsckService) Report() models.FsckReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := s.report
+	report.Issues = append([]models.FsckIssue{}, s.report.Issues...)
+	report.Errors = append([]string(nil), s.report.Errors...)
+	return report
+}
+
+// fsckBlob is a stored blob seen by the check
+type fsckBlob struct {
+	path   string
+	size   int64
+	broken bool
+}
+
+// fsckBrokenBlob is a blob whose repair waits until manifests tell where it comes from
+type fsckBrokenBlob struct {
+	issue  int
+	digest string
+	path   string
+}
+
+// fsckRun holds the state of one check
+type fsckRun struct {
+	*FsckService
+	repair      string
+	blobs       map[string]fsckBlob // by digest, in either layout
+	brokenBlobs []fsckBrokenBlob
+	manifests   map[string]bool   // stored manifest paths
+	proxyRefs   map[string]string // digest -> proxied repository referencing it
+	tags        []string          // tag metadata paths
+}
+
+func (s *FsckService) run(repair string) {
+	start := time.Now()
+	s.log.WithField("repair", repair).Info("Starting storage integrity check")
+
+	r := &fsckRun{
+		FsckService: s,
+		repair:      repair,
+		blobs:       make(map[string]fsckBlob),
+		manifests:   make(map[string]bool),
+		proxyRefs:   make(map[string]string),
+	}
+	// Blobs first: manifests are checked against what is actually stored
+	r.checkBlobs()
+	r.checkManifests()
+	r.repairBlobs()
+	r.checkTags()
+	r.checkIndex()
+	r.checkCache()
+
+	now := time.Now()
+	s.update(func(rep *models.FsckReport) {
+		rep.Running = false
+		rep.FinishedAt = &now
+		rep.DurationMs = time.Since(start).Milliseconds()
+	})
+
+	report := s.Report()
+	if data, err := json.Marshal(report); err == nil {
+		if err := s.backend.Write(fsckReportPath, data); err != nil {
+			s.log.WithError(err).Warn("Failed to record fsck report")
+		}
+	}
+	s.log.WithFields(logrus.Fields{
+		"blobs":      report.BlobsChecked,
+		"manifests":  report.ManifestsChecked,
+		"issues":     len(report.Issues),
+		"repaired":   report.Repaired,
+		"durationMs": report.DurationMs,
+	}).Info("Storage integrity check finished")
+}
+
+// checkBlobs re-hashes every blob against the digest it is stored under
+func (r *fsckRun) checkBlobs() {
+	err := r.backend.Walk("blobs", func(path string, info storage.FileInfo) error {
+		digest := r.pathManager.BlobDigestFromPath(path)
+		if digest == "" {
+			return nil
+		}
+
+		blob := fsckBlob{path: path, size: info.Size}
+		actual, hashed, err := hashStored(r.backend, path, digest)
+		switch {
+		case err != nil:
+			blob.broken = true
+			issue := r.addIssue(models.FsckIssue{Kind: models.FsckBlobUnreadable, Path: path, Digest: digest, Detail: err.Error()})
+			r.brokenBlobs = append(r.brokenBlobs, fsckBrokenBlob{issue: issue, digest: digest, path: path})
+		case actual != "" && actual != digest:
+			blob.broken = true
+			issue := r.addIssue(models.FsckIssue{
+				Kind:   models.FsckBlobCorrupt,
+				Path:   path,
+				Digest: digest,
+				Detail: fmt.Sprintf("content hashes to %s (%d bytes)", actual, hashed),
+			})
+			r.brokenBlobs = append(r.brokenBlobs, fsckBrokenBlob{issue: issue, digest: digest, path: path})
+		}
+		// A blob left in both layouts is usable if either copy is
+		if existing, ok := r.blobs[digest]; !ok || existing.broken {
+			r.blobs[digest] = blob
+		}
+
+		r.update(func(rep *models.FsckReport) {
+			rep.BlobsChecked++
+			rep.BytesHashed += hashed
+		})
+		return nil
+	})
+	if err != nil {
+		r.addError("blobs: " + err.Error())
+	}
+}
+
+// checkManifests checks image and chart manifests, collecting tag metadata on the way
+func (r *fsckRun) checkManifests() {
+	err := r.backend.Walk("images", func(path string, info storage.FileInfo) error {
+		p := filepath.ToSlash(path)
+		if !strings.HasSuffix(p, ".json") {
+			return nil
+		}
+		if i := strings.LastIndex(p, "/manifests/"); i > len("images") && !strings.Contains(p[i+len("/manifests/"):], "/") {
+			reference := strings.TrimSuffix(p[i+len("/manifests/"):], ".json")
+			if hex, ok := strings.CutPrefix(reference, "sha256_"); ok {
+				reference = "sha256:" + hex
+			}
+			r.checkManifest(path, p[len("images/"):i], reference)
+		} else if i := strings.LastIndex(p, "/tags/"); i > len("images") {
+			r.tags = append(r.tags, path)
+		}
+		return nil
+	})
+	if err != nil {
+		r.addError("image manifests: " + err.Error())
+	}
+
+	err = r.backend.Walk("manifests", func(path string, info storage.FileInfo) error {
+		p := filepath.ToSlash(path)
+		if !strings.HasSuffix(p, ".json") || strings.Count(p, "/") < 2 {
+			return nil
+		}
+		i := strings.LastIndex(p, "/")
+		r.checkManifest(path, p[len("manifests/"):i], strings.TrimSuffix(p[i+1:], ".json"))
+		return nil
+	})
+	if err != nil {
+		r.addError("chart manifests: " + err.Error())
+	}
+}
+
+func (r *fsckRun) checkManifest(path, name, reference string) {
+	r.manifests[path] = true
+	r.update(func(rep *models.FsckReport) { rep.ManifestsChecked++ })
+
+	data, err := r.backend.Read(path)
+	if err != nil {
+		issue := r.addIssue(models.FsckIssue{Kind: models.FsckManifestInvalid, Path: path, Repository: name, Detail: err.Error()})
+		r.resolveManifest([]int{issue}, path, name, reference, nil, true)
+		return
+	}
+	var manifest struct {
+		Config    models.OCIDescriptor   `json:"config"`
+		Layers    []models.OCIDescriptor `json:"layers"`
+		Manifests []models.OCIDescriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil || (manifest.Config.Digest == "" && len(manifest.Layers) == 0 && len(manifest.Manifests) == 0) {
+		issue := r.addIssue(models.FsckIssue{Kind: models.FsckManifestInvalid, Path: path, Repository: name, Detail: "not an OCI manifest"})
+		r.resolveManifest([]int{issue}, path, name, reference, data, true)
+		return
+	}
+	if strings.HasPrefix(reference, "sha256:") {
+		if actual := fmt.Sprintf("sha256:%x", sha256.Sum256(data)); actual != reference {
+			issue := r.addIssue(models.FsckIssue{
+				Kind:       models.FsckManifestDigestMismatch,
+				Path:       path,
+				Repository: name,
+				Digest:     reference,
+				Detail:     "content hashes to " + actual,
+			})
+			r.resolveManifest([]int{issue}, path, name, reference, data, true)
+			return
+		}
+	}
+
+	// Proxied images are cached lazily: their blobs are only stored once pulled
+	proxied := strings.HasPrefix(name, "proxy/")
+	refetchable := r.refetchable(name)
+	var issues []int
+	for _, desc := range append([]models.OCIDescriptor{manifest.Config}, manifest.Layers...) {
+		if desc.Digest == "" || len(desc.URLs) > 0 {
+			// No config (index) or foreign layer: nothing stored here
+			continue
+		}
+		if _, ok := r.proxyRefs[desc.Digest]; refetchable && !ok {
+			r.proxyRefs[desc.Digest] = name
+		}
+		blob, ok := r.blob(desc.Digest)
+		switch {
+		case !ok && !proxied:
+			issues = append(issues, r.addIssue(models.FsckIssue{Kind: models.FsckBlobMissing, Path: path, Repository: name, Digest: desc.Digest}))
+		case !ok || blob.broken:
+			// Reported with the blob itself
+		case desc.Size > 0 && blob.size != desc.Size:
+			issues = append(issues, r.addIssue(models.FsckIssue{
+				Kind:       models.FsckBlobSizeMismatch,
+				Path:       path,
+				Repository: name,
+				Digest:     desc.Digest,
+				Detail:     fmt.Sprintf("manifest declares %d bytes, stored blob has %d", desc.Size, blob.size),
+			}))
+		}
+	}
+	if !proxied {
+		// Pushed indexes require their children first; proxied ones fetch them on demand
+		for _, child := range manifest.Manifests {
+			if _, ok := r.blob(child.Digest); ok {
+				continue
+			}
+			if exists, _ := r.backend.Exists(r.pathManager.GetImageManifestPath(name, child.Digest)); exists {
+				continue
+			}
+			issues = append(issues, r.addIssue(models.FsckIssue{Kind: models.FsckManifestMissing, Path: path, Repository: name, Digest: child.Digest}))
+		}
+	}
+	if len(issues) > 0 {
+		r.resolveManifest(issues, path, name, reference, data, false)
+	}
+}
+
+// blob returns a blob seen by the check. Blobs stored after the blobs were walked, by a
+// push or a pull running meanwhile, are looked up in the storage: they are not missing.
+func (r *fsckRun) blob(digest string) (fsckBlob, bool) {
+	if blob, ok := r.blobs[digest]; ok {
+		return blob, true
+	}
+	path := r.pathManager.GetBlobPath(digest)
+	info, err := r.backend.Stat(path)
+	if err != nil {
+		return fsckBlob{}, false
+	}
+	blob := fsckBlob{path: path, size: info.Size}
+	r.blobs[digest] = blob
+	return blob, true
+}
+
+// manifestStored reports whether a manifest exists, stored after the manifests were walked included
+func (r *fsckRun) manifestStored(path string) bool {
+	if r.manifests[path] {
+		return true
+	}
+	exists, _ := r.backend.Exists(path)
+	return exists
+}
+
+// unchanged reports whether a manifest still holds what the check read (nil: unreadable).
+// Content rewritten while the server runs is not repaired from a stale verdict.
+func (r *fsckRun) unchanged(path string, checked []byte) bool {
+	data, err := r.backend.Read(path)
+	if checked == nil {
+		return err != nil
+	}
+	return err == nil && bytes.Equal(data, checked)
+}
+
+// resolveManifest repairs a broken manifest: restored from its blob copy when its
+// name is a digest, re-fetched when proxied, quarantined otherwise
+func (r *fsckRun) resolveManifest(issues []int, path, name, reference string, checked []byte, restorable bool) {
+	if r.repair == models.FsckRepairNone {
+		return
+	}
+	if !r.unchanged(path, checked) {
+		for _, issue := range issues {
+			r.resolve(issue, "", errFsckChanged)
+		}
+		return
+	}
+
+	action, err := "", error(nil)
+	if blob, ok := r.blobs[reference]; restorable && ok && !blob.broken {
+		// PutManifest keeps the exact pushed bytes under blobs/
+		var data []byte
+		if data, err = r.backend.Read(blob.path); err == nil {
+			if err = r.backend.Write(path, data); err == nil {
+				action = models.FsckActionRestored
+			}
+		}
+	}
+	if action == "" && r.repair == models.FsckRepairRefetch && r.refetchable(name) {
+		if err = r.refetchManifest(path, name, reference); err == nil {
+			action = models.FsckActionRefetched
+		}
+	}
+	if action == "" {
+		if err != nil {
+			r.log.WithError(err).WithField("manifest", path).Warn("Failed to repair manifest, quarantining it")
+		}
+		action, err = models.FsckActionQuarantined, r.quarantine(path)
+	}
+	for _, issue := range issues {
+		r.resolve(issue, action, err)
+	}
+}
+
+// repairBlobs re-fetches broken blobs referenced by a proxied image, quarantines the rest
+func (r *fsckRun) repairBlobs() {
+	if r.repair == models.FsckRepairNone {
+		return
+	}
+	for _, blob := range r.brokenBlobs {
+		if repository, ok := r.proxyRefs[blob.digest]; ok && r.repair == models.FsckRepairRefetch {
+			err := r.refetchBlob(repository, blob.digest, blob.path)
+			if err == nil {
+				r.resolve(blob.issue, models.FsckActionRefetched, nil)
+				continue
+			}
+			r.log.WithError(err).WithField("blob", blob.path).Warn("Failed to re-fetch blob, quarantining it")
+		}
+		r.resolve(blob.issue, models.FsckActionQuarantined, r.quarantine(blob.path))
+	}
+}
+
+// checkTags reports tag metadata whose manifest is gone
+func (r *fsckRun) checkTags() {
+	for _, path := range r.tags {
+		p := filepath.ToSlash(path)
+		i := strings.LastIndex(p, "/tags/")
+		name, tag := p[len("images/"):i], strings.TrimSuffix(p[i+len("/tags/"):], ".json")
+		r.update(func(rep *models.FsckReport) { rep.TagsChecked++ })
+
+		if r.manifestStored(r.pathManager.GetImageManifestPath(name, tag)) {
+			continue
+		}
+		issue := r.addIssue(models.FsckIssue{Kind: models.FsckTagOrphaned, Path: path, Repository: name, Detail: "no manifest for tag " + tag})
+		r.quarantineIssue(issue, path)
+	}
+}
+
+// checkIndex compares index.yaml with the chart archives
+func (r *fsckRun) checkIndex() {
+	var issues []int
+	indexPath := r.pathManager.GetIndexPath()
+	listed := make(map[string]bool)
+
+	var index IndexFile
+	data, err := r.backend.Read(indexPath)
+	if err == nil {
+		err = yaml.Unmarshal(data, &index)
+	}
+	if err != nil {
+		issues = append(issues, r.addIssue(models.FsckIssue{Kind: models.FsckIndexInvalid, Path: indexPath, Detail: err.Error()}))
+	}
+	for _, versions := range index.Entries {
+		for _, version := range versions {
+			if len(version.URLs) > 0 && strings.Contains(version.URLs[0], "/blobs/") {
+				// Chart cached by the proxy, served from its chart layer blob
+				digest := "sha256:" + version.Digest
+				if _, ok := r.blobs[digest]; !ok {
+					issues = append(issues, r.addIssue(models.FsckIssue{Kind: models.FsckIndexStale, Path: indexPath, Digest: digest, Detail: "cached chart " + version.Name + " " + version.Version + " not stored"}))
+				}
+				continue
+			}
+			chartPath := r.pathManager.GetChartPath(version.Name, version.Version)
+			listed[chartPath] = true
+			actual, _, err := hashStored(r.backend, chartPath, "sha256:")
+			switch {
+			case err != nil:
+				issues = append(issues, r.addIssue(models.FsckIssue{Kind: models.FsckIndexStale, Path: chartPath, Detail: "listed in index.yaml but not stored"}))
+			case actual != "sha256:"+version.Digest:
+				issues = append(issues, r.addIssue(models.FsckIssue{
+					Kind:   models.FsckIndexStale,
+					Path:   chartPath,
+					Digest: actual,
+					Detail: "index.yaml lists digest " + version.Digest,
+				}))
+			}
+		}
+	}
+
+	err = r.backend.ListIter(r.pathManager.GetChartsPath(), func(entry storage.FileInfo) error {
+		if entry.IsDir || filepath.Ext(entry.Name) != ".tgz" {
+			return nil
+		}
+		r.update(func(rep *models.FsckReport) { rep.ChartsChecked++ })
+		chartPath := filepath.Join(r.pathManager.GetChartsPath(), entry.Name)
+		if !listed[chartPath] {
+			issues = append(issues, r.addIssue(models.FsckIssue{Kind: models.FsckIndexStale, Path: chartPath, Detail: "not listed in index.yaml"}))
+		}
+		return nil
+	})
+	if err != nil {
+		r.addError("charts: " + err.Error())
+	}
+
+	if len(issues) == 0 || r.repair == models.FsckRepairNone || r.indexService == nil {
+		return
+	}
+	err = r.indexService.UpdateIndex()
+	for _, issue := range issues {
+		r.resolve(issue, models.FsckActionReindexed, err)
+	}
+}
+
+// checkCache reports cache metadata that cannot be parsed or whose manifest is gone
+func (r *fsckRun) checkCache() {
+	metadataDir := filepath.Join("cache", "metadata")
+	if exists, _ := r.backend.Exists(metadataDir); !exists {
+		return
+	}
+	err := r.backend.ListIter(metadataDir, func(entry storage.FileInfo) error {
+		if entry.IsDir || !strings.HasSuffix(entry.Name, ".json") {
+			return nil
+		}
+		r.update(func(rep *models.FsckReport) { rep.CacheEntriesChecked++ })
+		path := filepath.Join(metadataDir, entry.Name)
+
+		var metadata models.CachedImageMetadata
+		data, err := r.backend.Read(path)
+		if err == nil {
+			err = json.Unmarshal(data, &metadata)
+		}
+		if err != nil {
+			r.quarantineIssue(r.addIssue(models.FsckIssue{Kind: models.FsckCacheInvalid, Path: path, Detail: err.Error()}), path)
+			return nil
+		}
+		if !r.manifestStored(r.pathManager.GetImageManifestPath(metadata.Name, metadata.Tag)) {
+			issue := r.addIssue(models.FsckIssue{Kind: models.FsckCacheOrphaned, Path: path, Repository: metadata.Name, Detail: "no manifest for tag " + metadata.Tag})
+			r.quarantineIssue(issue, path)
+		}
+		return nil
+	})
+	if err != nil {
+		r.addError("cache metadata: " + err.Error())
+	}
+}
+
+// refetchable reports whether a repository is an image proxied from an upstream registry
+func (r *fsckRun) refetchable(name string) bool {
+	return r.proxyService != nil && r.proxyService.IsEnabled() &&
+		strings.HasPrefix(name, "proxy/") && !strings.HasPrefix(name, "proxy/helm/")
+}
+
+// refetchManifest downloads a manifest again and stores it with its blob copy
+func (r *fsckRun) refetchManifest(path, name, reference string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fsckRefetchTimeout)
+	defer cancel()
+
+	registryURL, upstreamName, err := r.proxyService.ResolveRegistry(name)
+	if err != nil {
+		return err
+	}
+	data, _, err := r.proxyService.GetManifest(ctx, registryURL, upstreamName, reference)
+	if err != nil {
+		return err
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	if strings.HasPrefix(reference, "sha256:") && digest != reference {
+		return fmt.Errorf("upstream manifest hashes to %s", digest)
+	}
+	if err := r.backend.Write(r.pathManager.GetBlobPath(digest), data); err != nil {
+		return err
+	}
+	return r.backend.Write(path, data)
+}
+
+// refetchBlob downloads a blob again, verifies it and replaces the broken copy
+func (r *fsckRun) refetchBlob(name, digest, brokenPath string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fsckRefetchTimeout)
+	defer cancel()
+
+	registryURL, upstreamName, err := r.proxyService.ResolveRegistry(name)
+	if err != nil {
+		return err
+	}
+	reader, size, err := r.proxyService.GetBlob(ctx, registryURL, upstreamName, digest)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if _, err := ImportBlob(r.backend, r.pathManager, reader, digest, size); err != nil {
+		return err
+	}
+	if blobPath := r.pathManager.GetBlobPath(digest); brokenPath != blobPath {
+		return r.backend.Delete(brokenPath)
+	}
+	return nil
+}
+
+// quarantine moves broken content out of the way, keeping it for inspection
+func (r *fsckRun) quarantine(path string) error {
+	delete(r.manifests, path)
+	return r.backend.Rename(path, filepath.Join(fsckQuarantineDir, path))
+}
+
+// quarantineIssue quarantines stale metadata in any repair mode: there is nothing to re-fetch
+func (r *fsckRun) quarantineIssue(issue int, path string) {
+	if r.repair != models.FsckRepairNone {
+		r.resolve(issue, models.FsckActionQuarantined, r.quarantine(path))
+	}
+}
+
+func (r *fsckRun) addIssue(issue models.FsckIssue) int {
+	var i int
+	r.update(func(rep *models.FsckReport) {
+		rep.Issues = append(rep.Issues, issue)
+		i = len(rep.Issues) - 1
+	})
+	r.log.WithFields(logrus.Fields{
+		"kind":   issue.Kind,
+		"path":   issue.Path,
+		"digest": issue.Digest,
+	}).Warn("Storage integrity issue found")
+	return i
+}
+
+func (r *fsckRun) resolve(issue int, action string, err error) {
+	r.update(func(rep *models.FsckReport) {
+		if err != nil {
+			rep.Issues[issue].RepairError = err.Error()
+			return
+		}
+		rep.Issues[issue].Action = action
+		rep.Repaired++
+	})
+}
+
+func (r *fsckRun) addError(msg string) {
+	r.update(func(rep *models.FsckReport) { rep.Errors = append(rep.Errors, msg) })
+}
+
+func (s *FsckService) update(fn func(*models.FsckReport)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.report)
+}
+
+// hashStored hashes a stored file with the algorithm of digest. The returned digest is
+// empty when the algorithm is not supported.
+func hashStored(backend storage.Backend, path, digest string) (string, int64, error) {
+	h := utils.NewDigestHash(digest)
+	if h == nil {
+		return "", 0, nil
+	}
+	reader, err := backend.ReadStream(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer reader.Close()
+	n, err := io.Copy(h, reader)
+	if err != nil {
+		return "", n, err
+	}
+	return utils.DigestOf(digest, h), n, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/models"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// walkHook runs a function once a walk of dir has finished, as a push landing mid-check would
+type walkHook struct {
+	storage.Backend
+	after map[string]func()
+}
+
+func (b *walkHook) Walk(dir string, fn func(path string, info storage.FileInfo) error) error {
+	err := b.Backend.Walk(dir, fn)
+	if hook := b.after[dir]; hook != nil {
+		delete(b.after, dir)
+		hook()
+	}
+	return err
+}
+
+func TestFsck_KeepsContentStoredDuringTheCheck(t *testing.T) {
+	local := storage.NewLocalBackend(t.TempDir())
+	log := utils.NewLogger(utils.Config{})
+	pathManager := utils.NewPathManager(t.TempDir(), log)
+	digestOf := func(data []byte) string { return fmt.Sprintf("sha256:%x", sha256.Sum256(data)) }
+	write := func(path string, data []byte) { assert.NoError(t, local.Write(path, data)) }
+
+	write("index.yaml", []byte("apiVersion: v1\nentries: {}\n"))
+	layer := []byte("layer pushed mid-check")
+	manifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"layers":[{"digest":"%s","size":%d}]}`, digestOf(layer), len(layer)))
+	backend := &walkHook{Backend: local, after: map[string]func(){
+		// Pushed once the blobs were walked: its manifest is seen, its blob is not
+		"blobs": func() {
+			write(pathManager.GetBlobPath(digestOf(layer)), layer)
+			write(pathManager.GetImageManifestPath("app", "v1"), manifest)
+			write("images/app/tags/v1.json", []byte(`{"name":"app","tag":"v1"}`))
+		},
+		// Pulled through the proxy once the manifests were walked
+		"images": func() {
+			write(pathManager.GetImageManifestPath("proxy/docker.io/nginx", "latest"), manifest)
+			write("cache/metadata/proxy_docker.io_nginx_latest.json", []byte(`{"name":"proxy/docker.io/nginx","tag":"latest"}`))
+		},
+	}}
+
+	fsck := NewFsckService(backend, pathManager, nil, nil, &coordination.NoopLockManager{}, log)
+	assert.NoError(t, fsck.Start(models.FsckRepairQuarantine))
+	var report models.FsckReport
+	assert.Eventually(t, func() bool {
+		report = fsck.Report()
+		return !report.Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Empty(t, report.Issues)
+	for _, path := range []string{
+		pathManager.GetImageManifestPath("app", "v1"),
+		pathManager.GetImageManifestPath("proxy/docker.io/nginx", "latest"),
+		"cache/metadata/proxy_docker.io_nginx_latest.json",
+	} {
+		exists, err := local.Exists(path)
+		assert.NoError(t, err)
+		assert.True(t, exists, path)
+	}
+}
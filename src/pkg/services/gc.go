@@ -3,7 +3,7 @@ package service
 
 import (
 	"encoding/json"
-	"path/filepath"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
@@ -109,7 +109,11 @@ type cleanResult struct {
 
 func (gc *GCService) cleanStaleProxyImages(dryRun bool) (*cleanResult, error) {
 	result := &cleanResult{}
-	cutoff := time.Now().AddDate(0, -1, 0) // 30 days ago
+	maxAgeDays := gc.config.Proxy.Cache.Eviction.MaxAgeDays
+	if maxAgeDays <= 0 {
+		maxAgeDays = defaultEvictionMaxAgeDays
+	}
+	cutoff := time.Now().AddDate(0, 0, -maxAgeDays)
 
 	gc.log.WithField("cutoff", cutoff).Debug("Scanning for stale proxy images")
 
@@ -119,7 +123,7 @@ func (gc *GCService) cleanStaleProxyImages(dryRun bool) (*cleanResult, error) {
 	}
 
 	for _, img := range images {
-		if !strings.HasPrefix(img.Name, "proxy/") {
+		if !strings.HasPrefix(img.Name, "proxy/") || img.IsPinned() {
 			continue
 		}
 
@@ -152,34 +156,26 @@ func (gc *GCService) cleanOrphanBlobs(dryRun bool) (*cleanResult, error) {
 	// Collect all referenced digests from manifests
 	referencedDigests := make(map[string]bool)
 
-	// Scan image manifests
-	gc.collectReferencedDigests("images", referencedDigests)
-
-	// Scan chart manifests
-	gc.collectReferencedDigests("manifests", referencedDigests)
-
-	gc.log.WithField("referencedCount", len(referencedDigests)).Debug("Collected referenced digests")
-
-	// Scan blobs directory and find orphans
-	entries, err := gc.backend.List("blobs")
-	if err != nil {
-		return result, nil
+	// Scan image and chart manifests. An incomplete scan would report referenced blobs
+	// as orphans, so listing errors abort the cleanup.
+	for _, dir := range []string{"images", "manifests"} {
+		if err := gc.collectReferencedDigests(dir, referencedDigests); err != nil {
+			return result, fmt.Errorf("failed to scan %s manifests: %w", dir, err)
+		}
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir {
-			continue
-		}
+	gc.log.WithField("referencedCount", len(referencedDigests)).Debug("Collected referenced digests")
 
-		blobName := entry.Name
-		digest := blobName
-		if !strings.HasPrefix(digest, "sha256:") {
-			digest = "sha256:" + digest
+	// Scan blobs in both layouts and find orphans
+	err := gc.backend.Walk("blobs", func(blobPath string, entry storage.FileInfo) error {
+		digest := gc.pathManager.BlobDigestFromPath(blobPath)
+		if digest == "" {
+			return nil
 		}
 
-		if !referencedDigests[digest] && !referencedDigests[blobName] {
+		if !referencedDigests[digest] {
 			gc.log.WithFields(logrus.Fields{
-				"blob":   blobName,
+				"blob":   blobPath,
 				"size":   entry.Size,
 				"dryRun": dryRun,
 			}).Info("Found orphan blob")
@@ -188,44 +184,35 @@ func (gc *GCService) cleanOrphanBlobs(dryRun bool) (*cleanResult, error) {
 			result.bytes += entry.Size
 
 			if !dryRun {
-				blobPath := filepath.Join("blobs", blobName)
 				if err := gc.backend.Delete(blobPath); err != nil {
-					gc.log.WithError(err).WithField("blob", blobName).Warn("Failed to delete orphan blob")
+					gc.log.WithError(err).WithField("blob", blobPath).Warn("Failed to delete orphan blob")
 				}
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to list blobs: %w", err)
 	}
 
 	return result, nil
 }
 
 // collectReferencedDigests walks a directory tree and extracts digests from manifests
-func (gc *GCService) collectReferencedDigests(dir string, digests map[string]bool) {
-	gc.walkAndCollectDigests(dir, digests)
+func (gc *GCService) collectReferencedDigests(dir string, digests map[string]bool) error {
+	return gc.walkAndCollectDigests(dir, digests)
 }
 
-// walkAndCollectDigests recursively walks directories via Backend.List and extracts digests from JSON manifests
-func (gc *GCService) walkAndCollectDigests(dir string, digests map[string]bool) {
-	entries, err := gc.backend.List(dir)
-	if err != nil {
-		return
-	}
-
-	for _, entry := range entries {
-		fullPath := filepath.Join(dir, entry.Name)
-
-		if entry.IsDir {
-			gc.walkAndCollectDigests(fullPath, digests)
-			continue
-		}
-
+// walkAndCollectDigests walks a directory tree via Backend.Walk and extracts digests from JSON manifests
+func (gc *GCService) walkAndCollectDigests(dir string, digests map[string]bool) error {
+	return gc.backend.Walk(dir, func(fullPath string, entry storage.FileInfo) error {
 		if !strings.HasSuffix(entry.Name, ".json") {
-			continue
+			return nil
 		}
 
 		data, err := gc.backend.Read(fullPath)
 		if err != nil {
-			continue
+			return nil
 		}
 
 		var manifest struct {
@@ -241,7 +228,7 @@ func (gc *GCService) walkAndCollectDigests(dir string, digests map[string]bool)
 		}
 
 		if err := json.Unmarshal(data, &manifest); err != nil {
-			continue
+			return nil
 		}
 
 		if manifest.Config.Digest != "" {
@@ -262,7 +249,8 @@ func (gc *GCService) walkAndCollectDigests(dir string, digests map[string]bool)
 				digests[strings.TrimPrefix(m.Digest, "sha256:")] = true
 			}
 		}
-	}
+		return nil
+	})
 }
 
 // GetStats returns current storage statistics
@@ -270,14 +258,13 @@ func (gc *GCService) GetStats() (*models.StorageStats, error) {
 	stats := &models.StorageStats{}
 
 	// Count blobs
-	if entries, err := gc.backend.List("blobs"); err == nil {
-		for _, e := range entries {
-			if !e.IsDir {
-				stats.BlobCount++
-				stats.BlobsSize += e.Size
-			}
+	gc.backend.Walk("blobs", func(blobPath string, e storage.FileInfo) error {
+		if gc.pathManager.BlobDigestFromPath(blobPath) != "" {
+			stats.BlobCount++
+			stats.BlobsSize += e.Size
 		}
-	}
+		return nil
+	})
 
 	// Count cached images
 	if images, err := gc.proxyService.GetCachedImages(); err == nil {
@@ -288,14 +275,13 @@ func (gc *GCService) GetStats() (*models.StorageStats, error) {
 	}
 
 	// Count charts
-	if entries, err := gc.backend.List("charts"); err == nil {
-		for _, e := range entries {
-			if !e.IsDir && strings.HasSuffix(e.Name, ".tgz") {
-				stats.ChartCount++
-				stats.ChartsSize += e.Size
-			}
+	gc.backend.ListIter("charts", func(e storage.FileInfo) error {
+		if !e.IsDir && strings.HasSuffix(e.Name, ".tgz") {
+			stats.ChartCount++
+			stats.ChartsSize += e.Size
 		}
-	}
+		return nil
+	})
 
 	stats.TotalSize = stats.BlobsSize + stats.CachedImagesSize + stats.ChartsSize
 
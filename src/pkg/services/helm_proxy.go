@@ -0,0 +1,369 @@
+// pkg/services/helm_proxy.go
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"oci-storage/config"
+	"oci-storage/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// ErrHelmRepoNotConfigured is returned for a /helm-proxy/<name>/ repository missing from proxy.helmRepositories
+	ErrHelmRepoNotConfigured = errors.New("helm repository not configured")
+	// ErrHelmChartNotFound is returned when a chart version is not listed in the upstream index
+	ErrHelmChartNotFound = errors.New("chart version not found in helm repository")
+)
+
+// maxHelmDownloadBytes bounds upstream index.yaml files and chart archives
+const maxHelmDownloadBytes = 256 * 1024 * 1024
+
+// helmRepoIndex is an upstream index.yaml rewritten to point at oci-storage
+type helmRepoIndex struct {
+	data    []byte
+	charts  map[string]helmChartEntry // by helmChartKey
+	expires time.Time
+}
+
+// helmChartEntry is what the proxy needs from an index entry to fetch and cache a chart
+type helmChartEntry struct {
+	url         string // absolute upstream URL
+	digest      string // sha256 hex, may be empty
+	apiVersion  string
+	appVersion  string
+	description string
+}
+
+func helmChartKey(chart, version string) string {
+	return chart + "@" + version
+}
+
+// HelmChartCacheName returns the cache name of a proxied chart. Charts are stored like
+// Helm OCI artifacts under proxy/helm/<repo>/<chart>, so they share image eviction, pins and GC.
+func HelmChartCacheName(repo, chart string) string {
+	return "proxy/helm/" + repo + "/" + chart
+}
+
+// helmProxyChartURL is the oci-storage download URL written into rewritten indexes
+func helmProxyChartURL(repo, chart, version string) string {
+	return fmt.Sprintf("/helm-proxy/%s/charts/%s/%s-%s.tgz", repo, chart, chart, version)
+}
+
+// helmRepo returns the configured Helm repository with the given name
+func (s *ProxyService) helmRepo(name string) *config.HelmRepositoryConfig {
+	for i := range s.config.Proxy.HelmRepositories {
+		if s.config.Proxy.HelmRepositories[i].Name == name {
+			return &s.config.Proxy.HelmRepositories[i]
+		}
+	}
+	return nil
+}
+
+// GetHelmIndex returns the upstream index.yaml of a Helm repository with chart URLs
+// rewritten to /helm-proxy/<repo>/charts/... Indexes are cached for
+// proxy.cache.helmIndexTTLSeconds; the last fetched copy is served if the upstream is down.
+func (s *ProxyService) GetHelmIndex(ctx context.Context, repoName string) ([]byte, error) {
+	repo := s.helmRepo(repoName)
+	if repo == nil {
+		return nil, fmt.Errorf("%w: %s", ErrHelmRepoNotConfigured, repoName)
+	}
+	idx, err := s.helmIndex(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	return idx.data, nil
+}
+
+// helmIndex returns the rewritten index of a repository, refreshing it when expired
+func (s *ProxyService) helmIndex(ctx context.Context, repo *config.HelmRepositoryConfig) (*helmRepoIndex, error) {
+	s.helmMu.Lock()
+	cached := s.helmIndexes[repo.Name]
+	s.helmMu.Unlock()
+	if cached != nil && time.Now().Before(cached.expires) {
+		return cached, nil
+	}
+
+	storedPath := filepath.Join("cache", "helm", repo.Name, "index.yaml")
+	raw, err := s.fetchHelmURL(ctx, repo, strings.TrimSuffix(repo.URL, "/")+"/index.yaml")
+	if err != nil {
+		if cached != nil {
+			s.log.WithError(err).WithField("repo", repo.Name).Warn("Failed to refresh Helm index, serving cached copy")
+			return cached, nil
+		}
+		stored, readErr := s.backend.Read(storedPath)
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to fetch index.yaml from %s: %w", repo.URL, err)
+		}
+		s.log.WithError(err).WithField("repo", repo.Name).Warn("Failed to fetch Helm index, serving stored copy")
+		raw = stored
+	} else if err := s.backend.Write(storedPath, raw); err != nil {
+		s.log.WithError(err).WithField("repo", repo.Name).Warn("Failed to store Helm index")
+	}
+
+	idx, err := rewriteHelmIndex(repo, raw)
+	if err != nil {
+		return nil, err
+	}
+	idx.expires = time.Now().Add(time.Duration(s.config.Proxy.Cache.HelmIndexTTLSeconds) * time.Second)
+
+	s.helmMu.Lock()
+	s.helmIndexes[repo.Name] = idx
+	s.helmMu.Unlock()
+
+	s.log.WithFields(logrus.Fields{
+		"repo":   repo.Name,
+		"charts": len(idx.charts),
+	}).Debug("Helm index refreshed")
+	return idx, nil
+}
+
+// rewriteHelmIndex points every chart URL of an index at oci-storage and records the
+// upstream URLs. Unknown fields and ordering are preserved.
+func rewriteHelmIndex(repo *config.HelmRepositoryConfig, raw []byte) (*helmRepoIndex, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("invalid index.yaml from %s: %w", repo.URL, err)
+	}
+
+	base, err := neturl.Parse(strings.TrimSuffix(repo.URL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid helm repository URL: %w", err)
+	}
+
+	idx := &helmRepoIndex{charts: make(map[string]helmChartEntry)}
+	for _, item := range doc {
+		if item.Key != "entries" {
+			continue
+		}
+		entries, _ := item.Value.(yaml.MapSlice)
+		for _, entry := range entries {
+			chart := fmt.Sprint(entry.Key)
+			versions, _ := entry.Value.([]interface{})
+			for _, v := range versions {
+				fields, ok := v.(yaml.MapSlice)
+				if !ok {
+					continue
+				}
+
+				var version string
+				var chartEntry helmChartEntry
+				urlsField := -1
+				for i, field := range fields {
+					switch field.Key {
+					case "version":
+						version = fmt.Sprint(field.Value)
+					case "digest":
+						chartEntry.digest = fmt.Sprint(field.Value)
+					case "apiVersion":
+						chartEntry.apiVersion = fmt.Sprint(field.Value)
+					case "appVersion":
+						chartEntry.appVersion = fmt.Sprint(field.Value)
+					case "description":
+						chartEntry.description = fmt.Sprint(field.Value)
+					case "urls":
+						urlsField = i
+						if urls, ok := field.Value.([]interface{}); ok && len(urls) > 0 {
+							chartEntry.url = fmt.Sprint(urls[0])
+						}
+					}
+				}
+				if version == "" || chartEntry.url == "" {
+					continue
+				}
+
+				// Relative URLs are relative to the repository URL
+				ref, err := neturl.Parse(chartEntry.url)
+				if err != nil {
+					continue
+				}
+				chartEntry.url = base.ResolveReference(ref).String()
+
+				idx.charts[helmChartKey(chart, version)] = chartEntry
+				fields[urlsField].Value = []interface{}{helmProxyChartURL(repo.Name, chart, version)}
+			}
+		}
+	}
+
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rewritten index: %w", err)
+	}
+	idx.data = data
+	return idx, nil
+}
+
+// GetHelmChart returns a chart archive of a proxied Helm repository, from the cache when
+// present, otherwise downloaded from the upstream URL listed in its index and cached.
+func (s *ProxyService) GetHelmChart(ctx context.Context, repoName, chart, version string) ([]byte, error) {
+	repo := s.helmRepo(repoName)
+	if repo == nil {
+		return nil, fmt.Errorf("%w: %s", ErrHelmRepoNotConfigured, repoName)
+	}
+
+	name := HelmChartCacheName(repo.Name, chart)
+	if data, err := s.readCachedHelmChart(name, version); err == nil {
+		s.UpdateAccessTime(name, version)
+		return data, nil
+	}
+
+	idx, err := s.helmIndex(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := idx.charts[helmChartKey(chart, version)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrHelmChartNotFound, chart, version)
+	}
+
+	data, err := s.fetchHelmURL(ctx, repo, entry.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", entry.url, err)
+	}
+	if entry.digest != "" {
+		sum := sha256.Sum256(data)
+		if actual := hex.EncodeToString(sum[:]); actual != entry.digest {
+			return nil, fmt.Errorf("digest mismatch for %s-%s: index has %s, got %s", chart, version, entry.digest, actual)
+		}
+	}
+
+	if err := s.cacheHelmChart(repo, chart, version, entry, data); err != nil {
+		s.log.WithError(err).WithFields(logrus.Fields{
+			"repo":    repo.Name,
+			"chart":   chart,
+			"version": version,
+		}).Warn("Failed to cache Helm chart")
+	}
+	return data, nil
+}
+
+// readCachedHelmChart reads a cached chart archive through its Helm OCI manifest
+func (s *ProxyService) readCachedHelmChart(name, version string) ([]byte, error) {
+	layer, err := s.cachedChartLayer(name, version)
+	if err != nil {
+		return nil, err
+	}
+	return s.backend.Read(s.pathManager.GetBlobPath(layer.Digest))
+}
+
+// cacheHelmChart stores a chart as a Helm OCI artifact (config + chart layer) and tracks it
+// like a proxied image, so it is subject to the same eviction, pins and stale GC
+func (s *ProxyService) cacheHelmChart(repo *config.HelmRepositoryConfig, chart, version string, entry helmChartEntry, data []byte) error {
+	chartConfig, err := json.Marshal(map[string]string{
+		"name":        chart,
+		"version":     version,
+		"apiVersion":  entry.apiVersion,
+		"appVersion":  entry.appVersion,
+		"description": entry.description,
+	})
+	if err != nil {
+		return err
+	}
+
+	manifest := models.OCIManifest{
+		SchemaVersion: 2,
+		MediaType:     models.MediaTypeOCIManifest,
+		Config:        s.writeHelmBlob(models.MediaTypeHelmConfig, chartConfig),
+		Layers:        []models.OCIDescriptor{s.writeHelmBlob(models.MediaTypeHelmChart, data)},
+	}
+	for _, desc := range append([]models.OCIDescriptor{manifest.Config}, manifest.Layers...) {
+		if desc.Digest == "" {
+			return fmt.Errorf("failed to store chart blobs")
+		}
+	}
+
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	name := HelmChartCacheName(repo.Name, chart)
+	if err := s.backend.Write(s.pathManager.GetImageManifestPath(name, version), manifestData); err != nil {
+		return fmt.Errorf("failed to write chart manifest: %w", err)
+	}
+
+	now := time.Now()
+	return s.AddToCache(models.CachedImageMetadata{
+		Name:           name,
+		Tag:            version,
+		Digest:         fmt.Sprintf("sha256:%x", sha256.Sum256(manifestData)),
+		SourceRegistry: "helm/" + repo.Name,
+		OriginalRef:    entry.url,
+		Size:           manifest.GetTotalSize(),
+		CachedAt:       now,
+		LastAccessed:   now,
+		AccessCount:    1,
+		ArtifactType:   models.ArtifactTypeHelmChart,
+	})
+}
+
+// writeHelmBlob stores content under blobs/ and returns its descriptor (empty digest on failure)
+func (s *ProxyService) writeHelmBlob(mediaType string, content []byte) models.OCIDescriptor {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	blobPath := s.pathManager.GetBlobPath(digest)
+	if exists, _ := s.backend.Exists(blobPath); !exists {
+		if err := s.backend.Write(blobPath, content); err != nil {
+			s.log.WithError(err).WithField("digest", digest).Warn("Failed to write chart blob")
+			return models.OCIDescriptor{}
+		}
+	}
+	return models.OCIDescriptor{MediaType: mediaType, Digest: digest, Size: int64(len(content))}
+}
+
+// fetchHelmURL downloads a file from a Helm repository. Credentials are only sent to the
+// repository host, not to external chart hosts (e.g. GitHub releases).
+func (s *ProxyService) fetchHelmURL(ctx context.Context, repo *config.HelmRepositoryConfig, rawURL string) ([]byte, error) {
+	client, err := s.clientFor(config.RegistryEndpoint{URL: repo.URL, TLS: repo.TLS})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if repo.Username != "" {
+		if repoURL, err := neturl.Parse(repo.URL); err == nil && repoURL.Host == req.URL.Host {
+			req.SetBasicAuth(repo.Username, repo.Password)
+		}
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"repo": repo.Name,
+		"url":  rawURL,
+	}).Debug("Fetching from upstream Helm repository")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrHelmChartNotFound, rawURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream returned %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHelmDownloadBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxHelmDownloadBytes {
+		return nil, fmt.Errorf("response exceeds %d bytes", maxHelmDownloadBytes)
+	}
+	return data, nil
+}
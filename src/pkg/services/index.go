@@ -8,6 +8,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -166,6 +167,28 @@ func (s *IndexService) UpdateIndex() error {
 		}).Debug("Chart added to index")
 	}
 
+	// Charts cached by the proxy are downloaded from their chart layer blob, which keeps
+	// pulls counted as cache hits
+	cached, err := s.chartService.ListCachedCharts()
+	if err != nil {
+		s.log.WithError(err).Warn("Error listing cached charts")
+	}
+	for _, metadata := range cached {
+		if exists, _ := s.backend.Exists(s.pathManager.GetChartPath(metadata.Name, metadata.Version)); exists {
+			continue
+		}
+		index.Entries[metadata.Name] = append(index.Entries[metadata.Name], &ChartVersion{
+			Name:        metadata.Name,
+			Version:     metadata.Version,
+			Description: metadata.Description,
+			AppVersion:  metadata.AppVersion,
+			APIVersion:  metadata.ApiVersion,
+			Created:     time.Now(),
+			Digest:      strings.TrimPrefix(metadata.Digest, "sha256:"),
+			URLs:        []string{fmt.Sprintf("%s/v2/%s/blobs/%s", s.baseURL, metadata.Source, metadata.Digest)},
+		})
+	}
+
 	indexYAML, err := yaml.Marshal(index)
 	if err != nil {
 		return fmt.Errorf("error marshaling index: %w", err)
@@ -4,17 +4,19 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"oci-storage/config"
+	"oci-storage/pkg/coordination"
 	"oci-storage/pkg/models"
 	"oci-storage/pkg/storage"
 	"oci-storage/pkg/utils"
@@ -22,41 +24,113 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	// ErrUpstreamNotFound is returned when the upstream registry answered 404,
+	// either just now or recently enough that the negative cache still remembers it.
+	ErrUpstreamNotFound = errors.New("not found on upstream registry")
+	// ErrCircuitOpen is returned when requests to a registry are short-circuited
+	// after repeated failures.
+	ErrCircuitOpen = errors.New("upstream circuit breaker open")
+	// ErrRateLimited is returned when every endpoint of a registry has exhausted its pull quota.
+	ErrRateLimited = errors.New("upstream pull quota exhausted")
+	// ErrCachedImageNotFound is returned when a cached image has no metadata entry.
+	ErrCachedImageNotFound = errors.New("cached image not found")
+)
+
 // ProxyService handles Docker registry proxying and caching
 type ProxyService struct {
 	config      *config.Config
 	pathManager *utils.PathManager
 	backend     storage.Backend
 	log         *utils.Logger
-	httpClient  *http.Client
 	cacheMutex  sync.RWMutex
 	cacheState  *models.CacheState
+
+	// negativeCache remembers upstream 404s (key: registryURL/name:reference -> expiry)
+	negativeMu    sync.Mutex
+	negativeCache map[string]time.Time
+
+	// clients holds one HTTP client (and transport) per upstream endpoint URL
+	clientsMu sync.Mutex
+	clients   map[string]*upstreamClient
+
+	// breakers holds one circuit breaker per upstream endpoint URL
+	breakersMu sync.Mutex
+	breakers   map[string]*circuitBreaker
+
+	// tokens caches upstream auth per endpoint and scope
+	tokens *tokenCache
+
+	// rateLimits holds the advertised pull quota per upstream endpoint URL
+	rateLimitsMu sync.Mutex
+	rateLimits   map[string]*rateLimitState
+
+	// listingCache briefly keeps upstream tags/list and _catalog results
+	listingMu    sync.Mutex
+	listingCache map[string]cachedListing
+
+	// policy decides which upstream images may be proxied; policyErr denies everything
+	// when the configured rules fail to compile
+	policy    *proxyPolicy
+	policyErr error
+
+	// pinPatterns are the compiled proxy.cache.pinned patterns
+	pinPatterns []*regexp.Regexp
+
+	// eviction ranks cached images when the cache is over its limits
+	eviction EvictionPolicy
+
+	// pendingAccess batches cache hits until the next FlushAccesses; accessStore shares
+	// the counters across replicas (nil: persisted to the per-image metadata)
+	accessMu      sync.Mutex
+	pendingAccess map[accessKey]*accessHit
+	accessStore   coordination.AccessStore
+
+	// helmIndexes caches rewritten upstream Helm index.yaml files by repository name
+	helmMu      sync.Mutex
+	helmIndexes map[string]*helmRepoIndex
+
+	// chartIndex regenerates index.yaml when cached Helm charts change (nil: not listed)
+	chartIndex IndexUpdater
+
+	// evictMu serializes eviction passes, evictRequests holds a pass requested by AddToCache;
+	// usage caches blob-level usage for /cache/status
+	evictMu         sync.Mutex
+	evictRequests   chan struct{}
+	usageMu         sync.Mutex
+	usage           *cacheBlobIndex
+	usageComputedAt time.Time
 }
 
 // NewProxyService creates a new proxy service
 func NewProxyService(cfg *config.Config, log *utils.Logger, pm *utils.PathManager, backend storage.Backend) *ProxyService {
-	// Configure HTTP transport with connection pooling to prevent fd exhaustion
-	transport := &http.Transport{
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 20,
-		MaxConnsPerHost:     50,
-		IdleConnTimeout:     90 * time.Second,
-	}
-
 	svc := &ProxyService{
 		config:      cfg,
 		pathManager: pm,
 		backend:     backend,
 		log:         log,
-		httpClient: &http.Client{
-			Timeout:   0,
-			Transport: transport,
-		},
 		cacheState: &models.CacheState{
 			MaxSize: int64(cfg.Proxy.Cache.MaxSizeGB) * 1024 * 1024 * 1024,
 		},
+		clients:       make(map[string]*upstreamClient),
+		negativeCache: make(map[string]time.Time),
+		breakers:      make(map[string]*circuitBreaker),
+		tokens:        newTokenCache(),
+		rateLimits:    make(map[string]*rateLimitState),
+		listingCache:  make(map[string]cachedListing),
+		pendingAccess: make(map[accessKey]*accessHit),
+		helmIndexes:   make(map[string]*helmRepoIndex),
+		evictRequests: make(chan struct{}, 1),
+	}
+
+	svc.policy, svc.policyErr = newProxyPolicy(cfg.Proxy.Policy)
+	if svc.policyErr != nil {
+		log.WithError(svc.policyErr).Error("Invalid proxy policy, all upstream fetches will be denied")
 	}
 
+	svc.pinPatterns = svc.compilePinPatterns()
+	svc.eviction = svc.configuredEvictionPolicy()
+
 	// Load existing cache state
 	svc.loadCacheState()
 
@@ -114,6 +188,20 @@ func (s *ProxyService) GetDefaultRegistry() string {
 
 // GetManifest fetches a manifest from upstream registry
 func (s *ProxyService) GetManifest(ctx context.Context, registryURL, name, reference string) ([]byte, string, error) {
+	if err := s.checkPolicy(registryURL, name, reference); err != nil {
+		return nil, "", err
+	}
+
+	negativeKey := registryURL + "/" + name + ":" + reference
+	if s.isNegativelyCached(negativeKey) {
+		s.log.WithFields(logrus.Fields{
+			"registry":  registryURL,
+			"name":      name,
+			"reference": reference,
+		}).Debug("Manifest miss served from negative cache")
+		return nil, "", fmt.Errorf("%w: %s:%s", ErrUpstreamNotFound, name, reference)
+	}
+
 	url := fmt.Sprintf("%s/v2/%s/manifests/%s", registryURL, name, reference)
 
 	s.log.WithFields(logrus.Fields{
@@ -141,6 +229,11 @@ func (s *ProxyService) GetManifest(ctx context.Context, registryURL, name, refer
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		s.addNegativeCache(negativeKey)
+		return nil, "", fmt.Errorf("%w: %s:%s", ErrUpstreamNotFound, name, reference)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, "", fmt.Errorf("upstream returned status %d: %s", resp.StatusCode, string(body))
@@ -180,6 +273,11 @@ func (s *ProxyService) GetBlob(ctx context.Context, registryURL, name, digest st
 		return nil, 0, fmt.Errorf("failed to fetch blob: %w", err)
 	}
 
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("%w: blob %s", ErrUpstreamNotFound, digest)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		resp.Body.Close()
 		return nil, 0, fmt.Errorf("upstream returned status %d", resp.StatusCode)
@@ -188,48 +286,422 @@ func (s *ProxyService) GetBlob(ctx context.Context, registryURL, name, digest st
 	return resp.Body, resp.ContentLength, nil
 }
 
-// FetchWithAuth handles Docker registry authentication flow
+// FetchWithAuth handles Docker registry authentication flow.
+// The request must target registryURL, the logical registry. When the registry has several
+// endpoints they are tried in order: endpoints whose circuit breaker is open are skipped and
+// network errors, 5xx and 429 fail over to the next one. Endpoints with an exhausted pull
+// quota are skipped and those running low are tried last. Calls fail fast with ErrRateLimited
+// or ErrCircuitOpen only when no endpoint is usable. Requests denied by the proxy policy
+// fail with ErrPolicyDenied before anything is sent.
 func (s *ProxyService) FetchWithAuth(ctx context.Context, req *http.Request, registryURL, name string) (*http.Response, error) {
+	if err := s.checkPolicy(registryURL, name, ""); err != nil {
+		return nil, err
+	}
+
+	endpoints := s.orderByQuota(s.endpointsFor(registryURL))
+
+	var lastResp *http.Response
+	var lastErr error
+	attempted, throttled := 0, 0
+
+	for i, ep := range endpoints {
+		if s.rateLimitFor(ep.URL).backoffRemaining(s.rateLimitBackoff()) > 0 {
+			s.log.WithFields(logrus.Fields{
+				"registry": registryURL,
+				"endpoint": ep.URL,
+			}).Debug("Pull quota exhausted, skipping endpoint")
+			throttled++
+			continue
+		}
+
+		breaker := s.breakerFor(ep.URL)
+		if !breaker.allow() {
+			s.log.WithFields(logrus.Fields{
+				"registry": registryURL,
+				"endpoint": ep.URL,
+			}).Debug("Circuit breaker open, skipping endpoint")
+			continue
+		}
+
+		// Only the last failed response is handed back to the caller
+		if lastResp != nil {
+			lastResp.Body.Close()
+			lastResp = nil
+		}
+		attempted++
+
+		epReq, epName, err := endpointRequest(ctx, req, registryURL, name, ep)
+		if err != nil {
+			breaker.release()
+			return nil, err
+		}
+
+		resp, err := s.doWithAuth(ctx, epReq, epName, ep)
+		if failed := s.recordUpstreamResult(ctx, breaker, ep.URL, resp, err); !failed {
+			return resp, err
+		}
+		lastResp, lastErr = resp, err
+
+		if i < len(endpoints)-1 {
+			s.log.WithFields(logrus.Fields{
+				"registry": registryURL,
+				"endpoint": ep.URL,
+			}).Warn("Upstream endpoint failed, trying next endpoint")
+		}
+	}
+
+	if attempted == 0 {
+		if throttled > 0 {
+			s.log.WithField("registry", registryURL).Warn("Pull quota exhausted on all usable endpoints, backing off")
+			return nil, fmt.Errorf("%w: %s", ErrRateLimited, registryURL)
+		}
+		s.log.WithField("registry", registryURL).Debug("Circuit breaker open on all endpoints, failing fast")
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, registryURL)
+	}
+	return lastResp, lastErr
+}
+
+// orderByQuota moves endpoints whose remaining pull quota is low to the end of the
+// failover list, keeping the configured order otherwise.
+func (s *ProxyService) orderByQuota(endpoints []config.RegistryEndpoint) []config.RegistryEndpoint {
+	watermark, backoff := s.config.Proxy.RateLimit.LowWatermark, s.rateLimitBackoff()
+	ordered := make([]config.RegistryEndpoint, 0, len(endpoints))
+	var low []config.RegistryEndpoint
+	for _, ep := range endpoints {
+		if s.rateLimitFor(ep.URL).isLow(watermark, backoff) {
+			low = append(low, ep)
+			continue
+		}
+		ordered = append(ordered, ep)
+	}
+	return append(ordered, low...)
+}
+
+// endpointRequest rewrites a request built against the logical registry URL so it targets
+// the given endpoint, inserting the endpoint's repository prefix. It also returns the
+// repository name as seen by that endpoint (used for token scopes).
+func endpointRequest(ctx context.Context, req *http.Request, registryURL, name string, ep config.RegistryEndpoint) (*http.Request, string, error) {
+	epReq := req.Clone(ctx)
+	if ep.URL == registryURL && ep.Prefix == "" {
+		return epReq, name, nil
+	}
+
+	rest := strings.TrimPrefix(req.URL.String(), registryURL)
+	epName := name
+	if prefix := strings.Trim(ep.Prefix, "/"); prefix != "" {
+		epName = prefix + "/" + name
+		rest = strings.Replace(rest, "/v2/"+name+"/", "/v2/"+epName+"/", 1)
+	}
+
+	target, err := neturl.Parse(strings.TrimSuffix(ep.URL, "/") + rest)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid endpoint URL %s: %w", ep.URL, err)
+	}
+	epReq.URL = target
+	epReq.Host = target.Host
+	return epReq, epName, nil
+}
+
+// doWithAuth performs the request with cached upstream auth when available. On a 401 it
+// answers the challenge (Bearer token or Basic credentials), caches the result and retries once.
+func (s *ProxyService) doWithAuth(ctx context.Context, req *http.Request, name string, ep config.RegistryEndpoint) (*http.Response, error) {
 	s.log.WithFields(logrus.Fields{
 		"url":    req.URL.String(),
 		"method": req.Method,
 	}).Debug("Making upstream request")
 
-	var regConfig *config.RegistryConfig
-	for i := range s.config.Proxy.Registries {
-		if s.config.Proxy.Registries[i].URL == registryURL {
-			regConfig = &s.config.Proxy.Registries[i]
-			break
-		}
+	client, err := s.clientFor(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheKey := tokenCacheKey(ep.URL, fmt.Sprintf("repository:%s:pull", name))
+	if auth, ok := s.tokens.get(cacheKey); ok {
+		auth.apply(req, ep)
 	}
 
-	resp, err := s.httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		s.log.WithError(err).Error("Upstream request failed")
 		return nil, err
 	}
+	s.recordRateLimit(ep.URL, resp)
 
 	s.log.WithField("status", resp.StatusCode).Debug("Upstream response received")
 
 	if resp.StatusCode == http.StatusUnauthorized {
 		resp.Body.Close()
-		s.log.Debug("Got 401, fetching auth token...")
+		s.tokens.invalidate(cacheKey)
+		s.log.Debug("Got 401, answering auth challenge...")
 
-		wwwAuth := resp.Header.Get("Www-Authenticate")
-		token, err := s.getToken(ctx, wwwAuth, name, regConfig)
+		auth, err := s.authorize(ctx, resp.Header.Get("Www-Authenticate"), name, ep)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get auth token: %w", err)
 		}
+		s.tokens.set(cacheKey, auth)
 
-		s.log.Debug("Token obtained, retrying request with auth")
-		req.Header.Set("Authorization", "Bearer "+token)
-		return s.httpClient.Do(req)
+		s.log.Debug("Auth obtained, retrying request")
+		auth.apply(req, ep)
+		resp, err = client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		s.recordRateLimit(ep.URL, resp)
+		return resp, nil
 	}
 
 	return resp, nil
 }
 
-func (s *ProxyService) getToken(ctx context.Context, wwwAuth, name string, regConfig *config.RegistryConfig) (string, error) {
+// authorize answers an upstream WWW-Authenticate challenge
+func (s *ProxyService) authorize(ctx context.Context, wwwAuth, name string, ep config.RegistryEndpoint) (upstreamAuth, error) {
+	if challengeScheme(wwwAuth) == authSchemeBasic {
+		if ep.Username == "" || ep.Password == "" {
+			return upstreamAuth{}, fmt.Errorf("endpoint %s requires basic auth but no credentials are configured", ep.URL)
+		}
+		return upstreamAuth{scheme: authSchemeBasic, expires: time.Now().Add(basicAuthTTL)}, nil
+	}
+
+	token, expiresIn, err := s.getToken(ctx, wwwAuth, name, ep)
+	if err != nil {
+		return upstreamAuth{}, err
+	}
+	return upstreamAuth{
+		scheme:  authSchemeBearer,
+		token:   token,
+		expires: time.Now().Add(tokenTTL(expiresIn)),
+	}, nil
+}
+
+// recordRateLimit stores the quota headers of an upstream response
+func (s *ProxyService) recordRateLimit(endpointURL string, resp *http.Response) {
+	s.rateLimitFor(endpointURL).update(resp, s.rateLimitBackoff())
+}
+
+// rateLimitFor returns the quota state for an upstream endpoint, creating it on first use
+func (s *ProxyService) rateLimitFor(endpointURL string) *rateLimitState {
+	s.rateLimitsMu.Lock()
+	defer s.rateLimitsMu.Unlock()
+
+	r, ok := s.rateLimits[endpointURL]
+	if !ok {
+		r = &rateLimitState{}
+		s.rateLimits[endpointURL] = r
+	}
+	return r
+}
+
+func (s *ProxyService) rateLimitBackoff() time.Duration {
+	return time.Duration(s.config.Proxy.RateLimit.BackoffSeconds) * time.Second
+}
+
+// IsQuotaLow reports whether every endpoint of a registry is low on pull quota.
+// Callers use it to skip optional upstream requests such as platform prefetching.
+func (s *ProxyService) IsQuotaLow(registryURL string) bool {
+	watermark, backoff := s.config.Proxy.RateLimit.LowWatermark, s.rateLimitBackoff()
+	for _, ep := range s.endpointsFor(registryURL) {
+		if !s.rateLimitFor(ep.URL).isLow(watermark, backoff) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordUpstreamResult feeds the outcome of an upstream call into the endpoint's breaker.
+// Network errors, 5xx and 429 count as failures; client cancellations are neutral.
+// Returns true when the call failed and the next endpoint should be tried.
+func (s *ProxyService) recordUpstreamResult(ctx context.Context, breaker *circuitBreaker, endpointURL string, resp *http.Response, err error) bool {
+	var reason string
+	switch {
+	case err != nil && ctx.Err() != nil:
+		breaker.release()
+		return false
+	case err != nil:
+		reason = err.Error()
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		reason = fmt.Sprintf("upstream returned status %d", resp.StatusCode)
+	default:
+		breaker.recordSuccess()
+		return false
+	}
+
+	if opened := breaker.recordFailure(reason); opened {
+		s.log.WithFields(logrus.Fields{
+			"endpoint": endpointURL,
+			"reason":   reason,
+		}).Warn("Upstream circuit breaker opened")
+	}
+	return true
+}
+
+// breakerFor returns the circuit breaker for an upstream endpoint, creating it on first use
+func (s *ProxyService) breakerFor(endpointURL string) *circuitBreaker {
+	s.breakersMu.Lock()
+	defer s.breakersMu.Unlock()
+
+	b, ok := s.breakers[endpointURL]
+	if !ok {
+		cbCfg := s.config.Proxy.CircuitBreaker
+		b = newCircuitBreaker(cbCfg.FailureThreshold, time.Duration(cbCfg.OpenSeconds)*time.Second)
+		s.breakers[endpointURL] = b
+	}
+	return b
+}
+
+// RetryAfter returns how long until one of the registry's endpoints accepts requests again,
+// considering both circuit breakers and exhausted pull quotas (0 when any is usable)
+func (s *ProxyService) RetryAfter(registryURL string) time.Duration {
+	var shortest time.Duration
+	for i, ep := range s.endpointsFor(registryURL) {
+		wait := s.breakerFor(ep.URL).retryAfter()
+		if quotaWait := s.rateLimitFor(ep.URL).backoffRemaining(s.rateLimitBackoff()); quotaWait > wait {
+			wait = quotaWait
+		}
+		if wait == 0 {
+			return 0
+		}
+		if i == 0 || wait < shortest {
+			shortest = wait
+		}
+	}
+	return shortest
+}
+
+// registryConfigForURL returns the configured registry matching an upstream URL, or nil
+func (s *ProxyService) registryConfigForURL(registryURL string) *config.RegistryConfig {
+	for i := range s.config.Proxy.Registries {
+		if s.config.Proxy.Registries[i].URL == registryURL {
+			return &s.config.Proxy.Registries[i]
+		}
+	}
+	return nil
+}
+
+// registryConfigForName returns the configured registry with the given name, if any
+func (s *ProxyService) registryConfigForName(name string) *config.RegistryConfig {
+	for i := range s.config.Proxy.Registries {
+		if s.config.Proxy.Registries[i].Name == name {
+			return &s.config.Proxy.Registries[i]
+		}
+	}
+	return nil
+}
+
+// endpointsFor returns the endpoints of a logical registry in failover order.
+// Unconfigured registries (e.g. the built-in Docker Hub default) have a single anonymous endpoint.
+func (s *ProxyService) endpointsFor(registryURL string) []config.RegistryEndpoint {
+	if regConfig := s.registryConfigForURL(registryURL); regConfig != nil {
+		return regConfig.GetEndpoints()
+	}
+	return []config.RegistryEndpoint{{URL: registryURL}}
+}
+
+// isNegativelyCached reports whether an upstream 404 for key is still remembered
+func (s *ProxyService) isNegativelyCached(key string) bool {
+	s.negativeMu.Lock()
+	defer s.negativeMu.Unlock()
+
+	expiry, ok := s.negativeCache[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(s.negativeCache, key)
+		return false
+	}
+	return true
+}
+
+// addNegativeCache remembers an upstream 404 for the configured TTL; a negative TTL disables it
+func (s *ProxyService) addNegativeCache(key string) {
+	ttl := time.Duration(s.config.Proxy.Cache.NegativeTTLSeconds) * time.Second
+	if ttl <= 0 {
+		return
+	}
+
+	s.negativeMu.Lock()
+	defer s.negativeMu.Unlock()
+
+	now := time.Now()
+	// Sweep expired entries occasionally so typo storms cannot grow the map unbounded
+	if len(s.negativeCache) >= 10000 {
+		for k, expiry := range s.negativeCache {
+			if now.After(expiry) {
+				delete(s.negativeCache, k)
+			}
+		}
+	}
+	s.negativeCache[key] = now.Add(ttl)
+}
+
+// GetUpstreamStatus returns circuit breaker state per endpoint and negative cache state per configured registry
+func (s *ProxyService) GetUpstreamStatus() []models.UpstreamStatus {
+	negativeCounts := make(map[string]int)
+	s.negativeMu.Lock()
+	now := time.Now()
+	for key, expiry := range s.negativeCache {
+		if now.After(expiry) {
+			continue
+		}
+		for _, reg := range s.config.Proxy.Registries {
+			if strings.HasPrefix(key, reg.URL+"/") {
+				negativeCounts[reg.URL]++
+				break
+			}
+		}
+	}
+	s.negativeMu.Unlock()
+
+	statuses := make([]models.UpstreamStatus, 0, len(s.config.Proxy.Registries))
+	for i := range s.config.Proxy.Registries {
+		reg := &s.config.Proxy.Registries[i]
+		status := models.UpstreamStatus{
+			Registry:             reg.Name,
+			URL:                  reg.URL,
+			BreakerState:         BreakerOpen,
+			NegativeCacheEntries: negativeCounts[reg.URL],
+		}
+
+		for _, ep := range reg.GetEndpoints() {
+			state, failures, openedAt, lastFailure, lastError := s.breakerFor(ep.URL).snapshot()
+			epStatus := models.UpstreamEndpointStatus{
+				URL:                 ep.URL,
+				BreakerState:        state,
+				ConsecutiveFailures: failures,
+				LastError:           lastError,
+			}
+			if state != BreakerClosed {
+				epStatus.OpenedAt = &openedAt
+			}
+			if !lastFailure.IsZero() {
+				epStatus.LastFailure = &lastFailure
+			}
+			if known, limit, remaining, reset, updatedAt := s.rateLimitFor(ep.URL).snapshot(); known {
+				epStatus.RateLimit = &models.UpstreamRateLimit{
+					Limit:     limit,
+					Remaining: remaining,
+					UpdatedAt: updatedAt,
+				}
+				if !reset.IsZero() {
+					epStatus.RateLimit.Reset = &reset
+				}
+			}
+			status.Endpoints = append(status.Endpoints, epStatus)
+
+			// The registry is as healthy as its best endpoint
+			if state == BreakerClosed || (state == BreakerHalfOpen && status.BreakerState == BreakerOpen) {
+				status.BreakerState = state
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// getToken fetches a bearer token from the challenge realm.
+// Returns the token and its lifetime in seconds as advertised by expires_in (0 when absent).
+func (s *ProxyService) getToken(ctx context.Context, wwwAuth, name string, ep config.RegistryEndpoint) (string, int, error) {
 	params := s.parseWwwAuthenticate(wwwAuth)
 
 	realm := params["realm"]
@@ -244,57 +716,51 @@ func (s *ProxyService) getToken(ctx context.Context, wwwAuth, name string, regCo
 
 	s.log.WithFields(logrus.Fields{
 		"tokenURL":       tokenURL,
-		"hasCredentials": regConfig != nil && regConfig.Username != "",
+		"hasCredentials": ep.Username != "",
 	}).Debug("Fetching auth token")
 
 	req, err := http.NewRequestWithContext(ctx, "GET", tokenURL, nil)
 	if err != nil {
-		return "", err
+		return "", 0, err
+	}
+
+	if ep.Username != "" && ep.Password != "" {
+		req.SetBasicAuth(ep.Username, ep.Password)
+		s.log.WithField("username", ep.Username).Debug("Using credentials for token request")
 	}
 
-	if regConfig != nil && regConfig.Username != "" && regConfig.Password != "" {
-		req.SetBasicAuth(regConfig.Username, regConfig.Password)
-		s.log.WithField("username", regConfig.Username).Debug("Using credentials for token request")
+	client, err := s.clientFor(ep)
+	if err != nil {
+		return "", 0, err
 	}
 
-	resp, err := s.httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+		return "", 0, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
 	}
 
 	var tokenResp struct {
 		Token       string `json:"token"`
 		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	if tokenResp.Token != "" {
-		return tokenResp.Token, nil
+		return tokenResp.Token, tokenResp.ExpiresIn, nil
 	}
-	return tokenResp.AccessToken, nil
+	return tokenResp.AccessToken, tokenResp.ExpiresIn, nil
 }
 
 func (s *ProxyService) parseWwwAuthenticate(header string) map[string]string {
-	params := make(map[string]string)
-	header = strings.TrimPrefix(header, "Bearer ")
-
-	re := regexp.MustCompile(`(\w+)="([^"]*)"`)
-	matches := re.FindAllStringSubmatch(header, -1)
-
-	for _, match := range matches {
-		if len(match) == 3 {
-			params[match[1]] = match[2]
-		}
-	}
-
-	return params
+	return parseChallengeParams(header)
 }
 
 // GetCacheState returns the current cache state calculated from filesystem
@@ -307,23 +773,39 @@ func (s *ProxyService) GetCacheState() *models.CacheState {
 		}
 	}
 
-	var totalSize int64
-	for _, img := range images {
-		totalSize += img.Size
+	state := &models.CacheState{
+		MaxSize:        int64(s.config.Proxy.Cache.MaxSizeGB) * 1024 * 1024 * 1024,
+		ItemCount:      len(images),
+		EvictionPolicy: s.eviction.Name(),
 	}
 
-	state := &models.CacheState{
-		TotalSize: totalSize,
-		MaxSize:   int64(s.config.Proxy.Cache.MaxSizeGB) * 1024 * 1024 * 1024,
-		ItemCount: len(images),
+	// Sizes are deduplicated blob bytes: layers shared between images count once
+	idx, err := s.cacheUsage(images)
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to compute blob-level cache usage")
+		return state
 	}
+	state.TotalSize = idx.size(nil)
+	state.PinnedSize = idx.size(func(img *cachedImageBlobs) bool { return img.metadata.IsPinned() })
+	state.Registries = s.registryUsage(idx)
 	state.CalculateUsagePercent()
 
 	return state
 }
 
-// GetCachedImages returns all cached images metadata by scanning the storage
+// GetCachedImages returns all cached images metadata by scanning the storage,
+// including accesses not yet persisted to the metadata files
 func (s *ProxyService) GetCachedImages() ([]models.CachedImageMetadata, error) {
+	images, err := s.readCachedImages()
+	if err != nil {
+		return nil, err
+	}
+	s.applyAccesses(images)
+	return images, nil
+}
+
+// readCachedImages reads the cache metadata files
+func (s *ProxyService) readCachedImages() ([]models.CachedImageMetadata, error) {
 	metadataDir := filepath.Join("cache", "metadata")
 
 	exists, _ := s.backend.Exists(metadataDir)
@@ -331,28 +813,23 @@ func (s *ProxyService) GetCachedImages() ([]models.CachedImageMetadata, error) {
 		return []models.CachedImageMetadata{}, nil
 	}
 
-	files, err := s.backend.List(metadataDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read cache metadata directory: %w", err)
-	}
-
 	var images []models.CachedImageMetadata
-	for _, file := range files {
+	err := s.backend.ListIter(metadataDir, func(file storage.FileInfo) error {
 		if file.IsDir || !strings.HasSuffix(file.Name, ".json") {
-			continue
+			return nil
 		}
 
 		filePath := filepath.Join(metadataDir, file.Name)
 		data, err := s.backend.Read(filePath)
 		if err != nil {
 			s.log.WithError(err).WithField("file", file.Name).Warn("Failed to read cache metadata file")
-			continue
+			return nil
 		}
 
 		var metadata models.CachedImageMetadata
 		if err := json.Unmarshal(data, &metadata); err != nil {
 			s.log.WithError(err).WithField("file", file.Name).Warn("Failed to parse cache metadata file")
-			continue
+			return nil
 		}
 
 		if strings.Contains(metadata.Tag, ":") || len(metadata.Tag) < 2 {
@@ -360,31 +837,20 @@ func (s *ProxyService) GetCachedImages() ([]models.CachedImageMetadata, error) {
 				"file": file.Name,
 				"tag":  metadata.Tag,
 			}).Debug("Skipping corrupted cache entry")
-			continue
+			return nil
 		}
 
+		metadata.PinnedByConfig = s.matchesPinPattern(metadata.Name, metadata.Tag)
 		images = append(images, metadata)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache metadata directory: %w", err)
 	}
 
 	return images, nil
 }
 
-// UpdateAccessTime updates the last accessed time for a cached image
-func (s *ProxyService) UpdateAccessTime(name, tag string) {
-	s.cacheMutex.Lock()
-	defer s.cacheMutex.Unlock()
-
-	for i := range s.cacheState.Images {
-		if s.cacheState.Images[i].Name == name && s.cacheState.Images[i].Tag == tag {
-			s.cacheState.Images[i].LastAccessed = time.Now()
-			s.cacheState.Images[i].AccessCount++
-			break
-		}
-	}
-
-	go s.saveCacheState()
-}
-
 // AddToCache adds image metadata to the cache tracking
 func (s *ProxyService) AddToCache(metadata models.CachedImageMetadata) error {
 	tag := metadata.Tag
@@ -402,12 +868,32 @@ func (s *ProxyService) AddToCache(metadata models.CachedImageMetadata) error {
 
 	metadataPath := s.pathManager.GetCachedImageMetadataPath(metadata.Name, metadata.Tag)
 
+	s.cacheMutex.Lock()
+	// Re-caching a tag keeps an API pin and the access history
+	var previous models.CachedImageMetadata
+	existing, err := s.backend.Read(metadataPath)
+	isNew := err != nil || json.Unmarshal(existing, &previous) != nil
+	if !isNew {
+		metadata.Pinned = metadata.Pinned || previous.Pinned
+		metadata.AccessCount += previous.AccessCount
+		if previous.LastAccessed.After(metadata.LastAccessed) {
+			metadata.LastAccessed = previous.LastAccessed
+		}
+	} else {
+		// A new entry must not inherit counters of an evicted copy
+		s.resetAccesses(metadata.Name, metadata.Tag)
+	}
+	metadata.PinnedByConfig = false
+
 	data, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
+		s.cacheMutex.Unlock()
 		return fmt.Errorf("failed to marshal cache metadata: %w", err)
 	}
 
-	if err := s.backend.Write(metadataPath, data); err != nil {
+	err = s.backend.Write(metadataPath, data)
+	s.cacheMutex.Unlock()
+	if err != nil {
 		return fmt.Errorf("failed to write cache metadata: %w", err)
 	}
 
@@ -417,105 +903,100 @@ func (s *ProxyService) AddToCache(metadata models.CachedImageMetadata) error {
 		"path": metadataPath,
 	}).Debug("Cache metadata saved")
 
-	s.checkAndEvictIfNeeded()
+	if isNew && metadata.ArtifactType == models.ArtifactTypeHelmChart {
+		s.chartsChanged()
+	}
+	s.invalidateCacheUsage()
+	s.requestEviction()
 
 	return nil
 }
 
-func (s *ProxyService) checkAndEvictIfNeeded() {
-	images, err := s.GetCachedImages()
-	if err != nil {
-		s.log.WithError(err).Warn("Failed to get cached images for eviction check")
-		return
-	}
+// StartEviction enforces the cache limits in the background until ctx is done: evictionDelay
+// after images are cached, so a burst of pulls costs a single pass, and every
+// evictionInterval, so age-based policies expire images without new pulls.
+func (s *ProxyService) StartEviction(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(evictionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.evictRequests:
+				select {
+				case <-time.After(evictionDelay):
+				case <-ctx.Done():
+					return
+				}
+			}
+			s.EnforceCacheLimits()
+		}
+	}()
+}
 
-	var totalSize int64
-	for _, img := range images {
-		totalSize += img.Size
+// requestEviction asks the background eviction for a pass; requests made while one is
+// pending are merged
+func (s *ProxyService) requestEviction() {
+	select {
+	case s.evictRequests <- struct{}{}:
+	default:
 	}
+}
 
+// EnforceCacheLimits runs the configured eviction policy: images past the policy's
+// max age go first, then per-registry quotas are enforced, so a burst from one registry
+// only displaces its own images, then the global cache size. Sizes are deduplicated blob
+// bytes; evicting an image deletes the blobs no other manifest references. Pinned images
+// are never evicted.
+func (s *ProxyService) EnforceCacheLimits() {
+	s.evictMu.Lock()
+	defer s.evictMu.Unlock()
+	defer s.invalidateCacheUsage()
+
+	// Cheap guard: the cache never holds more than the bytes stored under blobs/.
+	// Age-based policies must look at every image regardless of size.
 	maxSize := int64(s.config.Proxy.Cache.MaxSizeGB) * 1024 * 1024 * 1024
-	if totalSize > maxSize {
-		s.log.WithFields(logrus.Fields{
-			"totalSize": totalSize,
-			"maxSize":   maxSize,
-		}).Info("Cache over limit, triggering eviction")
-
-		sort.Slice(images, func(i, j int) bool {
-			return images[i].LastAccessed.Before(images[j].LastAccessed)
-		})
-
-		targetSize := maxSize * 90 / 100
-		for _, img := range images {
-			if totalSize <= targetSize {
-				break
+	if s.eviction.MaxAge() == 0 {
+		limit := maxSize
+		for registry := range s.config.Proxy.Cache.RegistryMaxSizeGB {
+			if quota := s.registryQuota(registry); quota > 0 && quota < limit {
+				limit = quota
 			}
-
-			s.log.WithFields(logrus.Fields{
-				"image": img.Name,
-				"tag":   img.Tag,
-				"size":  img.Size,
-			}).Info("Evicting cached image (LRU)")
-
-			if err := s.deleteCachedImageFiles(img.Name, img.Tag); err != nil {
-				s.log.WithError(err).Warn("Failed to delete cached image files during eviction")
-			}
-
-			metadataPath := s.pathManager.GetCachedImageMetadataPath(img.Name, img.Tag)
-			s.backend.Delete(metadataPath)
-
-			totalSize -= img.Size
+		}
+		if stored, err := s.storedBlobBytes(); err == nil && stored <= limit {
+			return
 		}
 	}
-}
-
-// EvictLRU removes least recently used images until target size is reached
-func (s *ProxyService) EvictLRU(targetBytes int64) error {
-	s.cacheMutex.Lock()
-	defer s.cacheMutex.Unlock()
-
-	return s.evictLRUInternal(targetBytes)
-}
 
-func (s *ProxyService) evictLRUInternal(targetBytes int64) error {
-	if s.cacheState.TotalSize <= targetBytes {
-		return nil
+	images, err := s.GetCachedImages()
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to get cached images for eviction check")
+		return
 	}
 
-	sort.Slice(s.cacheState.Images, func(i, j int) bool {
-		return s.cacheState.Images[i].LastAccessed.Before(s.cacheState.Images[j].LastAccessed)
-	})
-
-	for s.cacheState.TotalSize > targetBytes && len(s.cacheState.Images) > 0 {
-		oldest := s.cacheState.Images[0]
+	idx, err := s.buildCacheBlobIndex(images)
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to index blobs for eviction check")
+		return
+	}
 
+	result := s.runEviction(idx, s.eviction, maxSize, maxSize*90/100, true)
+	if len(result.Evicted) > 0 {
 		s.log.WithFields(logrus.Fields{
-			"image":        oldest.Name,
-			"tag":          oldest.Tag,
-			"lastAccessed": oldest.LastAccessed,
-			"size":         oldest.Size,
-		}).Info("Evicting cached image (LRU)")
-
-		if err := s.deleteCachedImageFiles(oldest.Name, oldest.Tag); err != nil {
-			s.log.WithError(err).Warn("Failed to delete cached image files")
-		}
-
-		s.cacheState.TotalSize -= oldest.Size
-		s.cacheState.Images = s.cacheState.Images[1:]
-		s.cacheState.ItemCount--
+			"policy":     result.Policy,
+			"evicted":    len(result.Evicted),
+			"freedBytes": result.FreedBytes,
+			"cacheSize":  result.SizeAfter,
+		}).Info("Cache eviction completed")
 	}
-
-	return s.saveCacheState()
 }
 
 // DeleteCachedImage removes a specific cached image
 func (s *ProxyService) DeleteCachedImage(name, tag string) error {
-	metadataPath := s.pathManager.GetCachedImageMetadataPath(name, tag)
-	if err := s.backend.Delete(metadataPath); err != nil {
-		s.log.WithError(err).WithField("path", metadataPath).Warn("Failed to delete cache metadata file")
-	}
-
 	s.deleteCachedImageFiles(name, tag)
+	s.invalidateCacheUsage()
 
 	s.log.WithField("name", name).WithField("tag", tag).Info("Cached image deleted")
 	return nil
@@ -523,6 +1004,10 @@ func (s *ProxyService) DeleteCachedImage(name, tag string) error {
 
 // deleteCachedImageFiles removes the files for a cached image
 func (s *ProxyService) deleteCachedImageFiles(name, tag string) error {
+	if s.isCachedChart(name, tag) {
+		defer s.chartsChanged()
+	}
+
 	// Delete cache metadata
 	metadataPath := s.pathManager.GetCachedImageMetadataPath(name, tag)
 	if err := s.backend.Delete(metadataPath); err != nil {
@@ -574,10 +1059,12 @@ func (s *ProxyService) PurgeAllCache() error {
 	s.cacheState.Images = []models.CachedImageMetadata{}
 	s.cacheState.TotalSize = 0
 	s.cacheState.ItemCount = 0
+	s.invalidateCacheUsage()
 
 	// Delete legacy state.json
 	statePath := s.pathManager.GetCacheStatePath()
 	s.backend.Delete(statePath)
+	s.chartsChanged()
 
 	s.log.Info("Cache purged successfully")
 	return nil
@@ -0,0 +1,190 @@
+// pkg/services/proxy_listing.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxListingPages bounds how many Link pages are followed for a single listing
+	maxListingPages = 100
+	// maxListingPageBytes bounds the size of a single tags/list or _catalog page
+	maxListingPageBytes = 10 * 1024 * 1024
+)
+
+// linkNextRe extracts the target of a rel="next" entry from a Link header
+var linkNextRe = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// cachedListing is an upstream tags/list or _catalog result kept for a short time
+type cachedListing struct {
+	entries []string
+	expires time.Time
+}
+
+// ListUpstreamTags returns all tags of a repository on the upstream registry,
+// following Link pagination. Results are cached for proxy.cache.tagsTTLSeconds.
+func (s *ProxyService) ListUpstreamTags(ctx context.Context, registryURL, name string) ([]string, error) {
+	cacheKey := registryURL + "/" + name + "/tags"
+	if tags, ok := s.getCachedListing(cacheKey); ok {
+		return tags, nil
+	}
+
+	var tags []string
+	err := s.fetchPaginated(ctx, registryURL, name, fmt.Sprintf("/v2/%s/tags/list", name), func(body []byte) error {
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return fmt.Errorf("invalid tags list: %w", err)
+		}
+		tags = append(tags, page.Tags...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(tags)
+	s.setCachedListing(cacheKey, tags)
+	return tags, nil
+}
+
+// ListUpstreamCatalog returns the repositories of the upstream registry's _catalog,
+// following Link pagination. Many public registries (Docker Hub, GHCR) do not implement it.
+// Repositories denied by the proxy policy are left out.
+func (s *ProxyService) ListUpstreamCatalog(ctx context.Context, registryURL string) ([]string, error) {
+	cacheKey := registryURL + "/_catalog"
+	if repos, ok := s.getCachedListing(cacheKey); ok {
+		return repos, nil
+	}
+
+	var repos []string
+	err := s.fetchPaginated(ctx, registryURL, "", "/v2/_catalog", func(body []byte) error {
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return fmt.Errorf("invalid catalog: %w", err)
+		}
+		for _, repo := range page.Repositories {
+			if s.checkPolicy(registryURL, repo, "") == nil {
+				repos = append(repos, repo)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(repos)
+	s.setCachedListing(cacheKey, repos)
+	return repos, nil
+}
+
+// fetchPaginated GETs a listing path on the upstream registry and follows Link rel="next"
+// pages, handing each page body to collect. Next pages are rebuilt from the link's query
+// on top of path, so mirror endpoints with a repository prefix keep working.
+func (s *ProxyService) fetchPaginated(ctx context.Context, registryURL, name, path string, collect func([]byte) error) error {
+	next := path
+	for page := 0; next != ""; page++ {
+		if page >= maxListingPages {
+			s.log.WithFields(logrus.Fields{
+				"registry": registryURL,
+				"path":     path,
+			}).Warn("Upstream listing has too many pages, truncating")
+			return nil
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", registryURL+next, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		resp, err := s.FetchWithAuth(ctx, req, registryURL, name)
+		if err != nil {
+			return fmt.Errorf("failed to fetch listing: %w", err)
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxListingPageBytes))
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read listing: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %s", ErrUpstreamNotFound, path)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("upstream returned status %d: %s", resp.StatusCode, string(body))
+		}
+
+		if err := collect(body); err != nil {
+			return err
+		}
+		next = nextPagePath(resp.Header.Get("Link"), path)
+	}
+	return nil
+}
+
+// nextPagePath returns path with the query of the Link header's rel="next" target,
+// or "" when there is no next page.
+func nextPagePath(linkHeader, path string) string {
+	match := linkNextRe.FindStringSubmatch(linkHeader)
+	if match == nil {
+		return ""
+	}
+	target, err := neturl.Parse(match[1])
+	if err != nil || target.RawQuery == "" {
+		return ""
+	}
+	return strings.SplitN(path, "?", 2)[0] + "?" + target.RawQuery
+}
+
+// getCachedListing returns a non-expired cached listing
+func (s *ProxyService) getCachedListing(key string) ([]string, bool) {
+	s.listingMu.Lock()
+	defer s.listingMu.Unlock()
+
+	cached, ok := s.listingCache[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(cached.expires) {
+		delete(s.listingCache, key)
+		return nil, false
+	}
+	return cached.entries, true
+}
+
+// setCachedListing stores a listing for the configured TTL
+func (s *ProxyService) setCachedListing(key string, entries []string) {
+	ttl := time.Duration(s.config.Proxy.Cache.TagsTTLSeconds) * time.Second
+	if ttl <= 0 {
+		return
+	}
+
+	s.listingMu.Lock()
+	defer s.listingMu.Unlock()
+
+	now := time.Now()
+	if len(s.listingCache) >= 1000 {
+		for k, cached := range s.listingCache {
+			if now.After(cached.expires) {
+				delete(s.listingCache, k)
+			}
+		}
+	}
+	s.listingCache[key] = cachedListing{entries: entries, expires: now.Add(ttl)}
+}
@@ -0,0 +1,195 @@
+// pkg/services/proxy_policy.go
+package service
+
+import (
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strings"
+
+	"oci-storage/config"
+)
+
+// ErrPolicyDenied is returned when the proxy policy forbids fetching an image from upstream.
+// The concrete error is a *PolicyDeniedError naming the rule that matched.
+var ErrPolicyDenied = errors.New("denied by proxy policy")
+
+// PolicyDeniedError reports which policy rule denied an upstream fetch
+type PolicyDeniedError struct {
+	Registry   string
+	Repository string
+	Reference  string
+	Rule       string
+}
+
+func (e *PolicyDeniedError) Error() string {
+	image := e.Registry + "/" + e.Repository
+	if e.Reference != "" {
+		image += ":" + e.Reference
+	}
+	return fmt.Sprintf("%s: %s (rule: %s)", ErrPolicyDenied, image, e.Rule)
+}
+
+func (e *PolicyDeniedError) Unwrap() error {
+	return ErrPolicyDenied
+}
+
+// policyRule is a compiled ProxyPolicyRule; nil patterns match anything
+type policyRule struct {
+	desc       string
+	registry   *regexp.Regexp
+	repository *regexp.Regexp
+	tag        *regexp.Regexp
+}
+
+// proxyPolicy holds the compiled allow and deny rules
+type proxyPolicy struct {
+	allow []policyRule
+	deny  []policyRule
+}
+
+// newProxyPolicy compiles the configured policy rules
+func newProxyPolicy(cfg config.ProxyPolicyConfig) (*proxyPolicy, error) {
+	policy := &proxyPolicy{}
+	var err error
+	if policy.allow, err = compilePolicyRules("allow", cfg.Allow); err != nil {
+		return nil, err
+	}
+	if policy.deny, err = compilePolicyRules("deny", cfg.Deny); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func compilePolicyRules(kind string, rules []config.ProxyPolicyRule) ([]policyRule, error) {
+	compiled := make([]policyRule, 0, len(rules))
+	for i, rule := range rules {
+		c := policyRule{desc: describePolicyRule(kind, i, rule)}
+		var err error
+		if c.registry, err = compilePolicyPattern(rule.Registry); err != nil {
+			return nil, fmt.Errorf("%s: invalid registry pattern: %w", c.desc, err)
+		}
+		if c.repository, err = compilePolicyPattern(rule.Repository); err != nil {
+			return nil, fmt.Errorf("%s: invalid repository pattern: %w", c.desc, err)
+		}
+		if c.tag, err = compilePolicyPattern(rule.Tag); err != nil {
+			return nil, fmt.Errorf("%s: invalid tag pattern: %w", c.desc, err)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// describePolicyRule identifies a rule in errors, e.g. `deny[0] "no-latest"` or `deny[0] tag=latest`
+func describePolicyRule(kind string, index int, rule config.ProxyPolicyRule) string {
+	desc := fmt.Sprintf("%s[%d]", kind, index)
+	if rule.Name != "" {
+		return fmt.Sprintf("%s %q", desc, rule.Name)
+	}
+	for _, field := range []struct{ key, value string }{
+		{"registry", rule.Registry},
+		{"repository", rule.Repository},
+		{"tag", rule.Tag},
+	} {
+		if field.value != "" {
+			desc += " " + field.key + "=" + field.value
+		}
+	}
+	return desc
+}
+
+// compilePolicyPattern turns a glob or "regex:" pattern into an anchored regexp.
+// An empty pattern yields nil, which matches anything.
+func compilePolicyPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if expr, ok := strings.CutPrefix(pattern, "regex:"); ok {
+		return regexp.Compile("^(?:" + expr + ")$")
+	}
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return regexp.Compile("^" + expr + "$")
+}
+
+// matches reports whether the rule matches an image. Empty repository or reference
+// values (catalog listings, blobs, pulls by digest) are unknown: allow rules treat
+// them as matching so the rest of a pull is not blocked, deny rules as not matching.
+func (r policyRule) matches(registry, repository, tag string, allow bool) bool {
+	fieldMatches := func(re *regexp.Regexp, value string) bool {
+		if re == nil {
+			return true
+		}
+		if value == "" {
+			return allow
+		}
+		return re.MatchString(value)
+	}
+	return fieldMatches(r.registry, registry) &&
+		fieldMatches(r.repository, repository) &&
+		fieldMatches(r.tag, tag)
+}
+
+// evaluate returns the description of the rule denying the image, or "" when it is allowed
+func (p *proxyPolicy) evaluate(registry, repository, tag string) string {
+	for _, rule := range p.deny {
+		if rule.matches(registry, repository, tag, false) {
+			return rule.desc
+		}
+	}
+	if len(p.allow) == 0 {
+		return ""
+	}
+	for _, rule := range p.allow {
+		if rule.matches(registry, repository, tag, true) {
+			return ""
+		}
+	}
+	return "no allow rule matched"
+}
+
+// checkPolicy evaluates the proxy policy for an upstream fetch. reference may be a tag,
+// a digest or empty; only tags are matched against tag patterns.
+func (s *ProxyService) checkPolicy(registryURL, name, reference string) error {
+	registry := s.registryName(registryURL)
+
+	var rule string
+	if s.policyErr != nil {
+		// Fail closed: a broken policy must not silently allow everything
+		rule = "invalid policy: " + s.policyErr.Error()
+	} else {
+		tag := reference
+		if strings.Contains(tag, ":") {
+			tag = ""
+		}
+		rule = s.policy.evaluate(registry, name, tag)
+	}
+	if rule == "" {
+		return nil
+	}
+
+	return &PolicyDeniedError{
+		Registry:   registry,
+		Repository: name,
+		Reference:  reference,
+		Rule:       rule,
+	}
+}
+
+// registryName returns the configured name of an upstream registry URL,
+// falling back to the URL host for unconfigured registries.
+func (s *ProxyService) registryName(registryURL string) string {
+	if regConfig := s.registryConfigForURL(registryURL); regConfig != nil {
+		return regConfig.Name
+	}
+	if registryURL == "https://registry-1.docker.io" {
+		// Built-in default registry (see GetDefaultRegistry)
+		return "docker.io"
+	}
+	if u, err := neturl.Parse(registryURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return registryURL
+}
@@ -0,0 +1,135 @@
+// pkg/services/ratelimit.go
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitState tracks the pull quota an upstream endpoint advertises through
+// RateLimit-Limit / RateLimit-Remaining / RateLimit-Reset headers (Docker Hub sends
+// "100;w=21600" style values) and 429 responses.
+type rateLimitState struct {
+	mu        sync.Mutex
+	known     bool
+	limit     int
+	remaining int
+	reset     time.Time // when the quota is expected back; zero when upstream does not say
+	updatedAt time.Time
+}
+
+// update records the quota headers of an upstream response.
+// backoff is used as the reset time after a 429 that carries no Retry-After/RateLimit-Reset.
+func (r *rateLimitState) update(resp *http.Response, backoff time.Duration) {
+	remaining, hasRemaining := parseRateLimitValue(resp.Header.Get("RateLimit-Remaining"))
+	limit, hasLimit := parseRateLimitValue(resp.Header.Get("RateLimit-Limit"))
+	reset := parseResetHeader(resp.Header.Get("RateLimit-Reset"))
+	throttled := resp.StatusCode == http.StatusTooManyRequests
+
+	if !hasRemaining && !throttled {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.known = true
+	r.updatedAt = now
+	if hasLimit {
+		r.limit = limit
+	}
+	if hasRemaining {
+		r.remaining = remaining
+	}
+	r.reset = reset
+
+	if throttled {
+		r.remaining = 0
+		if retryAfter := parseResetHeader(resp.Header.Get("Retry-After")); !retryAfter.IsZero() {
+			r.reset = retryAfter
+		}
+		if r.reset.IsZero() {
+			r.reset = now.Add(backoff)
+		}
+	}
+}
+
+// backoffRemaining returns how long requests to the endpoint should be held back
+// because the quota is exhausted (0 when requests may be sent).
+func (r *rateLimitState) backoffRemaining(backoff time.Duration) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.known || r.remaining > 0 {
+		return 0
+	}
+	until := r.reset
+	if until.IsZero() {
+		until = r.updatedAt.Add(backoff)
+	}
+	if wait := time.Until(until); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// isLow reports whether the remaining quota is at or below the watermark.
+// Stale readings are ignored once their reset time (or backoff) has passed.
+func (r *rateLimitState) isLow(watermark int, backoff time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.known || r.remaining > watermark {
+		return false
+	}
+	until := r.reset
+	if until.IsZero() {
+		until = r.updatedAt.Add(backoff)
+	}
+	return time.Now().Before(until)
+}
+
+// snapshot returns a consistent copy of the quota fields for status reporting
+func (r *rateLimitState) snapshot() (known bool, limit, remaining int, reset, updatedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.known, r.limit, r.remaining, r.reset, r.updatedAt
+}
+
+// parseRateLimitValue parses "76" or "76;w=21600" into 76
+func parseRateLimitValue(header string) (int, bool) {
+	if header == "" {
+		return 0, false
+	}
+	value := strings.TrimSpace(strings.SplitN(header, ";", 2)[0])
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseResetHeader parses a reset/Retry-After value given either as delta seconds,
+// a unix timestamp or an HTTP date. Returns the zero time when absent or invalid.
+func parseResetHeader(header string) time.Time {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return time.Time{}
+	}
+	if n, ok := parseRateLimitValue(header); ok {
+		// Values this large can only be absolute unix timestamps
+		if n > 1_000_000_000 {
+			return time.Unix(int64(n), 0)
+		}
+		return time.Now().Add(time.Duration(n) * time.Second)
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,581 @@
+// pkg/services/replication.go
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"oci-storage/config"
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/models"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrReplicationRuleNotFound is returned for a rule name missing from replication.rules
+var ErrReplicationRuleNotFound = errors.New("replication rule not found")
+
+const (
+	// replicationCheckInterval is how often the worker looks for due tasks
+	replicationCheckInterval = 5 * time.Second
+	// replicationMaxDelay caps the exponential retry delay
+	replicationMaxDelay = time.Hour
+	// replicationTaskTimeout bounds one replication attempt, and the lock held for it
+	replicationTaskTimeout = 30 * time.Minute
+)
+
+// replicationRule is a validated replication.rules entry
+type replicationRule struct {
+	config.ReplicationRule
+	repositories []*regexp.Regexp // empty: all repositories
+	tagPattern   *regexp.Regexp
+	client       *pushClient
+}
+
+// matches reports whether a push of repository:reference is covered by the rule.
+// Digest references are referrers (signatures, SBOMs) and are not filtered by tag.
+func (r *replicationRule) matches(repository, reference string, isChart bool) bool {
+	switch r.Charts {
+	case "exclude":
+		if isChart {
+			return false
+		}
+	case "only":
+		if !isChart {
+			return false
+		}
+	}
+	if r.tagPattern != nil && !strings.HasPrefix(reference, "sha256:") && !r.tagPattern.MatchString(reference) {
+		return false
+	}
+	if len(r.repositories) == 0 {
+		return true
+	}
+	for _, re := range r.repositories {
+		if re.MatchString(repository) {
+			return true
+		}
+	}
+	return false
+}
+
+// destinationRepository returns the repository name on the destination registry
+func (r *replicationRule) destinationRepository(repository string) string {
+	if ns := strings.Trim(r.Destination.Namespace, "/"); ns != "" {
+		return ns + "/" + repository
+	}
+	return repository
+}
+
+// ReplicationService copies pushed manifests and their blobs to downstream registries.
+// Pushes are queued in the storage backend, so pending copies survive restarts and are
+// shared by all replicas; failed copies are retried with exponential backoff.
+type ReplicationService struct {
+	config      *config.Config
+	log         *utils.Logger
+	pathManager *utils.PathManager
+	backend     storage.Backend
+	locker      coordination.LockManager
+
+	rules map[string]*replicationRule
+	// order keeps the configured rule order for status listings
+	order []string
+
+	wake     chan struct{}
+	statusMu sync.Mutex
+}
+
+// NewReplicationService validates replication.rules and creates the replication service
+func NewReplicationService(cfg *config.Config, log *utils.Logger, pm *utils.PathManager, backend storage.Backend, locker coordination.LockManager) (*ReplicationService, error) {
+	s := &ReplicationService{
+		config:      cfg,
+		log:         log,
+		pathManager: pm,
+		backend:     backend,
+		locker:      locker,
+		rules:       make(map[string]*replicationRule),
+		wake:        make(chan struct{}, 1),
+	}
+
+	for _, ruleCfg := range cfg.Replication.Rules {
+		rule, err := validateReplicationRule(ruleCfg)
+		if err != nil {
+			return nil, fmt.Errorf("replication rule %q: %w", ruleCfg.Name, err)
+		}
+		if s.rules[rule.Name] != nil {
+			return nil, fmt.Errorf("replication rule %q: duplicate name", rule.Name)
+		}
+		s.rules[rule.Name] = rule
+		s.order = append(s.order, rule.Name)
+	}
+	return s, nil
+}
+
+func validateReplicationRule(ruleCfg config.ReplicationRule) (*replicationRule, error) {
+	if !syncJobNameRe.MatchString(ruleCfg.Name) {
+		return nil, fmt.Errorf("invalid name (lowercase letters, digits, '.', '_' and '-')")
+	}
+	if !strings.HasPrefix(ruleCfg.Destination.URL, "http://") && !strings.HasPrefix(ruleCfg.Destination.URL, "https://") {
+		return nil, fmt.Errorf("destination url %q must start with http:// or https://", ruleCfg.Destination.URL)
+	}
+	switch ruleCfg.Charts {
+	case "include", "exclude", "only":
+	default:
+		return nil, fmt.Errorf("invalid charts %q (include, exclude or only)", ruleCfg.Charts)
+	}
+
+	rule := &replicationRule{ReplicationRule: ruleCfg}
+	for _, pattern := range ruleCfg.Repositories {
+		re, err := compilePolicyPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid repository pattern %q: %w", pattern, err)
+		}
+		if re != nil {
+			rule.repositories = append(rule.repositories, re)
+		}
+	}
+
+	var err error
+	if ruleCfg.TagPattern != "" {
+		if rule.tagPattern, err = regexp.Compile(ruleCfg.TagPattern); err != nil {
+			return nil, fmt.Errorf("invalid tagPattern: %w", err)
+		}
+	}
+	if rule.client, err = newPushClient(ruleCfg.Destination); err != nil {
+		return nil, fmt.Errorf("invalid destination: %w", err)
+	}
+	return rule, nil
+}
+
+// Start processes due replication tasks until ctx is done
+func (s *ReplicationService) Start(ctx context.Context) {
+	s.log.WithField("rules", len(s.rules)).Info("Push replication worker started")
+
+	go func() {
+		ticker := time.NewTicker(replicationCheckInterval)
+		defer ticker.Stop()
+		for {
+			s.processDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+// notify wakes the worker without blocking
+func (s *ReplicationService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Enqueue queues a successful push for every matching rule. Tags are replicated with the
+// manifests and blobs they reference; a push by digest is only replicated when it is a
+// referrer (has a subject), since platform manifests are copied with their index.
+func (s *ReplicationService) Enqueue(repository, reference, digest string) {
+	if len(s.rules) == 0 || strings.HasPrefix(repository, "proxy/") {
+		return
+	}
+	if s.enqueue(s.order, repository, reference, digest) > 0 {
+		s.notify()
+	}
+}
+
+// enqueue writes a task for each of the named rules matching the push and returns how many were queued
+func (s *ReplicationService) enqueue(ruleNames []string, repository, reference, digest string) int {
+	data, err := s.backend.Read(s.pathManager.GetBlobPath(digest))
+	if err != nil {
+		s.log.WithError(err).WithField("digest", digest).Warn("Replication skipped: manifest not found")
+		return 0
+	}
+	var manifest struct {
+		models.OCIManifest
+		Subject *models.OCIDescriptor `json:"subject,omitempty"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return 0
+	}
+	if strings.HasPrefix(reference, "sha256:") && manifest.Subject == nil {
+		return 0
+	}
+	isChart := models.DetectArtifactType(&manifest.OCIManifest) == models.ArtifactTypeHelmChart
+
+	queued := 0
+	now := time.Now()
+	for _, name := range ruleNames {
+		rule := s.rules[name]
+		if !rule.matches(repository, reference, isChart) {
+			continue
+		}
+		// One task per rule and reference: a re-push replaces the pending task and resets its retries
+		task := models.ReplicationTask{
+			ID:          replicationTaskID(repository, reference),
+			Rule:        rule.Name,
+			Repository:  repository,
+			Reference:   reference,
+			Digest:      digest,
+			NextAttempt: now,
+			CreatedAt:   now,
+		}
+		if err := s.saveTask(replicationQueuePath(rule.Name, task.ID), &task); err != nil {
+			s.log.WithError(err).WithField("rule", rule.Name).Error("Failed to queue replication")
+			continue
+		}
+		queued++
+	}
+	return queued
+}
+
+// ReplicateNow queues every local tag matching a rule, makes pending retries due now and
+// requeues tasks that exhausted their attempts. Returns the number of queued tasks.
+func (s *ReplicationService) ReplicateNow(name string) (int, error) {
+	rule := s.rules[name]
+	if rule == nil {
+		return 0, fmt.Errorf("%w: %s", ErrReplicationRuleNotFound, name)
+	}
+
+	queued := 0
+	seen := make(map[string]bool)
+	for _, root := range []string{"images", "manifests"} {
+		s.walkLocalManifests(root, func(repository, reference string, data []byte) {
+			id := replicationTaskID(repository, reference)
+			if seen[id] || strings.HasPrefix(repository, "proxy/") {
+				return
+			}
+			seen[id] = true
+			queued += s.enqueue([]string{name}, repository, reference, fmt.Sprintf("sha256:%x", sha256.Sum256(data)))
+		})
+	}
+
+	// Failed tasks not covered by a local tag anymore (e.g. referrers) are retried as they are
+	entries, _ := s.backend.List(replicationFailedPath(name, ""))
+	for _, entry := range entries {
+		failedPath := replicationFailedPath(name, strings.TrimSuffix(entry.Name, ".json"))
+		task, err := s.loadTask(failedPath)
+		if err == nil && !seen[task.ID] {
+			task.Attempts = 0
+			task.NextAttempt = time.Now()
+			if err := s.saveTask(replicationQueuePath(name, task.ID), task); err == nil {
+				queued++
+			}
+		}
+		s.backend.Delete(failedPath)
+	}
+
+	s.log.WithFields(logrus.Fields{"rule": name, "queued": queued}).Info("Replication of all matching tags requested")
+	s.notify()
+	return queued, nil
+}
+
+// walkLocalManifests calls fn for every manifest stored under root. Image manifests live in
+// images/<repository>/manifests/<ref>.json, OCI Helm charts in manifests/<repository>/<ref>.json.
+func (s *ReplicationService) walkLocalManifests(root string, fn func(repository, reference string, data []byte)) {
+	s.backend.Walk(root, func(fullPath string, entry storage.FileInfo) error {
+		if !strings.HasSuffix(entry.Name, ".json") {
+			return nil
+		}
+
+		repoDir := filepath.Dir(fullPath)
+		if root == "images" {
+			if filepath.Base(repoDir) != "manifests" {
+				return nil
+			}
+			repoDir = filepath.Dir(repoDir)
+		}
+		repository, err := filepath.Rel(root, repoDir)
+		if err != nil || repository == "." {
+			return nil
+		}
+		reference := strings.TrimSuffix(entry.Name, ".json")
+		if digest, ok := strings.CutPrefix(reference, "sha256_"); ok {
+			reference = "sha256:" + digest
+		}
+
+		data, err := s.backend.Read(fullPath)
+		if err != nil {
+			return nil
+		}
+		fn(repository, reference, data)
+		return nil
+	})
+}
+
+// GetStatus returns the configuration, queue sizes and outcomes of every rule
+func (s *ReplicationService) GetStatus() []models.ReplicationRuleStatus {
+	statuses := make([]models.ReplicationRuleStatus, 0, len(s.order))
+	for _, name := range s.order {
+		rule := s.rules[name]
+		status := s.loadStatus(rule)
+		if entries, err := s.backend.List(replicationQueuePath(name, "")); err == nil {
+			status.Pending = len(entries)
+		}
+		if entries, err := s.backend.List(replicationFailedPath(name, "")); err == nil {
+			status.Failed = len(entries)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// processDue runs every task whose next attempt is due
+func (s *ReplicationService) processDue(ctx context.Context) {
+	for _, name := range s.order {
+		entries, err := s.backend.List(replicationQueuePath(name, ""))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return
+			}
+			s.processTask(ctx, s.rules[name], strings.TrimSuffix(entry.Name, ".json"))
+		}
+	}
+}
+
+// processTask replicates one task. Only one replica works on a task at a time.
+func (s *ReplicationService) processTask(ctx context.Context, rule *replicationRule, id string) {
+	taskPath := replicationQueuePath(rule.Name, id)
+	task, err := s.loadTask(taskPath)
+	if err != nil || task.NextAttempt.After(time.Now()) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, replicationTaskTimeout)
+	defer cancel()
+	unlock, err := s.locker.Acquire(ctx, "replication:"+rule.Name+":"+id, replicationTaskTimeout)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	// Another replica may have completed or rescheduled the task before the lock was taken
+	if task, err = s.loadTask(taskPath); err != nil || task.NextAttempt.After(time.Now()) {
+		return
+	}
+
+	logger := s.log.WithFields(logrus.Fields{
+		"rule":        rule.Name,
+		"repository":  task.Repository,
+		"reference":   task.Reference,
+		"destination": rule.Destination.URL,
+	})
+
+	destRepo := rule.destinationRepository(task.Repository)
+	replicateErr := s.replicateManifest(ctx, rule, destRepo, task.Digest, task.Reference)
+
+	// A push during the attempt replaced the task: leave the new one queued
+	if current, err := s.loadTask(taskPath); err != nil || current.Digest != task.Digest || !current.CreatedAt.Equal(task.CreatedAt) {
+		return
+	}
+
+	event := models.ReplicationEvent{
+		Repository: task.Repository,
+		Reference:  task.Reference,
+		Digest:     task.Digest,
+		At:         time.Now(),
+	}
+	if replicateErr == nil {
+		s.backend.Delete(taskPath)
+		s.recordOutcome(rule, event)
+		logger.Info("Replicated to destination registry")
+		return
+	}
+
+	event.Error = replicateErr.Error()
+	s.recordOutcome(rule, event)
+
+	task.Attempts++
+	task.LastError = replicateErr.Error()
+	if task.Attempts >= s.config.Replication.MaxAttempts {
+		if err := s.saveTask(replicationFailedPath(rule.Name, id), task); err == nil {
+			s.backend.Delete(taskPath)
+		}
+		logger.WithError(replicateErr).WithField("attempts", task.Attempts).Error("Replication failed, giving up")
+		return
+	}
+
+	delay := time.Duration(s.config.Replication.RetryBaseSeconds) * time.Second << (task.Attempts - 1)
+	if delay > replicationMaxDelay || delay <= 0 {
+		delay = replicationMaxDelay
+	}
+	task.NextAttempt = time.Now().Add(delay)
+	if err := s.saveTask(taskPath, task); err != nil {
+		logger.WithError(err).Warn("Failed to reschedule replication")
+	}
+	logger.WithError(replicateErr).WithFields(logrus.Fields{
+		"attempts": task.Attempts,
+		"retryIn":  delay.String(),
+	}).Warn("Replication failed, will retry")
+}
+
+// replicateManifest copies a manifest and everything it references, children and blobs first,
+// so the destination never holds a manifest pointing at missing content.
+func (s *ReplicationService) replicateManifest(ctx context.Context, rule *replicationRule, destRepo, digest, reference string) error {
+	data, err := s.backend.Read(s.pathManager.GetBlobPath(digest))
+	if err != nil {
+		return fmt.Errorf("manifest %s not found locally: %w", digest, err)
+	}
+
+	var manifest struct {
+		MediaType string                 `json:"mediaType"`
+		Config    models.OCIDescriptor   `json:"config"`
+		Layers    []models.OCIDescriptor `json:"layers"`
+		Manifests []models.OCIDescriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid manifest %s: %w", digest, err)
+	}
+
+	mediaType := manifest.MediaType
+	for _, child := range manifest.Manifests {
+		if err := s.replicateManifest(ctx, rule, destRepo, child.Digest, child.Digest); err != nil {
+			return err
+		}
+	}
+	if len(manifest.Manifests) > 0 && mediaType == "" {
+		mediaType = models.MediaTypeOCIManifestList
+	}
+
+	descriptors := manifest.Layers
+	if manifest.Config.Digest != "" {
+		descriptors = append([]models.OCIDescriptor{manifest.Config}, descriptors...)
+	}
+	for _, desc := range descriptors {
+		if err := s.replicateBlob(ctx, rule, destRepo, desc.Digest); err != nil {
+			return fmt.Errorf("blob %s: %w", desc.Digest, err)
+		}
+	}
+
+	if mediaType == "" {
+		mediaType = models.MediaTypeOCIManifest
+	}
+	return rule.client.pushManifest(ctx, destRepo, reference, mediaType, data)
+}
+
+// replicateBlob uploads a blob unless the destination already has it
+func (s *ReplicationService) replicateBlob(ctx context.Context, rule *replicationRule, destRepo, digest string) error {
+	exists, err := rule.client.hasBlob(ctx, destRepo, digest)
+	if err != nil || exists {
+		return err
+	}
+
+	blobPath := s.pathManager.GetBlobPath(digest)
+	info, err := s.backend.Stat(blobPath)
+	if err != nil {
+		return fmt.Errorf("not found locally: %w", err)
+	}
+	return rule.client.pushBlob(ctx, destRepo, digest, info.Size, func() (io.ReadCloser, error) {
+		return s.backend.ReadStream(blobPath)
+	})
+}
+
+// loadStatus reads the persisted outcomes of a rule, shared by all replicas
+func (s *ReplicationService) loadStatus(rule *replicationRule) models.ReplicationRuleStatus {
+	status := models.ReplicationRuleStatus{
+		Name:         rule.Name,
+		Destination:  rule.Destination.URL,
+		Repositories: rule.Repositories,
+		TagPattern:   rule.TagPattern,
+		Charts:       rule.Charts,
+	}
+
+	data, err := s.backend.Read(replicationStatusPath(rule.Name))
+	if err != nil {
+		return status
+	}
+	var stored models.ReplicationRuleStatus
+	if err := json.Unmarshal(data, &stored); err != nil {
+		s.log.WithError(err).WithField("rule", rule.Name).Warn("Failed to parse replication status")
+		return status
+	}
+	status.Replicated = stored.Replicated
+	status.Errors = stored.Errors
+	status.LastSuccess = stored.LastSuccess
+	status.LastFailure = stored.LastFailure
+	return status
+}
+
+// recordOutcome adds an attempt to the persisted status of a rule
+func (s *ReplicationService) recordOutcome(rule *replicationRule, event models.ReplicationEvent) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	status := s.loadStatus(rule)
+	if event.Error == "" {
+		status.Replicated++
+		status.LastSuccess = &event
+	} else {
+		status.Errors++
+		status.LastFailure = &event
+	}
+
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := s.backend.Write(replicationStatusPath(rule.Name), data); err != nil {
+		s.log.WithError(err).WithField("rule", rule.Name).Warn("Failed to save replication status")
+	}
+}
+
+func (s *ReplicationService) loadTask(path string) (*models.ReplicationTask, error) {
+	data, err := s.backend.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	var task models.ReplicationTask
+	if err := json.Unmarshal(data, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (s *ReplicationService) saveTask(path string, task *models.ReplicationTask) error {
+	data, err := json.MarshalIndent(task, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.backend.Write(path, data)
+}
+
+// replicationTaskID identifies the task of a repository reference within a rule
+func replicationTaskID(repository, reference string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(repository+":"+reference)))[:32]
+}
+
+// replicationQueuePath returns the path of a pending task, or of the rule's queue when id is empty
+func replicationQueuePath(rule, id string) string {
+	if id == "" {
+		return filepath.Join("replication", "queue", rule)
+	}
+	return filepath.Join("replication", "queue", rule, id+".json")
+}
+
+// replicationFailedPath returns the path of a task that exhausted its attempts, or of the rule's failed queue
+func replicationFailedPath(rule, id string) string {
+	if id == "" {
+		return filepath.Join("replication", "failed", rule)
+	}
+	return filepath.Join("replication", "failed", rule, id+".json")
+}
+
+func replicationStatusPath(rule string) string {
+	return filepath.Join("replication", "status", rule+".json")
+}
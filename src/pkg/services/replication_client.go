@@ -0,0 +1,219 @@
+// pkg/services/replication_client.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"oci-storage/config"
+)
+
+// pushClient pushes blobs and manifests to a downstream registry (OCI distribution API)
+type pushClient struct {
+	endpoint config.RegistryEndpoint
+	client   *http.Client
+	tokens   *tokenCache
+}
+
+func newPushClient(dest config.ReplicationDestination) (*pushClient, error) {
+	ep := config.RegistryEndpoint{
+		URL:      strings.TrimSuffix(dest.URL, "/"),
+		Username: dest.Username,
+		Password: dest.Password,
+		TLS:      dest.TLS,
+	}
+	transport, err := newUpstreamTransport(ep)
+	if err != nil {
+		return nil, err
+	}
+	return &pushClient{
+		endpoint: ep,
+		client:   &http.Client{Transport: transport},
+		tokens:   newTokenCache(),
+	}, nil
+}
+
+// do sends a request built by newReq with cached auth. On a 401 it answers the challenge
+// with push scope and sends a fresh request once (bodies cannot be replayed).
+func (c *pushClient) do(ctx context.Context, repo string, newReq func() (*http.Request, error)) (*http.Response, error) {
+	req, err := newReq()
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := tokenCacheKey(c.endpoint.URL, fmt.Sprintf("repository:%s:pull,push", repo))
+	if auth, ok := c.tokens.get(cacheKey); ok {
+		auth.apply(req, c.endpoint)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+	c.tokens.invalidate(cacheKey)
+
+	auth, err := c.authorize(ctx, resp.Header.Get("Www-Authenticate"), repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate to %s: %w", c.endpoint.URL, err)
+	}
+	c.tokens.set(cacheKey, auth)
+
+	if req, err = newReq(); err != nil {
+		return nil, err
+	}
+	auth.apply(req, c.endpoint)
+	return c.client.Do(req)
+}
+
+func (c *pushClient) authorize(ctx context.Context, wwwAuth, repo string) (upstreamAuth, error) {
+	if c.endpoint.Username == "" || c.endpoint.Password == "" {
+		return upstreamAuth{}, fmt.Errorf("registry requires authentication but no credentials are configured")
+	}
+	if challengeScheme(wwwAuth) == authSchemeBasic {
+		return upstreamAuth{scheme: authSchemeBasic, expires: time.Now().Add(basicAuthTTL)}, nil
+	}
+
+	params := parseChallengeParams(wwwAuth)
+	if params["realm"] == "" {
+		return upstreamAuth{}, fmt.Errorf("unsupported auth challenge %q", wwwAuth)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull,push", repo)
+	}
+	tokenURL := fmt.Sprintf("%s?service=%s&scope=%s", params["realm"], neturl.QueryEscape(params["service"]), neturl.QueryEscape(scope))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL, nil)
+	if err != nil {
+		return upstreamAuth{}, err
+	}
+	req.SetBasicAuth(c.endpoint.Username, c.endpoint.Password)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return upstreamAuth{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return upstreamAuth{}, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return upstreamAuth{}, err
+	}
+	token := tokenResp.Token
+	if token == "" {
+		token = tokenResp.AccessToken
+	}
+	return upstreamAuth{scheme: authSchemeBearer, token: token, expires: time.Now().Add(tokenTTL(tokenResp.ExpiresIn))}, nil
+}
+
+// hasBlob reports whether the destination repository already holds a blob
+func (c *pushClient) hasBlob(ctx context.Context, repo, digest string) (bool, error) {
+	resp, err := c.do(ctx, repo, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodHead, fmt.Sprintf("%s/v2/%s/blobs/%s", c.endpoint.URL, repo, digest), nil)
+	})
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("HEAD blob %s returned status %d", digest, resp.StatusCode)
+}
+
+// pushBlob uploads a blob in a single PUT (monolithic upload). open is called for each attempt.
+func (c *pushClient) pushBlob(ctx context.Context, repo, digest string, size int64, open func() (io.ReadCloser, error)) error {
+	resp, err := c.do(ctx, repo, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/v2/%s/blobs/uploads/", c.endpoint.URL, repo), nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("starting blob upload returned status %d", resp.StatusCode)
+	}
+
+	location, err := c.resolve(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location: %w", err)
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = c.do(ctx, repo, func() (*http.Request, error) {
+		body, err := open()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, location.String(), body)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("blob upload %s returned status %d", digest, resp.StatusCode)
+	}
+	return nil
+}
+
+// pushManifest uploads a manifest under a tag or digest reference
+func (c *pushClient) pushManifest(ctx context.Context, repo, reference, mediaType string, data []byte) error {
+	resp, err := c.do(ctx, repo, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf("%s/v2/%s/manifests/%s", c.endpoint.URL, repo, reference), strings.NewReader(string(data)))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", mediaType)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("manifest upload %s returned status %d: %s", reference, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// resolve turns a Location header, possibly relative, into an absolute URL
+func (c *pushClient) resolve(location string) (*neturl.URL, error) {
+	if location == "" {
+		return nil, fmt.Errorf("missing Location header")
+	}
+	base, err := neturl.Parse(c.endpoint.URL + "/")
+	if err != nil {
+		return nil, err
+	}
+	ref, err := neturl.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	return base.ResolveReference(ref), nil
+}
@@ -0,0 +1,248 @@
+// pkg/services/storage_migration.go
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"oci-storage/pkg/models"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultMigrationWorkers is the number of objects copied in parallel
+	defaultMigrationWorkers = 8
+	// migrationProgressInterval is how many objects are processed between progress logs
+	migrationProgressInterval = 1000
+)
+
+// storageMigrationExcluded lists top-level directories holding state that only makes
+// sense on the original backend: local staging files and in-flight upload sessions
+var storageMigrationExcluded = map[string]bool{"temp": true, "uploads": true}
+
+// StorageMigrator copies every object from one storage backend to another. Objects
+// already in the target with the same content are skipped, so an interrupted
+// migration resumes where it stopped and a last run before switching backends only
+// copies what changed meanwhile.
+type StorageMigrator struct {
+	source      storage.Backend
+	target      storage.Backend
+	pathManager *utils.PathManager
+	workers     int
+	dryRun      bool
+	verify      bool
+	log         *utils.Logger
+
+	mu     sync.Mutex
+	report models.StorageMigrationReport
+}
+
+// NewStorageMigrator creates a migrator between two backends. Blobs already in the target
+// with the expected size are trusted, as they were verified when copied; verify re-hashes
+// them instead.
+func NewStorageMigrator(source, target storage.Backend, pm *utils.PathManager, workers int, dryRun, verify bool, log *utils.Logger) *StorageMigrator {
+	if workers <= 0 {
+		workers = defaultMigrationWorkers
+	}
+	return &StorageMigrator{
+		source:      source,
+		target:      target,
+		pathManager: pm,
+		workers:     workers,
+		dryRun:      dryRun,
+		verify:      verify,
+		log:         log,
+	}
+}
+
+// Run copies the objects, then compares both listings. The report is returned even
+// when the source cannot be fully listed.
+func (m *StorageMigrator) Run(ctx context.Context) (*models.StorageMigrationReport, error) {
+	start := time.Now()
+	m.report = models.StorageMigrationReport{DryRun: m.dryRun}
+	m.log.WithFields(logrus.Fields{
+		"workers": m.workers,
+		"dryRun":  m.dryRun,
+		"verify":  m.verify,
+	}).Info("Starting storage migration")
+
+	objects := make(chan storage.FileInfo, m.workers*4)
+	var wg sync.WaitGroup
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for object := range objects {
+				m.migrateObject(object.Name, object.Size)
+			}
+		}()
+	}
+
+	// FileInfo.Name carries the full path: workers need nothing else
+	listed := make(map[string]bool)
+	err := m.source.Walk("", func(path string, info storage.FileInfo) error {
+		if migrationExcluded(path) {
+			return nil
+		}
+		listed[filepath.ToSlash(path)] = true
+		select {
+		case objects <- storage.FileInfo{Name: path, Size: info.Size}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(objects)
+	wg.Wait()
+	if err != nil {
+		return m.finish(start), fmt.Errorf("failed to list source: %w", err)
+	}
+
+	// Objects only in the target are reported, never deleted
+	var extra []string
+	err = m.target.Walk("", func(path string, info storage.FileInfo) error {
+		if !migrationExcluded(path) && !listed[filepath.ToSlash(path)] {
+			extra = append(extra, filepath.ToSlash(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return m.finish(start), fmt.Errorf("failed to list target: %w", err)
+	}
+
+	m.report.Extra = extra
+	m.report.Consistent = !m.dryRun && m.report.Failed == 0
+	report := m.finish(start)
+	m.log.WithFields(logrus.Fields{
+		"objects":     report.Objects,
+		"copied":      report.Copied,
+		"skipped":     report.Skipped,
+		"failed":      report.Failed,
+		"bytesCopied": report.BytesCopied,
+		"extra":       len(report.Extra),
+		"durationMs":  report.DurationMs,
+	}).Info("Storage migration finished")
+	return report, nil
+}
+
+func (m *StorageMigrator) finish(start time.Time) *models.StorageMigrationReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.report.DurationMs = time.Since(start).Milliseconds()
+	report := m.report
+	return &report
+}
+
+// migrateObject copies one object unless the target already has it
+func (m *StorageMigrator) migrateObject(path string, size int64) {
+	// Blobs are verified against their digest, other objects against the source content
+	digest := m.pathManager.BlobDigestFromPath(path)
+	if digest == "" || utils.NewDigestHash(digest) == nil {
+		digest = ""
+	}
+
+	if m.inTarget(path, size, digest) {
+		m.record(func(r *models.StorageMigrationReport) { r.Skipped++ })
+		return
+	}
+	if m.dryRun {
+		m.record(func(r *models.StorageMigrationReport) { r.Pending++ })
+		return
+	}
+
+	written, err := m.copyObject(path, size, digest)
+	if err != nil {
+		m.log.WithError(err).WithField("path", path).Warn("Failed to migrate object")
+		m.record(func(r *models.StorageMigrationReport) {
+			r.Failed++
+			r.Failures = append(r.Failures, models.StorageMigrationFailure{Path: filepath.ToSlash(path), Error: err.Error()})
+		})
+		return
+	}
+	m.record(func(r *models.StorageMigrationReport) {
+		r.Copied++
+		r.BytesCopied += written
+	})
+}
+
+// inTarget reports whether the target already holds the object with the same content
+func (m *StorageMigrator) inTarget(path string, size int64, digest string) bool {
+	info, err := m.target.Stat(path)
+	if err != nil || info.Size != size {
+		return false
+	}
+	if digest != "" {
+		// Stored under its digest, a blob never changes: only a copy cut short could differ
+		if !m.verify {
+			return true
+		}
+		actual, _, err := hashStored(m.target, path, digest)
+		return err == nil && actual == digest
+	}
+	// Metadata is rewritten in place (index.yaml, tags): compare the contents
+	targetSum, _, err := hashStored(m.target, path, "sha256:")
+	if err != nil {
+		return false
+	}
+	sourceSum, _, err := hashStored(m.source, path, "sha256:")
+	return err == nil && sourceSum == targetSum
+}
+
+// copyObject streams an object to the target, verifying blobs on the way
+func (m *StorageMigrator) copyObject(path string, size int64, digest string) (int64, error) {
+	reader, err := m.source.ReadStream(path)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var body io.Reader = reader
+	h := utils.NewDigestHash(digest)
+	if h != nil {
+		body = io.TeeReader(reader, h)
+	}
+	written, err := m.target.WriteStream(path, body)
+	if err != nil {
+		return written, err
+	}
+	if written != size {
+		return written, fmt.Errorf("copied %d bytes, expected %d", written, size)
+	}
+	if h != nil {
+		if actual := utils.DigestOf(digest, h); actual != digest {
+			// Never spread a corrupt blob: fsck can repair the source
+			_ = m.target.Delete(path)
+			return written, fmt.Errorf("source content hashes to %s", actual)
+		}
+	}
+	return written, nil
+}
+
+func (m *StorageMigrator) record(fn func(*models.StorageMigrationReport)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(&m.report)
+	m.report.Objects++
+	if m.report.Objects%migrationProgressInterval == 0 {
+		m.log.WithFields(logrus.Fields{
+			"objects": m.report.Objects,
+			"copied":  m.report.Copied,
+			"skipped": m.report.Skipped,
+			"failed":  m.report.Failed,
+		}).Info("Storage migration progress")
+	}
+}
+
+// migrationExcluded reports whether a path belongs to a directory that is not migrated
+func migrationExcluded(path string) bool {
+	top, _, _ := strings.Cut(filepath.ToSlash(path), "/")
+	return storageMigrationExcluded[top]
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"oci-storage/pkg/models"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageMigrator_CopiesVerifiesAndResumes(t *testing.T) {
+	sourceDir, targetDir := t.TempDir(), t.TempDir()
+	source, target := storage.NewLocalBackend(sourceDir), storage.NewLocalBackend(targetDir)
+	log := utils.NewLogger(utils.Config{})
+	pathManager := utils.NewPathManager(t.TempDir(), log)
+
+	layer := []byte("layer content")
+	layerPath := pathManager.GetBlobPath(fmt.Sprintf("sha256:%x", sha256.Sum256(layer)))
+	// A blob whose content does not hash to the digest it is stored under
+	corruptPath := pathManager.GetBlobPath(fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("original"))))
+	for path, data := range map[string][]byte{
+		layerPath:                      layer,
+		corruptPath:                    []byte("bit rot"),
+		"index.yaml":                   []byte("apiVersion: v1\n"),
+		"temp/staging":                 []byte("local staging file"),
+		"uploads/session-1/data":       []byte("in-flight upload"),
+		"images/app/manifests/v1.json": []byte(`{"schemaVersion":2}`),
+	} {
+		assert.NoError(t, source.Write(path, data))
+	}
+	// Left by an earlier backend: reported, never deleted
+	assert.NoError(t, target.Write("images/old/manifests/v0.json", []byte(`{}`)))
+	assert.NoError(t, target.Write("uploads/other/data", []byte("in-flight upload")))
+
+	run := func(verify bool) *models.StorageMigrationReport {
+		report, err := NewStorageMigrator(source, target, pathManager, 2, false, verify, log).Run(context.Background())
+		assert.NoError(t, err)
+		return report
+	}
+
+	report := run(false)
+	assert.Equal(t, 4, report.Objects)
+	assert.Equal(t, 3, report.Copied)
+	assert.Equal(t, 0, report.Skipped)
+	assert.Equal(t, 1, report.Failed)
+	if assert.Len(t, report.Failures, 1) {
+		assert.Equal(t, filepath.ToSlash(corruptPath), report.Failures[0].Path)
+		assert.Contains(t, report.Failures[0].Error, "hashes to")
+	}
+	assert.Equal(t, []string{"images/old/manifests/v0.json"}, report.Extra)
+	assert.False(t, report.Consistent)
+
+	// The corrupt blob is not spread, staging and upload sessions are not copied
+	for _, path := range []string{corruptPath, "temp/staging", "uploads/session-1/data"} {
+		exists, err := target.Exists(path)
+		assert.NoError(t, err)
+		assert.False(t, exists, path)
+	}
+	data, err := target.Read(layerPath)
+	assert.NoError(t, err)
+	assert.Equal(t, layer, data)
+
+	// Resumed: what was copied is skipped, metadata rewritten meanwhile is copied again
+	assert.NoError(t, source.Write("index.yaml", []byte("apiVersion: v2\n")))
+	report = run(false)
+	assert.Equal(t, 1, report.Copied)
+	assert.Equal(t, 2, report.Skipped)
+	assert.Equal(t, 1, report.Failed)
+	data, err = target.Read("index.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "apiVersion: v2\n", string(data))
+
+	// Blobs in the target are trusted by size unless verification is asked for
+	assert.NoError(t, os.WriteFile(filepath.Join(targetDir, layerPath), []byte("LAYER CONTENT"), 0644))
+	report = run(false)
+	assert.Equal(t, 0, report.Copied)
+	assert.Equal(t, 3, report.Skipped)
+	report = run(true)
+	assert.Equal(t, 1, report.Copied)
+	assert.Equal(t, 2, report.Skipped)
+	data, err = target.Read(layerPath)
+	assert.NoError(t, err)
+	assert.Equal(t, layer, data)
+
+	// Fixing the source makes the migration consistent
+	assert.NoError(t, source.Delete(corruptPath))
+	report = run(false)
+	assert.Equal(t, 0, report.Failed)
+	assert.True(t, report.Consistent)
+}
+
+func TestStorageMigrator_DryRunCopiesNothing(t *testing.T) {
+	source, target := storage.NewLocalBackend(t.TempDir()), storage.NewLocalBackend(t.TempDir())
+	log := utils.NewLogger(utils.Config{})
+	pathManager := utils.NewPathManager(t.TempDir(), log)
+	assert.NoError(t, source.Write("index.yaml", []byte("apiVersion: v1\n")))
+
+	report, err := NewStorageMigrator(source, target, pathManager, 1, true, false, log).Run(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Pending)
+	assert.Equal(t, 0, report.Copied)
+	assert.False(t, report.Consistent)
+	exists, _ := target.Exists("index.yaml")
+	assert.False(t, exists)
+}
@@ -0,0 +1,538 @@
+// pkg/services/sync.go
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"oci-storage/config"
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/interfaces"
+	"oci-storage/pkg/models"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrSyncJobNotFound is returned for a job name missing from sync.jobs
+	ErrSyncJobNotFound = errors.New("sync job not found")
+	// ErrSyncJobRunning is returned when a run is requested while the job is running
+	ErrSyncJobRunning = errors.New("sync job already running")
+)
+
+// syncCheckInterval is how often the scheduler looks for due jobs
+const syncCheckInterval = time.Minute
+
+// syncJobNameRe validates job names, which are used in API paths and storage keys
+var syncJobNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// syncJob is a validated sync.jobs entry
+type syncJob struct {
+	config.SyncJobConfig
+	registryURL  string // upstream registry of Source
+	upstreamName string // repository on the upstream registry
+	tagPattern   *regexp.Regexp
+	platforms    map[string]bool // nil: all platforms
+}
+
+// SyncService mirrors upstream repositories into local repositories on a schedule.
+// Mirrored images are regular local images: they are not tracked by the proxy cache,
+// so they are never evicted, and their blobs stay referenced for GC.
+type SyncService struct {
+	config       *config.Config
+	log          *utils.Logger
+	pathManager  *utils.PathManager
+	backend      storage.Backend
+	proxy        *ProxyService
+	imageService interfaces.ImageServiceInterface
+	locker       coordination.LockManager
+
+	jobs map[string]*syncJob
+	// order keeps the configured job order for status listings
+	order []string
+
+	mu      sync.Mutex
+	running map[string]*models.SyncRun // runs in progress on this replica
+}
+
+// NewSyncService validates sync.jobs and creates the sync service
+func NewSyncService(cfg *config.Config, log *utils.Logger, pm *utils.PathManager, backend storage.Backend, proxy *ProxyService, imageService interfaces.ImageServiceInterface, locker coordination.LockManager) (*SyncService, error) {
+	s := &SyncService{
+		config:       cfg,
+		log:          log,
+		pathManager:  pm,
+		backend:      backend,
+		proxy:        proxy,
+		imageService: imageService,
+		locker:       locker,
+		jobs:         make(map[string]*syncJob),
+		running:      make(map[string]*models.SyncRun),
+	}
+
+	for _, jobCfg := range cfg.Sync.Jobs {
+		job, err := s.validateJob(jobCfg)
+		if err != nil {
+			return nil, fmt.Errorf("sync job %q: %w", jobCfg.Name, err)
+		}
+		if s.jobs[job.Name] != nil {
+			return nil, fmt.Errorf("sync job %q: duplicate name", job.Name)
+		}
+		s.jobs[job.Name] = job
+		s.order = append(s.order, job.Name)
+	}
+	return s, nil
+}
+
+func (s *SyncService) validateJob(jobCfg config.SyncJobConfig) (*syncJob, error) {
+	if !syncJobNameRe.MatchString(jobCfg.Name) {
+		return nil, fmt.Errorf("invalid name (lowercase letters, digits, '.', '_' and '-')")
+	}
+	if strings.HasPrefix(jobCfg.Target, "proxy/") || jobCfg.Target == "" {
+		return nil, fmt.Errorf("target %q must be a local repository outside proxy/", jobCfg.Target)
+	}
+
+	job := &syncJob{SyncJobConfig: jobCfg}
+
+	registry, _, _ := strings.Cut(jobCfg.Source, "/")
+	if s.proxy.registryConfigForName(registry) == nil {
+		return nil, fmt.Errorf("source %q must start with a configured proxy registry name", jobCfg.Source)
+	}
+	var err error
+	job.registryURL, job.upstreamName, err = s.proxy.ResolveRegistry(jobCfg.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	if jobCfg.TagPattern != "" {
+		job.tagPattern, err = regexp.Compile(jobCfg.TagPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tagPattern: %w", err)
+		}
+	}
+	if len(jobCfg.Platforms) > 0 {
+		job.platforms = make(map[string]bool, len(jobCfg.Platforms))
+		for _, platform := range jobCfg.Platforms {
+			job.platforms[platform] = true
+		}
+	}
+	return job, nil
+}
+
+// Start runs due jobs every minute until ctx is done. A job is due when its last run,
+// on any replica, started more than intervalMinutes ago.
+func (s *SyncService) Start(ctx context.Context) {
+	s.log.WithField("jobs", len(s.jobs)).Info("Repository sync scheduler started")
+
+	go func() {
+		ticker := time.NewTicker(syncCheckInterval)
+		defer ticker.Stop()
+		for {
+			s.runDueJobs()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *SyncService) runDueJobs() {
+	now := time.Now()
+	for _, name := range s.order {
+		job := s.jobs[name]
+		if next := s.nextRun(job); next != nil && next.After(now) {
+			continue
+		}
+		if err := s.RunJob(name); err != nil && !errors.Is(err, ErrSyncJobRunning) {
+			s.log.WithError(err).WithField("job", name).Warn("Failed to start scheduled sync")
+		}
+	}
+}
+
+// RunJob starts a run of a job in the background
+func (s *SyncService) RunJob(name string) error {
+	job := s.jobs[name]
+	if job == nil {
+		return fmt.Errorf("%w: %s", ErrSyncJobNotFound, name)
+	}
+
+	s.mu.Lock()
+	if s.running[name] != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrSyncJobRunning, name)
+	}
+	run := &models.SyncRun{Status: models.SyncStatusRunning, StartedAt: time.Now()}
+	s.running[name] = run
+	s.mu.Unlock()
+
+	go s.run(job, run)
+	return nil
+}
+
+// GetStatus returns the status of every configured job
+func (s *SyncService) GetStatus() []models.SyncJobStatus {
+	statuses := make([]models.SyncJobStatus, 0, len(s.order))
+	for _, name := range s.order {
+		statuses = append(statuses, s.jobStatus(s.jobs[name]))
+	}
+	return statuses
+}
+
+// GetJobStatus returns the status of one job
+func (s *SyncService) GetJobStatus(name string) (*models.SyncJobStatus, error) {
+	job := s.jobs[name]
+	if job == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSyncJobNotFound, name)
+	}
+	status := s.jobStatus(job)
+	return &status, nil
+}
+
+func (s *SyncService) jobStatus(job *syncJob) models.SyncJobStatus {
+	status := s.loadStatus(job)
+
+	s.mu.Lock()
+	if run := s.running[job.Name]; run != nil {
+		snapshot := *run
+		snapshot.Failures = append([]models.SyncTagFailure(nil), run.Failures...)
+		status.LastRun = &snapshot
+	}
+	s.mu.Unlock()
+
+	// A run left "running" by a replica that died stops counting once its lock expired
+	interval := time.Duration(job.IntervalMinutes) * time.Minute
+	status.Running = status.LastRun != nil && status.LastRun.Status == models.SyncStatusRunning &&
+		time.Since(status.LastRun.StartedAt) < interval
+	status.NextRun = s.nextRun(job)
+	return status
+}
+
+// nextRun returns when a job is due, nil when it never ran
+func (s *SyncService) nextRun(job *syncJob) *time.Time {
+	status := s.loadStatus(job)
+	if status.LastRun == nil {
+		return nil
+	}
+	next := status.LastRun.StartedAt.Add(time.Duration(job.IntervalMinutes) * time.Minute)
+	return &next
+}
+
+// loadStatus reads the persisted status of a job, shared by all replicas
+func (s *SyncService) loadStatus(job *syncJob) models.SyncJobStatus {
+	status := models.SyncJobStatus{
+		Name:            job.Name,
+		Source:          job.Source,
+		Target:          job.Target,
+		TagPattern:      job.TagPattern,
+		Platforms:       job.Platforms,
+		IntervalMinutes: job.IntervalMinutes,
+	}
+
+	data, err := s.backend.Read(syncStatusPath(job.Name))
+	if err != nil {
+		return status
+	}
+	var stored models.SyncJobStatus
+	if err := json.Unmarshal(data, &stored); err != nil {
+		s.log.WithError(err).WithField("job", job.Name).Warn("Failed to parse sync status")
+		return status
+	}
+	status.LastRun = stored.LastRun
+	status.LastSuccess = stored.LastSuccess
+	return status
+}
+
+func (s *SyncService) saveStatus(job *syncJob, run *models.SyncRun) {
+	status := s.loadStatus(job)
+	status.LastRun = run
+	if run.Status == models.SyncStatusSucceeded {
+		status.LastSuccess = run.FinishedAt
+	}
+
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := s.backend.Write(syncStatusPath(job.Name), data); err != nil {
+		s.log.WithError(err).WithField("job", job.Name).Warn("Failed to save sync status")
+	}
+}
+
+func syncStatusPath(name string) string {
+	return filepath.Join("sync", "status", name+".json")
+}
+
+// update applies fn to a run under the service lock
+func (s *SyncService) update(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+// run mirrors every matching upstream tag of a job. Only one replica runs a job at a time.
+func (s *SyncService) run(job *syncJob, run *models.SyncRun) {
+	defer s.update(func() { delete(s.running, job.Name) })
+
+	interval := time.Duration(job.IntervalMinutes) * time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+
+	unlock, err := s.locker.Acquire(ctx, "sync:"+job.Name, interval)
+	if err != nil {
+		s.log.WithField("job", job.Name).Info("Sync job running on another replica, skipping")
+		return
+	}
+	defer unlock()
+
+	logger := s.log.WithFields(logrus.Fields{
+		"job":    job.Name,
+		"source": job.Source,
+		"target": job.Target,
+	})
+	logger.Info("Repository sync started")
+
+	s.saveStatus(job, run)
+	s.syncTags(ctx, job, run)
+
+	now := time.Now()
+	var final models.SyncRun
+	s.update(func() {
+		run.FinishedAt = &now
+		switch {
+		case run.Error != "":
+			run.Status = models.SyncStatusFailed
+		case run.TagsFailed > 0 && run.TagsFailed == run.TagsMatched:
+			run.Status = models.SyncStatusFailed
+		case run.TagsFailed > 0:
+			run.Status = models.SyncStatusPartial
+		default:
+			run.Status = models.SyncStatusSucceeded
+		}
+		final = *run
+	})
+	s.saveStatus(job, &final)
+
+	logger.WithFields(logrus.Fields{
+		"status":    final.Status,
+		"copied":    final.TagsCopied,
+		"unchanged": final.TagsUnchanged,
+		"failed":    final.TagsFailed,
+		"bytes":     final.BytesDownloaded,
+	}).Info("Repository sync finished")
+}
+
+func (s *SyncService) syncTags(ctx context.Context, job *syncJob, run *models.SyncRun) {
+	tags, err := s.proxy.ListUpstreamTags(ctx, job.registryURL, job.upstreamName)
+	if err != nil {
+		s.update(func() { run.Error = fmt.Sprintf("failed to list upstream tags: %v", err) })
+		return
+	}
+
+	var matched []string
+	for _, tag := range tags {
+		if job.tagPattern == nil || job.tagPattern.MatchString(tag) {
+			matched = append(matched, tag)
+		}
+	}
+	s.update(func() { run.TagsMatched = len(matched) })
+
+	for _, tag := range matched {
+		copied, err := s.syncTag(ctx, job, run, tag)
+		s.update(func() {
+			switch {
+			case err != nil:
+				run.TagsFailed++
+				run.Failures = append(run.Failures, models.SyncTagFailure{Tag: tag, Error: err.Error()})
+			case copied:
+				run.TagsCopied++
+			default:
+				run.TagsUnchanged++
+			}
+		})
+		if err != nil {
+			s.log.WithError(err).WithFields(logrus.Fields{
+				"job": job.Name,
+				"tag": tag,
+			}).Warn("Failed to sync tag")
+		}
+		if ctx.Err() != nil {
+			s.update(func() { run.Error = "sync interval elapsed before all tags were copied" })
+			return
+		}
+	}
+}
+
+// syncTag copies one tag. Returns false when the local copy already matches upstream.
+func (s *SyncService) syncTag(ctx context.Context, job *syncJob, run *models.SyncRun, tag string) (bool, error) {
+	manifestData, _, err := s.proxy.GetManifest(ctx, job.registryURL, job.upstreamName, tag)
+	if err != nil {
+		return false, err
+	}
+
+	var index models.OCIIndex
+	if err := json.Unmarshal(manifestData, &index); err != nil {
+		return false, fmt.Errorf("invalid manifest: %w", err)
+	}
+	isIndex := index.MediaType == models.MediaTypeOCIManifestList ||
+		index.MediaType == models.MediaTypeDockerManifestList ||
+		len(index.Manifests) > 0
+	if isIndex && job.platforms != nil {
+		if manifestData, err = filterIndexPlatforms(manifestData, job.platforms); err != nil {
+			return false, err
+		}
+		if err := json.Unmarshal(manifestData, &index); err != nil {
+			return false, err
+		}
+	}
+
+	manifestPath := s.pathManager.GetImageManifestPath(job.Target, tag)
+	if local, err := s.backend.Read(manifestPath); err == nil && string(local) == string(manifestData) {
+		return false, nil
+	}
+
+	// Copy blobs and platform manifests before the tag so it never points at missing content
+	var totalSize int64
+	if isIndex {
+		if len(index.Manifests) == 0 {
+			return false, fmt.Errorf("no manifest matches platforms %v", job.Platforms)
+		}
+		for _, desc := range index.Manifests {
+			childData, _, err := s.proxy.GetManifest(ctx, job.registryURL, job.upstreamName, desc.Digest)
+			if err != nil {
+				return false, fmt.Errorf("platform manifest %s: %w", desc.Digest, err)
+			}
+			size, err := s.copyManifestContent(ctx, job, run, childData)
+			if err != nil {
+				return false, err
+			}
+			totalSize += size
+			if err := s.writeBlob(childData); err != nil {
+				return false, err
+			}
+		}
+	} else {
+		if totalSize, err = s.copyManifestContent(ctx, job, run, manifestData); err != nil {
+			return false, err
+		}
+	}
+
+	if err := s.writeBlob(manifestData); err != nil {
+		return false, err
+	}
+	if err := s.backend.Write(manifestPath, manifestData); err != nil {
+		return false, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	// Record the tag like a pushed image so it is listed with the local images
+	if isIndex {
+		err = s.imageService.SaveImageIndex(job.Target, tag, manifestData, totalSize)
+	} else {
+		var manifest models.OCIManifest
+		if err = json.Unmarshal(manifestData, &manifest); err == nil {
+			err = s.imageService.SaveImage(job.Target, tag, &manifest)
+		}
+	}
+	if err != nil {
+		s.log.WithError(err).WithField("image", job.Target+":"+tag).Warn("Failed to save mirrored image metadata")
+	}
+	return true, nil
+}
+
+// copyManifestContent downloads the config and layers of an image manifest and returns their total size
+func (s *SyncService) copyManifestContent(ctx context.Context, job *syncJob, run *models.SyncRun, manifestData []byte) (int64, error) {
+	var manifest models.OCIManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return 0, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	descriptors := manifest.Layers
+	if manifest.Config.Digest != "" {
+		descriptors = append([]models.OCIDescriptor{manifest.Config}, descriptors...)
+	}
+	for _, desc := range descriptors {
+		written, err := s.copyBlob(ctx, job, desc.Digest)
+		if err != nil {
+			return 0, fmt.Errorf("blob %s: %w", desc.Digest, err)
+		}
+		if written > 0 {
+			s.update(func() {
+				run.BlobsCopied++
+				run.BytesDownloaded += written
+			})
+		}
+	}
+	return manifest.GetTotalSize(), nil
+}
+
+// copyBlob downloads a blob missing locally and verifies its digest. Returns the bytes written.
+func (s *SyncService) copyBlob(ctx context.Context, job *syncJob, digest string) (int64, error) {
+	if exists, _ := s.backend.Exists(s.pathManager.GetBlobPath(digest)); exists {
+		return 0, nil
+	}
+
+	reader, size, err := s.proxy.GetBlob(ctx, job.registryURL, job.upstreamName, digest)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	return ImportBlob(s.backend, s.pathManager, reader, digest, size)
+}
+
+// writeBlob stores a manifest under its digest for digest-based pulls
+func (s *SyncService) writeBlob(data []byte) error {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	if exists, _ := s.backend.Exists(s.pathManager.GetBlobPath(digest)); exists {
+		return nil
+	}
+	if _, err := ImportBlob(s.backend, s.pathManager, bytes.NewReader(data), digest, int64(len(data))); err != nil {
+		return fmt.Errorf("failed to write manifest blob: %w", err)
+	}
+	return nil
+}
+
+// filterIndexPlatforms keeps the index entries of the selected platforms (os/arch or
+// os/arch/variant). Other fields are preserved; the index digest changes accordingly.
+func filterIndexPlatforms(data []byte, platforms map[string]bool) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid index: %w", err)
+	}
+	var manifests []json.RawMessage
+	if err := json.Unmarshal(doc["manifests"], &manifests); err != nil {
+		return nil, fmt.Errorf("invalid index manifests: %w", err)
+	}
+
+	kept := make([]json.RawMessage, 0, len(manifests))
+	for _, raw := range manifests {
+		var desc models.OCIDescriptor
+		if err := json.Unmarshal(raw, &desc); err != nil || desc.Platform == nil {
+			continue
+		}
+		platform := desc.Platform.OS + "/" + desc.Platform.Architecture
+		if platforms[platform] || (desc.Platform.Variant != "" && platforms[platform+"/"+desc.Platform.Variant]) {
+			kept = append(kept, raw)
+		}
+	}
+	if len(kept) == len(manifests) {
+		return data, nil
+	}
+
+	encoded, err := json.Marshal(kept)
+	if err != nil {
+		return nil, err
+	}
+	doc["manifests"] = encoded
+	return json.Marshal(doc)
+}
@@ -0,0 +1,128 @@
+// pkg/services/tokens.go
+package service
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"oci-storage/config"
+)
+
+// Authorization schemes from upstream WWW-Authenticate challenges
+const (
+	authSchemeBearer = "bearer"
+	authSchemeBasic  = "basic"
+)
+
+// basicAuthTTL is how long a Basic challenge is remembered for an endpoint
+const basicAuthTTL = time.Hour
+
+// upstreamAuth is a cached answer to an upstream auth challenge
+type upstreamAuth struct {
+	scheme  string
+	token   string // bearer token (empty for basic)
+	expires time.Time
+}
+
+// apply sets the Authorization header on an upstream request
+func (a upstreamAuth) apply(req *http.Request, ep config.RegistryEndpoint) {
+	if a.scheme == authSchemeBasic {
+		req.SetBasicAuth(ep.Username, ep.Password)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+}
+
+// tokenCache stores upstream auth per endpoint and scope so a token is requested
+// once per repository rather than once per manifest and blob.
+type tokenCache struct {
+	mu      sync.Mutex
+	entries map[string]upstreamAuth
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{entries: make(map[string]upstreamAuth)}
+}
+
+// tokenCacheKey builds the cache key for an endpoint and a token scope
+func tokenCacheKey(endpointURL, scope string) string {
+	return endpointURL + "|" + scope
+}
+
+// get returns a non-expired entry for key
+func (tc *tokenCache) get(key string) (upstreamAuth, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	auth, ok := tc.entries[key]
+	if !ok {
+		return upstreamAuth{}, false
+	}
+	if time.Now().After(auth.expires) {
+		delete(tc.entries, key)
+		return upstreamAuth{}, false
+	}
+	return auth, true
+}
+
+func (tc *tokenCache) set(key string, auth upstreamAuth) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	// Drop expired entries once the map grows so long-running pods don't accumulate scopes
+	if len(tc.entries) >= 1000 {
+		now := time.Now()
+		for k, v := range tc.entries {
+			if now.After(v.expires) {
+				delete(tc.entries, k)
+			}
+		}
+	}
+	tc.entries[key] = auth
+}
+
+func (tc *tokenCache) invalidate(key string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	delete(tc.entries, key)
+}
+
+// challengeScheme returns the lowercased scheme of a WWW-Authenticate header ("bearer", "basic")
+func challengeScheme(header string) string {
+	fields := strings.Fields(header)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+// challengeParamRe matches the key="value" parameters of a WWW-Authenticate header
+var challengeParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseChallengeParams returns the parameters of a WWW-Authenticate header (realm, service, scope)
+func parseChallengeParams(header string) map[string]string {
+	params := make(map[string]string)
+	header = strings.TrimPrefix(header, "Bearer ")
+
+	for _, match := range challengeParamRe.FindAllStringSubmatch(header, -1) {
+		if len(match) == 3 {
+			params[match[1]] = match[2]
+		}
+	}
+
+	return params
+}
+
+// tokenTTL converts a token endpoint expires_in into a cache lifetime.
+// The token spec defaults to 60 seconds; a 10% margin avoids using a token as it expires.
+func tokenTTL(expiresIn int) time.Duration {
+	if expiresIn <= 0 {
+		expiresIn = 60
+	}
+	ttl := time.Duration(expiresIn) * time.Second
+	return ttl - ttl/10
+}
@@ -0,0 +1,139 @@
+// pkg/services/transport.go
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"time"
+
+	"oci-storage/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// upstreamClient is the HTTP client of one upstream endpoint, or the error that prevented building it
+type upstreamClient struct {
+	client *http.Client
+	err    error
+}
+
+// clientFor returns the HTTP client dedicated to an upstream endpoint, building it on first use.
+// Each endpoint gets its own transport (connection pool, TLS settings); outbound proxies are
+// taken from HTTPS_PROXY / HTTP_PROXY / NO_PROXY.
+func (s *ProxyService) clientFor(ep config.RegistryEndpoint) (*http.Client, error) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	if c, ok := s.clients[ep.URL]; ok {
+		return c.client, c.err
+	}
+
+	c := &upstreamClient{}
+	transport, err := newUpstreamTransport(ep)
+	if err != nil {
+		c.err = fmt.Errorf("invalid TLS settings for %s: %w", ep.URL, err)
+		s.log.WithError(err).WithField("endpoint", ep.URL).Error("Failed to build upstream transport")
+	} else {
+		c.client = &http.Client{Timeout: 0, Transport: transport}
+		if ep.TLS != nil {
+			s.log.WithFields(logrus.Fields{
+				"endpoint":           ep.URL,
+				"caFile":             ep.TLS.CAFile,
+				"clientCert":         ep.TLS.CertFile != "",
+				"insecureSkipVerify": ep.TLS.InsecureSkipVerify,
+				"plainHTTP":          ep.TLS.PlainHTTP,
+			}).Info("Upstream transport configured")
+		}
+	}
+	s.clients[ep.URL] = c
+	return c.client, c.err
+}
+
+// newUpstreamTransport builds the transport for an upstream endpoint
+func newUpstreamTransport(ep config.RegistryEndpoint) (http.RoundTripper, error) {
+	// Connection pooling to prevent fd exhaustion
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 20,
+		MaxConnsPerHost:     50,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	if ep.TLS == nil {
+		return transport, nil
+	}
+
+	tlsConfig, err := upstreamTLSConfig(ep.TLS)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if !ep.TLS.PlainHTTP {
+		return transport, nil
+	}
+	u, err := neturl.Parse(ep.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint URL: %w", err)
+	}
+	return &plainHTTPTransport{base: transport, host: u.Host}, nil
+}
+
+// upstreamTLSConfig builds the TLS client configuration: extra CA bundle on top of the
+// system roots, optional client certificate and optional verification bypass.
+func upstreamTLSConfig(cfg *config.RegistryTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, // explicitly requested per registry
+	}
+
+	if cfg.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, fmt.Errorf("client certificate requires both certFile and keyFile")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// plainHTTPTransport downgrades requests to the endpoint host to plain HTTP.
+// Other hosts (e.g. a token realm elsewhere) are left untouched.
+type plainHTTPTransport struct {
+	base http.RoundTripper
+	host string
+}
+
+func (t *plainHTTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" && req.URL.Host == t.host {
+		req = req.Clone(req.Context())
+		req.URL.Scheme = "http"
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,406 @@
+// pkg/services/uploads.go
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"oci-storage/pkg/coordination"
+	"oci-storage/pkg/storage"
+	"oci-storage/pkg/utils"
+)
+
+var (
+	// ErrUploadUnknown is returned for an upload session that was never started or has expired
+	ErrUploadUnknown = errors.New("upload session not found")
+	// ErrUploadInProgress is returned when another request is writing to the same upload session
+	ErrUploadInProgress = errors.New("upload session is busy")
+	// ErrDigestMismatch is returned when uploaded content does not match the declared digest
+	ErrDigestMismatch = errors.New("digest mismatch")
+)
+
+const (
+	// uploadsDir holds upload sessions in the bucket: uploads/<uuid>/{session.json,pending,data}
+	uploadsDir = "uploads"
+	// uploadLockTTL bounds one PATCH or PUT, matching the server read timeout
+	uploadLockTTL = 30 * time.Minute
+	// uploadSessionMaxAge is how long an idle upload session is kept before being aborted
+	uploadSessionMaxAge = 24 * time.Hour
+	// uploadCleanupInterval is how often idle upload sessions are looked for
+	uploadCleanupInterval = time.Hour
+)
+
+// uploadSession is the state of a chunked upload, persisted between requests so any replica can continue it
+type uploadSession struct {
+	UploadID string                  `json:"uploadId,omitempty"` // multipart upload, created once a full part is received
+	Parts    []storage.CompletedPart `json:"parts,omitempty"`
+	Size     int64                   `json:"size"`
+	// Pending is the size of the data received after the last part, staged in the pending object
+	Pending int64 `json:"pending"`
+	// HashState is the marshaled sha256 state of all data received so far
+	HashState []byte    `json:"hashState"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// UploadService writes chunked blob uploads straight to object storage as multipart uploads.
+// Chunks are cut into parts of the backend's part size; the remainder below one part and
+// the incremental digest are stored in the bucket with the session, so no local disk or
+// session affinity is needed.
+type UploadService struct {
+	backend     storage.Backend
+	uploader    storage.MultipartUploader
+	pathManager *utils.PathManager
+	locker      coordination.LockManager
+	log         *utils.Logger
+}
+
+// NewUploadService creates an upload service for a backend supporting multipart uploads
+func NewUploadService(backend storage.Backend, uploader storage.MultipartUploader, pm *utils.PathManager, locker coordination.LockManager, log *utils.Logger) *UploadService {
+	return &UploadService{
+		backend:     backend,
+		uploader:    uploader,
+		pathManager: pm,
+		locker:      locker,
+		log:         log,
+	}
+}
+
+// Start aborts upload sessions left idle by clients in the background
+func (s *UploadService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(uploadCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.cleanupStale(ctx)
+			}
+		}
+	}()
+}
+
+// Create starts an empty upload session
+func (s *UploadService) Create(uuid string) error {
+	state, err := sha256.New().(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return s.save(uuid, &uploadSession{HashState: state, StartedAt: now, UpdatedAt: now})
+}
+
+// Append adds a chunk to an upload session. It returns the bytes read from body and the total upload size.
+func (s *UploadService) Append(ctx context.Context, uuid string, body io.Reader) (int64, int64, error) {
+	unlock, sess, err := s.acquire(ctx, uuid)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	hasher, tail, written, err := s.write(uuid, sess, body)
+	if err != nil {
+		return written, sess.Size, err
+	}
+
+	if len(tail) > 0 {
+		if err := s.backend.Write(s.pendingPath(uuid), tail); err != nil {
+			return written, sess.Size, fmt.Errorf("failed to stage upload data: %w", err)
+		}
+	}
+	sess.Pending = int64(len(tail))
+	if sess.HashState, err = hasher.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+		return written, sess.Size, err
+	}
+	sess.UpdatedAt = time.Now()
+	return written, sess.Size, s.save(uuid, sess)
+}
+
+// Complete adds the final chunk, verifies the digest and moves the upload to its blob path
+func (s *UploadService) Complete(ctx context.Context, uuid, digest string, body io.Reader) error {
+	unlock, sess, err := s.acquire(ctx, uuid)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	hasher, tail, _, err := s.write(uuid, sess, body)
+	if err != nil {
+		return err
+	}
+	// The session hashes sha256 as data arrives; other algorithms are checked on the
+	// assembled upload
+	incremental := strings.HasPrefix(digest, "sha256:")
+	if incremental {
+		if actual := utils.DigestOf(digest, hasher); actual != digest {
+			s.discard(uuid, sess)
+			return fmt.Errorf("%w: expected %s but got %s", ErrDigestMismatch, digest, actual)
+		}
+	} else if utils.NewDigestHash(digest) == nil {
+		s.discard(uuid, sess)
+		return fmt.Errorf("%w: unsupported digest algorithm %s", ErrDigestMismatch, digest)
+	}
+
+	blobPath := s.pathManager.GetBlobPath(digest)
+	if sess.UploadID == "" {
+		// Smaller than one part: a single object write
+		if !incremental {
+			if err := checkDigest(bytes.NewReader(tail), digest); err != nil {
+				s.discard(uuid, sess)
+				return err
+			}
+		}
+		if err := s.backend.Write(blobPath, tail); err != nil {
+			return fmt.Errorf("failed to write blob: %w", err)
+		}
+	} else {
+		if len(tail) > 0 {
+			if err := s.uploadPart(uuid, sess, tail); err != nil {
+				return err
+			}
+		}
+		if err := s.uploader.CompleteMultipart(s.dataPath(uuid), sess.UploadID, sess.Parts); err != nil {
+			return err
+		}
+		if !incremental {
+			if err := s.checkStoredDigest(s.dataPath(uuid), digest); err != nil {
+				if err := s.backend.RemoveAll(s.sessionDir(uuid)); err != nil {
+					s.log.WithError(err).WithField("uuid", uuid).Warn("Failed to remove upload session")
+				}
+				return err
+			}
+		}
+		if err := s.backend.Rename(s.dataPath(uuid), blobPath); err != nil {
+			return fmt.Errorf("failed to move blob to final path: %w", err)
+		}
+	}
+
+	if err := s.backend.RemoveAll(s.sessionDir(uuid)); err != nil {
+		s.log.WithError(err).WithField("uuid", uuid).Warn("Failed to remove upload session")
+	}
+	return nil
+}
+
+// checkStoredDigest hashes a stored object against digest
+func (s *UploadService) checkStoredDigest(path, digest string) error {
+	reader, err := s.backend.ReadStream(path)
+	if err != nil {
+		return fmt.Errorf("failed to read completed upload: %w", err)
+	}
+	defer reader.Close()
+	return checkDigest(reader, digest)
+}
+
+// checkDigest hashes reader with the algorithm of digest
+func checkDigest(reader io.Reader, digest string) error {
+	h := utils.NewDigestHash(digest)
+	if _, err := io.Copy(h, reader); err != nil {
+		return fmt.Errorf("failed to hash upload: %w", err)
+	}
+	if actual := utils.DigestOf(digest, h); actual != digest {
+		return fmt.Errorf("%w: expected %s but got %s", ErrDigestMismatch, digest, actual)
+	}
+	return nil
+}
+
+// Discard aborts an upload session and deletes its data
+func (s *UploadService) Discard(uuid string) error {
+	sess, err := s.load(uuid)
+	if err != nil {
+		if errors.Is(err, ErrUploadUnknown) {
+			return nil
+		}
+		return err
+	}
+	s.discard(uuid, sess)
+	return nil
+}
+
+func (s *UploadService) discard(uuid string, sess *uploadSession) {
+	if sess.UploadID != "" {
+		if err := s.uploader.AbortMultipart(s.dataPath(uuid), sess.UploadID); err != nil {
+			s.log.WithError(err).WithField("uuid", uuid).Warn("Failed to abort multipart upload")
+		}
+	}
+	if err := s.backend.RemoveAll(s.sessionDir(uuid)); err != nil {
+		s.log.WithError(err).WithField("uuid", uuid).Warn("Failed to remove upload session")
+	}
+}
+
+// write hashes body and uploads every complete part, starting from the staged pending data.
+// It returns the hash state, the data left after the last part and the bytes read from body.
+func (s *UploadService) write(uuid string, sess *uploadSession, body io.Reader) (hash.Hash, []byte, int64, error) {
+	hasher := sha256.New()
+	if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(sess.HashState); err != nil {
+		return nil, nil, 0, fmt.Errorf("invalid upload hash state: %w", err)
+	}
+
+	buf := make([]byte, s.uploader.PartSize())
+	n := 0
+	if sess.Pending > 0 {
+		pending, err := s.backend.Read(s.pendingPath(uuid))
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to read staged upload data: %w", err)
+		}
+		n = copy(buf, pending)
+	}
+
+	var written int64
+	for body != nil {
+		read, err := io.ReadFull(body, buf[n:])
+		hasher.Write(buf[n : n+read])
+		n += read
+		written += int64(read)
+		sess.Size += int64(read)
+
+		if n == len(buf) {
+			if err := s.uploadPart(uuid, sess, buf); err != nil {
+				return nil, nil, written, err
+			}
+			n = 0
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, written, fmt.Errorf("failed to read upload data: %w", err)
+		}
+	}
+	return hasher, buf[:n], written, nil
+}
+
+// uploadPart uploads the next part, starting the multipart upload on the first one
+func (s *UploadService) uploadPart(uuid string, sess *uploadSession, data []byte) error {
+	if sess.UploadID == "" {
+		uploadID, err := s.uploader.CreateMultipart(s.dataPath(uuid))
+		if err != nil {
+			return err
+		}
+		sess.UploadID = uploadID
+		// Saved right away so the multipart upload can be aborted if this request fails
+		if err := s.save(uuid, sess); err != nil {
+			return err
+		}
+	}
+
+	number := len(sess.Parts) + 1
+	etag, err := s.uploader.UploadPart(s.dataPath(uuid), sess.UploadID, number, data)
+	if err != nil {
+		return err
+	}
+	sess.Parts = append(sess.Parts, storage.CompletedPart{Number: number, ETag: etag})
+	return nil
+}
+
+// acquire locks an upload session and loads it
+func (s *UploadService) acquire(ctx context.Context, uuid string) (func(), *uploadSession, error) {
+	unlock, err := s.locker.Acquire(ctx, "upload:"+uuid, uploadLockTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrUploadInProgress, err)
+	}
+	sess, err := s.load(uuid)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return unlock, sess, nil
+}
+
+func (s *UploadService) load(uuid string) (*uploadSession, error) {
+	data, err := s.backend.Read(s.sessionPath(uuid))
+	if err != nil {
+		if exists, _ := s.backend.Exists(s.sessionPath(uuid)); !exists {
+			return nil, ErrUploadUnknown
+		}
+		return nil, fmt.Errorf("failed to read upload session: %w", err)
+	}
+	var sess uploadSession
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("invalid upload session: %w", err)
+	}
+	return &sess, nil
+}
+
+func (s *UploadService) save(uuid string, sess *uploadSession) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	if err := s.backend.Write(s.sessionPath(uuid), data); err != nil {
+		return fmt.Errorf("failed to save upload session: %w", err)
+	}
+	return nil
+}
+
+// cleanupStale aborts upload sessions not written to for uploadSessionMaxAge
+func (s *UploadService) cleanupStale(ctx context.Context) {
+	cutoff := time.Now().Add(-uploadSessionMaxAge)
+	var stale []string
+	err := s.backend.ListIter(uploadsDir, func(entry storage.FileInfo) error {
+		if !entry.IsDir {
+			return nil
+		}
+		if s.isStale(entry.Name, cutoff) {
+			stale = append(stale, entry.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		s.log.WithError(err).Warn("Failed to list upload sessions")
+		return
+	}
+
+	for _, uuid := range stale {
+		unlock, err := s.locker.Acquire(ctx, "upload:"+uuid, uploadLockTTL)
+		if err != nil {
+			continue
+		}
+		// Checked again under the lock: the client may have resumed the upload
+		if s.isStale(uuid, cutoff) {
+			if sess, err := s.load(uuid); err == nil {
+				s.discard(uuid, sess)
+			} else {
+				s.backend.RemoveAll(s.sessionDir(uuid))
+			}
+			s.log.WithField("uuid", uuid).Info("Removed stale upload session")
+		}
+		unlock()
+	}
+}
+
+// isStale reports whether an upload session has not been written to since cutoff, or lost its state
+func (s *UploadService) isStale(uuid string, cutoff time.Time) bool {
+	sess, err := s.load(uuid)
+	if err != nil {
+		return errors.Is(err, ErrUploadUnknown)
+	}
+	return sess.UpdatedAt.Before(cutoff)
+}
+
+func (s *UploadService) sessionDir(uuid string) string {
+	return filepath.Join(uploadsDir, uuid)
+}
+
+func (s *UploadService) sessionPath(uuid string) string {
+	return filepath.Join(uploadsDir, uuid, "session.json")
+}
+
+func (s *UploadService) pendingPath(uuid string) string {
+	return filepath.Join(uploadsDir, uuid, "pending")
+}
+
+func (s *UploadService) dataPath(uuid string) string {
+	return filepath.Join(uploadsDir, uuid, "data")
+}
@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"oci-storage/config"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+const (
+	// azureStreamBufferSize and azureStreamMaxBuffers bound the memory used by streamed uploads
+	azureStreamBufferSize = 4 * 1024 * 1024
+	azureStreamMaxBuffers = 4
+	// azureCopyPollInterval is how often Rename checks a pending server-side copy
+	azureCopyPollInterval = 200 * time.Millisecond
+)
+
+// AzureBackend implements Backend using Azure Blob Storage block blobs.
+// Also works with Azurite through config.AzureBlobConfig.Endpoint.
+type AzureBackend struct {
+	container     azblob.ContainerURL
+	containerName string
+	// credential signs SAS download URLs
+	credential *azblob.SharedKeyCredential
+	// endpoint and publicEndpoint are the account URLs used by the service and by clients
+	endpoint       string
+	publicEndpoint string
+	// localTempDir is used for CreateTemp (chunked uploads need local staging)
+	localTempDir string
+}
+
+// NewAzureBackend creates an Azure Blob storage backend from config, creating the container if needed
+func NewAzureBackend(cfg config.AzureBlobConfig, localTempDir string) (*AzureBackend, error) {
+	if cfg.StorageAccount == "" || cfg.Container == "" {
+		return nil, fmt.Errorf("azure storage account and container must be configured")
+	}
+	if cfg.AccountKey == "" {
+		return nil, fmt.Errorf("azure storage account key not provided")
+	}
+
+	credential, err := azblob.NewSharedKeyCredential(cfg.StorageAccount, cfg.AccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure credentials: %w", err)
+	}
+
+	endpoint := strings.TrimSuffix(cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", cfg.StorageAccount)
+	}
+	containerURL, err := url.Parse(endpoint + "/" + cfg.Container)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse container URL: %w", err)
+	}
+	container := azblob.NewContainerURL(*containerURL, azblob.NewPipeline(credential, azblob.PipelineOptions{}))
+	publicEndpoint := strings.TrimSuffix(cfg.PublicEndpoint, "/")
+	if publicEndpoint == "" {
+		publicEndpoint = endpoint
+	}
+
+	// Verify container exists (or create it)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := container.GetProperties(ctx, azblob.LeaseAccessConditions{}); err != nil {
+		var storageErr azblob.StorageError
+		if !errors.As(err, &storageErr) || storageErr.ServiceCode() != azblob.ServiceCodeContainerNotFound {
+			return nil, fmt.Errorf("failed to access container %s: %w", cfg.Container, err)
+		}
+		if _, createErr := container.Create(ctx, azblob.Metadata{}, azblob.PublicAccessNone); createErr != nil {
+			return nil, fmt.Errorf("container %s does not exist and could not be created: %w", cfg.Container, createErr)
+		}
+	}
+
+	// Ensure local temp dir exists for chunked uploads
+	if err := os.MkdirAll(localTempDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	return &AzureBackend{
+		container:      container,
+		containerName:  cfg.Container,
+		credential:     credential,
+		endpoint:       endpoint,
+		publicEndpoint: publicEndpoint,
+		localTempDir:   localTempDir,
+	}, nil
+}
+
+// PresignGet returns a read-only SAS URL for a blob, pointing at the public endpoint when configured
+func (b *AzureBackend) PresignGet(path string, ttl time.Duration) (string, error) {
+	sas, err := azblob.BlobSASSignatureValues{
+		Protocol:      azblob.SASProtocolHTTPSandHTTP,
+		ExpiryTime:    time.Now().UTC().Add(ttl),
+		ContainerName: b.containerName,
+		BlobName:      objectKey(path),
+		Permissions:   azblob.BlobSASPermissions{Read: true}.String(),
+	}.NewSASQueryParameters(b.credential)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign blob URL: %w", err)
+	}
+	blobURL := b.blob(path).URL()
+	blobURL.RawQuery = sas.Encode()
+	return b.publicEndpoint + strings.TrimPrefix(blobURL.String(), b.endpoint), nil
+}
+
+func (b *AzureBackend) blob(path string) azblob.BlockBlobURL {
+	return b.container.NewBlockBlobURL(objectKey(path))
+}
+
+func (b *AzureBackend) Read(path string) ([]byte, error) {
+	body, err := b.ReadStream(path)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (b *AzureBackend) Write(path string, data []byte) error {
+	_, err := azblob.UploadBufferToBlockBlob(context.Background(), data, b.blob(path), azblob.UploadToBlockBlobOptions{})
+	return err
+}
+
+func (b *AzureBackend) WriteStream(path string, reader io.Reader) (int64, error) {
+	// Blocks are staged as data arrives and committed at the end
+	counter := &countingReader{reader: reader}
+	_, err := azblob.UploadStreamToBlockBlob(context.Background(), counter, b.blob(path), azblob.UploadStreamToBlockBlobOptions{
+		BufferSize: azureStreamBufferSize,
+		MaxBuffers: azureStreamMaxBuffers,
+	})
+	return counter.n, err
+}
+
+func (b *AzureBackend) Exists(path string) (bool, error) {
+	_, err := b.blob(path).GetProperties(context.Background(), azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		if isAzureNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *AzureBackend) Stat(path string) (*FileInfo, error) {
+	props, err := b.blob(path).GetProperties(context.Background(), azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{
+		Name: baseName(objectKey(path)),
+		Size: props.ContentLength(),
+	}, nil
+}
+
+func (b *AzureBackend) Delete(path string) error {
+	_, err := b.blob(path).Delete(context.Background(), azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+	return err
+}
+
+func (b *AzureBackend) List(dir string) ([]FileInfo, error) {
+	var result []FileInfo
+	err := b.ListIter(dir, func(info FileInfo) error {
+		result = append(result, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListIter pages through a hierarchical listing (5000 entries per page) with a "/" delimiter
+func (b *AzureBackend) ListIter(dir string, fn func(FileInfo) error) error {
+	ctx := context.Background()
+	prefix := objectPrefix(dir)
+
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := b.container.ListBlobsHierarchySegment(ctx, marker, "/", azblob.ListBlobsSegmentOptions{Prefix: prefix})
+		if err != nil {
+			return err
+		}
+		marker = resp.NextMarker
+
+		var entries []FileInfo
+		// Blob prefixes = "directories"
+		for _, p := range resp.Segment.BlobPrefixes {
+			if name := trimDirName(p.Name, prefix); name != "" {
+				entries = append(entries, FileInfo{Name: name, IsDir: true})
+			}
+		}
+		// Blobs = "files"
+		for _, item := range resp.Segment.BlobItems {
+			if name := strings.TrimPrefix(item.Name, prefix); name != "" {
+				entries = append(entries, FileInfo{Name: name, Size: azureBlobSize(item)})
+			}
+		}
+
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				if errors.Is(err, fs.SkipAll) {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *AzureBackend) Walk(dir string, fn func(path string, info FileInfo) error) error {
+	ctx := context.Background()
+	options := azblob.ListBlobsSegmentOptions{Prefix: objectPrefix(dir)}
+
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := b.container.ListBlobsFlatSegment(ctx, marker, options)
+		if err != nil {
+			return err
+		}
+		marker = resp.NextMarker
+
+		for _, item := range resp.Segment.BlobItems {
+			if isDirMarker(item.Name) {
+				continue
+			}
+			if err := fn(filepath.FromSlash(item.Name), FileInfo{Name: baseName(item.Name), Size: azureBlobSize(item)}); err != nil {
+				if errors.Is(err, fs.SkipAll) {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *AzureBackend) ReadStream(path string) (io.ReadCloser, error) {
+	resp, err := b.blob(path).Download(context.Background(), 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// Resume interrupted downloads of large blobs instead of failing the read
+	return resp.Body(azblob.RetryReaderOptions{MaxRetryRequests: 3}), nil
+}
+
+func (b *AzureBackend) Rename(src, dst string) error {
+	// Azure has no rename - server-side copy (asynchronous for large blobs) then delete
+	ctx := context.Background()
+	srcBlob, dstBlob := b.blob(src), b.blob(dst)
+
+	resp, err := dstBlob.StartCopyFromURL(ctx, srcBlob.URL(), azblob.Metadata{}, azblob.ModifiedAccessConditions{}, azblob.BlobAccessConditions{}, azblob.DefaultAccessTier, nil)
+	if err != nil {
+		return fmt.Errorf("azure copy failed: %w", err)
+	}
+	status := resp.CopyStatus()
+	for status == azblob.CopyStatusPending {
+		time.Sleep(azureCopyPollInterval)
+		props, err := dstBlob.GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+		if err != nil {
+			return fmt.Errorf("azure copy status check failed: %w", err)
+		}
+		status = props.CopyStatus()
+	}
+	if status != azblob.CopyStatusSuccess {
+		return fmt.Errorf("azure copy of %s ended with status %s", objectKey(src), status)
+	}
+
+	_, err = srcBlob.Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+	return err
+}
+
+func (b *AzureBackend) CreateTemp(dir string) (TempFile, error) {
+	// Chunked uploads stage locally, then get uploaded to Azure on CompleteUpload
+	f, err := os.CreateTemp(b.localTempDir, ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	return &localTempFile{file: f}, nil
+}
+
+func (b *AzureBackend) Import(localPath, storagePath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open local file for import: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := azblob.UploadFileToBlockBlob(context.Background(), file, b.blob(storagePath), azblob.UploadToBlockBlobOptions{}); err != nil {
+		return fmt.Errorf("azure upload failed: %w", err)
+	}
+	return os.Remove(localPath)
+}
+
+func (b *AzureBackend) RemoveAll(path string) error {
+	return b.Walk(path, func(objectPath string, _ FileInfo) error {
+		if err := b.Delete(objectPath); err != nil && !isAzureNotFound(err) {
+			return fmt.Errorf("failed to delete blob %s: %w", objectKey(objectPath), err)
+		}
+		return nil
+	})
+}
+
+func azureBlobSize(item azblob.BlobItemInternal) int64 {
+	if item.Properties.ContentLength == nil {
+		return 0
+	}
+	return *item.Properties.ContentLength
+}
+
+// isAzureNotFound checks if an Azure error is a 404 (HEAD responses carry no service code)
+func isAzureNotFound(err error) bool {
+	var storageErr azblob.StorageError
+	if !errors.As(err, &storageErr) {
+		return false
+	}
+	if storageErr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+		return true
+	}
+	return storageErr.Response() != nil && storageErr.Response().StatusCode == http.StatusNotFound
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
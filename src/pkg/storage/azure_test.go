@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"oci-storage/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Azurite's well-known development account
+const (
+	azuriteAccount    = "devstoreaccount1"
+	azuriteAccountKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFTBVkKQLoqkQJxbQnHag=="
+)
+
+// Runs against Azurite when AZURITE_ENDPOINT is set, e.g.
+//
+//	docker run -p 10000:10000 mcr.microsoft.com/azure-storage/azurite azurite-blob --blobHost 0.0.0.0
+//	AZURITE_ENDPOINT=http://127.0.0.1:10000/devstoreaccount1 go test ./pkg/storage -run Azure
+func TestAzureBackend_Contract(t *testing.T) {
+	endpoint := os.Getenv("AZURITE_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("AZURITE_ENDPOINT not set")
+	}
+
+	// The backend creates the container
+	backend, err := NewAzureBackend(config.AzureBlobConfig{
+		StorageAccount: azuriteAccount,
+		AccountKey:     azuriteAccountKey,
+		Container:      fmt.Sprintf("oci-storage-test-%d", time.Now().UnixNano()),
+		Endpoint:       endpoint,
+	}, t.TempDir())
+	require.NoError(t, err)
+	testBackendContract(t, backend)
+}
@@ -1,11 +1,14 @@
 // pkg/storage/backend.go
-// Storage backend abstraction for local filesystem and S3-compatible object storage.
-// When S3 is enabled, blobs/manifests/charts are stored in the bucket instead of local disk,
+// Storage backend abstraction for local filesystem and object storage (S3-compatible, GCS, Azure Blob).
+// When S3, GCS or Azure Blob is enabled, blobs/manifests/charts are stored in the bucket instead of local disk,
 // allowing horizontal scaling with multiple replicas.
 package storage
 
 import (
 	"io"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 // FileInfo holds metadata about a stored object
@@ -16,8 +19,8 @@ type FileInfo struct {
 }
 
 // Backend abstracts file I/O operations so that the rest of the application
-// does not depend on a local filesystem. Implementations exist for local disk
-// and S3-compatible object stores (Garage, MinIO, AWS S3).
+// does not depend on a local filesystem. Implementations exist for local disk,
+// S3-compatible object stores (Garage, MinIO, AWS S3), Google Cloud Storage and Azure Blob Storage.
 type Backend interface {
 	// Read returns the full content of a file/object
 	Read(path string) ([]byte, error)
@@ -40,6 +43,16 @@ type Backend interface {
 	// List returns entries in a directory/prefix (non-recursive)
 	List(dir string) ([]FileInfo, error)
 
+	// ListIter calls fn for each entry in a directory/prefix (non-recursive), one
+	// page at a time, so large directories are never loaded in memory at once.
+	// Returning fs.SkipAll from fn stops the iteration without error.
+	ListIter(dir string, fn func(FileInfo) error) error
+
+	// Walk calls fn for every file/object below dir, recursively, with its path
+	// relative to the storage root. Directories are not reported.
+	// Returning fs.SkipAll from fn stops the walk without error.
+	Walk(dir string, fn func(path string, info FileInfo) error) error
+
 	// ReadStream returns a reader for streaming large files/objects
 	ReadStream(path string) (io.ReadCloser, error)
 
@@ -63,6 +76,119 @@ type Backend interface {
 	RemoveAll(path string) error
 }
 
+// Presigner is implemented by object store backends able to hand out short-lived
+// download URLs, so clients fetch object bytes directly from the bucket.
+type Presigner interface {
+	// PresignGet returns a URL allowing a GET of the object at path until ttl elapses,
+	// or "" when the object is better streamed (e.g. it is cached locally).
+	PresignGet(path string, ttl time.Duration) (string, error)
+}
+
+// PathResolver is implemented by backend wrappers that may serve an object from another
+// path than the requested one, e.g. a blob not yet moved to the sharded layout.
+type PathResolver interface {
+	ResolvePath(path string) string
+}
+
+// Unwrap returns the innermost backend of a chain of wrappers exposing Unwrap
+func Unwrap(b Backend) Backend {
+	for {
+		w, ok := b.(interface{ Unwrap() Backend })
+		if !ok {
+			return b
+		}
+		b = w.Unwrap()
+	}
+}
+
+// AsPresigner returns the Presigner of a backend or of the backend it wraps. Wrappers
+// that must see what goes through it forward it with an AsPresigner method instead of Unwrap.
+func AsPresigner(b Backend) (Presigner, bool) {
+	for {
+		switch w := b.(type) {
+		case Presigner:
+			return w, true
+		case interface{ AsPresigner() (Presigner, bool) }:
+			return w.AsPresigner()
+		case interface{ Unwrap() Backend }:
+			b = w.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// AsMultipartUploader returns the MultipartUploader of a backend or of the backend it
+// wraps. Wrappers that must see the objects it assembles forward it with an
+// AsMultipartUploader method instead of Unwrap.
+func AsMultipartUploader(b Backend) (MultipartUploader, bool) {
+	for {
+		switch w := b.(type) {
+		case MultipartUploader:
+			return w, true
+		case interface {
+			AsMultipartUploader() (MultipartUploader, bool)
+		}:
+			return w.AsMultipartUploader()
+		case interface{ Unwrap() Backend }:
+			b = w.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// CompletedPart identifies an uploaded part of a multipart upload
+type CompletedPart struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// MultipartUploader is implemented by object store backends that assemble an object from
+// separately uploaded parts, so chunked blob uploads are written straight to the bucket.
+type MultipartUploader interface {
+	// PartSize is the size of every part but the last (at least the store's minimum).
+	PartSize() int64
+	// CreateMultipart starts a multipart upload of the object at path and returns its ID.
+	CreateMultipart(path string) (string, error)
+	// UploadPart uploads part number (1-based) and returns its ETag.
+	UploadPart(path, uploadID string, number int, data []byte) (string, error)
+	// CompleteMultipart assembles the parts into the object at path.
+	CompleteMultipart(path, uploadID string, parts []CompletedPart) error
+	// AbortMultipart discards an unfinished multipart upload and its parts.
+	AbortMultipart(path, uploadID string) error
+}
+
+// objectKey converts a storage path into an object store key: forward slashes, no leading slash
+func objectKey(path string) string {
+	k := strings.ReplaceAll(path, string(filepath.Separator), "/")
+	return strings.TrimPrefix(k, "/")
+}
+
+// objectPrefix returns the key prefix of a "directory" in an object store, with a trailing slash
+func objectPrefix(dir string) string {
+	p := objectKey(dir)
+	if p != "" && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return p
+}
+
+// trimDirName returns the name of a "directory" prefix relative to the listed prefix
+func trimDirName(dirPrefix, listPrefix string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(dirPrefix, listPrefix), "/")
+}
+
+// isDirMarker reports whether a key is an empty "directory" placeholder object
+func isDirMarker(key string) bool {
+	return strings.HasSuffix(key, "/")
+}
+
+// baseName returns the last segment of an object key
+func baseName(key string) string {
+	return key[strings.LastIndex(key, "/")+1:]
+}
+
 // TempFile wraps a temporary file for chunked uploads.
 // Write data to it, Close it, then call Path() to get the location.
 type TempFile interface {
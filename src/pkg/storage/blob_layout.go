@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// LegacyBlobBackend serves blobs written before sharding. Blob paths in the sharded
+// layout (blobs/<algorithm>/<ab>/<cd>/<hex>) that are missing are looked up at their
+// flat path (blobs/<algorithm>:<hex>, or blobs/<hex> for sha256) until the blob layout
+// migration has moved them. Writes always go to the requested path.
+type LegacyBlobBackend struct {
+	Backend
+}
+
+// NewLegacyBlobBackend wraps a backend with the legacy blob layout fallback
+func NewLegacyBlobBackend(inner Backend) *LegacyBlobBackend {
+	return &LegacyBlobBackend{Backend: inner}
+}
+
+// Unwrap returns the wrapped backend
+func (b *LegacyBlobBackend) Unwrap() Backend {
+	return b.Backend
+}
+
+// ResolvePath returns the path a blob is actually stored at: its legacy path when it has not been migrated yet
+func (b *LegacyBlobBackend) ResolvePath(path string) string {
+	if exists, _ := b.Backend.Exists(path); exists {
+		return path
+	}
+	for _, legacy := range legacyBlobPaths(path) {
+		if exists, _ := b.Backend.Exists(legacy); exists {
+			return legacy
+		}
+	}
+	return path
+}
+
+func (b *LegacyBlobBackend) Read(path string) ([]byte, error) {
+	data, err := b.Backend.Read(path)
+	if err == nil {
+		return data, nil
+	}
+	if len(legacyBlobPaths(path)) == 0 {
+		return nil, err
+	}
+	// Retried even when resolved to path: the blob may have been migrated meanwhile
+	return b.Backend.Read(b.ResolvePath(path))
+}
+
+func (b *LegacyBlobBackend) ReadStream(path string) (io.ReadCloser, error) {
+	reader, err := b.Backend.ReadStream(path)
+	if err == nil {
+		return reader, nil
+	}
+	if len(legacyBlobPaths(path)) == 0 {
+		return nil, err
+	}
+	return b.Backend.ReadStream(b.ResolvePath(path))
+}
+
+func (b *LegacyBlobBackend) Exists(path string) (bool, error) {
+	exists, err := b.Backend.Exists(path)
+	if exists || err != nil || len(legacyBlobPaths(path)) == 0 {
+		return exists, err
+	}
+	return b.Backend.Exists(b.ResolvePath(path))
+}
+
+func (b *LegacyBlobBackend) Stat(path string) (*FileInfo, error) {
+	info, err := b.Backend.Stat(path)
+	if err == nil {
+		return info, nil
+	}
+	if len(legacyBlobPaths(path)) == 0 {
+		return nil, err
+	}
+	return b.Backend.Stat(b.ResolvePath(path))
+}
+
+// Delete removes a blob from both layouts
+func (b *LegacyBlobBackend) Delete(path string) error {
+	err := b.Backend.Delete(path)
+	for _, legacy := range legacyBlobPaths(path) {
+		if exists, _ := b.Backend.Exists(legacy); exists {
+			if legacyErr := b.Backend.Delete(legacy); legacyErr != nil {
+				return legacyErr
+			}
+			err = nil
+		}
+	}
+	return err
+}
+
+// legacyBlobPaths returns the flat paths of a sharded blob path, or nil for other paths
+func legacyBlobPaths(path string) []string {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(parts) != 5 || parts[0] != "blobs" || len(parts[4]) < 4 || parts[2]+parts[3] != parts[4][:4] {
+		return nil
+	}
+	algorithm, hex := parts[1], parts[4]
+	paths := []string{filepath.Join("blobs", algorithm+":"+hex)}
+	if algorithm == "sha256" {
+		paths = append(paths, filepath.Join("blobs", hex))
+	}
+	return paths
+}
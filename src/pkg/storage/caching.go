@@ -0,0 +1,604 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"oci-storage/config"
+)
+
+const (
+	// maxCachedObjectSize is the largest metadata object kept in memory
+	maxCachedObjectSize = 1 << 20
+	// cachedEntryOverhead approximates the memory used by an entry besides its path and content
+	cachedEntryOverhead = 128
+	// cacheDownloadPrefix names blob downloads not yet complete in the cache directory
+	cacheDownloadPrefix = ".download-"
+)
+
+// CachingBackend is a read-through cache in front of a remote backend. Blobs, immutable
+// and content-addressed, are kept on local disk until evicted. Small metadata (manifests,
+// tag metadata, index.yaml) is kept in memory, missing paths included, for a short TTL.
+// Writes through the cache invalidate the paths they touch; other replicas are told
+// through the publisher set with SetPublisher and call Invalidate.
+type CachingBackend struct {
+	Backend
+	dir            string
+	maxDiskBytes   int64
+	maxMemoryBytes int64
+	ttl            time.Duration
+	publish        func(path string)
+
+	mu          sync.Mutex
+	generation  uint64                   // bumped by each invalidation, so racing reads don't cache stale results
+	files       *list.List               // *cachedFile, most recently used first
+	fileIndex   map[string]*list.Element // by storage path
+	diskBytes   int64
+	entries     *list.List // *cachedEntry, most recently used first
+	entryIndex  map[string]*list.Element
+	memoryBytes int64
+}
+
+// cachedFile is a blob stored in the cache directory under its storage path
+type cachedFile struct {
+	path string
+	size int64
+}
+
+// cachedEntry is what is known of a path. Entries are replaced, never modified.
+type cachedEntry struct {
+	path    string
+	exists  bool
+	size    int64  // -1 when unknown
+	data    []byte // content, for small metadata that was read
+	expires time.Time
+}
+
+// NewCachingBackend wraps a backend with a blob cache in dir, keeping the blobs
+// already there from a previous run
+func NewCachingBackend(inner Backend, cfg config.StorageCacheConfig, dir string) (*CachingBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	b := &CachingBackend{
+		Backend:        inner,
+		dir:            dir,
+		maxDiskBytes:   int64(cfg.MaxSizeGB) << 30,
+		maxMemoryBytes: int64(cfg.MemoryMB) << 20,
+		ttl:            time.Duration(cfg.TTLSeconds) * time.Second,
+		files:          list.New(),
+		fileIndex:      make(map[string]*list.Element),
+		entries:        list.New(),
+		entryIndex:     make(map[string]*list.Element),
+	}
+
+	type existingFile struct {
+		cachedFile
+		modTime time.Time
+	}
+	var existing []existingFile
+	err := filepath.WalkDir(dir, func(localPath string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() {
+			return err
+		}
+		if strings.HasPrefix(e.Name(), cacheDownloadPrefix) {
+			return os.Remove(localPath)
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, localPath)
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingFile{cachedFile{path: rel, size: info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(existing, func(i, j int) bool { return existing[i].modTime.Before(existing[j].modTime) })
+	for _, f := range existing {
+		b.fileIndex[f.path] = b.files.PushFront(&cachedFile{path: f.path, size: f.size})
+		b.diskBytes += f.size
+	}
+	b.mu.Lock()
+	b.evictFiles()
+	b.mu.Unlock()
+	return b, nil
+}
+
+// AsPresigner forwards presigning to the wrapped backend. Blobs held in the local cache
+// are not presigned, so they keep being served from local disk.
+func (b *CachingBackend) AsPresigner() (Presigner, bool) {
+	inner, ok := AsPresigner(b.Backend)
+	if !ok {
+		return nil, false
+	}
+	return &cachingPresigner{Presigner: inner, cache: b}, true
+}
+
+// AsMultipartUploader forwards multipart uploads to the wrapped backend, the assembled
+// object invalidated like any other write
+func (b *CachingBackend) AsMultipartUploader() (MultipartUploader, bool) {
+	inner, ok := AsMultipartUploader(b.Backend)
+	if !ok {
+		return nil, false
+	}
+	return &cachingMultipartUploader{MultipartUploader: inner, cache: b}, true
+}
+
+// SetPublisher sets the function telling other replicas that a path changed
+func (b *CachingBackend) SetPublisher(publish func(path string)) {
+	b.publish = publish
+}
+
+// Invalidate drops a path from the caches. A path ending with "/" drops everything below it.
+func (b *CachingBackend) Invalidate(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.generation++
+
+	if dir, ok := strings.CutSuffix(path, "/"); ok {
+		dir = filepath.Clean(dir) + string(filepath.Separator)
+		for key, el := range b.entryIndex {
+			if strings.HasPrefix(key, dir) {
+				b.removeEntry(el)
+			}
+		}
+		for key, el := range b.fileIndex {
+			if strings.HasPrefix(key, dir) {
+				b.removeFile(el)
+			}
+		}
+		return
+	}
+
+	path = filepath.Clean(path)
+	if el, ok := b.entryIndex[path]; ok {
+		b.removeEntry(el)
+	}
+	if el, ok := b.fileIndex[path]; ok {
+		b.removeFile(el)
+	}
+	// Directories may have been created or emptied
+	for dir := filepath.Dir(path); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if el, ok := b.entryIndex[dir]; ok {
+			b.removeEntry(el)
+		}
+	}
+}
+
+func (b *CachingBackend) Read(path string) ([]byte, error) {
+	path = filepath.Clean(path)
+	if !isCachedPath(path) {
+		return b.Backend.Read(path)
+	}
+	if isBlobPath(path) {
+		if data, ok := b.readFile(path); ok {
+			return data, nil
+		}
+	}
+	if e, ok := b.lookup(path); ok {
+		if !e.exists {
+			return nil, &fs.PathError{Op: "read", Path: path, Err: fs.ErrNotExist}
+		}
+		if e.data != nil {
+			return bytes.Clone(e.data), nil
+		}
+	}
+
+	gen := b.currentGeneration()
+	data, err := b.Backend.Read(path)
+	if err != nil {
+		b.rememberMissing(path, gen)
+		return nil, err
+	}
+	entry := &cachedEntry{path: path, exists: true, size: int64(len(data))}
+	if isBlobPath(path) {
+		b.storeFile(path, data, gen)
+	} else if len(data) <= maxCachedObjectSize {
+		entry.data = bytes.Clone(data)
+	}
+	b.remember(entry, gen)
+	return data, nil
+}
+
+func (b *CachingBackend) ReadStream(path string) (io.ReadCloser, error) {
+	path = filepath.Clean(path)
+	if !isCachedPath(path) {
+		return b.Backend.ReadStream(path)
+	}
+	if !isBlobPath(path) {
+		if e, ok := b.lookup(path); ok {
+			if !e.exists {
+				return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+			}
+			if e.data != nil {
+				return io.NopCloser(bytes.NewReader(e.data)), nil
+			}
+		}
+		return b.Backend.ReadStream(path)
+	}
+
+	if f, ok := b.openFile(path); ok {
+		return f, nil
+	}
+	gen := b.currentGeneration()
+	reader, err := b.Backend.ReadStream(path)
+	if err != nil {
+		return nil, err
+	}
+	// Kept in the cache once read to the end
+	tmp, err := os.CreateTemp(b.dir, cacheDownloadPrefix+"*")
+	if err != nil {
+		return reader, nil
+	}
+	return &cachingReader{ReadCloser: reader, backend: b, path: path, generation: gen, tmp: tmp}, nil
+}
+
+func (b *CachingBackend) Exists(path string) (bool, error) {
+	path = filepath.Clean(path)
+	if !isCachedPath(path) {
+		return b.Backend.Exists(path)
+	}
+	if b.hasFile(path) {
+		return true, nil
+	}
+	if e, ok := b.lookup(path); ok {
+		return e.exists, nil
+	}
+
+	gen := b.currentGeneration()
+	exists, err := b.Backend.Exists(path)
+	// Blobs may be pushed by another replica any time: only metadata misses are cached
+	if err == nil && (exists || !isBlobPath(path)) {
+		b.remember(&cachedEntry{path: path, exists: exists, size: -1}, gen)
+	}
+	return exists, err
+}
+
+func (b *CachingBackend) Stat(path string) (*FileInfo, error) {
+	path = filepath.Clean(path)
+	if !isCachedPath(path) {
+		return b.Backend.Stat(path)
+	}
+	if size, ok := b.fileSize(path); ok {
+		return &FileInfo{Name: filepath.Base(path), Size: size}, nil
+	}
+	if e, ok := b.lookup(path); ok {
+		if !e.exists {
+			return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+		}
+		if e.size >= 0 {
+			return &FileInfo{Name: filepath.Base(path), Size: e.size}, nil
+		}
+	}
+
+	gen := b.currentGeneration()
+	info, err := b.Backend.Stat(path)
+	if err != nil {
+		b.rememberMissing(path, gen)
+		return nil, err
+	}
+	if !info.IsDir {
+		b.remember(&cachedEntry{path: path, exists: true, size: info.Size}, gen)
+	}
+	return info, nil
+}
+
+func (b *CachingBackend) Write(path string, data []byte) error {
+	err := b.Backend.Write(path, data)
+	b.invalidate(path)
+	return err
+}
+
+func (b *CachingBackend) WriteStream(path string, reader io.Reader) (int64, error) {
+	written, err := b.Backend.WriteStream(path, reader)
+	b.invalidate(path)
+	return written, err
+}
+
+func (b *CachingBackend) Delete(path string) error {
+	err := b.Backend.Delete(path)
+	b.invalidate(path)
+	return err
+}
+
+func (b *CachingBackend) Rename(src, dst string) error {
+	err := b.Backend.Rename(src, dst)
+	b.invalidate(src)
+	b.invalidate(dst)
+	return err
+}
+
+func (b *CachingBackend) Import(localPath, storagePath string) error {
+	err := b.Backend.Import(localPath, storagePath)
+	b.invalidate(storagePath)
+	return err
+}
+
+func (b *CachingBackend) RemoveAll(path string) error {
+	err := b.Backend.RemoveAll(path)
+	b.invalidate(path)
+	b.invalidate(filepath.Clean(path) + "/")
+	return err
+}
+
+// invalidate drops a path from the local caches and from those of other replicas
+func (b *CachingBackend) invalidate(path string) {
+	if !strings.HasSuffix(path, "/") {
+		path = filepath.Clean(path)
+	}
+	b.Invalidate(path)
+	if b.publish != nil && (strings.HasSuffix(path, "/") || isCachedPath(path)) {
+		b.publish(filepath.ToSlash(path))
+	}
+}
+
+// isBlobPath reports whether a path holds a blob, in either layout
+func isBlobPath(path string) bool {
+	p := filepath.ToSlash(path)
+	return strings.HasPrefix(p, "blobs/") && !strings.HasPrefix(filepath.Base(p), ".")
+}
+
+// isCachedPath reports whether a path is cached: blobs, manifests, tag metadata and index.yaml.
+// Other state (upload sessions, cache metadata, queues) is rewritten under locks and always read through.
+func isCachedPath(path string) bool {
+	p := filepath.ToSlash(path)
+	return isBlobPath(p) || p == "index.yaml" || strings.HasPrefix(p, "images/") || strings.HasPrefix(p, "manifests/")
+}
+
+func (b *CachingBackend) currentGeneration() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.generation
+}
+
+// lookup returns the entry of a path unless it expired
+func (b *CachingBackend) lookup(path string) (*cachedEntry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	el, ok := b.entryIndex[path]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cachedEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		b.removeEntry(el)
+		return nil, false
+	}
+	b.entries.MoveToFront(el)
+	return e, true
+}
+
+// remember caches an entry, unless the path was invalidated since gen was read
+func (b *CachingBackend) remember(e *cachedEntry, gen uint64) {
+	if !isBlobPath(e.path) {
+		// Metadata may be rewritten by another replica: trust it for the TTL at most
+		e.expires = time.Now().Add(b.ttl)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.generation {
+		return
+	}
+	if el, ok := b.entryIndex[e.path]; ok {
+		b.removeEntry(el)
+	}
+	b.entryIndex[e.path] = b.entries.PushFront(e)
+	b.memoryBytes += entryCost(e)
+	for b.memoryBytes > b.maxMemoryBytes && b.entries.Len() > 0 {
+		b.removeEntry(b.entries.Back())
+	}
+}
+
+// rememberMissing caches that a metadata path does not exist, once the backend confirms it
+func (b *CachingBackend) rememberMissing(path string, gen uint64) {
+	if isBlobPath(path) {
+		return
+	}
+	if exists, err := b.Backend.Exists(path); err == nil && !exists {
+		b.remember(&cachedEntry{path: path, size: -1}, gen)
+	}
+}
+
+func (b *CachingBackend) removeEntry(el *list.Element) {
+	e := b.entries.Remove(el).(*cachedEntry)
+	delete(b.entryIndex, e.path)
+	b.memoryBytes -= entryCost(e)
+}
+
+func entryCost(e *cachedEntry) int64 {
+	return int64(len(e.path)+len(e.data)) + cachedEntryOverhead
+}
+
+func (b *CachingBackend) localPath(path string) string {
+	return filepath.Join(b.dir, path)
+}
+
+func (b *CachingBackend) hasFile(path string) bool {
+	_, ok := b.fileSize(path)
+	return ok
+}
+
+func (b *CachingBackend) fileSize(path string) (int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	el, ok := b.fileIndex[path]
+	if !ok {
+		return 0, false
+	}
+	b.files.MoveToFront(el)
+	return el.Value.(*cachedFile).size, true
+}
+
+// readFile returns a cached blob, dropping it if the file went missing
+func (b *CachingBackend) readFile(path string) ([]byte, bool) {
+	if !b.hasFile(path) {
+		return nil, false
+	}
+	data, err := os.ReadFile(b.localPath(path))
+	if err != nil {
+		b.Invalidate(path)
+		return nil, false
+	}
+	return data, true
+}
+
+func (b *CachingBackend) openFile(path string) (*os.File, bool) {
+	if !b.hasFile(path) {
+		return nil, false
+	}
+	f, err := os.Open(b.localPath(path))
+	if err != nil {
+		b.Invalidate(path)
+		return nil, false
+	}
+	return f, true
+}
+
+// storeFile caches a blob read in full
+func (b *CachingBackend) storeFile(path string, data []byte, gen uint64) {
+	if int64(len(data)) > b.maxDiskBytes {
+		return
+	}
+	tmp, err := os.CreateTemp(b.dir, cacheDownloadPrefix+"*")
+	if err != nil {
+		return
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return
+	}
+	b.commitFile(path, tmp, int64(len(data)), gen)
+}
+
+// commitFile moves a complete download into the cache
+func (b *CachingBackend) commitFile(path string, tmp *os.File, size int64, gen uint64) {
+	tmp.Close()
+	target := b.localPath(path)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.generation {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if el, ok := b.fileIndex[path]; ok {
+		b.diskBytes -= el.Value.(*cachedFile).size
+		b.files.Remove(el)
+	}
+	b.fileIndex[path] = b.files.PushFront(&cachedFile{path: path, size: size})
+	b.diskBytes += size
+	b.evictFiles()
+}
+
+func (b *CachingBackend) removeFile(el *list.Element) {
+	f := b.files.Remove(el).(*cachedFile)
+	delete(b.fileIndex, f.path)
+	b.diskBytes -= f.size
+	// Readers holding the file open keep reading it
+	os.Remove(b.localPath(f.path))
+}
+
+func (b *CachingBackend) evictFiles() {
+	for b.diskBytes > b.maxDiskBytes && b.files.Len() > 0 {
+		b.removeFile(b.files.Back())
+	}
+}
+
+type cachingPresigner struct {
+	Presigner
+	cache *CachingBackend
+}
+
+func (p *cachingPresigner) PresignGet(path string, ttl time.Duration) (string, error) {
+	if p.cache.hasFile(filepath.Clean(path)) {
+		return "", nil
+	}
+	return p.Presigner.PresignGet(path, ttl)
+}
+
+type cachingMultipartUploader struct {
+	MultipartUploader
+	cache *CachingBackend
+}
+
+func (m *cachingMultipartUploader) CompleteMultipart(path, uploadID string, parts []CompletedPart) error {
+	err := m.MultipartUploader.CompleteMultipart(path, uploadID, parts)
+	m.cache.invalidate(path)
+	return err
+}
+
+// cachingReader streams a blob from the backend while copying it to the cache
+type cachingReader struct {
+	io.ReadCloser
+	backend    *CachingBackend
+	path       string
+	generation uint64
+	tmp        *os.File
+	written    int64
+}
+
+func (r *cachingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if r.tmp != nil && n > 0 {
+		if _, werr := r.tmp.Write(p[:n]); werr != nil || r.written+int64(n) > r.backend.maxDiskBytes {
+			r.discard()
+		} else {
+			r.written += int64(n)
+		}
+	}
+	if err == io.EOF {
+		r.commit()
+	}
+	return n, err
+}
+
+// Close drops the partial copy of a blob not read to the end. Readers stopping after
+// the announced size never see EOF: a blob fully read is still kept.
+func (r *cachingReader) Close() error {
+	if r.tmp != nil {
+		var probe [1]byte
+		if n, err := r.ReadCloser.Read(probe[:]); n == 0 && err == io.EOF {
+			r.commit()
+		}
+	}
+	r.discard()
+	return r.ReadCloser.Close()
+}
+
+func (r *cachingReader) commit() {
+	if r.tmp != nil {
+		r.backend.commitFile(r.path, r.tmp, r.written, r.generation)
+		r.tmp = nil
+	}
+}
+
+func (r *cachingReader) discard() {
+	if r.tmp != nil {
+		r.tmp.Close()
+		os.Remove(r.tmp.Name())
+		r.tmp = nil
+	}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"oci-storage/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// objectStore stands in for an object store backend that presigns and takes multipart uploads
+type objectStore struct {
+	Backend
+
+	mu    sync.Mutex
+	parts map[string][]byte
+}
+
+func (s *objectStore) PresignGet(path string, ttl time.Duration) (string, error) {
+	return "https://bucket.example/" + path, nil
+}
+
+func (s *objectStore) PartSize() int64 { return 5 << 20 }
+
+func (s *objectStore) CreateMultipart(path string) (string, error) { return "upload-1", nil }
+
+func (s *objectStore) UploadPart(path, uploadID string, number int, data []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parts[path] = append(s.parts[path], data...)
+	return "etag", nil
+}
+
+func (s *objectStore) CompleteMultipart(path, uploadID string, parts []CompletedPart) error {
+	s.mu.Lock()
+	data := s.parts[path]
+	delete(s.parts, path)
+	s.mu.Unlock()
+	return s.Backend.Write(path, data)
+}
+
+func (s *objectStore) AbortMultipart(path, uploadID string) error { return nil }
+
+func TestCachingBackend_ForwardsCapabilities(t *testing.T) {
+	store := &objectStore{Backend: NewLocalBackend(t.TempDir()), parts: make(map[string][]byte)}
+	cacheConfig := config.StorageCacheConfig{Enabled: true, MaxSizeGB: 1, MemoryMB: 1, TTLSeconds: 60}
+	cache, err := NewCachingBackend(store, cacheConfig, t.TempDir())
+	assert.NoError(t, err)
+	var published []string
+	cache.SetPublisher(func(path string) { published = append(published, path) })
+
+	// A wrapper above the cache does not hide it either
+	var backend Backend = NewLegacyBlobBackend(cache)
+
+	presigner, ok := AsPresigner(backend)
+	assert.True(t, ok)
+	uploader, ok := AsMultipartUploader(backend)
+	assert.True(t, ok)
+
+	// A multipart upload straight to a blob path is seen by the cache
+	blobPath := "blobs/sha256/ab/cd/abcd"
+	exists, err := backend.Exists(blobPath)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	uploadID, err := uploader.CreateMultipart(blobPath)
+	assert.NoError(t, err)
+	_, err = uploader.UploadPart(blobPath, uploadID, 1, []byte("layer"))
+	assert.NoError(t, err)
+	assert.NoError(t, uploader.CompleteMultipart(blobPath, uploadID, []CompletedPart{{Number: 1, ETag: "etag"}}))
+
+	exists, err = backend.Exists(blobPath)
+	assert.NoError(t, err)
+	assert.True(t, exists, "missing path still cached after the multipart upload")
+	assert.Contains(t, published, blobPath)
+
+	// Blobs are redirected to the bucket until they are cached locally
+	location, err := presigner.PresignGet(blobPath, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://bucket.example/"+blobPath, location)
+
+	reader, err := backend.ReadStream(blobPath)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, []byte("layer"), data)
+
+	location, err = presigner.PresignGet(blobPath, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, location)
+}
+
+func TestCachingBackend_NoCapabilitiesOfPlainBackend(t *testing.T) {
+	cacheConfig := config.StorageCacheConfig{Enabled: true, MaxSizeGB: 1, MemoryMB: 1, TTLSeconds: 60}
+	cache, err := NewCachingBackend(NewLocalBackend(t.TempDir()), cacheConfig, t.TempDir())
+	assert.NoError(t, err)
+
+	_, ok := AsPresigner(cache)
+	assert.False(t, ok)
+	_, ok = AsMultipartUploader(cache)
+	assert.False(t, ok)
+}
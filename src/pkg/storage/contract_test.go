@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBackendContract checks the behaviour every Backend shares. Objects are
+// written under a prefix unique to the run, removed when the test ends.
+func testBackendContract(t *testing.T, b Backend) {
+	root := fmt.Sprintf("contract-%d", time.Now().UnixNano())
+	t.Cleanup(func() { b.RemoveAll(root) })
+	at := func(path string) string { return root + "/" + path }
+
+	// Read, Write, Exists, Stat
+	_, err := b.Read(at("missing"))
+	assert.Error(t, err)
+	exists, err := b.Exists(at("missing"))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	objects := map[string][]byte{
+		"index.yaml":                   []byte("apiVersion: v1\n"),
+		"images/app/manifests/v1.json": []byte(`{"schemaVersion":2}`),
+		"images/app/tags/latest":       []byte("sha256:abcd"),
+		"blobs/sha256/ab/cd/abcd":      bytes.Repeat([]byte("layer"), 1000),
+	}
+	for path, data := range objects {
+		require.NoError(t, b.Write(at(path), data), path)
+	}
+	for path, data := range objects {
+		read, err := b.Read(at(path))
+		assert.NoError(t, err, path)
+		assert.Equal(t, data, read, path)
+		exists, err := b.Exists(at(path))
+		assert.NoError(t, err, path)
+		assert.True(t, exists, path)
+		info, err := b.Stat(at(path))
+		if assert.NoError(t, err, path) {
+			assert.Equal(t, int64(len(data)), info.Size, path)
+		}
+	}
+
+	// WriteStream and ReadStream
+	written, err := b.WriteStream(at("images/app/manifests/v2.json"), bytes.NewReader([]byte(`{"v":2}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), written)
+	reader, err := b.ReadStream(at("images/app/manifests/v2.json"))
+	if assert.NoError(t, err) {
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, `{"v":2}`, string(data))
+	}
+
+	// Rename replaces the destination and removes the source
+	assert.NoError(t, b.Write(at("images/app/tags/stable"), []byte("old")))
+	assert.NoError(t, b.Rename(at("images/app/tags/latest"), at("images/app/tags/stable")))
+	exists, err = b.Exists(at("images/app/tags/latest"))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	data, err := b.Read(at("images/app/tags/stable"))
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:abcd", string(data))
+
+	// ListIter reports files with their size and directories, not nested objects.
+	// Directory sizes are backend specific.
+	entries, err := b.List(at("images/app"))
+	assert.NoError(t, err)
+	var dirs []string
+	for _, entry := range entries {
+		assert.True(t, entry.IsDir, entry.Name)
+		dirs = append(dirs, entry.Name)
+	}
+	assert.ElementsMatch(t, []string{"manifests", "tags"}, dirs)
+	entries, err = b.List(at("images/app/manifests"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []FileInfo{
+		{Name: "v1.json", Size: int64(len(objects["images/app/manifests/v1.json"]))},
+		{Name: "v2.json", Size: 7},
+	}, entries)
+	var seen int
+	assert.NoError(t, b.ListIter(at("images/app/manifests"), func(FileInfo) error {
+		seen++
+		return fs.SkipAll
+	}))
+	assert.Equal(t, 1, seen)
+
+	// Walk reports every nested file relative to the backend root, no directories
+	walked := make(map[string]int64)
+	assert.NoError(t, b.Walk(root, func(path string, info FileInfo) error {
+		assert.False(t, info.IsDir, path)
+		assert.Equal(t, filepath.Base(path), info.Name)
+		walked[filepath.ToSlash(path)] = info.Size
+		return nil
+	}))
+	assert.Equal(t, map[string]int64{
+		at("index.yaml"):                   int64(len(objects["index.yaml"])),
+		at("images/app/manifests/v1.json"): int64(len(objects["images/app/manifests/v1.json"])),
+		at("images/app/manifests/v2.json"): 7,
+		at("images/app/tags/stable"):       int64(len("sha256:abcd")),
+		at("blobs/sha256/ab/cd/abcd"):      int64(len(objects["blobs/sha256/ab/cd/abcd"])),
+	}, walked)
+	seen = 0
+	assert.NoError(t, b.Walk(root, func(string, FileInfo) error {
+		seen++
+		return fs.SkipAll
+	}))
+	assert.Equal(t, 1, seen)
+	errStop := errors.New("stop")
+	err = b.Walk(root, func(string, FileInfo) error { return errStop })
+	assert.ErrorIs(t, err, errStop)
+
+	// Delete and RemoveAll
+	assert.NoError(t, b.Delete(at("index.yaml")))
+	exists, err = b.Exists(at("index.yaml"))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	assert.NoError(t, b.RemoveAll(at("images")))
+	walked = make(map[string]int64)
+	assert.NoError(t, b.Walk(root, func(path string, info FileInfo) error {
+		walked[filepath.ToSlash(path)] = info.Size
+		return nil
+	}))
+	assert.Equal(t, map[string]int64{
+		at("blobs/sha256/ab/cd/abcd"): int64(len(objects["blobs/sha256/ab/cd/abcd"])),
+	}, walked)
+}
+
+func TestLocalBackend_Contract(t *testing.T) {
+	testBackendContract(t, NewLocalBackend(t.TempDir()))
+}
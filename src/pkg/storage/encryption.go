@@ -0,0 +1,701 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// Encrypted objects start with a fixed size header, followed by the content split in
+// segments sealed separately, so multi-GB blobs are encrypted and decrypted as they stream:
+//
+//	header:  magic (8) | nonce prefix (7) | key id length (1) | key id | wrapped key length (2) | wrapped key | zero padding
+//	segment: AES-256-GCM of up to 64 KiB of content, nonce = prefix | segment number (4) | last segment flag (1)
+//
+// The last segment flag detects truncation, the segment number reordering. The fixed
+// header size gives the content size from the stored size alone.
+const (
+	encryptionMagic           = "\x00ocienc1"
+	encryptionHeaderSize      = 512
+	encryptionNoncePrefixSize = 7
+	encryptionSegmentSize     = 64 << 10
+	encryptionTagSize         = 16
+	encryptionDataKeySize     = 32
+	// encryptionKeyCacheSize bounds the unwrapped data keys kept to avoid KMS round trips
+	encryptionKeyCacheSize = 4096
+	// encryptionFormatCacheSize bounds the objects remembered as encrypted or not
+	encryptionFormatCacheSize = 100000
+)
+
+var (
+	// ErrNotEncrypted is returned when reading an object stored in plaintext once every object should be encrypted
+	ErrNotEncrypted = errors.New("object is not encrypted")
+	// ErrCorruptEncrypted is returned when an encrypted object fails authentication or is truncated
+	ErrCorruptEncrypted = errors.New("encrypted object is corrupt or truncated")
+)
+
+// EncryptingBackend encrypts objects at rest with envelope encryption: each object is
+// sealed with its own random data key, stored in the object header wrapped by a key of
+// the KeyWrapper. Rotating the wrapping key only rewrites headers (see Rewrap).
+//
+// It deliberately does not expose the wrapped backend: presigned URLs would hand out
+// ciphertext, and multipart uploads would bypass encryption.
+type EncryptingBackend struct {
+	Backend
+	keys              KeyWrapper
+	plaintextRejected atomic.Bool
+
+	mu       sync.Mutex
+	dataKeys map[string][]byte       // unwrapped data keys, by key id and wrapped key
+	formats  map[string]objectFormat // by path, while plaintext objects are allowed
+}
+
+// objectFormat records whether the object stored at a path with a given size is encrypted.
+// Other replicas only write encrypted objects, so a rewritten object is told apart by its size.
+type objectFormat struct {
+	storedSize int64
+	encrypted  bool
+}
+
+// encryptionHeader describes how an object is encrypted
+type encryptionHeader struct {
+	noncePrefix [encryptionNoncePrefixSize]byte
+	keyID       string
+	wrappedKey  []byte
+}
+
+// NewEncryptingBackend wraps a backend with encryption. Objects stored before encryption
+// was enabled are read as plaintext until RejectPlaintext is called.
+func NewEncryptingBackend(inner Backend, keys KeyWrapper) *EncryptingBackend {
+	return &EncryptingBackend{
+		Backend:  inner,
+		keys:     keys,
+		dataKeys: make(map[string][]byte),
+		formats:  make(map[string]objectFormat),
+	}
+}
+
+// RejectPlaintext makes objects stored without encryption unreadable, once all were encrypted
+func (b *EncryptingBackend) RejectPlaintext() {
+	b.plaintextRejected.Store(true)
+	b.mu.Lock()
+	clear(b.formats)
+	b.mu.Unlock()
+}
+
+// ActiveKeyID identifies the key wrapping the data keys of new objects
+func (b *EncryptingBackend) ActiveKeyID() string {
+	return b.keys.ActiveKeyID()
+}
+
+func (b *EncryptingBackend) Read(path string) ([]byte, error) {
+	data, err := b.Backend.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(encryptionMagic)) {
+		return b.plaintext(path, data)
+	}
+	header, err := parseEncryptionHeader(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r, err := b.newDecrypter(bytes.NewReader(data[encryptionHeaderSize:]), header)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return plain, nil
+}
+
+func (b *EncryptingBackend) ReadStream(path string) (io.ReadCloser, error) {
+	reader, header, closer, err := b.open(path)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		if b.plaintextRejected.Load() {
+			closer.Close()
+			return nil, fmt.Errorf("%s: %w", path, ErrNotEncrypted)
+		}
+		return readCloser{reader, closer}, nil
+	}
+	r, err := b.newDecrypter(reader, header)
+	if err != nil {
+		closer.Close()
+		return nil, err
+	}
+	return readCloser{r, closer}, nil
+}
+
+func (b *EncryptingBackend) Write(path string, data []byte) error {
+	var buf bytes.Buffer
+	buf.Grow(int(encryptedSize(int64(len(data)))))
+	w, err := b.newEncrypter(&buf)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	b.forgetFormat(path)
+	return b.Backend.Write(path, buf.Bytes())
+}
+
+// WriteStream encrypts the content as it is written, returning the content size
+func (b *EncryptingBackend) WriteStream(path string, reader io.Reader) (int64, error) {
+	pr, pw := io.Pipe()
+	var read int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w, err := b.newEncrypter(pw)
+		if err == nil {
+			read, err = io.Copy(w, reader)
+			if err == nil {
+				err = w.Close()
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+
+	b.forgetFormat(path)
+	_, err := b.Backend.WriteStream(path, pr)
+	// Unblocks the encryption if the backend stopped reading early
+	pr.CloseWithError(io.ErrClosedPipe)
+	<-done
+	return read, err
+}
+
+func (b *EncryptingBackend) Rename(src, dst string) error {
+	b.forgetFormat(src)
+	b.forgetFormat(dst)
+	return b.Backend.Rename(src, dst)
+}
+
+// Stat reports the content size of objects, encrypted or not
+func (b *EncryptingBackend) Stat(path string) (*FileInfo, error) {
+	info, err := b.Backend.Stat(path)
+	if err != nil || info.IsDir {
+		return info, err
+	}
+	size, err := b.contentSize(path, info.Size)
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{Name: info.Name, Size: size}, nil
+}
+
+// List reports content sizes; a listed object that cannot be sized keeps its stored size
+func (b *EncryptingBackend) List(dir string) ([]FileInfo, error) {
+	entries, err := b.Backend.List(dir)
+	for i := range entries {
+		entries[i] = b.listedInfo(filepath.Join(dir, entries[i].Name), entries[i])
+	}
+	return entries, err
+}
+
+func (b *EncryptingBackend) ListIter(dir string, fn func(FileInfo) error) error {
+	return b.Backend.ListIter(dir, func(info FileInfo) error {
+		return fn(b.listedInfo(filepath.Join(dir, info.Name), info))
+	})
+}
+
+func (b *EncryptingBackend) Walk(dir string, fn func(path string, info FileInfo) error) error {
+	return b.Backend.Walk(dir, func(path string, info FileInfo) error {
+		return fn(path, b.listedInfo(path, info))
+	})
+}
+
+// WalkStored walks objects with their stored sizes, without reading any header. The
+// rewrap uses it, as it reads every object anyway.
+func (b *EncryptingBackend) WalkStored(dir string, fn func(path string, info FileInfo) error) error {
+	return b.Backend.Walk(dir, fn)
+}
+
+// CreateTemp returns a temporary file encrypting what is written to it, so it can be renamed into place
+func (b *EncryptingBackend) CreateTemp(dir string) (TempFile, error) {
+	tmp, err := b.Backend.CreateTemp(dir)
+	if err != nil {
+		return nil, err
+	}
+	w, err := b.newEncrypter(tmp)
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	return &encryptingTempFile{TempFile: tmp, writer: w}, nil
+}
+
+// Import encrypts a local file into storage, then deletes it
+func (b *EncryptingBackend) Import(localPath, storagePath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteStream(storagePath, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(localPath)
+}
+
+// Rewrap makes an object readable with the active key only: the data key of an object
+// wrapped by a previous key is wrapped again, the content left as is, and an object
+// stored in plaintext is encrypted. It reports whether the object was rewritten.
+func (b *EncryptingBackend) Rewrap(path string) (bool, error) {
+	if !isBlobPath(path) {
+		return b.rewrapMutable(path)
+	}
+
+	// Blobs never change: stream them back in place
+	reader, header, closer, err := b.open(path)
+	if err != nil {
+		return false, err
+	}
+	defer closer.Close()
+	if header == nil {
+		_, err := b.WriteStream(path, reader)
+		return err == nil, err
+	}
+	if header.keyID == b.keys.ActiveKeyID() {
+		return false, nil
+	}
+	newHeader, err := b.rewrapHeader(header)
+	if err != nil {
+		return false, err
+	}
+	_, err = b.Backend.WriteStream(path, io.MultiReader(bytes.NewReader(newHeader), reader))
+	return err == nil, err
+}
+
+// rewrapMutable rewraps a small object that may be rewritten meanwhile, in which case
+// the new version, written with the active key, is kept
+func (b *EncryptingBackend) rewrapMutable(path string) (bool, error) {
+	stored, err := b.Backend.Read(path)
+	if err != nil {
+		return false, err
+	}
+
+	var rewritten []byte
+	if !bytes.HasPrefix(stored, []byte(encryptionMagic)) {
+		var buf bytes.Buffer
+		w, err := b.newEncrypter(&buf)
+		if err != nil {
+			return false, err
+		}
+		if _, err := w.Write(stored); err != nil {
+			return false, err
+		}
+		if err := w.Close(); err != nil {
+			return false, err
+		}
+		rewritten = buf.Bytes()
+	} else {
+		header, err := parseEncryptionHeader(stored)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", path, err)
+		}
+		if header.keyID == b.keys.ActiveKeyID() {
+			return false, nil
+		}
+		newHeader, err := b.rewrapHeader(header)
+		if err != nil {
+			return false, err
+		}
+		rewritten = append(newHeader, stored[encryptionHeaderSize:]...)
+	}
+
+	if current, err := b.Backend.Read(path); err != nil || !bytes.Equal(current, stored) {
+		return false, err
+	}
+	b.forgetFormat(path)
+	return true, b.Backend.Write(path, rewritten)
+}
+
+// rewrapHeader returns the header of an object with its data key wrapped by the active key
+func (b *EncryptingBackend) rewrapHeader(header *encryptionHeader) ([]byte, error) {
+	dataKey, err := b.unwrapKey(header)
+	if err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := b.keys.WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	// The nonce prefix is kept: the segments stay valid
+	rewrapped := &encryptionHeader{noncePrefix: header.noncePrefix, keyID: keyID, wrappedKey: wrapped}
+	return rewrapped.marshal()
+}
+
+// open opens an object, returning its header when encrypted. The reader is positioned after
+// the header of an encrypted object, at the start of a plaintext one.
+func (b *EncryptingBackend) open(path string) (*bufio.Reader, *encryptionHeader, io.Closer, error) {
+	stream, err := b.Backend.ReadStream(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	reader := bufio.NewReaderSize(stream, encryptionSegmentSize+encryptionTagSize)
+	peeked, _ := reader.Peek(encryptionHeaderSize)
+	if !bytes.HasPrefix(peeked, []byte(encryptionMagic)) {
+		return reader, nil, stream, nil
+	}
+	header, err := parseEncryptionHeader(peeked)
+	if err != nil {
+		stream.Close()
+		return nil, nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	reader.Discard(encryptionHeaderSize)
+	return reader, header, stream, nil
+}
+
+func (b *EncryptingBackend) plaintext(path string, data []byte) ([]byte, error) {
+	if b.plaintextRejected.Load() {
+		return nil, fmt.Errorf("%s: %w", path, ErrNotEncrypted)
+	}
+	return data, nil
+}
+
+// contentSize returns the content size of the object stored at path with the given size.
+// Once plaintext is rejected every object is encrypted; until then, whether an object is
+// encrypted is read from its header once per path and stored size.
+func (b *EncryptingBackend) contentSize(path string, stored int64) (int64, error) {
+	size, ok := decryptedSize(stored)
+	if !b.plaintextRejected.Load() {
+		if stored < encryptionHeaderSize+encryptionTagSize {
+			// Too small to be encrypted
+			return stored, nil
+		}
+		encrypted, err := b.isEncrypted(path, stored)
+		if err != nil {
+			return 0, err
+		}
+		if !encrypted {
+			return stored, nil
+		}
+	}
+	if !ok {
+		return 0, fmt.Errorf("%s: %w", path, ErrCorruptEncrypted)
+	}
+	return size, nil
+}
+
+// isEncrypted reports whether the object stored at path with the given size is encrypted
+func (b *EncryptingBackend) isEncrypted(path string, stored int64) (bool, error) {
+	key := filepath.ToSlash(filepath.Clean(path))
+	b.mu.Lock()
+	format, ok := b.formats[key]
+	b.mu.Unlock()
+	if ok && format.storedSize == stored {
+		return format.encrypted, nil
+	}
+
+	_, header, closer, err := b.open(path)
+	if err != nil {
+		return false, err
+	}
+	closer.Close()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.formats) >= encryptionFormatCacheSize {
+		clear(b.formats)
+	}
+	b.formats[key] = objectFormat{storedSize: stored, encrypted: header != nil}
+	return header != nil, nil
+}
+
+// forgetFormat drops what is known of an object about to be rewritten
+func (b *EncryptingBackend) forgetFormat(path string) {
+	b.mu.Lock()
+	delete(b.formats, filepath.ToSlash(filepath.Clean(path)))
+	b.mu.Unlock()
+}
+
+// listedInfo reports the content size of a listed object
+func (b *EncryptingBackend) listedInfo(path string, info FileInfo) FileInfo {
+	if !info.IsDir {
+		if size, err := b.contentSize(path, info.Size); err == nil {
+			info.Size = size
+		}
+	}
+	return info
+}
+
+// newEncrypter writes the header of a new object to w, then encrypts what is written
+func (b *EncryptingBackend) newEncrypter(w io.Writer) (io.WriteCloser, error) {
+	dataKey := make([]byte, encryptionDataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	header := &encryptionHeader{}
+	if _, err := rand.Read(header.noncePrefix[:]); err != nil {
+		return nil, err
+	}
+	var err error
+	header.keyID, header.wrappedKey, err = b.keys.WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := header.marshal()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(encoded); err != nil {
+		return nil, err
+	}
+	return &segmentWriter{dst: w, aead: aead, header: header, buf: make([]byte, 0, encryptionSegmentSize)}, nil
+}
+
+func (b *EncryptingBackend) newDecrypter(r io.Reader, header *encryptionHeader) (io.Reader, error) {
+	dataKey, err := b.unwrapKey(header)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, encryptionSegmentSize+encryptionTagSize)
+	}
+	return &segmentReader{src: br, aead: aead, header: header, in: make([]byte, encryptionSegmentSize+encryptionTagSize)}, nil
+}
+
+func (b *EncryptingBackend) unwrapKey(header *encryptionHeader) ([]byte, error) {
+	cacheKey := header.keyID + "\x00" + string(header.wrappedKey)
+	b.mu.Lock()
+	dataKey, ok := b.dataKeys[cacheKey]
+	b.mu.Unlock()
+	if ok {
+		return dataKey, nil
+	}
+
+	dataKey, err := b.keys.UnwrapKey(header.keyID, header.wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	if len(b.dataKeys) >= encryptionKeyCacheSize {
+		clear(b.dataKeys)
+	}
+	b.dataKeys[cacheKey] = dataKey
+	b.mu.Unlock()
+	return dataKey, nil
+}
+
+func (h *encryptionHeader) marshal() ([]byte, error) {
+	if len(h.keyID) > math.MaxUint8 {
+		return nil, fmt.Errorf("key id %q too long", h.keyID)
+	}
+	buf := make([]byte, 0, encryptionHeaderSize)
+	buf = append(buf, encryptionMagic...)
+	buf = append(buf, h.noncePrefix[:]...)
+	buf = append(buf, byte(len(h.keyID)))
+	buf = append(buf, h.keyID...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(h.wrappedKey)))
+	buf = append(buf, h.wrappedKey...)
+	if len(buf) > encryptionHeaderSize {
+		return nil, fmt.Errorf("wrapped data key of %d bytes does not fit the header", len(h.wrappedKey))
+	}
+	return buf[:encryptionHeaderSize], nil
+}
+
+func parseEncryptionHeader(data []byte) (*encryptionHeader, error) {
+	if len(data) < encryptionHeaderSize {
+		return nil, ErrCorruptEncrypted
+	}
+	h := &encryptionHeader{}
+	rest := data[len(encryptionMagic):encryptionHeaderSize]
+	copy(h.noncePrefix[:], rest)
+	rest = rest[encryptionNoncePrefixSize:]
+	keyIDLen := int(rest[0])
+	if len(rest) < 1+keyIDLen+2 {
+		return nil, ErrCorruptEncrypted
+	}
+	h.keyID = string(rest[1 : 1+keyIDLen])
+	rest = rest[1+keyIDLen:]
+	wrappedLen := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+wrappedLen {
+		return nil, ErrCorruptEncrypted
+	}
+	h.wrappedKey = bytes.Clone(rest[2 : 2+wrappedLen])
+	return h, nil
+}
+
+// additionalData authenticates the magic and nonce prefix with every segment
+func (h *encryptionHeader) additionalData() []byte {
+	return append([]byte(encryptionMagic), h.noncePrefix[:]...)
+}
+
+func (h *encryptionHeader) nonce(segment uint32, last bool) []byte {
+	nonce := make([]byte, 0, encryptionNoncePrefixSize+5)
+	nonce = append(nonce, h.noncePrefix[:]...)
+	nonce = binary.BigEndian.AppendUint32(nonce, segment)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// encryptedSize returns the stored size of content of the given size
+func encryptedSize(size int64) int64 {
+	segments := max(1, (size+encryptionSegmentSize-1)/encryptionSegmentSize)
+	return encryptionHeaderSize + size + segments*encryptionTagSize
+}
+
+// decryptedSize returns the content size of an encrypted object of the given stored size
+func decryptedSize(stored int64) (int64, bool) {
+	body := stored - encryptionHeaderSize
+	if body < encryptionTagSize {
+		return 0, false
+	}
+	const sealed = encryptionSegmentSize + encryptionTagSize
+	segments := (body + sealed - 1) / sealed
+	if body-(segments-1)*sealed < encryptionTagSize {
+		return 0, false
+	}
+	return body - segments*encryptionTagSize, true
+}
+
+// segmentWriter seals content segment by segment. The last segment, possibly empty,
+// is only written on Close.
+type segmentWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	header  *encryptionHeader
+	buf     []byte
+	segment uint32
+	out     []byte
+}
+
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(w.buf) == encryptionSegmentSize {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):encryptionSegmentSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *segmentWriter) Close() error {
+	return w.flush(true)
+}
+
+func (w *segmentWriter) flush(last bool) error {
+	if w.segment == math.MaxUint32 {
+		return errors.New("object too large to encrypt")
+	}
+	w.out = w.aead.Seal(w.out[:0], w.header.nonce(w.segment, last), w.buf, w.header.additionalData())
+	w.segment++
+	w.buf = w.buf[:0]
+	_, err := w.dst.Write(w.out)
+	return err
+}
+
+// segmentReader opens the segments written by segmentWriter
+type segmentReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	header  *encryptionHeader
+	in      []byte
+	plain   []byte
+	segment uint32
+	done    bool
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *segmentReader) next() error {
+	n, err := io.ReadFull(r.src, r.in)
+	last := false
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		last = true
+	case err == io.EOF:
+		// The segment flagged last is missing
+		return ErrCorruptEncrypted
+	case err != nil:
+		return err
+	default:
+		if _, err := r.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	plain, err := r.aead.Open(r.in[:0], r.header.nonce(r.segment, last), r.in[:n], r.header.additionalData())
+	if err != nil {
+		return ErrCorruptEncrypted
+	}
+	r.plain = plain
+	r.segment++
+	r.done = last
+	return nil
+}
+
+// encryptingTempFile encrypts what is written to a temporary file
+type encryptingTempFile struct {
+	TempFile
+	writer io.WriteCloser
+}
+
+func (f *encryptingTempFile) Write(p []byte) (int, error) {
+	return f.writer.Write(p)
+}
+
+func (f *encryptingTempFile) Close() error {
+	err := f.writer.Close()
+	if closeErr := f.TempFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// readCloser reads from a reader and closes the stream it reads from
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
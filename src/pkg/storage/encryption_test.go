@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testKeyring writes a key file holding the given key ids, the first one active
+func testKeyring(t *testing.T, ids ...string) *FileKeyring {
+	var lines []string
+	for _, id := range ids {
+		key := sha256.Sum256([]byte("test key " + id))
+		lines = append(lines, id+" "+base64.StdEncoding.EncodeToString(key[:]))
+	}
+	path := filepath.Join(t.TempDir(), "keys")
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600))
+	k, err := NewFileKeyring(path)
+	assert.NoError(t, err)
+	return k
+}
+
+// streamCounter counts the objects opened on the wrapped backend
+type streamCounter struct {
+	Backend
+	mu      sync.Mutex
+	streams int
+}
+
+func (b *streamCounter) ReadStream(path string) (io.ReadCloser, error) {
+	b.mu.Lock()
+	b.streams++
+	b.mu.Unlock()
+	return b.Backend.ReadStream(path)
+}
+
+func (b *streamCounter) Streams() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.streams
+}
+
+func TestEncryptingBackend_EncryptsAtRestAndRotatesKeys(t *testing.T) {
+	dir := t.TempDir()
+	local := NewLocalBackend(dir)
+	stored := func(path string) []byte {
+		data, err := os.ReadFile(filepath.Join(dir, path))
+		assert.NoError(t, err)
+		return data
+	}
+
+	// Blob stored before encryption was enabled
+	legacy := []byte("stored in plaintext")
+	legacyPath := "blobs/sha256/00/00/0000legacy"
+	assert.NoError(t, local.Write(legacyPath, legacy))
+
+	encrypting := NewEncryptingBackend(local, testKeyring(t, "v1"))
+
+	// A layer spanning several segments, imported as pulls and pushes do
+	layer := make([]byte, 200*1024+7)
+	for i := range layer {
+		layer[i] = byte(i * 31)
+	}
+	layerPath := "blobs/sha256/00/00/0000layer"
+	upload := filepath.Join(t.TempDir(), "upload")
+	assert.NoError(t, os.WriteFile(upload, layer, 0644))
+	assert.NoError(t, encrypting.Import(upload, layerPath))
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	manifestPath := "images/app/manifests/v1.json"
+	assert.NoError(t, encrypting.Write(manifestPath, manifest))
+
+	// Contents are encrypted at rest and read in clear, with their content size
+	assert.False(t, bytes.Contains(stored(layerPath), layer[:1024]))
+	assert.False(t, bytes.Contains(stored(manifestPath), []byte("schemaVersion")))
+	for path, content := range map[string][]byte{layerPath: layer, manifestPath: manifest, legacyPath: legacy} {
+		data, err := encrypting.Read(path)
+		assert.NoError(t, err, path)
+		assert.Equal(t, content, data, path)
+
+		reader, err := encrypting.ReadStream(path)
+		assert.NoError(t, err, path)
+		data, err = io.ReadAll(reader)
+		reader.Close()
+		assert.NoError(t, err, path)
+		assert.Equal(t, content, data, path)
+
+		info, err := encrypting.Stat(path)
+		assert.NoError(t, err, path)
+		assert.Equal(t, int64(len(content)), info.Size, path)
+	}
+
+	// Rotation: the new key encrypts, the previous one still decrypts
+	encrypting = NewEncryptingBackend(local, testKeyring(t, "v2", "v1"))
+	data, err := encrypting.Read(layerPath)
+	assert.NoError(t, err)
+	assert.Equal(t, layer, data)
+
+	for _, path := range []string{layerPath, manifestPath, legacyPath} {
+		rewritten, err := encrypting.Rewrap(path)
+		assert.NoError(t, err, path)
+		assert.True(t, rewritten, path)
+	}
+	rewritten, err := encrypting.Rewrap(layerPath)
+	assert.NoError(t, err)
+	assert.False(t, rewritten, "already wrapped by the active key")
+
+	// Once rewrapped, the previous key can be dropped and plaintext rejected
+	encrypting = NewEncryptingBackend(local, testKeyring(t, "v2"))
+	encrypting.RejectPlaintext()
+	for path, content := range map[string][]byte{layerPath: layer, manifestPath: manifest, legacyPath: legacy} {
+		data, err := encrypting.Read(path)
+		assert.NoError(t, err, path)
+		assert.Equal(t, content, data, path)
+	}
+	assert.NoError(t, local.Write("images/app/tags/planted.json", []byte(`{}`)))
+	_, err = encrypting.Read("images/app/tags/planted.json")
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+	_, err = encrypting.ReadStream("images/app/tags/planted.json")
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+
+	// Tampered and truncated contents are refused
+	sealed := stored(layerPath)
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)/2] ^= 1
+	assert.NoError(t, local.Write(layerPath, tampered))
+	_, err = encrypting.Read(layerPath)
+	assert.ErrorIs(t, err, ErrCorruptEncrypted)
+	// Cut after the first 64 KiB segment
+	assert.NoError(t, local.Write(layerPath, sealed[:512+64*1024+16]))
+	_, err = encrypting.Read(layerPath)
+	assert.ErrorIs(t, err, ErrCorruptEncrypted)
+}
+
+func TestEncryptingBackend_SizesPlaintextObjects(t *testing.T) {
+	inner := &streamCounter{Backend: NewLocalBackend(t.TempDir())}
+	encrypting := NewEncryptingBackend(inner, testKeyring(t, "v1"))
+
+	// A plaintext object as large as an encrypted one of 1000 bytes
+	plain := bytes.Repeat([]byte("p"), int(encryptedSize(1000)))
+	assert.NoError(t, inner.Write("blobs/sha256/aa/aa/aaaa", plain))
+	sealed := bytes.Repeat([]byte("e"), 1000)
+	assert.NoError(t, encrypting.Write("blobs/sha256/bb/bb/bbbb", sealed))
+	assert.NoError(t, inner.Write("blobs/sha256/cc/cc/cccc", []byte("small")))
+
+	want := map[string]int64{
+		"blobs/sha256/aa/aa/aaaa": int64(len(plain)),
+		"blobs/sha256/bb/bb/bbbb": int64(len(sealed)),
+		"blobs/sha256/cc/cc/cccc": 5,
+	}
+	walked := make(map[string]int64)
+	assert.NoError(t, encrypting.Walk("blobs", func(path string, info FileInfo) error {
+		walked[filepath.ToSlash(path)] = info.Size
+		return nil
+	}))
+	assert.Equal(t, want, walked)
+
+	// Each object was opened once to tell whether it is encrypted; small ones never
+	opened := inner.Streams()
+	assert.Equal(t, 2, opened)
+	for path, size := range want {
+		info, err := encrypting.Stat(path)
+		assert.NoError(t, err, path)
+		assert.Equal(t, size, info.Size, path)
+	}
+	entries, err := encrypting.List("blobs/sha256/aa/aa")
+	assert.NoError(t, err)
+	assert.Equal(t, []FileInfo{{Name: "aaaa", Size: int64(len(plain))}}, entries)
+	assert.NoError(t, encrypting.ListIter("blobs/sha256/bb/bb", func(info FileInfo) error {
+		assert.Equal(t, int64(len(sealed)), info.Size)
+		return nil
+	}))
+	assert.Equal(t, opened, inner.Streams())
+
+	// Encrypting an object replaces what was known of it
+	rewritten, err := encrypting.Rewrap("blobs/sha256/aa/aa/aaaa")
+	assert.NoError(t, err)
+	assert.True(t, rewritten)
+	info, err := encrypting.Stat("blobs/sha256/aa/aa/aaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(plain)), info.Size)
+
+	// Once plaintext is rejected, sizes come from stored sizes alone
+	encrypting.RejectPlaintext()
+	opened = inner.Streams()
+	info, err = encrypting.Stat("blobs/sha256/bb/bb/bbbb")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(sealed)), info.Size)
+	assert.Equal(t, opened, inner.Streams())
+}
@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"oci-storage/config"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// GCSBackend implements Backend using Google Cloud Storage.
+// Also works with fake-gcs-server through config.GCSConfig.Endpoint.
+type GCSBackend struct {
+	client *gcs.Client
+	bucket *gcs.BucketHandle
+	// publicURL is the host signed URLs point at (nil: storage.googleapis.com)
+	publicURL *url.URL
+	// localTempDir is used for CreateTemp (chunked uploads need local staging)
+	localTempDir string
+}
+
+// NewGCSBackend creates a GCS storage backend from config. Without a credentials
+// file, Application Default Credentials are used (GKE workload identity).
+func NewGCSBackend(cfg config.GCSConfig, localTempDir string) (*GCSBackend, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("GCS bucket name is not configured")
+	}
+
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+		if cfg.CredentialsFile == "" {
+			// Emulators don't authenticate requests
+			opts = append(opts, option.WithoutAuthentication())
+		}
+	}
+
+	client, err := gcs.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	var publicURL *url.URL
+	if cfg.PublicEndpoint != "" {
+		if publicURL, err = url.Parse(cfg.PublicEndpoint); err != nil || publicURL.Host == "" {
+			client.Close()
+			return nil, fmt.Errorf("invalid GCS public endpoint %q", cfg.PublicEndpoint)
+		}
+	}
+
+	// Verify bucket exists
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bucket := client.Bucket(cfg.Bucket)
+	if _, err := bucket.Attrs(ctx); err != nil {
+		client.Close()
+		if errors.Is(err, gcs.ErrBucketNotExist) {
+			return nil, fmt.Errorf("bucket %s does not exist", cfg.Bucket)
+		}
+		return nil, fmt.Errorf("failed to access bucket %s: %w", cfg.Bucket, err)
+	}
+
+	// Ensure local temp dir exists for chunked uploads
+	if err := os.MkdirAll(localTempDir, 0755); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	return &GCSBackend{
+		client:       client,
+		bucket:       bucket,
+		publicURL:    publicURL,
+		localTempDir: localTempDir,
+	}, nil
+}
+
+// PresignGet returns a V4 signed GET URL for an object. Signing needs a service
+// account key or the IAM signBlob permission for the workload identity.
+func (b *GCSBackend) PresignGet(path string, ttl time.Duration) (string, error) {
+	opts := &gcs.SignedURLOptions{
+		Scheme:  gcs.SigningSchemeV4,
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(ttl),
+	}
+	if b.publicURL != nil {
+		opts.Hostname = b.publicURL.Host
+		opts.Insecure = b.publicURL.Scheme == "http"
+	}
+	return b.bucket.SignedURL(objectKey(path), opts)
+}
+
+func (b *GCSBackend) object(path string) *gcs.ObjectHandle {
+	return b.bucket.Object(objectKey(path))
+}
+
+func (b *GCSBackend) Read(path string) ([]byte, error) {
+	r, err := b.object(path).NewReader(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (b *GCSBackend) Write(path string, data []byte) error {
+	w := b.object(path).NewWriter(context.Background())
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (b *GCSBackend) WriteStream(path string, reader io.Reader) (int64, error) {
+	// The writer uploads in chunks as data arrives; cancelling its context aborts the upload
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := b.object(path).NewWriter(ctx)
+	written, err := io.Copy(w, reader)
+	if err != nil {
+		cancel()
+		w.Close()
+		return written, err
+	}
+	return written, w.Close()
+}
+
+func (b *GCSBackend) Exists(path string) (bool, error) {
+	_, err := b.object(path).Attrs(context.Background())
+	if err != nil {
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *GCSBackend) Stat(path string) (*FileInfo, error) {
+	attrs, err := b.object(path).Attrs(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{
+		Name: filepath.Base(attrs.Name),
+		Size: attrs.Size,
+	}, nil
+}
+
+func (b *GCSBackend) Delete(path string) error {
+	return b.object(path).Delete(context.Background())
+}
+
+func (b *GCSBackend) List(dir string) ([]FileInfo, error) {
+	var result []FileInfo
+	err := b.ListIter(dir, func(info FileInfo) error {
+		result = append(result, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListIter uses a "/" delimiter; the object iterator fetches pages lazily
+func (b *GCSBackend) ListIter(dir string, fn func(FileInfo) error) error {
+	prefix := objectPrefix(dir)
+	query := &gcs.Query{Prefix: prefix, Delimiter: "/"}
+	if err := query.SetAttrSelection([]string{"Name", "Size"}); err != nil {
+		return err
+	}
+
+	it := b.bucket.Objects(context.Background(), query)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var info FileInfo
+		if attrs.Prefix != "" {
+			// Synthetic prefix = "directory"
+			info = FileInfo{Name: trimDirName(attrs.Prefix, prefix), IsDir: true}
+		} else {
+			info = FileInfo{Name: attrs.Name[len(prefix):], Size: attrs.Size}
+		}
+		if info.Name == "" {
+			continue
+		}
+		if err := fn(info); err != nil {
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (b *GCSBackend) Walk(dir string, fn func(path string, info FileInfo) error) error {
+	query := &gcs.Query{Prefix: objectPrefix(dir)}
+	if err := query.SetAttrSelection([]string{"Name", "Size"}); err != nil {
+		return err
+	}
+
+	it := b.bucket.Objects(context.Background(), query)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if isDirMarker(attrs.Name) {
+			continue
+		}
+		if err := fn(filepath.FromSlash(attrs.Name), FileInfo{Name: baseName(attrs.Name), Size: attrs.Size}); err != nil {
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (b *GCSBackend) ReadStream(path string) (io.ReadCloser, error) {
+	return b.object(path).NewReader(context.Background())
+}
+
+func (b *GCSBackend) Rename(src, dst string) error {
+	// GCS has no rename - server-side copy then delete
+	ctx := context.Background()
+	if _, err := b.object(dst).CopierFrom(b.object(src)).Run(ctx); err != nil {
+		return fmt.Errorf("GCS copy failed: %w", err)
+	}
+	return b.object(src).Delete(ctx)
+}
+
+func (b *GCSBackend) CreateTemp(dir string) (TempFile, error) {
+	// Chunked uploads stage locally, then get uploaded to GCS on CompleteUpload
+	f, err := os.CreateTemp(b.localTempDir, ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	return &localTempFile{file: f}, nil
+}
+
+func (b *GCSBackend) Import(localPath, storagePath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open local file for import: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := b.WriteStream(storagePath, file); err != nil {
+		return fmt.Errorf("GCS upload failed: %w", err)
+	}
+	return os.Remove(localPath)
+}
+
+func (b *GCSBackend) RemoveAll(path string) error {
+	return b.Walk(path, func(objectPath string, _ FileInfo) error {
+		if err := b.Delete(objectPath); err != nil && !errors.Is(err, gcs.ErrObjectNotExist) {
+			return fmt.Errorf("failed to delete object %s: %w", objectKey(objectPath), err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"oci-storage/config"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+// Runs against fake-gcs-server when GCS_EMULATOR_ENDPOINT is set, e.g.
+//
+//	docker run -p 4443:4443 fsouza/fake-gcs-server -scheme http
+//	GCS_EMULATOR_ENDPOINT=http://localhost:4443/storage/v1/ go test ./pkg/storage -run GCS
+func TestGCSBackend_Contract(t *testing.T) {
+	endpoint := os.Getenv("GCS_EMULATOR_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("GCS_EMULATOR_ENDPOINT not set")
+	}
+
+	// The backend expects the bucket to exist
+	bucket := fmt.Sprintf("oci-storage-test-%d", time.Now().UnixNano())
+	client, err := gcs.NewClient(context.Background(), option.WithEndpoint(endpoint), option.WithoutAuthentication())
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Bucket(bucket).Create(context.Background(), "test", nil))
+
+	backend, err := NewGCSBackend(config.GCSConfig{Bucket: bucket, Endpoint: endpoint}, t.TempDir())
+	require.NoError(t, err)
+	testBackendContract(t, backend)
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"oci-storage/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// ErrUnknownKey is returned when a data key was wrapped by a key no longer configured
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyWrapper encrypts the data keys of stored objects (envelope encryption)
+type KeyWrapper interface {
+	// ActiveKeyID identifies the key wrapping new data keys
+	ActiveKeyID() string
+	// WrapKey encrypts a data key with the active key
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey decrypts a data key wrapped by the given key
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// FileKeyring wraps data keys with AES-256-GCM keys read from a file. Keys are listed
+// one per line as "<id> <base64 key>"; the first one wraps new data keys, the others
+// are kept to read objects written before a rotation.
+type FileKeyring struct {
+	activeID string
+	keys     map[string]cipher.AEAD
+}
+
+// NewFileKeyring loads the keys of a key file
+func NewFileKeyring(path string) (*FileKeyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	k := &FileKeyring{keys: make(map[string]cipher.AEAD)}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<id> <base64 key>\"", path, line)
+		}
+		id := fields[0]
+		if len(id) > 64 {
+			return nil, fmt.Errorf("%s:%d: key id longer than 64 characters", path, line)
+		}
+		if _, ok := k.keys[id]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate key id %q", path, line, id)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("%s:%d: key must be 32 bytes, base64 encoded", path, line)
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+		if k.activeID == "" {
+			k.activeID = id
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if k.activeID == "" {
+		return nil, fmt.Errorf("%s: no key found", path)
+	}
+	return k, nil
+}
+
+func (k *FileKeyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// WrapKey seals the data key under the active key, the key id authenticated with it
+func (k *FileKeyring) WrapKey(dataKey []byte) (string, []byte, error) {
+	aead := k.keys[k.activeID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return k.activeID, aead.Seal(nonce, nonce, dataKey, []byte(k.activeID)), nil
+}
+
+func (k *FileKeyring) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped data key too short")
+	}
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, []byte(keyID))
+}
+
+// KMSKeyWrapper wraps data keys with a key of AWS KMS, or of a compatible service such
+// as local-kms. Data keys wrapped by a previous key stay readable as long as KMS can use it.
+type KMSKeyWrapper struct {
+	client *kms.KMS
+	keyARN string
+}
+
+// NewKMSKeyWrapper connects to KMS and resolves the configured key to its ARN
+func NewKMSKeyWrapper(cfg config.KMSConfig) (*KMSKeyWrapper, error) {
+	awsCfg := &aws.Config{}
+	if cfg.Endpoint != "" {
+		awsCfg.Endpoint = aws.String(cfg.Endpoint)
+	}
+	if cfg.Region != "" {
+		awsCfg.Region = aws.String(cfg.Region)
+	}
+	if cfg.AccessKey != "" {
+		awsCfg.Credentials = credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, "")
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KMS session: %w", err)
+	}
+
+	client := kms.New(sess)
+	out, err := client.DescribeKey(&kms.DescribeKeyInput{KeyId: aws.String(cfg.KeyID)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe KMS key %s: %w", cfg.KeyID, err)
+	}
+	return &KMSKeyWrapper{client: client, keyARN: aws.StringValue(out.KeyMetadata.Arn)}, nil
+}
+
+func (k *KMSKeyWrapper) ActiveKeyID() string {
+	return k.keyARN
+}
+
+func (k *KMSKeyWrapper) WrapKey(dataKey []byte) (string, []byte, error) {
+	out, err := k.client.Encrypt(&kms.EncryptInput{KeyId: aws.String(k.keyARN), Plaintext: dataKey})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return aws.StringValue(out.KeyId), out.CiphertextBlob, nil
+}
+
+func (k *KMSKeyWrapper) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	out, err := k.client.Decrypt(&kms.DecryptInput{KeyId: aws.String(keyID), CiphertextBlob: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return out.Plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -1,12 +1,17 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
 
+// listBatchSize is the number of directory entries read at a time by ListIter
+const listBatchSize = 256
+
 // LocalBackend implements Backend using the local filesystem.
 // This is the default storage backend when S3 is not enabled.
 type LocalBackend struct {
@@ -129,6 +134,73 @@ func (b *LocalBackend) List(dir string) ([]FileInfo, error) {
 	return result, nil
 }
 
+func (b *LocalBackend) ListIter(dir string, fn func(FileInfo) error) error {
+	d, err := os.Open(b.resolve(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer d.Close()
+
+	for {
+		entries, err := d.ReadDir(listBatchSize)
+		for _, e := range entries {
+			info, infoErr := e.Info()
+			if infoErr != nil {
+				continue
+			}
+			fnErr := fn(FileInfo{
+				Name:  e.Name(),
+				Size:  info.Size(),
+				IsDir: e.IsDir(),
+			})
+			if errors.Is(fnErr, fs.SkipAll) {
+				return nil
+			}
+			if fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (b *LocalBackend) Walk(dir string, fn func(path string, info FileInfo) error) error {
+	root := b.resolve(dir)
+	err := filepath.WalkDir(root, func(fullPath string, e fs.DirEntry, err error) error {
+		if err != nil {
+			// A missing root is an empty tree; entries removed during the walk are skipped
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if e.IsDir() {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(b.basePath, fullPath)
+		if err != nil {
+			return err
+		}
+		return fn(rel, FileInfo{Name: e.Name(), Size: info.Size()})
+	})
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
 func (b *LocalBackend) ReadStream(path string) (io.ReadCloser, error) {
 	return os.Open(b.resolve(path))
 }
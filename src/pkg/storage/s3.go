@@ -3,8 +3,10 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -18,11 +20,25 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
+const (
+	// s3MinPartSize is the smallest part S3 accepts for all but the last part
+	s3MinPartSize = 5 * 1024 * 1024
+	// s3DefaultPartSize is used when s3.partSizeMB is not set
+	s3DefaultPartSize = 16 * 1024 * 1024
+	// s3MaxCopySize is the largest object CopyObject can copy; larger ones use a multipart copy
+	s3MaxCopySize = 5 * 1024 * 1024 * 1024
+	// s3CopyPartSize is the range size of each UploadPartCopy in a multipart copy
+	s3CopyPartSize = 1024 * 1024 * 1024
+)
+
 // S3Backend implements Backend using S3-compatible object storage.
 // Compatible with AWS S3, Garage, and MinIO.
 type S3Backend struct {
 	client *s3.S3
-	bucket string
+	// presignClient signs download URLs against the public endpoint
+	presignClient *s3.S3
+	bucket        string
+	partSize      int64
 	// localTempDir is used for CreateTemp (chunked uploads need local staging)
 	localTempDir string
 }
@@ -40,6 +56,19 @@ func NewS3Backend(cfg config.S3Config, localTempDir string) (*S3Backend, error)
 	}
 
 	client := s3.New(sess)
+	presignClient := client
+	if cfg.PublicEndpoint != "" {
+		publicSess, err := session.NewSession(&aws.Config{
+			Endpoint:         aws.String(cfg.PublicEndpoint),
+			Region:           aws.String(cfg.Region),
+			Credentials:      credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, ""),
+			S3ForcePathStyle: aws.Bool(cfg.PathStyle),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create S3 public endpoint session: %w", err)
+		}
+		presignClient = s3.New(publicSess)
+	}
 
 	// Verify bucket exists (or create it)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -63,18 +92,39 @@ func NewS3Backend(cfg config.S3Config, localTempDir string) (*S3Backend, error)
 		return nil, fmt.Errorf("failed to create temp dir: %w", err)
 	}
 
+	partSize := int64(cfg.PartSizeMB) * 1024 * 1024
+	if partSize == 0 {
+		partSize = s3DefaultPartSize
+	}
+	if partSize < s3MinPartSize {
+		partSize = s3MinPartSize
+	}
+
 	return &S3Backend{
-		client:       client,
-		bucket:       cfg.Bucket,
-		localTempDir: localTempDir,
+		client:        client,
+		presignClient: presignClient,
+		bucket:        cfg.Bucket,
+		partSize:      partSize,
+		localTempDir:  localTempDir,
 	}, nil
 }
 
+// PresignGet returns a presigned GET URL for an object, signed for the public endpoint
+func (b *S3Backend) PresignGet(path string, ttl time.Duration) (string, error) {
+	req, _ := b.presignClient.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(path)),
+	})
+	return req.Presign(ttl)
+}
+
 func (b *S3Backend) key(path string) string {
-	// Normalize path separators and remove leading slash
-	k := strings.ReplaceAll(path, string(filepath.Separator), "/")
-	k = strings.TrimPrefix(k, "/")
-	return k
+	return objectKey(path)
+}
+
+// prefix returns the key prefix of a "directory", with a trailing slash
+func (b *S3Backend) prefix(dir string) string {
+	return objectPrefix(dir)
 }
 
 func (b *S3Backend) Read(path string) ([]byte, error) {
@@ -167,43 +217,85 @@ func (b *S3Backend) Delete(path string) error {
 }
 
 func (b *S3Backend) List(dir string) ([]FileInfo, error) {
-	prefix := b.key(dir)
-	if prefix != "" && !strings.HasSuffix(prefix, "/") {
-		prefix += "/"
+	var result []FileInfo
+	err := b.ListIter(dir, func(info FileInfo) error {
+		result = append(result, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return result, nil
+}
+
+// ListIter pages through ListObjectsV2 (1000 keys per page) with a "/" delimiter
+func (b *S3Backend) ListIter(dir string, fn func(FileInfo) error) error {
+	prefix := b.prefix(dir)
 
-	out, err := b.client.ListObjectsV2(&s3.ListObjectsV2Input{
+	var fnErr error
+	err := b.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
 		Bucket:    aws.String(b.bucket),
 		Prefix:    aws.String(prefix),
 		Delimiter: aws.String("/"),
+	}, func(out *s3.ListObjectsV2Output, lastPage bool) bool {
+		// Common prefixes = "directories"
+		for _, p := range out.CommonPrefixes {
+			name := trimDirName(aws.StringValue(p.Prefix), prefix)
+			if name == "" {
+				continue
+			}
+			if fnErr = fn(FileInfo{Name: name, IsDir: true}); fnErr != nil {
+				return false
+			}
+		}
+
+		// Objects = "files"
+		for _, obj := range out.Contents {
+			name := strings.TrimPrefix(aws.StringValue(obj.Key), prefix)
+			if name == "" || name == "/" {
+				continue
+			}
+			if fnErr = fn(FileInfo{Name: name, Size: aws.Int64Value(obj.Size)}); fnErr != nil {
+				return false
+			}
+		}
+		return true
 	})
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	var result []FileInfo
-
-	// Common prefixes = "directories"
-	for _, p := range out.CommonPrefixes {
-		name := strings.TrimPrefix(aws.StringValue(p.Prefix), prefix)
-		name = strings.TrimSuffix(name, "/")
-		if name != "" {
-			result = append(result, FileInfo{Name: name, IsDir: true})
-		}
+	if errors.Is(fnErr, fs.SkipAll) {
+		return nil
 	}
+	return fnErr
+}
 
-	// Objects = "files"
-	for _, obj := range out.Contents {
-		name := strings.TrimPrefix(aws.StringValue(obj.Key), prefix)
-		if name != "" && name != "/" {
-			result = append(result, FileInfo{
-				Name: name,
-				Size: aws.Int64Value(obj.Size),
-			})
+// Walk pages through every key under dir without a delimiter, so nested
+// "directories" cost no extra requests
+func (b *S3Backend) Walk(dir string, fn func(path string, info FileInfo) error) error {
+	var fnErr error
+	err := b.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(b.prefix(dir)),
+	}, func(out *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range out.Contents {
+			key := aws.StringValue(obj.Key)
+			if isDirMarker(key) {
+				continue
+			}
+			if fnErr = fn(filepath.FromSlash(key), FileInfo{Name: baseName(key), Size: aws.Int64Value(obj.Size)}); fnErr != nil {
+				return false
+			}
 		}
+		return true
+	})
+	if err != nil {
+		return err
 	}
-
-	return result, nil
+	if errors.Is(fnErr, fs.SkipAll) {
+		return nil
+	}
+	return fnErr
 }
 
 func (b *S3Backend) ReadStream(path string) (io.ReadCloser, error) {
@@ -219,14 +311,25 @@ func (b *S3Backend) ReadStream(path string) (io.ReadCloser, error) {
 
 func (b *S3Backend) Rename(src, dst string) error {
 	// S3 has no rename - copy then delete
-	_, err := b.client.CopyObject(&s3.CopyObjectInput{
-		Bucket:     aws.String(b.bucket),
-		CopySource: aws.String(b.bucket + "/" + b.key(src)),
-		Key:        aws.String(b.key(dst)),
+	head, err := b.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(src)),
 	})
 	if err != nil {
 		return fmt.Errorf("S3 copy failed: %w", err)
 	}
+	if size := aws.Int64Value(head.ContentLength); size > s3MaxCopySize {
+		err = b.multipartCopy(src, dst, size)
+	} else {
+		_, err = b.client.CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String(b.bucket),
+			CopySource: aws.String(b.bucket + "/" + b.key(src)),
+			Key:        aws.String(b.key(dst)),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("S3 copy failed: %w", err)
+	}
 
 	_, err = b.client.DeleteObject(&s3.DeleteObjectInput{
 		Bucket: aws.String(b.bucket),
@@ -235,6 +338,103 @@ func (b *S3Backend) Rename(src, dst string) error {
 	return err
 }
 
+// multipartCopy copies an object larger than CopyObject allows, range by range
+func (b *S3Backend) multipartCopy(src, dst string, size int64) error {
+	uploadID, err := b.CreateMultipart(dst)
+	if err != nil {
+		return err
+	}
+	var parts []CompletedPart
+	for start := int64(0); start < size; start += s3CopyPartSize {
+		end := start + s3CopyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		out, err := b.client.UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket:          aws.String(b.bucket),
+			Key:             aws.String(b.key(dst)),
+			UploadId:        aws.String(uploadID),
+			PartNumber:      aws.Int64(int64(len(parts) + 1)),
+			CopySource:      aws.String(b.bucket + "/" + b.key(src)),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+		})
+		if err != nil {
+			b.AbortMultipart(dst, uploadID)
+			return err
+		}
+		parts = append(parts, CompletedPart{Number: len(parts) + 1, ETag: aws.StringValue(out.CopyPartResult.ETag)})
+	}
+	if err := b.CompleteMultipart(dst, uploadID, parts); err != nil {
+		b.AbortMultipart(dst, uploadID)
+		return err
+	}
+	return nil
+}
+
+// PartSize returns the size of the parts chunked uploads are split into
+func (b *S3Backend) PartSize() int64 {
+	return b.partSize
+}
+
+func (b *S3Backend) CreateMultipart(path string) (string, error) {
+	out, err := b.client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key(path)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	return aws.StringValue(out.UploadId), nil
+}
+
+func (b *S3Backend) UploadPart(path, uploadID string, number int, data []byte) (string, error) {
+	out, err := b.client.UploadPart(&s3.UploadPartInput{
+		Bucket:        aws.String(b.bucket),
+		Key:           aws.String(b.key(path)),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int64(int64(number)),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload part %d: %w", number, err)
+	}
+	return aws.StringValue(out.ETag), nil
+}
+
+func (b *S3Backend) CompleteMultipart(path, uploadID string, parts []CompletedPart) error {
+	completed := make([]*s3.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, &s3.CompletedPart{
+			PartNumber: aws.Int64(int64(part.Number)),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+	_, err := b.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.bucket),
+		Key:             aws.String(b.key(path)),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (b *S3Backend) AbortMultipart(path, uploadID string) error {
+	_, err := b.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(b.bucket),
+		Key:      aws.String(b.key(path)),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil && strings.Contains(err.Error(), s3.ErrCodeNoSuchUpload) {
+		// Already completed or aborted
+		return nil
+	}
+	return err
+}
+
 type s3TempFile struct {
 	file    *os.File
 	backend *S3Backend
@@ -279,10 +479,7 @@ func (b *S3Backend) Import(localPath, storagePath string) error {
 }
 
 func (b *S3Backend) RemoveAll(path string) error {
-	prefix := b.key(path)
-	if prefix != "" && !strings.HasSuffix(prefix, "/") {
-		prefix += "/"
-	}
+	prefix := b.prefix(path)
 
 	// List all objects under prefix and delete them
 	listInput := &s3.ListObjectsV2Input{
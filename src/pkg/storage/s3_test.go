@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"encoding/xml"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 serves ListObjectsV2 for a fixed set of keys, pageSize entries per page
+type fakeS3 struct {
+	keys     map[string]int64
+	pageSize int
+
+	mu    sync.Mutex
+	pages int
+}
+
+type fakeS3Listing struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	IsTruncated           bool
+	NextContinuationToken string `xml:",omitempty"`
+	Contents              []struct {
+		Key  string
+		Size int64
+	}
+	CommonPrefixes []struct{ Prefix string }
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	f.mu.Lock()
+	f.pages++
+	f.mu.Unlock()
+
+	// Entries in key order, a common prefix standing for every key under it
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	var keys []string
+	for key := range f.keys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	type entry struct {
+		key   string
+		isDir bool
+	}
+	var entries []entry
+	for _, key := range keys {
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				dir := key[:len(prefix)+i+1]
+				if len(entries) == 0 || entries[len(entries)-1].key != dir {
+					entries = append(entries, entry{dir, true})
+				}
+				continue
+			}
+		}
+		entries = append(entries, entry{key, false})
+	}
+
+	start, _ := strconv.Atoi(query.Get("continuation-token"))
+	end := min(start+f.pageSize, len(entries))
+	var out fakeS3Listing
+	for _, e := range entries[start:end] {
+		if e.isDir {
+			out.CommonPrefixes = append(out.CommonPrefixes, struct{ Prefix string }{e.key})
+		} else {
+			out.Contents = append(out.Contents, struct {
+				Key  string
+				Size int64
+			}{e.key, f.keys[e.key]})
+		}
+	}
+	if end < len(entries) {
+		out.IsTruncated = true
+		out.NextContinuationToken = strconv.Itoa(end)
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(out)
+}
+
+// Pages returns the number of pages served since the last call
+func (f *fakeS3) Pages() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pages := f.pages
+	f.pages = 0
+	return pages
+}
+
+func newFakeS3Backend(t *testing.T, keys map[string]int64) (*S3Backend, *fakeS3) {
+	fake := &fakeS3{keys: keys, pageSize: 2}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	assert.NoError(t, err)
+	return &S3Backend{client: s3.New(sess), bucket: "bucket"}, fake
+}
+
+func TestS3Backend_ListIterPages(t *testing.T) {
+	backend, fake := newFakeS3Backend(t, map[string]int64{
+		"images/a.json":            1,
+		"images/app/manifests/v1":  2,
+		"images/app/manifests/v2":  3,
+		"images/b.json":            4,
+		"images/base/tags/latest":  5,
+		"images/c.json":            6,
+		"images/":                  0,
+		"imagesextra/not-included": 7,
+	})
+
+	// Directories come from common prefixes, split over several pages
+	entries, err := backend.List("images")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []FileInfo{
+		{Name: "a.json", Size: 1},
+		{Name: "app", IsDir: true},
+		{Name: "b.json", Size: 4},
+		{Name: "base", IsDir: true},
+		{Name: "c.json", Size: 6},
+	}, entries)
+	assert.Equal(t, 3, fake.Pages())
+
+	// Stopping early fetches no further page. fs.SkipDir is not part of the contract:
+	// like any error, it stops the listing and is returned.
+	for _, stop := range []error{fs.SkipAll, fs.SkipDir} {
+		var seen int
+		err := backend.ListIter("images", func(FileInfo) error {
+			seen++
+			if seen == 3 {
+				return stop
+			}
+			return nil
+		})
+		if stop == fs.SkipAll {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, fs.SkipDir)
+		}
+		assert.Equal(t, 3, seen)
+		assert.Equal(t, 2, fake.Pages())
+	}
+}
+
+func TestS3Backend_WalkPages(t *testing.T) {
+	keys := map[string]int64{
+		"blobs/sha256/aa/aa/aaaa":  1,
+		"blobs/sha256/aa/bb/aabb":  2,
+		"blobs/sha256/bb/":         0,
+		"blobs/sha256/bb/cc/bbcc":  3,
+		"blobs/sha256/cc/dd/ccdd":  4,
+		"blobs/sha512/dd/ee/ddee":  5,
+		"manifests/app/v1.json":    6,
+		"blobsextra/not-included":  7,
+		"blobs/sha256/ee/ff/eeff0": 8,
+	}
+	backend, fake := newFakeS3Backend(t, keys)
+
+	// Every key below the prefix, nested "directories" included, directory markers left out
+	walked := make(map[string]FileInfo)
+	err := backend.Walk("blobs", func(path string, info FileInfo) error {
+		walked[filepath.ToSlash(path)] = info
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]FileInfo{
+		"blobs/sha256/aa/aa/aaaa":  {Name: "aaaa", Size: 1},
+		"blobs/sha256/aa/bb/aabb":  {Name: "aabb", Size: 2},
+		"blobs/sha256/bb/cc/bbcc":  {Name: "bbcc", Size: 3},
+		"blobs/sha256/cc/dd/ccdd":  {Name: "ccdd", Size: 4},
+		"blobs/sha256/ee/ff/eeff0": {Name: "eeff0", Size: 8},
+		"blobs/sha512/dd/ee/ddee":  {Name: "ddee", Size: 5},
+	}, walked)
+	assert.Equal(t, 4, fake.Pages())
+
+	// Stopping early fetches no further page. fs.SkipDir is not part of the contract:
+	// like any error, it stops the listing and is returned.
+	for _, stop := range []error{fs.SkipAll, fs.SkipDir} {
+		var seen int
+		err := backend.Walk("blobs", func(string, FileInfo) error {
+			seen++
+			if seen == 2 {
+				return stop
+			}
+			return nil
+		})
+		if stop == fs.SkipAll {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, fs.SkipDir)
+		}
+		assert.Equal(t, 2, seen)
+		assert.Equal(t, 1, fake.Pages())
+	}
+}
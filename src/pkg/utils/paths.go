@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"syscall"
 )
@@ -34,11 +35,67 @@ func (pm *PathManager) GetTempPath(uuid string) string {
 	return filepath.Join(pm.baseStoragePath, "temp", uuid)
 }
 
-// GetBlobPath returns a relative storage path for a blob.
+// GetBlobPath returns a relative storage path for a blob, sharded by digest to keep
+// directories and object store prefixes small: blobs/<algorithm>/<ab>/<cd>/<hex>.
+// Bare hex digests are sha256.
 func (pm *PathManager) GetBlobPath(digest string) string {
+	algorithm, hex := splitBlobDigest(digest)
+	if !isBlobDigest(algorithm, hex) {
+		// Not a digest: keep the flat path rather than building a misleading one
+		return pm.GetLegacyBlobPath(digest)
+	}
+	return filepath.Join("blobs", algorithm, hex[0:2], hex[2:4], hex)
+}
+
+// GetLegacyBlobPath returns the flat storage path blobs were written to before sharding.
+func (pm *PathManager) GetLegacyBlobPath(digest string) string {
 	return filepath.Join("blobs", digest)
 }
 
+// BlobDigestFromPath returns the digest of the blob stored at a relative path in either
+// layout, or "" when the path is not a blob (e.g. a temp file or a non-digest name).
+func (pm *PathManager) BlobDigestFromPath(path string) string {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(parts) < 2 || parts[0] != "blobs" {
+		return ""
+	}
+	var algorithm, hex string
+	switch len(parts) {
+	case 2:
+		// Legacy flat layout: blobs/sha256:<hex> or blobs/<hex>
+		algorithm, hex = splitBlobDigest(parts[1])
+	case 5:
+		algorithm, hex = parts[1], parts[4]
+		if !strings.HasPrefix(hex, parts[2]+parts[3]) {
+			return ""
+		}
+	default:
+		return ""
+	}
+	if !isBlobDigest(algorithm, hex) {
+		return ""
+	}
+	return algorithm + ":" + hex
+}
+
+var (
+	blobAlgorithmPattern = regexp.MustCompile(`^[a-z0-9]+$`)
+	blobHexPattern       = regexp.MustCompile(`^[a-f0-9]+$`)
+)
+
+// isBlobDigest reports whether algorithm and hex form a digest blobs can be sharded by
+func isBlobDigest(algorithm, hex string) bool {
+	return len(hex) >= 4 && blobHexPattern.MatchString(hex) && blobAlgorithmPattern.MatchString(algorithm)
+}
+
+// splitBlobDigest splits "algorithm:hex", defaulting to sha256 for bare hex
+func splitBlobDigest(digest string) (string, string) {
+	if algorithm, hex, ok := strings.Cut(digest, ":"); ok {
+		return algorithm, hex
+	}
+	return "sha256", digest
+}
+
 // GetManifestPath returns a relative storage path for a manifest.
 func (pm *PathManager) GetManifestPath(name, reference string) string {
 	return filepath.Join("manifests", name, reference+".json")
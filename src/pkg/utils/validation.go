@@ -2,10 +2,13 @@ package utils
 
 import (
 	"crypto/sha256"
+	"crypto/sha512"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"regexp"
+	"strings"
 )
 
 // OCI specification compliant validation patterns
@@ -32,7 +35,7 @@ func ValidateDigest(digest string) error {
 		return fmt.Errorf("digest cannot be empty")
 	}
 	if !digestPattern.MatchString(digest) {
-		return fmt.Errorf("invalid digest format: must be sha256:<64 hex chars>")
+		return fmt.Errorf("invalid digest format: must be sha256:<64 hex chars> or sha512:<128 hex chars>")
 	}
 	return nil
 }
@@ -93,21 +96,42 @@ func ValidateUUID(uuid string) error {
 	return nil
 }
 
-// ComputeFileDigest computes the sha256 digest of a file by streaming it
-// without loading the entire file into memory.
-func ComputeFileDigest(path string) (string, error) {
+// ComputeFileDigest computes the digest of a file with the algorithm of the expected
+// digest, streaming it without loading the entire file into memory.
+func ComputeFileDigest(path, expected string) (string, error) {
+	h := NewDigestHash(expected)
+	if h == nil {
+		return "", fmt.Errorf("unsupported digest algorithm: %s", expected)
+	}
 	f, err := os.Open(path)
 	if err != nil {
 		return "", fmt.Errorf("failed to open file for digest: %w", err)
 	}
 	defer f.Close()
 
-	h := sha256.New()
 	if _, err := io.Copy(h, f); err != nil {
 		return "", fmt.Errorf("failed to compute digest: %w", err)
 	}
 
-	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+	return DigestOf(expected, h), nil
+}
+
+// NewDigestHash returns the hash of a digest's algorithm, or nil when unsupported
+func NewDigestHash(digest string) hash.Hash {
+	algorithm, _, _ := strings.Cut(digest, ":")
+	switch algorithm {
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// DigestOf formats the sum of h as a digest of the same algorithm
+func DigestOf(digest string, h hash.Hash) string {
+	algorithm, _, _ := strings.Cut(digest, ":")
+	return fmt.Sprintf("%s:%x", algorithm, h.Sum(nil))
 }
 
 // ValidateManifestContent performs minimal structural validation of an OCI manifest.